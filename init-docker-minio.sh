@@ -0,0 +1,14 @@
+#!/bin/bash
+
+CONTAINER_NAME="sds-minio"
+
+echo "Stopping containers if they were already up..."
+docker stop ${CONTAINER_NAME} || true && docker rm ${CONTAINER_NAME} || true
+
+echo "Running Docker image..."
+docker run --name ${CONTAINER_NAME} \
+         -e MINIO_ACCESS_KEY=minio \
+         -e MINIO_SECRET_KEY=minio123 \
+         -d -p 9000:9000 \
+         minio/minio server /data
+echo "Done"
@@ -0,0 +1,7 @@
+/* Claves de datos de cada usuario, cifradas con la clave maestra */
+CREATE TABLE user_keys (
+  created_at  TIMESTAMP DEFAULT NOW() NOT NULL,
+  "user"      VARCHAR(40)             NOT NULL CONSTRAINT user_keys_pk PRIMARY KEY,
+  wrapped_key BYTEA                   NOT NULL,
+  CONSTRAINT user_keys_users_email_fk FOREIGN KEY ("user") REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE
+);
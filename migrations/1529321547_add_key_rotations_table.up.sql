@@ -0,0 +1,18 @@
+/* Progreso de las rotaciones de la clave maestra, para poder reanudarlas si se interrumpen */
+CREATE TABLE key_rotations (
+  id                  BIGSERIAL PRIMARY KEY,
+  created_at          TIMESTAMP   DEFAULT NOW()       NOT NULL,
+  updated_at          TIMESTAMP   DEFAULT NOW()       NOT NULL,
+  finished_at         TIMESTAMP,
+  old_key_fingerprint CHAR(64)                        NOT NULL,
+  new_key_fingerprint CHAR(64)                        NOT NULL,
+  phase               VARCHAR(20) DEFAULT 'user_keys' NOT NULL,
+  "cursor"            VARCHAR     DEFAULT ''          NOT NULL,
+  processed           BIGINT      DEFAULT 0           NOT NULL
+);
+
+CREATE TRIGGER set_key_rotations_timestamp
+  BEFORE UPDATE
+  ON key_rotations
+  FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
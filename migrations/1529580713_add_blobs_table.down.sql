@@ -0,0 +1,3 @@
+ALTER TABLE files
+  DROP COLUMN blob_id;
+DROP TABLE IF EXISTS blobs;
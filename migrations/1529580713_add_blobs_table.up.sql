@@ -0,0 +1,15 @@
+/* Contenidos de los ficheros, deduplicados por usuario. Los ficheros anteriores conservan su propio blob (blob_id nulo) */
+CREATE TABLE blobs (
+  id         BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  owner      VARCHAR(40)             NOT NULL,
+  hash       CHAR(64)                NOT NULL,
+  size       BIGINT                  NOT NULL,
+  ref_count  BIGINT DEFAULT 1        NOT NULL,
+  stored     BOOLEAN DEFAULT FALSE   NOT NULL,
+  CONSTRAINT blobs_users_email_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT blobs_owner_hash_unique UNIQUE (owner, hash)
+);
+
+ALTER TABLE files
+  ADD blob_id BIGINT NULL CONSTRAINT files_blobs_id_fk REFERENCES blobs (id) ON DELETE SET NULL;
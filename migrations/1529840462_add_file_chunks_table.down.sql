@@ -0,0 +1,3 @@
+ALTER TABLE files
+  DROP COLUMN chunked;
+DROP TABLE IF EXISTS file_chunks;
@@ -0,0 +1,12 @@
+/* Las versiones troceadas guardan la lista ordenada de sus trozos, que son blobs deduplicados por usuario */
+CREATE TABLE file_chunks (
+  file_id  BIGINT  NOT NULL,
+  position INTEGER NOT NULL,
+  blob_id  BIGINT  NOT NULL,
+  CONSTRAINT file_chunks_pk PRIMARY KEY (file_id, position),
+  CONSTRAINT file_chunks_files_id_fk FOREIGN KEY (file_id) REFERENCES files (id) ON DELETE CASCADE,
+  CONSTRAINT file_chunks_blobs_id_fk FOREIGN KEY (blob_id) REFERENCES blobs (id) ON DELETE CASCADE
+);
+
+ALTER TABLE files
+  ADD chunked BOOLEAN DEFAULT FALSE NOT NULL;
@@ -0,0 +1,27 @@
+/* Subidas reanudables: cada PATCH se guarda como una parte cifrada hasta que se finaliza la subida */
+CREATE TABLE uploads (
+  id              CHAR(32) PRIMARY KEY,
+  created_at      TIMESTAMP DEFAULT NOW()         NOT NULL,
+  updated_at      TIMESTAMP DEFAULT NOW()         NOT NULL,
+  expires_at      TIMESTAMP                       NOT NULL,
+  owner           VARCHAR(40)                     NOT NULL,
+  name            VARCHAR                         NOT NULL CONSTRAINT upload_name_not_empty CHECK (length(name) > 0),
+  permissions_str CHAR(9) DEFAULT 'rw-r--r--'     NOT NULL,
+  size            BIGINT                          NOT NULL CONSTRAINT upload_size_not_negative CHECK (size >= 0),
+  received        BIGINT DEFAULT 0                NOT NULL,
+  CONSTRAINT uploads_users_email_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE upload_parts (
+  upload_id CHAR(32) NOT NULL,
+  position  BIGINT   NOT NULL,
+  size      BIGINT   NOT NULL,
+  CONSTRAINT upload_parts_pk PRIMARY KEY (upload_id, position),
+  CONSTRAINT upload_parts_uploads_id_fk FOREIGN KEY (upload_id) REFERENCES uploads (id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_uploads_timestamp
+  BEFORE UPDATE
+  ON uploads
+  FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
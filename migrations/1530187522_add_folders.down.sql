@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS folders;
+DROP INDEX IF EXISTS files_owner_folder_index;
+ALTER TABLE files
+  DROP COLUMN folder;
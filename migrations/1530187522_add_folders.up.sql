@@ -0,0 +1,20 @@
+/* Los ficheros se identifican por su ruta completa, y guardan la carpeta en la que están para poder listarlas */
+ALTER TABLE files
+  ADD folder VARCHAR DEFAULT '' NOT NULL;
+
+CREATE INDEX files_owner_folder_index
+  ON files (owner, folder);
+
+/* Las carpetas se guardan aparte para que puedan existir aunque estén vacías. La raíz ('') no se guarda */
+CREATE TABLE folders (
+  id         BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  owner      VARCHAR(40)             NOT NULL,
+  path       VARCHAR                 NOT NULL CONSTRAINT folder_path_not_empty CHECK (length(path) > 0),
+  parent     VARCHAR DEFAULT ''      NOT NULL,
+  CONSTRAINT folders_owner_path_unique UNIQUE (owner, path),
+  CONSTRAINT folders_users_email_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX folders_owner_parent_index
+  ON folders (owner, parent);
@@ -0,0 +1,18 @@
+DROP TRIGGER set_files_logical_id
+ON files;
+DROP FUNCTION IF EXISTS trigger_set_files_logical_id();
+
+DROP TRIGGER set_files_timestamp
+ON files;
+
+CREATE TRIGGER set_files_timestamp
+  BEFORE UPDATE
+  ON files
+  FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+DROP FUNCTION IF EXISTS trigger_set_files_timestamp();
+
+ALTER TABLE files
+  DROP COLUMN logical_id;
+DROP TABLE IF EXISTS logical_files;
@@ -0,0 +1,89 @@
+/* Las versiones de un fichero pertenecen a un fichero lógico, que mantiene su identidad aunque se renombre o se mueva */
+CREATE TABLE logical_files (
+  id         BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  owner      VARCHAR(40)             NOT NULL,
+  CONSTRAINT logical_files_users_email_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+ALTER TABLE files
+  ADD logical_id BIGINT;
+
+/* Las versiones que ya existen se agrupan por nombre, y el fichero lógico toma el id de la primera.
+   El trigger se desactiva para no cambiar la fecha de las versiones */
+ALTER TABLE files
+  DISABLE TRIGGER set_files_timestamp;
+
+UPDATE files f
+SET logical_id = g.first_id
+FROM (SELECT owner, name, MIN(id) AS first_id
+      FROM files
+      GROUP BY owner, name) g
+WHERE f.owner = g.owner AND f.name = g.name;
+
+ALTER TABLE files
+  ENABLE TRIGGER set_files_timestamp;
+
+INSERT INTO logical_files (id, created_at, owner)
+  SELECT id, created_at, owner
+  FROM files
+  WHERE id = logical_id;
+
+SELECT setval('logical_files_id_seq', COALESCE((SELECT MAX(id) FROM logical_files), 0) + 1, FALSE);
+
+ALTER TABLE files
+  ALTER COLUMN logical_id SET NOT NULL,
+  ADD CONSTRAINT files_logical_files_id_fk FOREIGN KEY (logical_id) REFERENCES logical_files (id) ON DELETE CASCADE;
+
+CREATE INDEX files_logical_id_index
+  ON files (logical_id);
+
+/* Las versiones nuevas se añaden al fichero lógico con la misma ruta, o a uno nuevo si no lo hay */
+CREATE OR REPLACE FUNCTION trigger_set_files_logical_id()
+  RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.logical_id IS NULL
+  THEN
+    SELECT logical_id INTO NEW.logical_id
+    FROM files
+    WHERE owner = NEW.owner AND name = NEW.name AND deleted_at IS NULL
+    ORDER BY id DESC
+    LIMIT 1;
+  END IF;
+  IF NEW.logical_id IS NULL
+  THEN
+    INSERT INTO logical_files (owner) VALUES (NEW.owner)
+    RETURNING id INTO NEW.logical_id;
+  END IF;
+  RETURN NEW;
+END;
+$$
+LANGUAGE plpgsql;
+
+CREATE TRIGGER set_files_logical_id
+  BEFORE INSERT
+  ON files
+  FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_files_logical_id();
+
+/* Renombrar o mover un fichero no cambia la fecha de sus versiones */
+CREATE OR REPLACE FUNCTION trigger_set_files_timestamp()
+  RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.name IS NOT DISTINCT FROM OLD.name AND NEW.folder IS NOT DISTINCT FROM OLD.folder
+  THEN
+    NEW.updated_at = NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$
+LANGUAGE plpgsql;
+
+DROP TRIGGER set_files_timestamp
+ON files;
+
+CREATE TRIGGER set_files_timestamp
+  BEFORE UPDATE
+  ON files
+  FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_files_timestamp();
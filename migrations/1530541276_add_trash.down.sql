@@ -0,0 +1,15 @@
+CREATE OR REPLACE FUNCTION trigger_set_files_timestamp()
+  RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.name IS NOT DISTINCT FROM OLD.name AND NEW.folder IS NOT DISTINCT FROM OLD.folder
+  THEN
+    NEW.updated_at = NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$
+LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS logical_files_deleted_at_index;
+ALTER TABLE logical_files
+  DROP COLUMN deleted_at;
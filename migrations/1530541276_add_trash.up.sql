@@ -0,0 +1,22 @@
+/* Un fichero borrado queda en la papelera, con todas sus versiones, hasta que se restaura o se purga.
+   Las versiones borradas antes de la papelera ya no tienen su contenido, así que no entran en ella */
+ALTER TABLE logical_files
+  ADD deleted_at TIMESTAMP;
+
+CREATE INDEX logical_files_deleted_at_index
+  ON logical_files (deleted_at)
+  WHERE deleted_at IS NOT NULL;
+
+/* Ni renombrar, ni mover, ni borrar o restaurar un fichero cambian la fecha de sus versiones */
+CREATE OR REPLACE FUNCTION trigger_set_files_timestamp()
+  RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.name IS NOT DISTINCT FROM OLD.name AND NEW.folder IS NOT DISTINCT FROM OLD.folder AND
+     NEW.deleted_at IS NOT DISTINCT FROM OLD.deleted_at
+  THEN
+    NEW.updated_at = NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$
+LANGUAGE plpgsql;
@@ -0,0 +1,10 @@
+/* Política de retención de versiones de cada usuario. Los usuarios sin política usan la global de la configuración */
+CREATE TABLE retention_policies (
+  owner        VARCHAR(40) PRIMARY KEY,
+  updated_at   TIMESTAMP DEFAULT NOW() NOT NULL,
+  keep_last    INTEGER DEFAULT 0       NOT NULL,
+  keep_within  VARCHAR DEFAULT ''      NOT NULL,
+  keep_daily   INTEGER DEFAULT 0       NOT NULL,
+  keep_monthly INTEGER DEFAULT 0       NOT NULL,
+  CONSTRAINT retention_policies_users_email_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE
+);
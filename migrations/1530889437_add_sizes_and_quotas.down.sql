@@ -0,0 +1,5 @@
+ALTER TABLE users
+  DROP COLUMN quota;
+ALTER TABLE files
+  DROP COLUMN size,
+  DROP COLUMN stored_size;
@@ -0,0 +1,30 @@
+/* Tamaño de cada versión: el del contenido en claro y el que ocupa cifrado en el almacenamiento */
+ALTER TABLE files
+  ADD size        BIGINT DEFAULT 0 NOT NULL,
+  ADD stored_size BIGINT DEFAULT 0 NOT NULL;
+
+/* Las versiones que ya existen toman el tamaño de sus blobs. El tamaño almacenado no se puede calcular sin la
+   configuración del cifrado, así que se aproxima con el tamaño en claro.
+   El trigger se desactiva para no cambiar la fecha de las versiones */
+ALTER TABLE files
+  DISABLE TRIGGER set_files_timestamp;
+
+UPDATE files f
+SET size = b.size, stored_size = b.size
+FROM blobs b
+WHERE f.blob_id = b.id AND NOT f.chunked;
+
+UPDATE files f
+SET size = c.size, stored_size = c.size
+FROM (SELECT fc.file_id, SUM(b.size) AS size
+      FROM file_chunks fc
+        JOIN blobs b ON fc.blob_id = b.id
+      GROUP BY fc.file_id) c
+WHERE f.id = c.file_id AND f.chunked;
+
+ALTER TABLE files
+  ENABLE TRIGGER set_files_timestamp;
+
+/* Cuota de cada usuario en bytes. Los usuarios sin cuota usan la de la configuración */
+ALTER TABLE users
+  ADD quota BIGINT;
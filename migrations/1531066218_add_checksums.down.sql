@@ -0,0 +1,4 @@
+ALTER TABLE uploads
+  DROP COLUMN checksum;
+ALTER TABLE files
+  DROP COLUMN checksum;
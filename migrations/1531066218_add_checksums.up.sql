@@ -0,0 +1,7 @@
+/* Suma SHA-256 del contenido en claro de cada versión. Las versiones que ya existen no la tienen */
+ALTER TABLE files
+  ADD checksum CHAR(64);
+
+/* Suma que el cliente espera del contenido de la subida, si la da */
+ALTER TABLE uploads
+  ADD checksum CHAR(64);
@@ -0,0 +1,21 @@
+/* Informes del repaso de los blobs: cada uno recoge los problemas encontrados entre los metadatos y el almacenamiento */
+CREATE TABLE scrub_reports (
+  id               BIGSERIAL PRIMARY KEY,
+  created_at       TIMESTAMP DEFAULT NOW() NOT NULL,
+  finished_at      TIMESTAMP               NOT NULL,
+  checked_versions BIGINT DEFAULT 0        NOT NULL,
+  checked_blobs    BIGINT DEFAULT 0        NOT NULL
+);
+
+/* La versión no referencia a files, porque el informe debe sobrevivir a su borrado */
+CREATE TABLE scrub_issues (
+  report_id BIGINT      NOT NULL,
+  kind      VARCHAR(40) NOT NULL,
+  key       VARCHAR     NOT NULL,
+  file_id   BIGINT,
+  detail    VARCHAR DEFAULT '' NOT NULL,
+  CONSTRAINT scrub_issues_scrub_reports_id_fk FOREIGN KEY (report_id) REFERENCES scrub_reports (id) ON DELETE CASCADE
+);
+
+CREATE INDEX scrub_issues_report_id_index
+  ON scrub_issues (report_id);
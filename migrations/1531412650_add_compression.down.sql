@@ -0,0 +1,5 @@
+ALTER TABLE files
+  DROP COLUMN compression;
+ALTER TABLE blobs
+  DROP COLUMN compression,
+  DROP COLUMN stored_size;
@@ -0,0 +1,14 @@
+/* Códec con el que se comprimió el contenido de cada blob antes de cifrarlo (vacío si no se comprimió) y lo que ocupa
+   en el almacenamiento. Los blobs que ya existen no están comprimidos, y su tamaño almacenado se aproxima con el tamaño
+   en claro, como el de las versiones */
+ALTER TABLE blobs
+  ADD compression VARCHAR(10) DEFAULT '' NOT NULL,
+  ADD stored_size BIGINT DEFAULT 0       NOT NULL;
+
+UPDATE blobs
+SET stored_size = size;
+
+/* Las versiones de un solo blob guardan también su códec, para leerlas sin consultar el blob. Las versiones por trozos
+   se leen con el códec de cada trozo */
+ALTER TABLE files
+  ADD compression VARCHAR(10) DEFAULT '' NOT NULL;
@@ -0,0 +1,17 @@
+/* Ficheros y carpetas que cada usuario comparte con otros, para leerlos o también para subir nuevas versiones. Las
+   rutas de las carpetas acaban en barra, y dan acceso a todo lo que contienen */
+CREATE TABLE shares (
+  id         BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  owner      VARCHAR(40)             NOT NULL,
+  path       VARCHAR                 NOT NULL,
+  grantee    VARCHAR(40)             NOT NULL,
+  access     VARCHAR(10)             NOT NULL,
+  CONSTRAINT shares_owner_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT shares_grantee_fk FOREIGN KEY (grantee) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT shares_access_check CHECK (access IN ('read', 'write')),
+  CONSTRAINT shares_owner_path_grantee_unique UNIQUE (owner, path, grantee)
+);
+
+CREATE INDEX shares_grantee_index
+  ON shares (grantee);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS link_accesses;
+DROP TABLE IF EXISTS links;
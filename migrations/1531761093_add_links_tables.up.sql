@@ -0,0 +1,36 @@
+/* Enlaces públicos para descargar un fichero sin iniciar sesión. Apuntan al fichero lógico, así que siguen al fichero
+   aunque se mueva, y sirven su última versión o la versión indicada. La contraseña se guarda con bcrypt */
+CREATE TABLE links (
+  id            BIGSERIAL PRIMARY KEY,
+  created_at    TIMESTAMP DEFAULT NOW() NOT NULL,
+  token         VARCHAR(64)             NOT NULL,
+  owner         VARCHAR(40)             NOT NULL,
+  logical_id    BIGINT                  NOT NULL,
+  version       BIGINT,
+  expires_at    TIMESTAMP,
+  max_downloads INTEGER,
+  downloads     INTEGER DEFAULT 0       NOT NULL,
+  password      VARCHAR(60),
+  revoked_at    TIMESTAMP,
+  CONSTRAINT links_token_unique UNIQUE (token),
+  CONSTRAINT links_owner_fk FOREIGN KEY (owner) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT links_logical_files_id_fk FOREIGN KEY (logical_id) REFERENCES logical_files (id) ON DELETE CASCADE,
+  CONSTRAINT links_files_id_fk FOREIGN KEY (version) REFERENCES files (id) ON DELETE CASCADE
+);
+
+CREATE INDEX links_owner_index
+  ON links (owner);
+
+/* Cada acceso a un enlace, se haya permitido la descarga o no */
+CREATE TABLE link_accesses (
+  id          BIGSERIAL PRIMARY KEY,
+  link_id     BIGINT                  NOT NULL,
+  accessed_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  ip          VARCHAR(45)             NOT NULL,
+  user_agent  VARCHAR DEFAULT ''      NOT NULL,
+  granted     BOOLEAN                 NOT NULL,
+  CONSTRAINT link_accesses_links_id_fk FOREIGN KEY (link_id) REFERENCES links (id) ON DELETE CASCADE
+);
+
+CREATE INDEX link_accesses_link_id_index
+  ON link_accesses (link_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS group_members;
+/* Las cuentas de los grupos se borran con sus ficheros */
+DELETE FROM users
+WHERE email IN (SELECT name
+                FROM groups);
+DROP TABLE IF EXISTS groups;
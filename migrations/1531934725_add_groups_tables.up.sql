@@ -0,0 +1,24 @@
+/* Grupos de usuarios con un espacio de almacenamiento propio. Cada grupo tiene una cuenta en la tabla de usuarios, con
+   el nombre del grupo y una contraseña imposible, que es la propietaria de sus ficheros. Así, los ficheros del grupo
+   no dependen de la cuenta de ninguno de sus miembros, y usan la misma cuota, papelera y retención que los de un usuario */
+CREATE TABLE groups (
+  name       VARCHAR(40)             NOT NULL CONSTRAINT groups_pk PRIMARY KEY,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  CONSTRAINT groups_users_email_fk FOREIGN KEY (name) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+/* Los miembros acceden a los ficheros del grupo según sus permisos de grupo, y los gestores además pueden añadir y
+   quitar miembros */
+CREATE TABLE group_members (
+  group_name VARCHAR(40)             NOT NULL,
+  member     VARCHAR(40)             NOT NULL,
+  role       VARCHAR(10)             NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  CONSTRAINT group_members_pk PRIMARY KEY (group_name, member),
+  CONSTRAINT group_members_groups_name_fk FOREIGN KEY (group_name) REFERENCES groups (name) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT group_members_users_email_fk FOREIGN KEY (member) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT group_members_role_check CHECK (role IN ('member', 'manager'))
+);
+
+CREATE INDEX group_members_member_index
+  ON group_members (member);
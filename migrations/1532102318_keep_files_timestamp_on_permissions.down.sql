@@ -0,0 +1,12 @@
+CREATE OR REPLACE FUNCTION trigger_set_files_timestamp()
+  RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.name IS NOT DISTINCT FROM OLD.name AND NEW.folder IS NOT DISTINCT FROM OLD.folder AND
+     NEW.deleted_at IS NOT DISTINCT FROM OLD.deleted_at
+  THEN
+    NEW.updated_at = NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$
+LANGUAGE plpgsql;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+  DROP COLUMN role,
+  DROP COLUMN disabled_at,
+  DROP COLUMN tokens_revoked_at;
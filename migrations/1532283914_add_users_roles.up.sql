@@ -0,0 +1,7 @@
+/* Rol de cada usuario: los administradores gestionan a los demás usuarios desde /admin */
+ALTER TABLE users
+  ADD role VARCHAR(10) DEFAULT 'user' NOT NULL CHECK (role IN ('user', 'admin')),
+  /* Los usuarios deshabilitados no pueden iniciar sesión, y sus tokens dejan de valer */
+  ADD disabled_at TIMESTAMP,
+  /* Los tokens emitidos antes de esta fecha dejan de valer, lo que cierra las sesiones del usuario */
+  ADD tokens_revoked_at TIMESTAMP;
@@ -0,0 +1,5 @@
+UPDATE uploads SET permissions_str = 'rw-r--r--' WHERE permissions_str = '';
+
+ALTER TABLE uploads
+  ALTER COLUMN permissions_str TYPE CHAR(9),
+  ALTER COLUMN permissions_str SET DEFAULT 'rw-r--r--';
@@ -0,0 +1,4 @@
+/* Las subidas sin permisos los dejan vacíos, para que la nueva versión conserve los del fichero */
+ALTER TABLE uploads
+  ALTER COLUMN permissions_str TYPE VARCHAR(9),
+  ALTER COLUMN permissions_str DROP DEFAULT;
@@ -0,0 +1,14 @@
+/* Calcular el tamaño de las versiones guardadas antes de los blobs tampoco cambia su fecha, que decide cuál es la última */
+CREATE OR REPLACE FUNCTION trigger_set_files_timestamp()
+  RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.name IS NOT DISTINCT FROM OLD.name AND NEW.folder IS NOT DISTINCT FROM OLD.folder AND
+     NEW.deleted_at IS NOT DISTINCT FROM OLD.deleted_at AND NEW.permissions_str IS NOT DISTINCT FROM OLD.permissions_str AND
+     NEW.size IS NOT DISTINCT FROM OLD.size AND NEW.stored_size IS NOT DISTINCT FROM OLD.stored_size
+  THEN
+    NEW.updated_at = NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$
+LANGUAGE plpgsql;
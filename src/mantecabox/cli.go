@@ -29,7 +29,7 @@ func init() {
 func main() {
 	var args struct {
 		Operation       string   `arg:"positional, required" help:"(signup|login|transfer|help)"`
-		TransferActions []string `arg:"positional" help:"(list|((upload|download|remove) <files>...)"`
+		TransferActions []string `arg:"positional" help:"(list|((upload|download|remove) <files>...)|(move <file> <new path>)|(chmod <file> <permissions>)|(copy <file> <new path> [version])|(restore <file> [version])|(trash (list|(restore [ids...])|empty))|(share ((add <path> <email> [read|write])|list|(revoke <id>)))|(link ((add <file> [version])|list|((revoke|log) <id>)))|(group (list|(members <group>)|(add <group> <email> [member|manager])|(remove <group> <email>)))|((mkdir|rmdir) <folders>...))"`
 	}
 	parser := arg.MustParse(&args)
 
@@ -1,49 +1,347 @@
 package cli
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"mantecabox/models"
+	"mantecabox/utilities"
 
+	"github.com/go-http-utils/headers"
 	"github.com/go-resty/resty"
 	"github.com/mitchellh/go-homedir"
 	"github.com/phayes/permbits"
 	"github.com/tidwall/gjson"
 	"gopkg.in/AlecAivazis/survey.v1"
+	"gopkg.in/guregu/null.v3"
 )
 
+const (
+	// chunkedUploadThreshold is the size from which the files are uploaded in chunks, so that only the chunks the
+	// server doesn't have yet are sent
+	chunkedUploadThreshold = utilities.MaxChunkSize
+	uploadPartSize         = 1024 * 1024
+	uploadOffsetHeader     = "Upload-Offset"
+	maxUploadAttempts      = 5
+	uploadRetryDelay       = 2 * time.Second
+)
+
+type fileChunk struct {
+	digest string
+	offset int64
+	size   int64
+}
+
 func uploadFile(filePath string, token string) (string, error) {
 	permissionBits, err := permbits.Stat(filePath)
 	if err != nil {
 		return "", err
 	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	if fileInfo.Size() > chunkedUploadThreshold {
+		return uploadFileInChunks(filePath, permissionBits.String(), token)
+	}
+	return uploadFileResumably(filePath, fileInfo.Size(), permissionBits.String(), token)
+}
+
+// uploadPath uploads the file, or every file inside the folder and its subfolders
+func uploadPath(localPath string, token string) error {
+	return filepath.Walk(localPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		fileName, err := uploadFile(filePath, token)
+		if err != nil {
+			fmt.Printf(ErrorMessage("Error uploading file '%v'\n", filePath))
+		} else {
+			fmt.Printf(SuccesMessage("File '%v' uploaded correctly.\n", fileName))
+		}
+		return nil
+	})
+}
+
+// remotePath names the file in the server after its path inside the Mantecabox directory, so its folders are kept.
+// The files outside it are uploaded to the root folder.
+func remotePath(filePath string) string {
+	home, err := homedir.Dir()
+	if err != nil {
+		return filepath.Base(filePath)
+	}
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return filepath.Base(filePath)
+	}
+	relativePath, err := filepath.Rel(filepath.Join(home, "Mantecabox"), absolutePath)
+	if err != nil {
+		return filepath.Base(filePath)
+	}
+	relativePath = filepath.ToSlash(relativePath)
+	if relativePath == ".." || strings.HasPrefix(relativePath, "../") {
+		return filepath.Base(filePath)
+	}
+	return relativePath
+}
+
+// escapeFilePath escapes each name of the path, so it can be used in the files' routes
+func escapeFilePath(path string) string {
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		names[i] = url.PathEscape(name)
+	}
+	return strings.Join(names, "/")
+}
+
+// uploadFileResumably sends the file in parts, so if the connection drops, the upload is resumed from the last part
+// the server received
+func uploadFileResumably(filePath string, size int64, permissionsStr, token string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	checksum, err := fileChecksum(file)
+	if err != nil {
+		return "", err
+	}
+
 	s := GetSpinner()
+	defer s.Stop()
+	var upload models.Upload
+	var serverError models.ServerError
+	err = retryOnNetworkErrors(func() error {
+		response, err := resty.R().
+			SetAuthToken(token).
+			SetBody(models.Upload{Name: remotePath(filePath), Size: size, PermissionsStr: permissionsStr, Checksum: null.StringFrom(checksum)}).
+			SetResult(&upload).
+			SetError(&serverError).
+			Post("/uploads")
+		if err == nil && response.StatusCode() != http.StatusCreated {
+			err = errors.New(ErrorMessage("error uploading file '%v'. ", filePath) + serverError.Message)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	offset := upload.Received
+	resync := false
+	for offset < size {
+		err = retryOnNetworkErrors(func() error {
+			var err error
+			if resync {
+				// The connection dropped while sending the last part, so the server tells where to resume from
+				offset, err = getUploadOffset(upload.Id, token)
+				if err != nil {
+					return err
+				}
+				resync = false
+			}
+			offset, err = sendUploadPart(file, upload.Id, offset, size, token)
+			resync = err != nil
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var fileDto models.FileDTO
+	err = retryOnNetworkErrors(func() error {
+		response, err := resty.R().
+			SetAuthToken(token).
+			SetResult(&fileDto).
+			SetError(&serverError).
+			Post("/uploads/" + upload.Id + "/finalize")
+		if err == nil && response.StatusCode() != http.StatusCreated {
+			err = errors.New(ErrorMessage("error uploading file '%v'. ", filePath) + serverError.Message)
+		}
+		return err
+	})
+	return fileDto.Name, err
+}
+
+// sendUploadPart sends the part of the file that starts at offset, and returns the offset of the next one
+func sendUploadPart(file *os.File, uploadId string, offset, size int64, token string) (int64, error) {
+	partSize := size - offset
+	if partSize > uploadPartSize {
+		partSize = uploadPartSize
+	}
+	var serverError models.ServerError
 	response, err := resty.R().
-		SetFiles(map[string]string{
-			"file": filePath,
-		}).
-		SetFormData(map[string]string{
-			"permissions": permissionBits.String(),
-		}).
 		SetAuthToken(token).
-		Post("/files")
-	s.Stop()
+		SetHeader(uploadOffsetHeader, strconv.FormatInt(offset, 10)).
+		SetHeader(headers.ContentType, "application/offset+octet-stream").
+		SetBody(io.NewSectionReader(file, offset, partSize)).
+		SetError(&serverError).
+		Patch("/uploads/" + uploadId)
+	if err != nil {
+		return offset, err
+	}
+	switch response.StatusCode() {
+	case http.StatusNoContent, http.StatusConflict:
+		// On conflict, the server has received more than we thought, so we go on from there
+		return strconv.ParseInt(response.Header().Get(uploadOffsetHeader), 10, 64)
+	default:
+		return offset, errors.New(ErrorMessage("error uploading part at offset %v. ", strconv.FormatInt(offset, 10)) + serverError.Message)
+	}
+}
+
+func getUploadOffset(uploadId, token string) (int64, error) {
+	response, err := resty.R().
+		SetAuthToken(token).
+		Head("/uploads/" + uploadId)
+	if err != nil {
+		return 0, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return 0, errors.New(ErrorMessage("unable to resume upload '%v'.", uploadId))
+	}
+	return strconv.ParseInt(response.Header().Get(uploadOffsetHeader), 10, 64)
+}
+
+// retryOnNetworkErrors runs the request again, after waiting a bit longer each time, while it fails because of the
+// connection with the server
+func retryOnNetworkErrors(request func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if _, isNetworkError := err.(*url.Error); !isNetworkError || attempt == maxUploadAttempts {
+			return err
+		}
+		fmt.Println(ErrorMessage("Connection lost, retrying in %v...", (time.Duration(attempt) * uploadRetryDelay).String()))
+		time.Sleep(time.Duration(attempt) * uploadRetryDelay)
+	}
+}
 
+func uploadFileInChunks(filePath, permissionsStr, token string) (string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
 
-	fileName := gjson.Get(response.String(), "name")
+	s := GetSpinner()
+	defer s.Stop()
+	chunks, checksum, err := splitFile(file)
+	if err != nil {
+		return "", err
+	}
+	digests := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		digests[i] = chunk.digest
+	}
 
-	if response.StatusCode() != http.StatusCreated && response.StatusCode() != http.StatusOK {
-		return "", errors.New(ErrorMessage("error uploading file '%v'.", fileName.Str))
+	fileName := remotePath(filePath)
+	// If one of the chunks is removed from the server before the manifest is sent, we try once again
+	for attempt := 0; ; attempt++ {
+		// After a network drop, the server is asked again for the missing chunks, so the upload is resumed
+		err := retryOnNetworkErrors(func() error {
+			return uploadMissingChunks(file, chunks, digests, token)
+		})
+		if err != nil {
+			return "", err
+		}
+		var fileDto models.FileDTO
+		var serverError models.ServerError
+		var response *resty.Response
+		err = retryOnNetworkErrors(func() error {
+			var err error
+			response, err = resty.R().
+				SetAuthToken(token).
+				SetQueryParam("permissions", permissionsStr).
+				SetBody(models.ChunkList{Chunks: digests, Checksum: null.StringFrom(checksum)}).
+				SetResult(&fileDto).
+				SetError(&serverError).
+				Post("/files/" + escapeFilePath(fileName) + "/manifest")
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		if response.StatusCode() == http.StatusConflict && attempt == 0 {
+			continue
+		}
+		if response.StatusCode() != http.StatusCreated {
+			return "", errors.New(ErrorMessage("error uploading file '%v'. ", fileName) + serverError.Message)
+		}
+		return fileDto.Name, nil
 	}
+}
 
-	return fileName.Str, nil
+// splitFile finds the content-defined chunks of the file, so the chunks of its unchanged parts are the same as in the
+// previous versions. The checksum of the whole file is computed along the way.
+func splitFile(file *os.File) ([]fileChunk, string, error) {
+	chunks := make([]fileChunk, 0)
+	chunker := utilities.NewChunker(file)
+	checksumHash := sha256.New()
+	var offset int64
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks, hex.EncodeToString(checksumHash.Sum(nil)), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		checksumHash.Write(chunk)
+		sum := sha256.Sum256(chunk)
+		chunks = append(chunks, fileChunk{digest: hex.EncodeToString(sum[:]), offset: offset, size: int64(len(chunk))})
+		offset += int64(len(chunk))
+	}
+}
+
+func uploadMissingChunks(file *os.File, chunks []fileChunk, digests []string, token string) error {
+	var missingChunks models.MissingChunks
+	var serverError models.ServerError
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(models.ChunkList{Chunks: digests}).
+		SetResult(&missingChunks).
+		SetError(&serverError).
+		Post("/chunks")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return errors.New(ErrorMessage("error checking the file's chunks. ") + serverError.Message)
+	}
+
+	missing := make(map[string]bool, len(missingChunks.Missing))
+	for _, digest := range missingChunks.Missing {
+		missing[digest] = true
+	}
+	for _, chunk := range chunks {
+		if !missing[chunk.digest] {
+			continue
+		}
+		response, err := resty.R().
+			SetAuthToken(token).
+			SetBody(io.NewSectionReader(file, chunk.offset, chunk.size)).
+			SetError(&serverError).
+			Put("/chunks/" + chunk.digest)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode() != http.StatusNoContent {
+			return errors.New(ErrorMessage("error uploading chunk '%v'. ", chunk.digest) + serverError.Message)
+		}
+		// A chunk may appear more than once in the file, but it's only sent once
+		delete(missing, chunk.digest)
+	}
+	return nil
 }
 
 func downloadFileVersion(selectedFile, token string) error {
@@ -51,11 +349,11 @@ func downloadFileVersion(selectedFile, token string) error {
 	if err != nil {
 		return err
 	}
-	return downloadFileWithUrl(selectedFile, "/files/"+selectedFile+"/versions/"+version, token)
+	return downloadFileWithUrl(selectedFile, "/files/"+escapeFilePath(selectedFile)+"/versions/"+version, token)
 }
 
 func downloadFile(selectedFile, token string) error {
-	return downloadFileWithUrl(selectedFile, "/files/"+selectedFile, token)
+	return downloadFileWithUrl(selectedFile, "/files/"+escapeFilePath(selectedFile), token)
 }
 
 func downloadFileWithUrl(selectedFile, fileUrl, token string) error {
@@ -90,10 +388,55 @@ func downloadFileWithUrl(selectedFile, fileUrl, token string) error {
 	if response.StatusCode() != http.StatusOK {
 		return errors.New(ErrorMessage("error downloading file '%v'.", selectedFile))
 	}
+	// The versions uploaded before the checksums existed can't be verified
+	checksum := response.Header().Get(models.ChecksumHeader)
+	if checksum == "" {
+		checksum = fileDto.Checksum.ValueOrZero()
+	}
+	if checksum != "" {
+		if err := verifyDownloadedFile(selectedFile, checksum); err != nil {
+			return err
+		}
+	}
 	setFilePermissions(selectedFile, fileDto.PermissionsStr)
 	return nil
 }
 
+// verifyDownloadedFile checks the downloaded file against its checksum, removing it if it doesn't match
+func verifyDownloadedFile(selectedFile string, checksum string) error {
+	home, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(home, "Mantecabox", selectedFile)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	downloadedChecksum, err := fileChecksum(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if downloadedChecksum != checksum {
+		os.Remove(filePath)
+		return errors.New(ErrorMessage("the downloaded file '%v' is corrupted, so it has been removed.", selectedFile))
+	}
+	return nil
+}
+
+// fileChecksum computes the hex encoded SHA-256 checksum of the file's content, and leaves it ready to be read again
+func fileChecksum(file *os.File) (string, error) {
+	checksumHash := sha256.New()
+	if _, err := io.Copy(checksumHash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksumHash.Sum(nil)), nil
+}
+
 func setFilePermissions(selectedFile string, permissionsStr string) error {
 	if len(permissionsStr) != 9 {
 		return errors.New("wrong permissions string (must contain 9 characters)")
@@ -123,11 +466,38 @@ func setFilePermissions(selectedFile string, permissionsStr string) error {
 	return nil
 }
 
+// changeFilePermissions changes the permissions of the file in the server, and in the local copy if there is one
+func changeFilePermissions(filePath string, permissionsStr string, token string) error {
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(models.FilePatch{PermissionsStr: null.StringFrom(permissionsStr)}).
+		SetError(&serverError).
+		Patch("/files/" + escapeFilePath(filePath))
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return errors.New(ErrorMessage("error changing the permissions of '%v'. ", filePath) + serverError.Message)
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(home, "Mantecabox", filepath.FromSlash(filePath))); os.IsNotExist(err) {
+		return nil
+	}
+	return setFilePermissions(filePath, permissionsStr)
+}
+
 func deleteFile(filePath string, token string) error {
 	s := GetSpinner()
 	response, err := resty.R().
 		SetAuthToken(token).
-		Delete("/files/" + filePath)
+		Delete("/files/" + escapeFilePath(filePath))
 	s.Stop()
 	if err != nil {
 		return err
@@ -140,6 +510,124 @@ func deleteFile(filePath string, token string) error {
 	return nil
 }
 
+// moveFile renames the file in the server, keeping its versions, and the local copy too if there is one
+func moveFile(filePath string, newPath string, token string) error {
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(models.FilePatch{Name: null.StringFrom(newPath)}).
+		SetError(&serverError).
+		Patch("/files/" + escapeFilePath(filePath))
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return errors.New(ErrorMessage("error moving file '%v'. ", filePath) + serverError.Message)
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+	localPath := filepath.Join(home, "Mantecabox", filepath.FromSlash(filePath))
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		return nil
+	}
+	newLocalPath := filepath.Join(home, "Mantecabox", filepath.FromSlash(strings.Trim(newPath, "/")))
+	if err := os.MkdirAll(filepath.Dir(newLocalPath), 0755); err != nil {
+		return err
+	}
+	return os.Rename(localPath, newLocalPath)
+}
+
+// copyFile copies the file's last version, or the given one, to the new path in the server, without downloading it
+func copyFile(filePath string, newPath string, version string, token string) error {
+	fileCopy := models.FileCopy{Name: newPath}
+	if version != "" {
+		versionId, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return errors.New(ErrorMessage("wrong version '%v'.", version))
+		}
+		fileCopy.Version = null.IntFrom(versionId)
+	}
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(fileCopy).
+		SetError(&serverError).
+		Post("/files/" + escapeFilePath(filePath) + "/copy")
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusCreated {
+		return errors.New(ErrorMessage("error copying file '%v'. ", filePath) + serverError.Message)
+	}
+	return nil
+}
+
+// restoreFile makes the given version of the file, or the one chosen by the user, its current version in the server
+func restoreFile(filePath string, version string, token string) error {
+	if version == "" {
+		selectedVersion, err := getFileVersion(filePath, token)
+		if err != nil {
+			return err
+		}
+		version = selectedVersion
+	}
+	if _, err := strconv.ParseInt(version, 10, 64); err != nil {
+		return errors.New(ErrorMessage("wrong version '%v'.", version))
+	}
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Post("/files/" + escapeFilePath(filePath) + "/versions/" + version + "/restore")
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusCreated {
+		return errors.New(ErrorMessage("error restoring file '%v'. ", filePath) + serverError.Message)
+	}
+	return nil
+}
+
+func createFolder(folder string, token string) error {
+	var serverError models.ServerError
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Put("/files/" + escapeFilePath(strings.Trim(folder, "/")) + "/")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusCreated {
+		return errors.New(ErrorMessage("error creating folder '%v'. ", folder) + serverError.Message)
+	}
+	return nil
+}
+
+// deleteFolder removes the folder from the server, which only works if it's empty
+func deleteFolder(folder string, token string) error {
+	var serverError models.ServerError
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Delete("/files/" + escapeFilePath(strings.Trim(folder, "/")) + "/")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusNoContent {
+		return errors.New(ErrorMessage("error removing folder '%v'. ", folder) + serverError.Message)
+	}
+	return nil
+}
+
 func Transfer(transferActions []string) error {
 	token, err := GetToken()
 	if err != nil {
@@ -162,11 +650,9 @@ func Transfer(transferActions []string) error {
 		case "upload":
 			if lengthActions > 1 {
 				for i := 1; i < len(transferActions); i++ {
-					fileName, err := uploadFile(transferActions[i], token)
+					err := uploadPath(transferActions[i], token)
 					if err != nil {
-						fmt.Printf(ErrorMessage("Error uploading file '%v'\n", transferActions[i]))
-					} else {
-						fmt.Printf(SuccesMessage("File '%v' uploaded correctly.\n", fileName))
+						fmt.Printf(ErrorMessage("Error uploading '%v'\n", transferActions[i]))
 					}
 				}
 			} else {
@@ -238,6 +724,82 @@ func Transfer(transferActions []string) error {
 				}
 				fmt.Println(SuccesMessage("File '%v' remove correctly.", fileSelected))
 			}
+		case "move":
+			if lengthActions != 3 {
+				return errors.New("usage: transfer move <file> <new path>")
+			}
+			err := moveFile(transferActions[1], transferActions[2], token)
+			if err != nil {
+				return err
+			}
+			fmt.Println(SuccesMessage("File '%v' moved correctly to '%v'.", transferActions[1], transferActions[2]))
+		case "chmod":
+			if lengthActions != 3 {
+				return errors.New("usage: transfer chmod <file> <permissions>")
+			}
+			err := changeFilePermissions(transferActions[1], transferActions[2], token)
+			if err != nil {
+				return err
+			}
+			fmt.Println(SuccesMessage("%v", fmt.Sprintf("Permissions of '%v' changed correctly to '%v'.", transferActions[1], transferActions[2])))
+		case "copy":
+			if lengthActions != 3 && lengthActions != 4 {
+				return errors.New("usage: transfer copy <file> <new path> [version]")
+			}
+			version := ""
+			if lengthActions == 4 {
+				version = transferActions[3]
+			}
+			err := copyFile(transferActions[1], transferActions[2], version, token)
+			if err != nil {
+				return err
+			}
+			fmt.Println(SuccesMessage("File '%v' copied correctly to '%v'.", transferActions[1], transferActions[2]))
+		case "restore":
+			if lengthActions != 2 && lengthActions != 3 {
+				return errors.New("usage: transfer restore <file> [version]")
+			}
+			version := ""
+			if lengthActions == 3 {
+				version = transferActions[2]
+			}
+			err := restoreFile(transferActions[1], version, token)
+			if err != nil {
+				return err
+			}
+			fmt.Println(SuccesMessage("File '%v' restored correctly.", transferActions[1]))
+		case "trash":
+			return trash(transferActions[1:], token)
+		case "share":
+			return share(transferActions[1:], token)
+		case "link":
+			return link(transferActions[1:], token)
+		case "group":
+			return group(transferActions[1:], token)
+		case "mkdir":
+			if lengthActions > 1 {
+				for _, folder := range transferActions[1:] {
+					err := createFolder(folder, token)
+					if err != nil {
+						return err
+					}
+					fmt.Println(SuccesMessage("Folder '%v' created correctly.", folder))
+				}
+			} else {
+				return errors.New("params not found")
+			}
+		case "rmdir":
+			if lengthActions > 1 {
+				for _, folder := range transferActions[1:] {
+					err := deleteFolder(folder, token)
+					if err != nil {
+						return err
+					}
+					fmt.Println(SuccesMessage("Folder '%v' removed correctly.", folder))
+				}
+			} else {
+				return errors.New("params not found")
+			}
 		default:
 			return errors.New(ErrorMessage("action '%v' not exist", transferActions[0]))
 		}
@@ -303,7 +865,7 @@ func getFileVersion(file, token string) (string, error) {
 }
 
 func getFileVersionsList(file, token string) ([]gjson.Result, []gjson.Result, []gjson.Result, []gjson.Result, error) {
-	return getList("/files/"+file+"/versions", token)
+	return getList("/files/"+escapeFilePath(file)+"/versions", token)
 }
 
 func getFilesList(token string) ([]gjson.Result, []gjson.Result, []gjson.Result, []gjson.Result, error) {
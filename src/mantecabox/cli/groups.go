@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/go-resty/resty"
+)
+
+// group manages the groups that the user is a member of. Only their managers can add and remove other members.
+func group(groupActions []string, token string) error {
+	if len(groupActions) == 0 {
+		return errors.New("usage: transfer group list|(members <group>)|(add <group> <email> [member|manager])|(remove <group> <email>)")
+	}
+	switch groupActions[0] {
+	case "list":
+		groups, err := getGroupMembers("/groups", token)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			fmt.Println("You aren't a member of any group.")
+		}
+		for _, g := range groups {
+			fmt.Printf("%-7v %v /groups/%v/files/\n", g.Role, g.CreatedAt.Format(time.RFC822), g.Group)
+		}
+	case "members":
+		if len(groupActions) != 2 {
+			return errors.New("usage: transfer group members <group>")
+		}
+		members, err := getGroupMembers("/groups/"+groupActions[1]+"/members", token)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			fmt.Printf("%-7v %v %v\n", m.Role, m.CreatedAt.Format(time.RFC822), m.Member)
+		}
+	case "add":
+		if len(groupActions) != 3 && len(groupActions) != 4 {
+			return errors.New("usage: transfer group add <group> <email> [member|manager]")
+		}
+		role := models.GroupRoleMember
+		if len(groupActions) == 4 {
+			role = groupActions[3]
+		}
+		member, err := setGroupMember(groupActions[1], groupActions[2], role, token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("%v", fmt.Sprintf("'%v' added correctly to '%v' (%v).", member.Member, member.Group, member.Role)))
+	case "remove":
+		if len(groupActions) != 3 {
+			return errors.New("usage: transfer group remove <group> <email>")
+		}
+		err := removeGroupMember(groupActions[1], groupActions[2], token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("%v", fmt.Sprintf("'%v' removed correctly from '%v'.", groupActions[2], groupActions[1])))
+	default:
+		return errors.New(ErrorMessage("action 'group %v' not exist", groupActions[0]))
+	}
+	return nil
+}
+
+func getGroupMembers(url, token string) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetResult(&members).
+		SetError(&serverError).
+		Get(url)
+	s.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(ErrorMessage("error retrieving the groups. ") + serverError.Message)
+	}
+	return members, nil
+}
+
+func setGroupMember(group, email, role, token string) (models.GroupMember, error) {
+	var member models.GroupMember
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(models.GroupMember{Role: role}).
+		SetResult(&member).
+		SetError(&serverError).
+		Put("/groups/" + group + "/members/" + email)
+	s.Stop()
+	if err != nil {
+		return member, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return member, errors.New(ErrorMessage("error adding '%v' to the group. ", email) + serverError.Message)
+	}
+	return member, nil
+}
+
+func removeGroupMember(group, email, token string) error {
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Delete("/groups/" + group + "/members/" + email)
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusNoContent {
+		return errors.New(ErrorMessage("error removing '%v' from the group. ", email) + serverError.Message)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/go-resty/resty"
+	"github.com/howeyc/gopass"
+	"gopkg.in/guregu/null.v3"
+)
+
+// link manages the public links to the user's files, which anyone can download without logging in
+func link(linkActions []string, token string) error {
+	if len(linkActions) == 0 {
+		return errors.New("usage: transfer link (add <file> [version])|list|(revoke <id>)|(log <id>)")
+	}
+	switch linkActions[0] {
+	case "add":
+		if len(linkActions) != 2 && len(linkActions) != 3 {
+			return errors.New("usage: transfer link add <file> [version]")
+		}
+		var options models.LinkOptions
+		if len(linkActions) == 3 {
+			version, err := strconv.ParseInt(linkActions[2], 10, 64)
+			if err != nil {
+				return errors.New(ErrorMessage("wrong version '%v'.", linkActions[2]))
+			}
+			options.Version = null.IntFrom(version)
+		}
+		if err := readLinkOptions(&options); err != nil {
+			return err
+		}
+		createdLink, err := createLink(linkActions[1], options, token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("Link created correctly: %v", createdLink.Url))
+	case "list":
+		links, err := getLinks(token)
+		if err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			fmt.Println("There are no links.")
+		}
+		for _, l := range links {
+			fmt.Printf("%v %v %v %v\n", l.Id, linkStatus(l), l.Name, l.Url)
+		}
+	case "revoke":
+		if len(linkActions) != 2 {
+			return errors.New("usage: transfer link revoke <id>")
+		}
+		err := revokeLink(linkActions[1], token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("Link '%v' revoked correctly.", linkActions[1]))
+	case "log":
+		if len(linkActions) != 2 {
+			return errors.New("usage: transfer link log <id>")
+		}
+		accesses, err := getLinkAccesses(linkActions[1], token)
+		if err != nil {
+			return err
+		}
+		if len(accesses) == 0 {
+			fmt.Println("The link hasn't been accessed.")
+		}
+		for _, access := range accesses {
+			result := "denied"
+			if access.Granted {
+				result = "downloaded"
+			}
+			fmt.Printf("%v %-10v %v %v\n", access.AccessedAt.Format(time.RFC822), result, access.Ip, access.UserAgent)
+		}
+	default:
+		return errors.New(ErrorMessage("action 'link %v' not exist", linkActions[0]))
+	}
+	return nil
+}
+
+// readLinkOptions asks for the link's limits. Leaving them empty means no limit.
+func readLinkOptions(options *models.LinkOptions) error {
+	fmt.Print("Expires in (such as 72h, empty for never): ")
+	fmt.Scanln(&options.ExpiresIn)
+	var maxDownloads string
+	fmt.Print("Maximum downloads (empty for no limit): ")
+	fmt.Scanln(&maxDownloads)
+	if maxDownloads != "" {
+		max, err := strconv.ParseInt(maxDownloads, 10, 64)
+		if err != nil {
+			return errors.New(ErrorMessage("wrong maximum downloads '%v'.", maxDownloads))
+		}
+		options.MaxDownloads = null.IntFrom(max)
+	}
+	fmt.Print("Password (empty for none): ")
+	password, err := gopass.GetPasswdMasked()
+	if err != nil {
+		return err
+	}
+	options.Password = string(password)
+	return nil
+}
+
+// linkStatus tells whether the link can still be downloaded, and how many times it has been
+func linkStatus(l models.Link) string {
+	downloads := strconv.FormatInt(l.Downloads, 10)
+	if l.MaxDownloads.Valid {
+		downloads += "/" + strconv.FormatInt(l.MaxDownloads.Int64, 10)
+	}
+	switch {
+	case l.RevokedAt.Valid:
+		return "revoked " + downloads
+	case l.ExpiresAt.Valid && l.ExpiresAt.Time.Before(time.Now()):
+		return "expired " + downloads
+	case l.ExpiresAt.Valid:
+		return "until " + l.ExpiresAt.Time.Format(time.RFC822) + " " + downloads
+	}
+	return "active " + downloads
+}
+
+func createLink(file string, options models.LinkOptions, token string) (models.Link, error) {
+	var createdLink models.Link
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(options).
+		SetResult(&createdLink).
+		SetError(&serverError).
+		Post("/files/" + escapeFilePath(file) + "/links")
+	s.Stop()
+	if err != nil {
+		return createdLink, err
+	}
+	if response.StatusCode() != http.StatusCreated {
+		return createdLink, errors.New(ErrorMessage("error creating a link to '%v'. ", file) + serverError.Message)
+	}
+	return createdLink, nil
+}
+
+func getLinks(token string) ([]models.Link, error) {
+	var links []models.Link
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetResult(&links).
+		SetError(&serverError).
+		Get("/links")
+	s.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(ErrorMessage("error retrieving the links. ") + serverError.Message)
+	}
+	return links, nil
+}
+
+func revokeLink(id string, token string) error {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return errors.New(ErrorMessage("wrong link ID '%v'.", id))
+	}
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Delete("/links/" + id)
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusNoContent {
+		return errors.New(ErrorMessage("error revoking link '%v'. ", id) + serverError.Message)
+	}
+	return nil
+}
+
+func getLinkAccesses(id string, token string) ([]models.LinkAccess, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, errors.New(ErrorMessage("wrong link ID '%v'.", id))
+	}
+	var accesses []models.LinkAccess
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetResult(&accesses).
+		SetError(&serverError).
+		Get("/links/" + id + "/accesses")
+	s.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(ErrorMessage("error retrieving the link's accesses. ") + serverError.Message)
+	}
+	return accesses, nil
+}
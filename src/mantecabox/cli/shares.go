@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/go-resty/resty"
+)
+
+// share manages the files and folders shared with other users. The folders' paths end with a slash.
+func share(shareActions []string, token string) error {
+	if len(shareActions) == 0 {
+		return errors.New("usage: transfer share (add <path> <email> [read|write])|list|(revoke <id>)")
+	}
+	switch shareActions[0] {
+	case "add":
+		if len(shareActions) != 3 && len(shareActions) != 4 {
+			return errors.New("usage: transfer share add <path> <email> [read|write]")
+		}
+		access := models.ShareAccessRead
+		if len(shareActions) == 4 {
+			access = shareActions[3]
+		}
+		savedShare, err := addShare(shareActions[1], shareActions[2], access, token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("%v", fmt.Sprintf("'%v' shared correctly with '%v' (%v).", savedShare.Path, savedShare.Grantee, savedShare.Access)))
+	case "list":
+		shares, err := getShares("/shares", token)
+		if err != nil {
+			return err
+		}
+		sharedWithMe, err := getShares("/shared-with-me", token)
+		if err != nil {
+			return err
+		}
+		if len(shares) == 0 && len(sharedWithMe) == 0 {
+			fmt.Println("There are no shares.")
+		}
+		for _, s := range shares {
+			fmt.Printf("%v %-5v %v %v -> %v\n", s.Id, s.Access, s.CreatedAt.Format(time.RFC822), s.Path, s.Grantee)
+		}
+		for _, s := range sharedWithMe {
+			fmt.Printf("- %-5v %v /shared/%v/%v\n", s.Access, s.CreatedAt.Format(time.RFC822), s.Owner, s.Path)
+		}
+	case "revoke":
+		if len(shareActions) != 2 {
+			return errors.New("usage: transfer share revoke <id>")
+		}
+		err := revokeShare(shareActions[1], token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("Share '%v' revoked correctly.", shareActions[1]))
+	default:
+		return errors.New(ErrorMessage("action 'share %v' not exist", shareActions[0]))
+	}
+	return nil
+}
+
+func addShare(path, grantee, access, token string) (models.Share, error) {
+	var savedShare models.Share
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetBody(models.Share{Path: path, Grantee: grantee, Access: access}).
+		SetResult(&savedShare).
+		SetError(&serverError).
+		Post("/shares")
+	s.Stop()
+	if err != nil {
+		return savedShare, err
+	}
+	if response.StatusCode() != http.StatusCreated {
+		return savedShare, errors.New(ErrorMessage("error sharing '%v'. ", path) + serverError.Message)
+	}
+	return savedShare, nil
+}
+
+func getShares(url, token string) ([]models.Share, error) {
+	var shares []models.Share
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetResult(&shares).
+		SetError(&serverError).
+		Get(url)
+	s.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(ErrorMessage("error retrieving the shares. ") + serverError.Message)
+	}
+	return shares, nil
+}
+
+func revokeShare(id string, token string) error {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return errors.New(ErrorMessage("wrong share ID '%v'.", id))
+	}
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Delete("/shares/" + id)
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusNoContent {
+		return errors.New(ErrorMessage("error revoking share '%v'. ", id) + serverError.Message)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/go-resty/resty"
+	"gopkg.in/AlecAivazis/survey.v1"
+)
+
+// trash manages the deleted files, which are kept in the server until they are restored or the trash is emptied
+func trash(trashActions []string, token string) error {
+	if len(trashActions) == 0 {
+		return errors.New("usage: transfer trash (list|(restore [ids...])|empty)")
+	}
+	switch trashActions[0] {
+	case "list":
+		files, err := getTrash(token)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			fmt.Println("The trash is empty.")
+		}
+		for _, file := range files {
+			fmt.Printf("%v %v %v %v\n", file.Id, file.PermissionsStr, file.DeletedAt.Time.Format(time.RFC822), file.Name)
+		}
+	case "restore":
+		ids := trashActions[1:]
+		if len(ids) == 0 {
+			id, err := getTrashedFileId(token)
+			if err != nil {
+				return err
+			}
+			ids = []string{id}
+		}
+		for _, id := range ids {
+			file, err := restoreTrashedFile(id, token)
+			if err != nil {
+				return err
+			}
+			fmt.Println(SuccesMessage("File '%v' restored correctly.", file.Name))
+		}
+	case "empty":
+		err := emptyTrash(token)
+		if err != nil {
+			return err
+		}
+		fmt.Println(SuccesMessage("Trash emptied correctly."))
+	default:
+		return errors.New(ErrorMessage("action 'trash %v' not exist", trashActions[0]))
+	}
+	return nil
+}
+
+func getTrash(token string) ([]models.TrashedFileDTO, error) {
+	var files []models.TrashedFileDTO
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetResult(&files).
+		SetError(&serverError).
+		Get("/trash")
+	s.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(ErrorMessage("error retrieving the trash. ") + serverError.Message)
+	}
+	return files, nil
+}
+
+// getTrashedFileId lets the user choose one of the trashed files, and returns its ID
+func getTrashedFileId(token string) (string, error) {
+	files, err := getTrash(token)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", errors.New("the trash is empty")
+	}
+
+	var list []string
+	for _, file := range files {
+		list = append(list, fmt.Sprintf("%v %v (%v)", file.Id, file.Name, file.DeletedAt.Time.Format(time.RFC822)))
+	}
+	fileSelected := ""
+	prompt := &survey.Select{
+		Message: "Please, choose one file: ",
+		Options: list,
+	}
+	err = survey.AskOne(prompt, &fileSelected, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.Fields(fileSelected)[0], nil
+}
+
+func restoreTrashedFile(id string, token string) (models.FileDTO, error) {
+	var file models.FileDTO
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return file, errors.New(ErrorMessage("wrong trashed file ID '%v'.", id))
+	}
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetResult(&file).
+		SetError(&serverError).
+		Post("/trash/" + id + "/restore")
+	s.Stop()
+	if err != nil {
+		return file, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return file, errors.New(ErrorMessage("error restoring trashed file '%v'. ", id) + serverError.Message)
+	}
+	return file, nil
+}
+
+func emptyTrash(token string) error {
+	var serverError models.ServerError
+	s := GetSpinner()
+	response, err := resty.R().
+		SetAuthToken(token).
+		SetError(&serverError).
+		Delete("/trash")
+	s.Stop()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusNoContent {
+		return errors.New(ErrorMessage("error emptying the trash. ") + serverError.Message)
+	}
+	return nil
+}
@@ -2,8 +2,8 @@ package cli
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
 	"mantecabox/models"
@@ -21,22 +21,11 @@ func monitorChanges(w *watcher.Watcher) {
 		select {
 		case event := <-w.Event:
 			fmt.Println(event) // Print the event's info.
-			fileInfos, err := ioutil.ReadDir(event.Path)
+			localFiles, err := getLocalFiles()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 			}
 
-			localFiles := make([]models.FileDTO, 0)
-			for _, fileInfo := range fileInfos {
-				if fileInfo.Name() != "" {
-					localFiles = append(localFiles, models.FileDTO{
-						TimeStamp:      models.TimeStamp{UpdatedAt: null.Time{Time: fileInfo.ModTime(), Valid: true}},
-						Name:           fileInfo.Name(),
-						PermissionsStr: permbits.FileMode(fileInfo.Mode()).String(),
-					})
-				}
-			}
-
 			token, err := GetToken()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "unable to get token:", err)
@@ -66,6 +55,27 @@ func monitorChanges(w *watcher.Watcher) {
 	}
 }
 
+// getLocalFiles lists the files inside the Mantecabox directory and its subfolders, named after their path inside it
+func getLocalFiles() ([]models.FileDTO, error) {
+	localFiles := make([]models.FileDTO, 0)
+	err := filepath.Walk(mantecaboxDir, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(mantecaboxDir, filePath)
+		if err != nil {
+			return err
+		}
+		localFiles = append(localFiles, models.FileDTO{
+			TimeStamp:      models.TimeStamp{UpdatedAt: null.Time{Time: fileInfo.ModTime(), Valid: true}},
+			Name:           filepath.ToSlash(relativePath),
+			PermissionsStr: permbits.FileMode(fileInfo.Mode()).String(),
+		})
+		return nil
+	})
+	return localFiles, err
+}
+
 func compareFileLists(localFiles []models.FileDTO, remoteFiles []models.FileDTO, token string) {
 	for _, localFile := range localFiles {
 		if !fileInSlice(localFile, remoteFiles) {
@@ -99,7 +109,7 @@ func StartDaemon() {
 	}
 	dir += "/Mantecabox/"
 	mantecaboxDir = dir
-	if err := w.Add(mantecaboxDir); err != nil {
+	if err := w.AddRecursive(mantecaboxDir); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
 
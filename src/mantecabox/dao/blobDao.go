@@ -0,0 +1,209 @@
+package dao
+
+import (
+	"database/sql"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// If the owner already has a blob with the same content, it gets one more reference instead
+	acquireBlobQuery = `INSERT INTO blobs (owner, hash, size) VALUES ($1, $2, $3)
+ON CONFLICT (owner, hash) DO UPDATE SET ref_count = blobs.ref_count + 1
+RETURNING *`
+	markBlobStoredQuery = `UPDATE blobs SET stored = TRUE, compression = $1, stored_size = $2 WHERE id = $3`
+	referenceBlobQuery  = `UPDATE blobs SET ref_count = ref_count + 1 WHERE id = $1 AND stored`
+	releaseBlobQuery    = `UPDATE blobs SET ref_count = ref_count - 1 WHERE id = $1`
+	// The blob is only removed if nobody has acquired it again in the meantime
+	deleteUnreferencedBlobQuery = `DELETE FROM blobs WHERE id = $1 AND ref_count <= 0`
+	// The chunks have no references until a file's manifest points to them
+	storeBlobQuery = `INSERT INTO blobs (owner, hash, size, ref_count) VALUES ($1, $2, $3, 0)
+ON CONFLICT (owner, hash) DO UPDATE SET hash = EXCLUDED.hash
+RETURNING *`
+	getStoredBlobHashesQuery = `SELECT hash FROM blobs WHERE owner = $1 AND hash = ANY ($2) AND stored`
+	getFileChunksQuery       = `SELECT b.*
+FROM file_chunks fc
+  JOIN blobs b ON fc.blob_id = b.id
+WHERE fc.file_id = $1
+ORDER BY fc.position`
+)
+
+type (
+	BlobDao interface {
+		Acquire(blob *models.Blob) (models.Blob, error)
+		MarkStored(id int64, compression string, storedSize int64) error
+		Reference(id int64) error
+		Release(id int64) (bool, error)
+		Store(blob *models.Blob) (models.Blob, error)
+		GetStoredHashes(owner string, hashes []string) ([]string, error)
+		GetFileChunks(fileId int64) ([]models.Blob, error)
+	}
+
+	BlobPgDao struct {
+	}
+)
+
+// Acquire returns the owner's blob with the same hash, with one more reference, or creates it if there isn't any.
+// Its content must be uploaded to the storage backend if it's not marked as stored yet.
+func (dao BlobPgDao) Acquire(blob *models.Blob) (models.Blob, error) {
+	logs.DaoLog.Debug("Acquire")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var acquiredBlob models.Blob
+		err := scanBlobRow(db.QueryRow(acquireBlobQuery, blob.Owner, blob.Hash, blob.Size), &acquiredBlob)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute BlobPgDao.Acquire(blob models.Blob) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Acquired blob %v (%v references)", acquiredBlob.Id, acquiredBlob.RefCount)
+		}
+		return acquiredBlob, err
+	})
+	return res.(models.Blob), err
+}
+
+// MarkStored records that the blob's content has been uploaded, along with how it was compressed and its stored size
+func (dao BlobPgDao) MarkStored(id int64, compression string, storedSize int64) error {
+	logs.DaoLog.Debug("MarkStored")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		_, err := db.Exec(markBlobStoredQuery, compression, storedSize, id)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute BlobPgDao.MarkStored(id int64, compression string, storedSize int64) query. Reason: %v", err)
+		}
+		return nil, err
+	})
+	return err
+}
+
+// Reference adds one more reference to a stored blob. If the blob doesn't exist, sql.ErrNoRows is returned.
+func (dao BlobPgDao) Reference(id int64) error {
+	logs.DaoLog.Debug("Reference")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(referenceBlobQuery, id)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute BlobPgDao.Reference(id int64) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		return nil, err
+	})
+	return err
+}
+
+// Release drops one of the blob's references, and tells if it was the last one. In that case the blob is removed, and
+// its content must be removed from the storage backend.
+func (dao BlobPgDao) Release(id int64) (bool, error) {
+	logs.DaoLog.Debug("Release")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(releaseBlobQuery, id)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute BlobPgDao.Release(id int64) query. Reason: %v", err)
+			return false, err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			if err == nil {
+				err = sql.ErrNoRows
+			}
+			logs.DaoLog.Infof("Unable to release blob %v. Reason: %v", id, err)
+			return false, err
+		}
+		result, err = db.Exec(deleteUnreferencedBlobQuery, id)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute BlobPgDao.Release(id int64) query. Reason: %v", err)
+			return false, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if rowsAffected > 0 {
+			logs.DaoLog.Infof("Blob %v is no longer referenced", id)
+		}
+		return rowsAffected > 0, nil
+	})
+	return res.(bool), err
+}
+
+// Store returns the owner's blob with the same hash, or creates it without references if there isn't any. Unlike
+// Acquire, it's meant for the chunks, which are referenced later by the files' manifests.
+func (dao BlobPgDao) Store(blob *models.Blob) (models.Blob, error) {
+	logs.DaoLog.Debug("Store")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var storedBlob models.Blob
+		err := scanBlobRow(db.QueryRow(storeBlobQuery, blob.Owner, blob.Hash, blob.Size), &storedBlob)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute BlobPgDao.Store(blob models.Blob) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Stored blob %v", storedBlob.Id)
+		}
+		return storedBlob, err
+	})
+	return res.(models.Blob), err
+}
+
+// GetStoredHashes tells which of the given hashes belong to blobs of the owner whose content is already stored
+func (dao BlobPgDao) GetStoredHashes(owner string, hashes []string) ([]string, error) {
+	logs.DaoLog.Debug("GetStoredHashes")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		storedHashes := make([]string, 0)
+		rows, err := db.Query(getStoredBlobHashesQuery, owner, pq.Array(hashes))
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute BlobPgDao.GetStoredHashes(owner string, hashes []string) query. Reason: %v", err)
+			return storedHashes, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				logs.DaoLog.Errorf("Unable to execute BlobPgDao.GetStoredHashes(owner string, hashes []string) query. Reason: %v", err)
+				return storedHashes, err
+			}
+			storedHashes = append(storedHashes, hash)
+		}
+		return storedHashes, rows.Err()
+	})
+	return res.([]string), err
+}
+
+// GetFileChunks returns the blobs of a chunked file, in the order their content must be joined
+func (dao BlobPgDao) GetFileChunks(fileId int64) ([]models.Blob, error) {
+	logs.DaoLog.Debug("GetFileChunks")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		chunks := make([]models.Blob, 0)
+		rows, err := db.Query(getFileChunksQuery, fileId)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute BlobPgDao.GetFileChunks(fileId int64) query. Reason: %v", err)
+			return chunks, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var chunk models.Blob
+			if err := scanBlobRow(rows, &chunk); err != nil {
+				logs.DaoLog.Errorf("Unable to execute BlobPgDao.GetFileChunks(fileId int64) query. Reason: %v", err)
+				return chunks, err
+			}
+			chunks = append(chunks, chunk)
+		}
+		logs.DaoLog.Info("Queried ", len(chunks), " chunks")
+		return chunks, rows.Err()
+	})
+	return res.([]models.Blob), err
+}
+
+func scanBlobRow(scanner polimorphicScanner, blob *models.Blob) error {
+	logs.DaoLog.Debug("scanBlobRow")
+	return scanner.Scan(
+		&blob.Id,
+		&blob.CreatedAt,
+		&blob.Owner,
+		&blob.Hash,
+		&blob.Size,
+		&blob.RefCount,
+		&blob.Stored,
+		&blob.Compression,
+		&blob.StoredSize)
+}
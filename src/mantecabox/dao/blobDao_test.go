@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBlobHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestBlobPgDao_Acquire(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := BlobPgDao{}
+
+	blob, err := dao.Acquire(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), blob.RefCount)
+	require.False(t, blob.Stored)
+	require.NoError(t, dao.MarkStored(blob.Id, "zstd", 60))
+
+	// The same content gets the same blob, with its compression
+	sameBlob, err := dao.Acquire(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	require.Equal(t, blob.Id, sameBlob.Id)
+	require.Equal(t, int64(2), sameBlob.RefCount)
+	require.True(t, sameBlob.Stored)
+	require.Equal(t, "zstd", sameBlob.Compression)
+	require.Equal(t, int64(60), sameBlob.StoredSize)
+
+	// But the blobs are never shared between users
+	otherBlob, err := dao.Acquire(&models.Blob{Owner: "testuser2", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	require.NotEqual(t, blob.Id, otherBlob.Id)
+	require.Equal(t, int64(1), otherBlob.RefCount)
+}
+
+func TestBlobPgDao_Release(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := BlobPgDao{}
+
+	blob, err := dao.Acquire(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	_, err = dao.Acquire(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+
+	unreferenced, err := dao.Release(blob.Id)
+	require.NoError(t, err)
+	require.False(t, unreferenced)
+
+	unreferenced, err = dao.Release(blob.Id)
+	require.NoError(t, err)
+	require.True(t, unreferenced)
+
+	_, err = dao.Release(blob.Id)
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestBlobPgDao_Reference(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := BlobPgDao{}
+
+	blob, err := dao.Acquire(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	// The blobs can't be referenced until their content is stored
+	require.Equal(t, sql.ErrNoRows, dao.Reference(blob.Id))
+	require.NoError(t, dao.MarkStored(blob.Id, "", 4))
+	require.NoError(t, dao.Reference(blob.Id))
+
+	unreferenced, err := dao.Release(blob.Id)
+	require.NoError(t, err)
+	require.False(t, unreferenced)
+	unreferenced, err = dao.Release(blob.Id)
+	require.NoError(t, err)
+	require.True(t, unreferenced)
+}
+
+func TestBlobPgDao_Store(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := BlobPgDao{}
+
+	blob, err := dao.Store(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), blob.RefCount)
+	require.False(t, blob.Stored)
+
+	hashes, err := dao.GetStoredHashes("testuser1", []string{testBlobHash})
+	require.NoError(t, err)
+	require.Empty(t, hashes)
+
+	require.NoError(t, dao.MarkStored(blob.Id, "", 4))
+	sameBlob, err := dao.Store(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+	require.Equal(t, blob.Id, sameBlob.Id)
+	require.Equal(t, int64(0), sameBlob.RefCount)
+	require.True(t, sameBlob.Stored)
+
+	hashes, err = dao.GetStoredHashes("testuser1", []string{testBlobHash, "0000000000000000000000000000000000000000000000000000000000000000"})
+	require.NoError(t, err)
+	require.Equal(t, []string{testBlobHash}, hashes)
+	hashes, err = dao.GetStoredHashes("testuser2", []string{testBlobHash})
+	require.NoError(t, err)
+	require.Empty(t, hashes)
+}
@@ -40,3 +40,103 @@ func LoginAttemptFactory(engine string) LoginAttempDao {
 		return nil
 	}
 }
+
+func UserKeyDaoFactory(engine string) UserKeyDao {
+	logs.DaoLog.Debug("UserKeyDaoFactory")
+	switch engine {
+	case "postgres":
+		return UserKeyPgDao{}
+	default:
+		return nil
+	}
+}
+
+func KeyRotationDaoFactory(engine string) KeyRotationDao {
+	logs.DaoLog.Debug("KeyRotationDaoFactory")
+	switch engine {
+	case "postgres":
+		return KeyRotationPgDao{}
+	default:
+		return nil
+	}
+}
+
+func BlobDaoFactory(engine string) BlobDao {
+	logs.DaoLog.Debug("BlobDaoFactory")
+	switch engine {
+	case "postgres":
+		return BlobPgDao{}
+	default:
+		return nil
+	}
+}
+
+func UploadDaoFactory(engine string) UploadDao {
+	logs.DaoLog.Debug("UploadDaoFactory")
+	switch engine {
+	case "postgres":
+		return UploadPgDao{}
+	default:
+		return nil
+	}
+}
+
+func FolderDaoFactory(engine string) FolderDao {
+	logs.DaoLog.Debug("FolderDaoFactory")
+	switch engine {
+	case "postgres":
+		return FolderPgDao{}
+	default:
+		return nil
+	}
+}
+
+func RetentionPolicyDaoFactory(engine string) RetentionPolicyDao {
+	logs.DaoLog.Debug("RetentionPolicyDaoFactory")
+	switch engine {
+	case "postgres":
+		return RetentionPolicyPgDao{}
+	default:
+		return nil
+	}
+}
+
+func ScrubDaoFactory(engine string) ScrubDao {
+	logs.DaoLog.Debug("ScrubDaoFactory")
+	switch engine {
+	case "postgres":
+		return ScrubPgDao{}
+	default:
+		return nil
+	}
+}
+
+func ShareDaoFactory(engine string) ShareDao {
+	logs.DaoLog.Debug("ShareDaoFactory")
+	switch engine {
+	case "postgres":
+		return SharePgDao{}
+	default:
+		return nil
+	}
+}
+
+func LinkDaoFactory(engine string) LinkDao {
+	logs.DaoLog.Debug("LinkDaoFactory")
+	switch engine {
+	case "postgres":
+		return LinkPgDao{}
+	default:
+		return nil
+	}
+}
+
+func GroupDaoFactory(engine string) GroupDao {
+	logs.DaoLog.Debug("GroupDaoFactory")
+	switch engine {
+	case "postgres":
+		return GroupPgDao{}
+	default:
+		return nil
+	}
+}
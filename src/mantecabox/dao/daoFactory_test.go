@@ -117,3 +117,273 @@ func TestLoginAttemptFactory(t *testing.T) {
 		})
 	}
 }
+
+func TestUserKeyDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want UserKeyDao
+	}{
+		{
+			`When asking for "postgres" DAO, return UserKeyPgDao instance`,
+			args{engine: "postgres"},
+			UserKeyPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, UserKeyDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestKeyRotationDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want KeyRotationDao
+	}{
+		{
+			`When asking for "postgres" DAO, return KeyRotationPgDao instance`,
+			args{engine: "postgres"},
+			KeyRotationPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, KeyRotationDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestBlobDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want BlobDao
+	}{
+		{
+			`When asking for "postgres" DAO, return BlobPgDao instance`,
+			args{engine: "postgres"},
+			BlobPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, BlobDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestUploadDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want UploadDao
+	}{
+		{
+			`When asking for "postgres" DAO, return UploadPgDao instance`,
+			args{engine: "postgres"},
+			UploadPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, UploadDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestFolderDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want FolderDao
+	}{
+		{
+			`When asking for "postgres" DAO, return FolderPgDao instance`,
+			args{engine: "postgres"},
+			FolderPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, FolderDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestRetentionPolicyDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want RetentionPolicyDao
+	}{
+		{
+			`When asking for "postgres" DAO, return RetentionPolicyPgDao instance`,
+			args{engine: "postgres"},
+			RetentionPolicyPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, RetentionPolicyDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestScrubDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want ScrubDao
+	}{
+		{
+			`When asking for "postgres" DAO, return ScrubPgDao instance`,
+			args{engine: "postgres"},
+			ScrubPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, ScrubDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestShareDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want ShareDao
+	}{
+		{
+			`When asking for "postgres" DAO, return SharePgDao instance`,
+			args{engine: "postgres"},
+			SharePgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, ShareDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestLinkDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want LinkDao
+	}{
+		{
+			`When asking for "postgres" DAO, return LinkPgDao instance`,
+			args{engine: "postgres"},
+			LinkPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, LinkDaoFactory(testCase.args.engine))
+		})
+	}
+}
+
+func TestGroupDaoFactory(t *testing.T) {
+	type args struct {
+		engine string
+	}
+	tests := []struct {
+		name string
+		args args
+		want GroupDao
+	}{
+		{
+			`When asking for "postgres" DAO, return GroupPgDao instance`,
+			args{engine: "postgres"},
+			GroupPgDao{},
+		},
+		{
+			`When asking for "mysql" DAO, return nil`,
+			args{engine: "mysql"},
+			nil,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, GroupDaoFactory(testCase.args.engine))
+		})
+	}
+}
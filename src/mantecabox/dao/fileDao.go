@@ -4,24 +4,34 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"mantecabox/logs"
 	"mantecabox/models"
+
+	"gopkg.in/guregu/null.v3"
 )
 
+var MissingChunkError = errors.New("some of the file's chunks are not stored")
+
 const (
-	getAllFilesByOwnerQuery = `SELECT DISTINCT ON (name, owner) *
+	getAllFilesByOwnerQuery = `SELECT DISTINCT ON (logical_id) *
 FROM (SELECT *
       FROM files f
         JOIN users u ON f.owner = u.email
-      WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND u.email = $1
+      WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND u.email = $1 AND ($2::VARCHAR IS NULL OR f.folder = $2)
       ORDER BY f.updated_at DESC) as T;`
+	// The versions are those of the logical file with the given path, even if some were uploaded with another one
 	getFileVersionsByNameAndOwner = `SELECT
   f.*,
   u.*
 FROM files f
   JOIN users u ON f.owner = u.email
-WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND f.name = $1 AND f.owner = $2`
+WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND f.logical_id = (SELECT logical_id
+                                                                         FROM files
+                                                                         WHERE deleted_at IS NULL AND name = $1 AND owner = $2
+                                                                         ORDER BY id DESC
+                                                                         LIMIT 1)`
 	getLastVersionFileByNameAndOwnerQuery = `SELECT DISTINCT ON (name) *
 FROM (SELECT *
       FROM files f
@@ -29,33 +39,130 @@ FROM (SELECT *
       WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND f.name = $1 AND f.owner = $2
       ORDER BY f.updated_at DESC) as T;`
 	getFileByVersionQuery = `SELECT f.*, u.* FROM files f JOIN users u on f.owner = u.email WHERE f.id = $1`
-	insertFileQuery       = `INSERT INTO files (name, owner) VALUES ($1, $2) RETURNING *;`
-	setGDriveIdQuery      = `UPDATE files SET gdrive_id = $1 WHERE id = $2`
-	deleteFileQuery       = "UPDATE files SET deleted_at = NOW() WHERE name = $1 AND owner = $2"
+	// The versions without permissions keep the ones of the file's last version, and the new files get the default ones
+	insertFileQuery     = `INSERT INTO files (name, owner, folder, permissions_str) VALUES ($1, $2, $3, ` + insertedPermissions + `) RETURNING *;`
+	insertedPermissions = `COALESCE(NULLIF($4, ''), (SELECT permissions_str
+                                FROM files
+                                WHERE deleted_at IS NULL AND name = $1 AND owner = $2
+                                ORDER BY updated_at DESC
+                                LIMIT 1), 'rw-r--r--')`
+	setGDriveIdQuery    = `UPDATE files SET gdrive_id = $1 WHERE id = $2`
+	setBlobQuery        = `UPDATE files SET blob_id = $1 WHERE id = $2`
+	setSizeQuery        = `UPDATE files SET size = $1, stored_size = $2 WHERE id = $3`
+	setChecksumQuery    = `UPDATE files SET checksum = $1 WHERE id = $2`
+	setCompressionQuery = `UPDATE files SET compression = $1 WHERE id = $2`
+	// Deleting a file moves it to the trash, with all its versions. The logical file and its versions get the same
+	// deletion date, which tells apart the versions deleted before.
+	trashLogicalFileQuery = `UPDATE logical_files SET deleted_at = NOW()
+WHERE deleted_at IS NULL AND id = (SELECT logical_id
+                                   FROM files
+                                   WHERE deleted_at IS NULL AND name = $1 AND owner = $2
+                                   ORDER BY id DESC
+                                   LIMIT 1)
+RETURNING id`
+	deleteFileQuery = `UPDATE files SET deleted_at = NOW() WHERE logical_id = $1 AND deleted_at IS NULL`
+	// The trashed files are shown by the last version they had when they were deleted
+	getTrashedFilesQuery = `SELECT f.*, u.*
+FROM logical_files l
+  JOIN files f ON f.id = (SELECT v.id
+                          FROM files v
+                          WHERE v.logical_id = l.id AND v.deleted_at = l.deleted_at
+                          ORDER BY v.updated_at DESC, v.id DESC
+                          LIMIT 1)
+  JOIN users u ON f.owner = u.email
+WHERE l.deleted_at IS NOT NULL`
+	getTrashQuery           = getTrashedFilesQuery + ` AND l.owner = $1 ORDER BY l.deleted_at DESC`
+	getTrashedFileQuery     = getTrashedFilesQuery + ` AND l.id = $1 AND l.owner = $2`
+	getExpiredTrashQuery    = getTrashedFilesQuery + ` AND l.deleted_at <= $1 ORDER BY l.deleted_at LIMIT $2`
+	getTrashedVersionsQuery = `SELECT f.*, u.*
+FROM files f
+  JOIN logical_files l ON f.logical_id = l.id
+  JOIN users u ON f.owner = u.email
+WHERE l.id = $1 AND f.deleted_at = l.deleted_at`
+	restoreFileVersionsQuery = `UPDATE files f SET deleted_at = NULL
+FROM logical_files l
+WHERE l.id = $1 AND l.owner = $2 AND f.logical_id = l.id AND f.deleted_at = l.deleted_at`
+	restoreLogicalFileQuery = `UPDATE logical_files SET deleted_at = NULL WHERE id = $1 AND owner = $2 AND deleted_at IS NOT NULL`
+	// Only the old versions are pruned, and never the ones in the trash
+	deleteFileVersionQuery = `DELETE FROM files WHERE id = $1 AND deleted_at IS NULL`
+	// Purging a trashed file removes all its versions and their chunks' records
+	purgeLogicalFileQuery = `DELETE FROM logical_files WHERE id = $1 AND deleted_at IS NOT NULL`
+	// Moving a file keeps the date of its versions, as the files' trigger doesn't change it when the path changes
+	moveFileQuery = `UPDATE files SET name = $1, folder = $2 WHERE logical_id = $3 AND deleted_at IS NULL`
+	// Neither does changing its permissions, which all its versions share
+	setPermissionsQuery = `UPDATE files SET permissions_str = $1 WHERE logical_id = $2 AND deleted_at IS NULL`
+
+	// Every version takes its own space, even if it shares its content with others. The current version of each live
+	// file is the last one, and the versions deleted before the trash existed are not counted, as their content is gone.
+	getUsageQuery = `SELECT category, COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(stored_size), 0)
+FROM (SELECT
+        f.size,
+        f.stored_size,
+        CASE WHEN f.deleted_at IS NOT NULL
+          THEN 'trash'
+        WHEN ROW_NUMBER() OVER (PARTITION BY f.logical_id, f.deleted_at IS NULL ORDER BY f.updated_at DESC, f.id DESC) = 1
+          THEN 'live'
+        ELSE 'old_versions' END AS category
+      FROM files f
+        JOIN logical_files l ON f.logical_id = l.id
+      WHERE f.owner = $1 AND (f.deleted_at IS NULL OR f.deleted_at = l.deleted_at)) AS v
+GROUP BY category`
+	// The versions uploaded before the deduplication were left without size by the migration that added it, as only
+	// the storage knows it. Every stored blob takes some space, so the versions without a stored size are the ones to
+	// backfill. The files of the deleted users are skipped, as their keys are gone.
+	getUnsizedLegacyVersionsQuery = `SELECT f.*, u.*
+FROM files f
+  JOIN users u ON f.owner = u.email
+WHERE f.blob_id IS NULL AND NOT f.chunked AND f.stored_size = 0 AND u.deleted_at IS NULL AND f.id > $1
+ORDER BY f.id
+LIMIT $2`
+
+	insertChunkedFileQuery = `INSERT INTO files (name, owner, folder, permissions_str, chunked) VALUES ($1, $2, $3, ` + insertedPermissions + `, TRUE) RETURNING *;`
+	// Every position of the manifest takes a reference to its chunk, even if it's repeated
+	acquireChunkQuery    = `UPDATE blobs SET ref_count = ref_count + 1 WHERE owner = $1 AND hash = $2 AND stored RETURNING id`
+	insertFileChunkQuery = `INSERT INTO file_chunks (file_id, position, blob_id) VALUES ($1, $2, $3)`
 )
 
 type (
 	FileDao interface {
-		GetAllByOwner(user *models.User) ([]models.File, error)
+		GetAllByOwner(user *models.User, folder null.String) ([]models.File, error)
 		GetVersionsByNameAndOwner(filename string, user *models.User) ([]models.File, error)
 		GetLastVersionFileByNameAndOwner(filename string, user *models.User) (models.File, error)
 		GetFileByVersion(id int64) (models.File, error)
 		Create(f *models.File) (models.File, error)
+		CreateChunked(f *models.File, chunkHashes []string) (models.File, error)
 		SetGdriveId(id int64, gdriveId string) error
+		SetBlob(id int64, blobId int64) error
+		SetSize(id int64, size int64, storedSize int64) error
+		SetChecksum(id int64, checksum string) error
+		SetCompression(id int64, compression string) error
+		Move(logicalId int64, name string, folder string) error
+		SetPermissions(logicalId int64, permissionsStr string) error
 		Delete(filename string, user *models.User) error
+		GetTrash(owner string) ([]models.File, error)
+		GetTrashedFile(logicalId int64, owner string) (models.File, error)
+		GetTrashedVersions(logicalId int64) ([]models.File, error)
+		GetExpiredTrash(deletedBefore time.Time, limit int) ([]models.File, error)
+		Restore(logicalId int64, owner string) error
+		Purge(logicalId int64) error
+		DeleteVersion(id int64) error
+		GetUsage(owner string) (models.Usage, error)
+		GetUnsizedLegacyVersions(afterId int64, limit int) ([]models.File, error)
 	}
 
 	FilePgDao struct {
 	}
 )
 
-func (dao FilePgDao) GetAllByOwner(user *models.User) ([]models.File, error) {
+// GetAllByOwner returns the last version of the user's files. If the folder is given, only the ones directly inside it
+// are returned.
+func (dao FilePgDao) GetAllByOwner(user *models.User, folder null.String) ([]models.File, error) {
 	logs.DaoLog.Debug("GetAllByOwner")
 	res, err := withDb(func(db *sql.DB) (interface{}, error) {
 		files := make([]models.File, 0)
-		rows, err := db.Query(getAllFilesByOwnerQuery, user.Email)
+		rows, err := db.Query(getAllFilesByOwnerQuery, user.Email, folder)
 		if err != nil {
-			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetAllByOwner(user *models.User) query. Reason: %v", err)
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetAllByOwner(user *models.User, folder null.String) query. Reason: %v", err)
 			return nil, err
 		}
 
@@ -63,7 +170,7 @@ func (dao FilePgDao) GetAllByOwner(user *models.User) ([]models.File, error) {
 			var file models.File
 			err := scanFileRowWithUser(rows, &file)
 			if err != nil {
-				logs.DaoLog.Errorf("Unable to execute FilePgDao.GetAllByOwner(user *models.User) query. Reason: %v", err)
+				logs.DaoLog.Errorf("Unable to execute FilePgDao.GetAllByOwner(user *models.User, folder null.String) query. Reason: %v", err)
 				return nil, err
 			}
 			files = append(files, file)
@@ -137,7 +244,7 @@ func (dao FilePgDao) Create(file *models.File) (models.File, error) {
 	logs.DaoLog.Debug("Create")
 	res, err := withDb(func(db *sql.DB) (interface{}, error) {
 		var createdFile models.File
-		row := db.QueryRow(insertFileQuery, file.Name, file.Owner.Email)
+		row := db.QueryRow(insertFileQuery, file.Name, file.Owner.Email, file.Folder, file.PermissionsStr)
 		err := scanFileRow(row, &createdFile)
 		if err != nil {
 			logs.DaoLog.Errorf("Unable to execute FilePgDao.Create(file models.File) query. Reason: %v", err)
@@ -151,6 +258,44 @@ func (dao FilePgDao) Create(file *models.File) (models.File, error) {
 	return res.(models.File), err
 }
 
+// CreateChunked creates a file made of the owner's chunks with the given hashes, in that order. If any of them isn't
+// stored, nothing is created and MissingChunkError is returned.
+func (dao FilePgDao) CreateChunked(file *models.File, chunkHashes []string) (models.File, error) {
+	logs.DaoLog.Debug("CreateChunked")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var createdFile models.File
+		err := withTx(db, func(tx *sql.Tx) error {
+			err := scanFileRow(tx.QueryRow(insertChunkedFileQuery, file.Name, file.Owner.Email, file.Folder, file.PermissionsStr), &createdFile)
+			if err != nil {
+				return err
+			}
+			for position, hash := range chunkHashes {
+				var blobId int64
+				err := tx.QueryRow(acquireChunkQuery, file.Owner.Email, hash).Scan(&blobId)
+				if err == sql.ErrNoRows {
+					return MissingChunkError
+				}
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(insertFileChunkQuery, createdFile.Id, position, blobId); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.CreateChunked(file models.File, chunkHashes []string) query. Reason: %v", err)
+			return models.File{}, err
+		}
+		logs.DaoLog.Infof("Created file with %v chunks: %v", len(chunkHashes), createdFile)
+		owner, err := UserPgDao{}.GetByPk(createdFile.Owner.Email)
+		createdFile.Owner = owner
+		return createdFile, err
+	})
+	return res.(models.File), err
+}
+
 func (dao FilePgDao) SetGdriveId(id int64, gdriveId string) error {
 	logs.DaoLog.Debug("SetGdriveId")
 	_, err := withDb(func(db *sql.DB) (interface{}, error) {
@@ -178,33 +323,359 @@ func (dao FilePgDao) SetGdriveId(id int64, gdriveId string) error {
 	return err
 }
 
+func (dao FilePgDao) SetBlob(id int64, blobId int64) error {
+	logs.DaoLog.Debug("SetBlob")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(setBlobQuery, blobId, id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.SetBlob(id int64, blobId int64) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = errors.New("not found")
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to set %v's file blob "%v". Reason %v`, id, blobId, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`%v's file blob "%v" successfully set.`, id, blobId))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// SetSize records the plaintext size of the version's content, and the size it takes in the storage
+func (dao FilePgDao) SetSize(id int64, size int64, storedSize int64) error {
+	logs.DaoLog.Debug("SetSize")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(setSizeQuery, size, storedSize, id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.SetSize(id int64, size int64, storedSize int64) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = errors.New("not found")
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to set %v's file size. Reason %v`, id, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`%v's file size %v successfully set.`, id, size))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// SetChecksum records the SHA-256 checksum of the version's content
+func (dao FilePgDao) SetChecksum(id int64, checksum string) error {
+	logs.DaoLog.Debug("SetChecksum")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(setChecksumQuery, checksum, id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.SetChecksum(id int64, checksum string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = errors.New("not found")
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to set %v's file checksum "%v". Reason %v`, id, checksum, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`%v's file checksum "%v" successfully set.`, id, checksum))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// SetCompression records the codec that the version's blob was compressed with
+func (dao FilePgDao) SetCompression(id int64, compression string) error {
+	logs.DaoLog.Debug("SetCompression")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(setCompressionQuery, compression, id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.SetCompression(id int64, compression string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = errors.New("not found")
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to set %v's file compression "%v". Reason %v`, id, compression, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`%v's file compression "%v" successfully set.`, id, compression))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// Move renames all the versions of the logical file, or moves them to another folder
+func (dao FilePgDao) Move(logicalId int64, name string, folder string) error {
+	logs.DaoLog.Debug("Move")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(moveFileQuery, name, folder, logicalId)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.Move(logicalId int64, name string, folder string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to move file %v to "%v". Reason %v`, logicalId, name, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`File %v successfully moved to "%v", with its %v versions.`, logicalId, name, rowsAffected))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// SetPermissions changes the permissions of all the file's versions
+func (dao FilePgDao) SetPermissions(logicalId int64, permissionsStr string) error {
+	logs.DaoLog.Debug("SetPermissions")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(setPermissionsQuery, permissionsStr, logicalId)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.SetPermissions(logicalId int64, permissionsStr string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to set the permissions of file %v to "%v". Reason %v`, logicalId, permissionsStr, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`Permissions of file %v successfully set to "%v", in its %v versions.`, logicalId, permissionsStr, rowsAffected))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// Delete moves the file to the trash, with all its versions
 func (dao FilePgDao) Delete(filename string, user *models.User) error {
 	logs.DaoLog.Debug("Delete")
 	_, err := withDb(func(db *sql.DB) (interface{}, error) {
-		result, err := db.Exec(deleteFileQuery, filename, user.Email)
+		err := withTx(db, func(tx *sql.Tx) error {
+			var logicalId int64
+			if err := tx.QueryRow(trashLogicalFileQuery, filename, user.Email).Scan(&logicalId); err != nil {
+				return err
+			}
+			_, err := tx.Exec(deleteFileQuery, logicalId)
+			return err
+		})
 		if err != nil {
-			logs.DaoLog.Error("Unable to execute FilePgDao.Delete(id int64) query. Reason:", err)
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to delete %v's' file "%v". Reason %v`, user.Email, filename, err))
 		} else {
-			var rowsAffected int64
-			rowsAffected, err = result.RowsAffected()
+			logs.DaoLog.Info(fmt.Sprintf(`%v's' file "%v" successfully deleted.`, user.Email, filename))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// GetTrash returns the last version of the owner's trashed files, the most recently deleted first
+func (dao FilePgDao) GetTrash(owner string) ([]models.File, error) {
+	logs.DaoLog.Debug("GetTrash")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		files, err := queryFiles(db, getTrashQuery, owner)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetTrash(owner string) query. Reason: %v", err)
+		}
+		return files, err
+	})
+	return res.([]models.File), err
+}
+
+// GetTrashedFile returns the last version of the owner's trashed file
+func (dao FilePgDao) GetTrashedFile(logicalId int64, owner string) (models.File, error) {
+	logs.DaoLog.Debug("GetTrashedFile")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var file models.File
+		err := scanFileRowWithUser(db.QueryRow(getTrashedFileQuery, logicalId, owner), &file)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute FilePgDao.GetTrashedFile(logicalId int64, owner string) query. Reason: %v", err)
+		}
+		return file, err
+	})
+	return res.(models.File), err
+}
+
+// GetTrashedVersions returns the versions the file had when it was moved to the trash
+func (dao FilePgDao) GetTrashedVersions(logicalId int64) ([]models.File, error) {
+	logs.DaoLog.Debug("GetTrashedVersions")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		files, err := queryFiles(db, getTrashedVersionsQuery, logicalId)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetTrashedVersions(logicalId int64) query. Reason: %v", err)
+		}
+		return files, err
+	})
+	return res.([]models.File), err
+}
+
+// GetExpiredTrash returns the last version of the files moved to the trash before the given date, of every owner
+func (dao FilePgDao) GetExpiredTrash(deletedBefore time.Time, limit int) ([]models.File, error) {
+	logs.DaoLog.Debug("GetExpiredTrash")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		files, err := queryFiles(db, getExpiredTrashQuery, deletedBefore, limit)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetExpiredTrash(deletedBefore time.Time, limit int) query. Reason: %v", err)
+		}
+		return files, err
+	})
+	return res.([]models.File), err
+}
+
+// Restore takes the owner's file out of the trash, with the versions it had when it was deleted
+func (dao FilePgDao) Restore(logicalId int64, owner string) error {
+	logs.DaoLog.Debug("Restore")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		err := withTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(restoreFileVersionsQuery, logicalId, owner); err != nil {
+				return err
+			}
+			result, err := tx.Exec(restoreLogicalFileQuery, logicalId, owner)
 			if err != nil {
-				logs.DaoLog.Error("Some error occured during deleting:", err)
-			} else {
-				if rowsAffected == 0 {
-					err = errors.New("not found")
-				}
-				if err != nil {
-					logs.DaoLog.Info(fmt.Sprintf(`Unable to delete %v's' file "%v". Reason %v`, user.Email, filename, err))
-				} else {
-					logs.DaoLog.Info(fmt.Sprintf(`%v's' file "%v" successfully deleted.`, user.Email, filename))
-				}
+				return err
 			}
+			rowsAffected, err := result.RowsAffected()
+			if err == nil && rowsAffected == 0 {
+				err = sql.ErrNoRows
+			}
+			return err
+		})
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to restore %v's file %v. Reason %v`, owner, logicalId, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`%v's file %v successfully restored.`, owner, logicalId))
 		}
 		return nil, err
 	})
 	return err
 }
 
+// Purge removes the trashed file's records for good. Its blobs must be released apart.
+func (dao FilePgDao) Purge(logicalId int64) error {
+	logs.DaoLog.Debug("Purge")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(purgeLogicalFileQuery, logicalId)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.Purge(logicalId int64) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to purge file %v. Reason %v`, logicalId, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`File %v successfully purged.`, logicalId))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// DeleteVersion removes the version's records for good. Its blobs must be released apart.
+func (dao FilePgDao) DeleteVersion(id int64) error {
+	logs.DaoLog.Debug("DeleteVersion")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(deleteFileVersionQuery, id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.DeleteVersion(id int64) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			logs.DaoLog.Info(fmt.Sprintf(`Unable to delete file version %v. Reason %v`, id, err))
+		} else {
+			logs.DaoLog.Info(fmt.Sprintf(`File version %v successfully deleted.`, id))
+		}
+		return nil, err
+	})
+	return err
+}
+
+// GetUsage returns the space taken by the owner's live files, their old versions and the trashed files
+func (dao FilePgDao) GetUsage(owner string) (models.Usage, error) {
+	logs.DaoLog.Debug("GetUsage")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var usage models.Usage
+		rows, err := db.Query(getUsageQuery, owner)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetUsage(owner string) query. Reason: %v", err)
+			return usage, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var category string
+			var storageUsage models.StorageUsage
+			if err := rows.Scan(&category, &storageUsage.Versions, &storageUsage.Size, &storageUsage.StoredSize); err != nil {
+				logs.DaoLog.Errorf("Unable to execute FilePgDao.GetUsage(owner string) scan. Reason: %v", err)
+				return usage, err
+			}
+			switch category {
+			case "live":
+				usage.Live = storageUsage
+			case "old_versions":
+				usage.OldVersions = storageUsage
+			case "trash":
+				usage.Trash = storageUsage
+			}
+		}
+		return usage, rows.Err()
+	})
+	if err != nil {
+		return models.Usage{}, err
+	}
+	return res.(models.Usage), err
+}
+
+// GetUnsizedLegacyVersions returns the versions stored before the blobs whose size isn't known yet, along with their
+// owner, sorted by ID
+func (dao FilePgDao) GetUnsizedLegacyVersions(afterId int64, limit int) ([]models.File, error) {
+	logs.DaoLog.Debug("GetUnsizedLegacyVersions")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		files, err := queryFiles(db, getUnsizedLegacyVersionsQuery, afterId, limit)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FilePgDao.GetUnsizedLegacyVersions(afterId int64, limit int) query. Reason: %v", err)
+		}
+		return files, err
+	})
+	return res.([]models.File), err
+}
+
+// queryFiles returns the files, along with their owner, of a query
+func queryFiles(db *sql.DB, query string, args ...interface{}) ([]models.File, error) {
+	files := make([]models.File, 0)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return files, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var file models.File
+		if err := scanFileRowWithUser(rows, &file); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
 func scanFileRow(scanner polimorphicScanner, file *models.File) error {
 	logs.DaoLog.Debug("scanFileRow")
 	err := scanner.Scan(&file.Id,
@@ -214,7 +685,15 @@ func scanFileRow(scanner polimorphicScanner, file *models.File) error {
 		&file.Name,
 		&file.Owner.Email,
 		&file.PermissionsStr,
-		&file.GdriveID)
+		&file.GdriveID,
+		&file.BlobId,
+		&file.Chunked,
+		&file.Folder,
+		&file.LogicalId,
+		&file.Size,
+		&file.StoredSize,
+		&file.Checksum,
+		&file.Compression)
 	return err
 }
 
@@ -228,6 +707,14 @@ func scanFileRowWithUser(scanner polimorphicScanner, file *models.File) error {
 		&file.Owner.Email,
 		&file.PermissionsStr,
 		&file.GdriveID,
+		&file.BlobId,
+		&file.Chunked,
+		&file.Folder,
+		&file.LogicalId,
+		&file.Size,
+		&file.StoredSize,
+		&file.Checksum,
+		&file.Compression,
 		// user
 		&file.Owner.CreatedAt,
 		&file.Owner.UpdatedAt,
@@ -235,6 +722,10 @@ func scanFileRowWithUser(scanner polimorphicScanner, file *models.File) error {
 		&file.Owner.Email,
 		&file.Owner.Password,
 		&file.Owner.TwoFactorAuth,
-		&file.Owner.TwoFactorTime)
+		&file.Owner.TwoFactorTime,
+		&file.Owner.Quota,
+		&file.Owner.Role,
+		&file.Owner.DisabledAt,
+		&file.Owner.TokensRevokedAt)
 	return err
 }
@@ -1,7 +1,9 @@
 package dao
 
 import (
+	"database/sql"
 	"testing"
+	"time"
 
 	"mantecabox/models"
 	"mantecabox/utilities"
@@ -22,7 +24,8 @@ VALUES ('testuser1', 'testpassword1'),
 
 func TestFilePgDao_GetAllByOwner(t *testing.T) {
 	type args struct {
-		user models.User
+		user   models.User
+		folder null.String
 	}
 	testCases := []struct {
 		name        string
@@ -38,16 +41,16 @@ VALUES ('testfile1a', 'testuser1'),
   ('testfile2a', 'testuser2'),
   ('testfile2b', 'testuser2');`,
 			[]models.File{
-				{Name: "testfile1a", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}, PermissionsStr: "rw-r--r--"},
-				{Name: "testfile1b", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}, PermissionsStr: "rw-r--r--"},
+				{Name: "testfile1a", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, PermissionsStr: "rw-r--r--"},
+				{Name: "testfile1b", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, PermissionsStr: "rw-r--r--"},
 			},
-			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}},
+			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, null.String{}},
 		},
 		{
 			"When the files table is empty, retrieve an empty set",
 			``,
 			[]models.File{},
-			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}},
+			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, null.String{}},
 		},
 		{
 			"When the files table has some deleted users, don't retrieve them",
@@ -57,9 +60,21 @@ VALUES (NULL, 'testfile1a', 'testuser1'),
   (NULL, 'testfile2a', 'testuser2'),
   (NOW(), 'testfile2b', 'testuser2');`,
 			[]models.File{
-				{Name: "testfile1a", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}, PermissionsStr: "rw-r--r--"},
+				{Name: "testfile1a", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, PermissionsStr: "rw-r--r--"},
 			},
-			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}},
+			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, null.String{}},
+		},
+		{
+			"When a folder is given, retrieve only the files directly inside it",
+			testUsersInsertQuery + `INSERT INTO files (name, owner, folder)
+VALUES ('testfile1a', 'testuser1', ''),
+  ('docs/testfile1b', 'testuser1', 'docs'),
+  ('docs/old/testfile1c', 'testuser1', 'docs/old'),
+  ('docs/testfile2a', 'testuser2', 'docs');`,
+			[]models.File{
+				{Name: "docs/testfile1b", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, PermissionsStr: "rw-r--r--", Folder: "docs"},
+			},
+			args{models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, null.StringFrom("docs")},
 		},
 	}
 
@@ -71,7 +86,7 @@ VALUES (NULL, 'testfile1a', 'testuser1'),
 
 		t.Run(testCase.name, func(t *testing.T) {
 			dao := FilePgDao{}
-			got, err := dao.GetAllByOwner(&testCase.args.user)
+			got, err := dao.GetAllByOwner(&testCase.args.user, testCase.args.folder)
 			require.NoError(t, err)
 
 			// We ignore the timestamps as we don't need to get them compared
@@ -94,6 +109,7 @@ VALUES (NULL, 'testfile1a', 'testuser1'),
 				got[k].Owner.UpdatedAt = null.Time{}
 
 				got[k].Id = 0
+				got[k].LogicalId = 0
 			}
 			require.Equal(t, testCase.want, got)
 		})
@@ -116,7 +132,7 @@ func TestFilePgDao_GetByPk(t *testing.T) {
 			testFileInsertQuery,
 			args{"testfile1a", &models.User{Credentials: models.Credentials{Email: "testuser1"}}},
 			[]models.File{
-				{Name: "testfile1a", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}, PermissionsStr: "rw-r--r--"},
+				{Name: "testfile1a", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, PermissionsStr: "rw-r--r--"},
 			},
 		},
 		{
@@ -159,6 +175,7 @@ func TestFilePgDao_GetByPk(t *testing.T) {
 				got[k].Owner.UpdatedAt = null.Time{}
 
 				got[k].Id = 0
+				got[k].LogicalId = 0
 			}
 			require.Equal(t, testCase.want, got)
 		})
@@ -166,11 +183,13 @@ func TestFilePgDao_GetByPk(t *testing.T) {
 }
 
 func TestFilePgDao_Create(t *testing.T) {
-	file := models.File{Name: "testfile", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}, PermissionsStr: "rw-r--r--"}
+	file := models.File{Name: "testfile", Owner: models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}, PermissionsStr: "rw-r--r--"}
 	fileWithoutName := file
 	fileWithoutName.Name = ""
 	fileWithoutOwner := file
 	fileWithoutOwner.Owner = models.User{}
+	executableFile := file
+	executableFile.PermissionsStr = "rwxr-x---"
 
 	type args struct {
 		file *models.File
@@ -189,6 +208,13 @@ func TestFilePgDao_Create(t *testing.T) {
 			file,
 			false,
 		},
+		{
+			"When you create a new file with its permissions, they get inserted",
+			testUsersInsertQuery,
+			args{file: &executableFile},
+			executableFile,
+			false,
+		},
 		{
 			"When you create a new file without filename, return an empty file and an error",
 			testUsersInsertQuery,
@@ -273,6 +299,116 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestFilePgDao_SetBlob(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	var fileId int64
+	require.NoError(t, db.QueryRow(testFileInsertQuery).Scan(&fileId))
+	blob, err := BlobPgDao{}.Acquire(&models.Blob{Owner: "testuser1", Hash: testBlobHash, Size: 4})
+	require.NoError(t, err)
+
+	dao := FilePgDao{}
+	require.NoError(t, dao.SetBlob(fileId, blob.Id))
+	file, err := dao.GetFileByVersion(fileId)
+	require.NoError(t, err)
+	require.Equal(t, null.IntFrom(blob.Id), file.BlobId)
+
+	require.Error(t, dao.SetBlob(fileId+1, blob.Id))
+}
+
+func TestFilePgDao_SetSize(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	var fileId int64
+	require.NoError(t, db.QueryRow(testFileInsertQuery).Scan(&fileId))
+
+	dao := FilePgDao{}
+	require.NoError(t, dao.SetSize(fileId, 4, 48))
+	file, err := dao.GetFileByVersion(fileId)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), file.Size)
+	require.Equal(t, int64(48), file.StoredSize)
+
+	require.Error(t, dao.SetSize(fileId+1, 4, 48))
+}
+
+func TestFilePgDao_SetChecksum(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	var fileId int64
+	require.NoError(t, db.QueryRow(testFileInsertQuery).Scan(&fileId))
+
+	dao := FilePgDao{}
+	file, err := dao.GetFileByVersion(fileId)
+	require.NoError(t, err)
+	require.False(t, file.Checksum.Valid)
+	require.NoError(t, dao.SetChecksum(fileId, testChecksum))
+	file, err = dao.GetFileByVersion(fileId)
+	require.NoError(t, err)
+	require.Equal(t, null.StringFrom(testChecksum), file.Checksum)
+
+	require.Error(t, dao.SetChecksum(fileId+1, testChecksum))
+}
+
+func TestFilePgDao_SetCompression(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	var fileId int64
+	require.NoError(t, db.QueryRow(testFileInsertQuery).Scan(&fileId))
+
+	dao := FilePgDao{}
+	file, err := dao.GetFileByVersion(fileId)
+	require.NoError(t, err)
+	require.Empty(t, file.Compression)
+	require.NoError(t, dao.SetCompression(fileId, "gzip"))
+	file, err = dao.GetFileByVersion(fileId)
+	require.NoError(t, err)
+	require.Equal(t, "gzip", file.Compression)
+
+	require.Error(t, dao.SetCompression(fileId+1, "gzip"))
+}
+
+func TestFilePgDao_CreateChunked(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	const otherHash = "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+	blobDao := BlobPgDao{}
+	for _, hash := range []string{testBlobHash, otherHash} {
+		blob, err := blobDao.Store(&models.Blob{Owner: "testuser1", Hash: hash, Size: 4})
+		require.NoError(t, err)
+		require.NoError(t, blobDao.MarkStored(blob.Id, "", 4))
+	}
+	dao := FilePgDao{}
+	file := &models.File{Name: "chunked.img", Owner: models.User{Credentials: models.Credentials{Email: "testuser1"}}}
+
+	createdFile, err := dao.CreateChunked(file, []string{otherHash, testBlobHash, otherHash})
+	require.NoError(t, err)
+	require.True(t, createdFile.Chunked)
+	require.Equal(t, "testuser1", createdFile.Owner.Email)
+	chunks, err := blobDao.GetFileChunks(createdFile.Id)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	require.Equal(t, []string{otherHash, testBlobHash, otherHash}, []string{chunks[0].Hash, chunks[1].Hash, chunks[2].Hash})
+	// Every position holds a reference
+	require.Equal(t, int64(2), chunks[0].RefCount)
+	require.Equal(t, int64(1), chunks[1].RefCount)
+
+	// If a chunk is missing, nothing is created
+	_, err = dao.CreateChunked(file, []string{testBlobHash, "0000000000000000000000000000000000000000000000000000000000000000"})
+	require.Equal(t, MissingChunkError, err)
+	versions, err := dao.GetVersionsByNameAndOwner(file.Name, &file.Owner)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	chunks, err = blobDao.GetFileChunks(createdFile.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), chunks[1].RefCount)
+}
+
 func requireFileEqualCheckingErrors(t *testing.T, wantErr bool, err error, expected models.File, actual models.File) {
 	if wantErr {
 		require.Error(t, err)
@@ -296,3 +432,210 @@ func requireFileEqualCheckingErrors(t *testing.T, wantErr bool, err error, expec
 	require.Equal(t, expected.Owner.Email, actual.Owner.Email)
 	require.Equal(t, expected.Owner.Password, actual.Owner.Password)
 }
+
+func TestFilePgDao_Move(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at)
+VALUES ('testfile1a', 'testuser1', '2018-06-01'),
+  ('testfile1a', 'testuser1', '2018-06-02'),
+  ('testfile1b', 'testuser1', '2018-06-03');`, t)
+	dao := FilePgDao{}
+	user := &models.User{Credentials: models.Credentials{Email: "testuser1"}}
+
+	versions, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	// All the versions with the same path belong to the same logical file
+	require.Equal(t, versions[0].LogicalId, versions[1].LogicalId)
+
+	require.NoError(t, dao.Move(versions[0].LogicalId, "docs/testfile1c", "docs"))
+	moved, err := dao.GetVersionsByNameAndOwner("docs/testfile1c", user)
+	require.NoError(t, err)
+	require.Len(t, moved, 2)
+	updatedAt := map[int64]null.Time{versions[0].Id: versions[0].UpdatedAt, versions[1].Id: versions[1].UpdatedAt}
+	for _, version := range moved {
+		require.Equal(t, "docs", version.Folder)
+		// The versions keep their dates
+		require.Equal(t, updatedAt[version.Id], version.UpdatedAt)
+	}
+	_, err = dao.GetLastVersionFileByNameAndOwner("testfile1a", user)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	// The new versions are added to the moved file
+	created, err := dao.Create(&models.File{Name: "docs/testfile1c", Owner: *user, Folder: "docs"})
+	require.NoError(t, err)
+	require.Equal(t, versions[0].LogicalId, created.LogicalId)
+
+	require.Equal(t, sql.ErrNoRows, dao.Move(-1, "testfile1d", ""))
+}
+
+func TestFilePgDao_SetPermissions(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at)
+VALUES ('testfile1a', 'testuser1', '2018-06-01'),
+  ('testfile1a', 'testuser1', '2018-06-02');`, t)
+	dao := FilePgDao{}
+	user := &models.User{Credentials: models.Credentials{Email: "testuser1"}}
+
+	versions, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.NoError(t, dao.SetPermissions(versions[0].LogicalId, "rw-rw----"))
+	changed, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	updatedAt := map[int64]null.Time{versions[0].Id: versions[0].UpdatedAt, versions[1].Id: versions[1].UpdatedAt}
+	for _, version := range changed {
+		require.Equal(t, "rw-rw----", version.PermissionsStr)
+		// The versions keep their dates
+		require.Equal(t, updatedAt[version.Id], version.UpdatedAt)
+	}
+
+	// The new versions keep the file's permissions, unless they are given
+	created, err := dao.Create(&models.File{Name: "testfile1a", Owner: *user})
+	require.NoError(t, err)
+	require.Equal(t, "rw-rw----", created.PermissionsStr)
+	created, err = dao.Create(&models.File{Name: "testfile1a", Owner: *user, PermissionsStr: "rw-------"})
+	require.NoError(t, err)
+	require.Equal(t, "rw-------", created.PermissionsStr)
+	created, err = dao.Create(&models.File{Name: "testfile1b", Owner: *user})
+	require.NoError(t, err)
+	require.Equal(t, "rw-r--r--", created.PermissionsStr)
+
+	require.Equal(t, sql.ErrNoRows, dao.SetPermissions(-1, "rw-rw----"))
+}
+
+func TestFilePgDao_Trash(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at)
+VALUES ('testfile1a', 'testuser1', '2018-06-01'),
+  ('testfile1a', 'testuser1', '2018-06-02'),
+  ('testfile1b', 'testuser1', '2018-06-03');`, t)
+	dao := FilePgDao{}
+	user := &models.User{Credentials: models.Credentials{Email: "testuser1"}}
+
+	versions, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	last, err := dao.GetLastVersionFileByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.NoError(t, dao.Delete("testfile1a", user))
+	_, err = dao.GetLastVersionFileByNameAndOwner("testfile1a", user)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	// The trashed file is shown by its last version, and keeps all of them
+	trash, err := dao.GetTrash("testuser1")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, last.Id, trash[0].Id)
+	require.True(t, trash[0].DeletedAt.Valid)
+	trashedVersions, err := dao.GetTrashedVersions(last.LogicalId)
+	require.NoError(t, err)
+	require.Len(t, trashedVersions, len(versions))
+	_, err = dao.GetTrashedFile(last.LogicalId, "testuser2")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	expired, err := dao.GetExpiredTrash(time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, expired)
+	expired, err = dao.GetExpiredTrash(time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+
+	// Restoring the file brings back all its versions, with their dates
+	require.Equal(t, sql.ErrNoRows, dao.Restore(last.LogicalId, "testuser2"))
+	require.NoError(t, dao.Restore(last.LogicalId, "testuser1"))
+	restored, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.ElementsMatch(t, versions, restored)
+	trash, err = dao.GetTrash("testuser1")
+	require.NoError(t, err)
+	require.Empty(t, trash)
+
+	// Purging the file removes all its versions
+	require.NoError(t, dao.Delete("testfile1a", user))
+	require.NoError(t, dao.Purge(last.LogicalId))
+	_, err = dao.GetTrashedFile(last.LogicalId, "testuser1")
+	require.Equal(t, sql.ErrNoRows, err)
+	_, err = dao.GetFileByVersion(last.Id)
+	require.Equal(t, sql.ErrNoRows, err)
+	require.Equal(t, sql.ErrNoRows, dao.Purge(last.LogicalId))
+}
+
+func TestFilePgDao_DeleteVersion(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at)
+VALUES ('testfile1a', 'testuser1', '2018-06-01'),
+  ('testfile1a', 'testuser1', '2018-06-02');`, t)
+	dao := FilePgDao{}
+	user := &models.User{Credentials: models.Credentials{Email: "testuser1"}}
+
+	versions, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.NoError(t, dao.DeleteVersion(versions[0].Id))
+	left, err := dao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.Equal(t, []models.File{versions[1]}, left)
+	require.Equal(t, sql.ErrNoRows, dao.DeleteVersion(versions[0].Id))
+}
+
+func TestFilePgDao_GetUsage(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at, size, stored_size)
+VALUES ('testfile1a', 'testuser1', '2018-06-01', 10, 40),
+  ('testfile1a', 'testuser1', '2018-06-02', 20, 50),
+  ('testfile1a', 'testuser1', '2018-06-03', 30, 60),
+  ('testfile1b', 'testuser1', '2018-06-01', 5, 35),
+  ('testfile1c', 'testuser1', '2018-06-01', 1, 31),
+  ('testfile1c', 'testuser1', '2018-06-02', 2, 32),
+  ('testfile2a', 'testuser2', '2018-06-01', 100, 130);`, t)
+	dao := FilePgDao{}
+	require.NoError(t, dao.Delete("testfile1c", &models.User{Credentials: models.Credentials{Email: "testuser1"}}))
+
+	usage, err := dao.GetUsage("testuser1")
+	require.NoError(t, err)
+	require.Equal(t, models.Usage{
+		Live:        models.StorageUsage{Versions: 2, Size: 35, StoredSize: 95},
+		OldVersions: models.StorageUsage{Versions: 2, Size: 30, StoredSize: 90},
+		Trash:       models.StorageUsage{Versions: 2, Size: 3, StoredSize: 63},
+	}, usage)
+
+	usage, err = dao.GetUsage("testuser3")
+	require.NoError(t, err)
+	require.Equal(t, models.Usage{}, usage)
+}
+
+func TestFilePgDao_GetUnsizedLegacyVersions(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at, size, stored_size, chunked)
+VALUES ('testfile1a', 'testuser1', '2018-06-01', 0, 0, FALSE),
+  ('testfile1b', 'testuser1', '2018-06-01', 4, 48, FALSE),
+  ('testfile1c', 'testuser1', '2018-06-01', 0, 0, TRUE),
+  ('testfile2a', 'testuser2', '2018-06-01', 0, 0, FALSE);`, t)
+	dao := FilePgDao{}
+	versions, err := dao.GetUnsizedLegacyVersions(0, 10)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "testfile1a", versions[0].Name)
+	require.Equal(t, "testuser1", versions[0].Owner.Email)
+	require.Equal(t, "testfile2a", versions[1].Name)
+
+	// Sizing a version doesn't change its date, which decides which one is the last
+	require.NoError(t, dao.SetSize(versions[0].Id, 0, 16))
+	file, err := dao.GetFileByVersion(versions[0].Id)
+	require.NoError(t, err)
+	require.Equal(t, versions[0].UpdatedAt, file.UpdatedAt)
+
+	versions, err = dao.GetUnsizedLegacyVersions(0, 10)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, "testfile2a", versions[0].Name)
+
+	versions, err = dao.GetUnsizedLegacyVersions(versions[0].Id, 10)
+	require.NoError(t, err)
+	require.Empty(t, versions)
+}
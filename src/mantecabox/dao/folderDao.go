@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+var FolderNotEmptyError = errors.New("the folder is not empty")
+
+const (
+	// Creating a folder that already exists just returns it
+	insertFolderQuery = `INSERT INTO folders (owner, path, parent) VALUES ($1, $2, $3)
+ON CONFLICT (owner, path) DO UPDATE SET parent = EXCLUDED.parent
+RETURNING *`
+	getFolderQuery         = `SELECT * FROM folders WHERE owner = $1 AND path = $2`
+	getFolderChildrenQuery = `SELECT * FROM folders WHERE owner = $1 AND parent = $2 ORDER BY path`
+	// The folder is only deleted if there is nothing inside it
+	deleteEmptyFolderQuery = `DELETE FROM folders f
+WHERE f.owner = $1 AND f.path = $2
+      AND NOT EXISTS(SELECT 1 FROM folders c WHERE c.owner = $1 AND c.parent = $2)
+      AND NOT EXISTS(SELECT 1 FROM files c WHERE c.owner = $1 AND c.folder = $2 AND c.deleted_at IS NULL)`
+)
+
+type (
+	FolderDao interface {
+		Create(folder *models.Folder) (models.Folder, error)
+		GetByPathAndOwner(path string, owner string) (models.Folder, error)
+		GetChildren(path string, owner string) ([]models.Folder, error)
+		DeleteEmpty(path string, owner string) error
+	}
+
+	FolderPgDao struct {
+	}
+)
+
+// Create creates the folder, or returns it if it already exists. Its parent folder must be created before.
+func (dao FolderPgDao) Create(folder *models.Folder) (models.Folder, error) {
+	logs.DaoLog.Debug("Create")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var createdFolder models.Folder
+		row := db.QueryRow(insertFolderQuery, folder.Owner, folder.Path, folder.Parent)
+		err := scanFolderRow(row, &createdFolder)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FolderPgDao.Create(folder models.Folder) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Created folder %v of %v", createdFolder.Path, createdFolder.Owner)
+		}
+		return createdFolder, err
+	})
+	return res.(models.Folder), err
+}
+
+func (dao FolderPgDao) GetByPathAndOwner(path string, owner string) (models.Folder, error) {
+	logs.DaoLog.Debug("GetByPathAndOwner")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var folder models.Folder
+		err := scanFolderRow(db.QueryRow(getFolderQuery, owner, path), &folder)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute FolderPgDao.GetByPathAndOwner(path string, owner string) query. Reason: %v", err)
+		}
+		return folder, err
+	})
+	return res.(models.Folder), err
+}
+
+// GetChildren returns the folders directly inside the given one, sorted by their path
+func (dao FolderPgDao) GetChildren(path string, owner string) ([]models.Folder, error) {
+	logs.DaoLog.Debug("GetChildren")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		folders := make([]models.Folder, 0)
+		rows, err := db.Query(getFolderChildrenQuery, owner, path)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FolderPgDao.GetChildren(path string, owner string) query. Reason: %v", err)
+			return folders, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var folder models.Folder
+			if err := scanFolderRow(rows, &folder); err != nil {
+				logs.DaoLog.Errorf("Unable to execute FolderPgDao.GetChildren(path string, owner string) query. Reason: %v", err)
+				return folders, err
+			}
+			folders = append(folders, folder)
+		}
+		return folders, rows.Err()
+	})
+	return res.([]models.Folder), err
+}
+
+// DeleteEmpty deletes the folder, as long as it has no files nor folders inside. Otherwise, FolderNotEmptyError is
+// returned.
+func (dao FolderPgDao) DeleteEmpty(path string, owner string) error {
+	logs.DaoLog.Debug("DeleteEmpty")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(deleteEmptyFolderQuery, owner, path)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute FolderPgDao.DeleteEmpty(path string, owner string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = FolderNotEmptyError
+		}
+		if err != nil {
+			logs.DaoLog.Infof("Unable to delete %v's folder %v. Reason: %v", owner, path, err)
+		} else {
+			logs.DaoLog.Infof("%v's folder %v successfully deleted", owner, path)
+		}
+		return nil, err
+	})
+	return err
+}
+
+func scanFolderRow(scanner polimorphicScanner, folder *models.Folder) error {
+	return scanner.Scan(&folder.Id,
+		&folder.CreatedAt,
+		&folder.Owner,
+		&folder.Path,
+		&folder.Parent)
+}
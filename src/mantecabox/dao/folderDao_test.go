@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderPgDao_Create(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := FolderPgDao{}
+
+	folder, err := dao.Create(&models.Folder{Owner: "testuser1", Path: "docs", Parent: ""})
+	require.NoError(t, err)
+	require.Equal(t, "docs", folder.Path)
+
+	// Creating it again returns the same folder
+	again, err := dao.Create(&models.Folder{Owner: "testuser1", Path: "docs", Parent: ""})
+	require.NoError(t, err)
+	require.Equal(t, folder.Id, again.Id)
+
+	// The other users' folders are different
+	_, err = dao.GetByPathAndOwner("docs", "testuser2")
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestFolderPgDao_GetChildren(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO folders (owner, path, parent)
+VALUES ('testuser1', 'docs', ''),
+  ('testuser1', 'docs/old', 'docs'),
+  ('testuser1', 'docs/new', 'docs'),
+  ('testuser1', 'docs/new/drafts', 'docs/new'),
+  ('testuser2', 'docs/other', 'docs');`, t)
+
+	children, err := FolderPgDao{}.GetChildren("docs", "testuser1")
+	require.NoError(t, err)
+	paths := make([]string, len(children))
+	for i, child := range children {
+		paths[i] = child.Path
+	}
+	require.Equal(t, []string{"docs/new", "docs/old"}, paths)
+}
+
+func TestFolderPgDao_DeleteEmpty(t *testing.T) {
+	testCases := []struct {
+		name        string
+		insertQuery string
+		wantErr     error
+	}{
+		{
+			"When the folder is empty, delete it",
+			``,
+			nil,
+		},
+		{
+			"When the folder has a subfolder, return an error",
+			`INSERT INTO folders (owner, path, parent) VALUES ('testuser1', 'docs/old', 'docs');`,
+			FolderNotEmptyError,
+		},
+		{
+			"When the folder has a file, return an error",
+			`INSERT INTO files (name, owner, folder) VALUES ('docs/testfile1a', 'testuser1', 'docs');`,
+			FolderNotEmptyError,
+		},
+		{
+			"When the folder only has deleted files, delete it",
+			`INSERT INTO files (deleted_at, name, owner, folder) VALUES (NOW(), 'docs/testfile1a', 'testuser1', 'docs');`,
+			nil,
+		},
+	}
+
+	db := getDb(t)
+	defer db.Close()
+
+	for _, testCase := range testCases {
+		cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO folders (owner, path, parent) VALUES ('testuser1', 'docs', '');`+testCase.insertQuery, t)
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dao := FolderPgDao{}
+			require.Equal(t, testCase.wantErr, dao.DeleteEmpty("docs", "testuser1"))
+			_, err := dao.GetByPathAndOwner("docs", "testuser1")
+			if testCase.wantErr == nil {
+				require.Equal(t, sql.ErrNoRows, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+var GroupNameTakenError = errors.New("there is already a user or a group with the name")
+
+const (
+	// The group's account owns its files. Its password isn't valid base64, so nobody can log in with it.
+	insertGroupAccountQuery = `INSERT INTO users (email, password) VALUES ($1, '!') ON CONFLICT DO NOTHING`
+	insertGroupQuery        = `INSERT INTO groups (name) VALUES ($1) RETURNING *`
+	getAllGroupsQuery       = `SELECT * FROM groups ORDER BY name`
+	getGroupQuery           = `SELECT * FROM groups WHERE name = $1`
+	// Deleting the group's account deletes the group and its members
+	deleteGroupQuery = `DELETE FROM users WHERE email = (SELECT name FROM groups WHERE name = $1)`
+	// The deleted users are not shown as members
+	getGroupMembersQuery = `SELECT m.*
+FROM group_members m
+  JOIN users u ON m.member = u.email
+WHERE u.deleted_at IS NULL AND m.group_name = $1
+ORDER BY m.member`
+	getGroupsByMemberQuery = `SELECT * FROM group_members WHERE member = $1 ORDER BY group_name`
+	getGroupMemberQuery    = `SELECT m.*
+FROM group_members m
+  JOIN users u ON m.member = u.email
+WHERE u.deleted_at IS NULL AND m.group_name = $1 AND m.member = $2`
+	// Adding a member again changes their role
+	saveGroupMemberQuery = `INSERT INTO group_members (group_name, member, role) VALUES ($1, $2, $3)
+ON CONFLICT (group_name, member) DO UPDATE SET role = EXCLUDED.role
+RETURNING *`
+	deleteGroupMemberQuery = `DELETE FROM group_members WHERE group_name = $1 AND member = $2`
+)
+
+type (
+	// GroupDao keeps the groups and their members. Every group has an account in the users' table, named after the
+	// group, which owns the group's files.
+	GroupDao interface {
+		Create(name string) (models.Group, error)
+		GetAll() ([]models.Group, error)
+		Get(name string) (models.Group, error)
+		Delete(name string) error
+		GetMembers(group string) ([]models.GroupMember, error)
+		GetByMember(email string) ([]models.GroupMember, error)
+		GetMember(group string, email string) (models.GroupMember, error)
+		SaveMember(member *models.GroupMember) (models.GroupMember, error)
+		DeleteMember(group string, email string) error
+	}
+
+	GroupPgDao struct {
+	}
+)
+
+// Create creates the group with its account. If there is already a user or a group with the name, GroupNameTakenError
+// is returned.
+func (dao GroupPgDao) Create(name string) (models.Group, error) {
+	logs.DaoLog.Debug("Create")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var group models.Group
+		err := withTx(db, func(tx *sql.Tx) error {
+			result, err := tx.Exec(insertGroupAccountQuery, name)
+			if err != nil {
+				return err
+			}
+			if rowsAffected, err := result.RowsAffected(); err != nil {
+				return err
+			} else if rowsAffected == 0 {
+				return GroupNameTakenError
+			}
+			return tx.QueryRow(insertGroupQuery, name).Scan(&group.Name, &group.CreatedAt)
+		})
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute GroupPgDao.Create(name string) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Created group %v", group.Name)
+		}
+		return group, err
+	})
+	return res.(models.Group), err
+}
+
+func (dao GroupPgDao) GetAll() ([]models.Group, error) {
+	logs.DaoLog.Debug("GetAll")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		groups := make([]models.Group, 0)
+		rows, err := db.Query(getAllGroupsQuery)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute GroupPgDao.GetAll() query. Reason: %v", err)
+			return groups, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var group models.Group
+			if err := rows.Scan(&group.Name, &group.CreatedAt); err != nil {
+				return groups, err
+			}
+			groups = append(groups, group)
+		}
+		return groups, rows.Err()
+	})
+	return res.([]models.Group), err
+}
+
+func (dao GroupPgDao) Get(name string) (models.Group, error) {
+	logs.DaoLog.Debug("Get")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var group models.Group
+		err := db.QueryRow(getGroupQuery, name).Scan(&group.Name, &group.CreatedAt)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute GroupPgDao.Get(name string) query. Reason: %v", err)
+		}
+		return group, err
+	})
+	return res.(models.Group), err
+}
+
+// Delete deletes the group with its account, which deletes its files too. If there is no group with the name,
+// sql.ErrNoRows is returned.
+func (dao GroupPgDao) Delete(name string) error {
+	logs.DaoLog.Debug("Delete")
+	err := execAffectingRow(deleteGroupQuery, name)
+	if err == nil {
+		logs.DaoLog.Infof("Deleted group %v", name)
+	}
+	return err
+}
+
+func (dao GroupPgDao) GetMembers(group string) ([]models.GroupMember, error) {
+	logs.DaoLog.Debug("GetMembers")
+	return queryGroupMembers(getGroupMembersQuery, group)
+}
+
+// GetByMember returns the user's memberships
+func (dao GroupPgDao) GetByMember(email string) ([]models.GroupMember, error) {
+	logs.DaoLog.Debug("GetByMember")
+	return queryGroupMembers(getGroupsByMemberQuery, email)
+}
+
+// GetMember returns the user's membership in the group. If they aren't a member, sql.ErrNoRows is returned.
+func (dao GroupPgDao) GetMember(group string, email string) (models.GroupMember, error) {
+	logs.DaoLog.Debug("GetMember")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var member models.GroupMember
+		err := scanGroupMemberRow(db.QueryRow(getGroupMemberQuery, group, email), &member)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute GroupPgDao.GetMember(group string, email string) query. Reason: %v", err)
+		}
+		return member, err
+	})
+	return res.(models.GroupMember), err
+}
+
+// SaveMember adds the user to the group, or changes their role if they are already a member
+func (dao GroupPgDao) SaveMember(member *models.GroupMember) (models.GroupMember, error) {
+	logs.DaoLog.Debug("SaveMember")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var savedMember models.GroupMember
+		row := db.QueryRow(saveGroupMemberQuery, member.Group, member.Member, member.Role)
+		err := scanGroupMemberRow(row, &savedMember)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute GroupPgDao.SaveMember(member models.GroupMember) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("%v is %v of group %v", savedMember.Member, savedMember.Role, savedMember.Group)
+		}
+		return savedMember, err
+	})
+	return res.(models.GroupMember), err
+}
+
+// DeleteMember removes the user from the group. If they aren't a member, sql.ErrNoRows is returned.
+func (dao GroupPgDao) DeleteMember(group string, email string) error {
+	logs.DaoLog.Debug("DeleteMember")
+	return execAffectingRow(deleteGroupMemberQuery, group, email)
+}
+
+func queryGroupMembers(query string, arg string) ([]models.GroupMember, error) {
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		members := make([]models.GroupMember, 0)
+		rows, err := db.Query(query, arg)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute query %v. Reason: %v", query, err)
+			return members, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var member models.GroupMember
+			if err := scanGroupMemberRow(rows, &member); err != nil {
+				return members, err
+			}
+			members = append(members, member)
+		}
+		return members, rows.Err()
+	})
+	return res.([]models.GroupMember), err
+}
+
+func scanGroupMemberRow(scanner polimorphicScanner, member *models.GroupMember) error {
+	return scanner.Scan(&member.Group,
+		&member.Member,
+		&member.Role,
+		&member.CreatedAt)
+}
@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupPgDao(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := GroupPgDao{}
+	userDao := UserPgDao{}
+
+	group, err := dao.Create("project")
+	require.NoError(t, err)
+	require.Equal(t, "project", group.Name)
+	_, err = dao.Create("project")
+	require.Equal(t, GroupNameTakenError, err)
+	_, err = dao.Create("testuser1")
+	require.Equal(t, GroupNameTakenError, err)
+
+	// The group's account owns its files, but it isn't listed with the users
+	account, err := userDao.GetByPk("project")
+	require.NoError(t, err)
+	require.Equal(t, "project", account.Email)
+	users, err := userDao.GetAll()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+
+	groups, err := dao.GetAll()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	got, err := dao.Get("project")
+	require.NoError(t, err)
+	require.Equal(t, group, got)
+	_, err = dao.Get("testuser1")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	manager, err := dao.SaveMember(&models.GroupMember{Group: "project", Member: "testuser1", Role: models.GroupRoleManager})
+	require.NoError(t, err)
+	require.Equal(t, models.GroupRoleManager, manager.Role)
+	_, err = dao.SaveMember(&models.GroupMember{Group: "project", Member: "testuser2", Role: models.GroupRoleManager})
+	require.NoError(t, err)
+	// Adding the member again changes their role
+	member, err := dao.SaveMember(&models.GroupMember{Group: "project", Member: "testuser2", Role: models.GroupRoleMember})
+	require.NoError(t, err)
+	require.Equal(t, models.GroupRoleMember, member.Role)
+	_, err = dao.SaveMember(&models.GroupMember{Group: "project", Member: "testuser2", Role: "owner"})
+	require.Error(t, err)
+	_, err = dao.SaveMember(&models.GroupMember{Group: "unknown", Member: "testuser2", Role: models.GroupRoleMember})
+	require.Error(t, err)
+
+	members, err := dao.GetMembers("project")
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	memberships, err := dao.GetByMember("testuser2")
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	require.Equal(t, "project", memberships[0].Group)
+
+	gotMember, err := dao.GetMember("project", "testuser2")
+	require.NoError(t, err)
+	require.Equal(t, models.GroupRoleMember, gotMember.Role)
+	_, err = dao.GetMember("project", "testuser3")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	require.NoError(t, dao.DeleteMember("project", "testuser2"))
+	require.Equal(t, sql.ErrNoRows, dao.DeleteMember("project", "testuser2"))
+
+	// Deleting the group deletes its account and its members
+	require.Equal(t, sql.ErrNoRows, dao.Delete("testuser1"))
+	require.NoError(t, dao.Delete("project"))
+	_, err = userDao.GetByPk("project")
+	require.Equal(t, sql.ErrNoRows, err)
+	memberships, err = dao.GetByMember("testuser1")
+	require.NoError(t, err)
+	require.Empty(t, memberships)
+	require.Equal(t, sql.ErrNoRows, dao.Delete("project"))
+}
@@ -0,0 +1,245 @@
+package dao
+
+import (
+	"database/sql"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	getUnfinishedKeyRotationQuery = `SELECT * FROM key_rotations WHERE finished_at IS NULL ORDER BY id DESC LIMIT 1`
+	insertKeyRotationQuery        = `INSERT INTO key_rotations (old_key_fingerprint, new_key_fingerprint) VALUES ($1, $2) RETURNING *`
+	updateKeyRotationQuery        = `UPDATE key_rotations SET phase = $1, "cursor" = $2, processed = $3, finished_at = $4 WHERE id = $5 RETURNING *`
+	// The deleted users are included, as their passwords are encrypted too
+	getUsersPageQuery    = `SELECT * FROM users WHERE email > $1 ORDER BY email LIMIT $2`
+	getUserKeysPageQuery = `SELECT * FROM user_keys WHERE "user" > $1 ORDER BY "user" LIMIT $2`
+	// The files of the deleted users are skipped, so they can't be decrypted after the rotation
+	getFilesPageQuery = `SELECT f.*
+FROM files f
+  JOIN users u ON f.owner = u.email
+WHERE u.deleted_at IS NULL AND f.id > $1
+ORDER BY f.id
+LIMIT $2`
+	updateUserPasswordQuery = `UPDATE users SET password = $1 WHERE email = $2 RETURNING *`
+	updateUserKeyQuery      = `UPDATE user_keys SET wrapped_key = $1 WHERE "user" = $2 RETURNING *`
+)
+
+type (
+	// KeyRotationDao keeps the progress of the master key rotations. The batches of rows are saved along with the
+	// rotation's progress in the same transaction, so an interrupted rotation never processes a row twice.
+	KeyRotationDao interface {
+		GetUnfinished() (models.KeyRotation, error)
+		Create(rotation *models.KeyRotation) (models.KeyRotation, error)
+		UpdateProgress(rotation *models.KeyRotation) (models.KeyRotation, error)
+		GetUsersPage(afterEmail string, limit int) ([]models.User, error)
+		GetUserKeysPage(afterEmail string, limit int) ([]models.UserKey, error)
+		GetFilesPage(afterId int64, limit int) ([]models.File, error)
+		SaveUsersBatch(users []models.User, rotation *models.KeyRotation, verify func(saved []models.User) error) (models.KeyRotation, error)
+		SaveUserKeysBatch(keys []models.UserKey, rotation *models.KeyRotation, verify func(saved []models.UserKey) error) (models.KeyRotation, error)
+	}
+
+	KeyRotationPgDao struct {
+	}
+)
+
+func (dao KeyRotationPgDao) GetUnfinished() (models.KeyRotation, error) {
+	logs.DaoLog.Debug("GetUnfinished")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var rotation models.KeyRotation
+		err := scanKeyRotationRow(db.QueryRow(getUnfinishedKeyRotationQuery), &rotation)
+		if err != nil && err != sql.ErrNoRows {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetUnfinished() query. Reason: %v", err)
+		}
+		return rotation, err
+	})
+	return res.(models.KeyRotation), err
+}
+
+func (dao KeyRotationPgDao) Create(rotation *models.KeyRotation) (models.KeyRotation, error) {
+	logs.DaoLog.Debug("Create")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var createdRotation models.KeyRotation
+		row := db.QueryRow(insertKeyRotationQuery, rotation.OldKeyFingerprint, rotation.NewKeyFingerprint)
+		err := scanKeyRotationRow(row, &createdRotation)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.Create(rotation models.KeyRotation) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Created key rotation %v", createdRotation.Id)
+		}
+		return createdRotation, err
+	})
+	return res.(models.KeyRotation), err
+}
+
+func (dao KeyRotationPgDao) UpdateProgress(rotation *models.KeyRotation) (models.KeyRotation, error) {
+	logs.DaoLog.Debug("UpdateProgress")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var updatedRotation models.KeyRotation
+		err := updateKeyRotation(db, rotation, &updatedRotation)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.UpdateProgress(rotation models.KeyRotation) query. Reason: %v", err)
+		}
+		return updatedRotation, err
+	})
+	return res.(models.KeyRotation), err
+}
+
+func (dao KeyRotationPgDao) GetUsersPage(afterEmail string, limit int) ([]models.User, error) {
+	logs.DaoLog.Debug("GetUsersPage")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		users := make([]models.User, 0)
+		rows, err := db.Query(getUsersPageQuery, afterEmail, limit)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetUsersPage() query. Reason: %v", err)
+			return users, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var user models.User
+			if err := scanUserRow(rows, &user); err != nil {
+				logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetUsersPage() scan. Reason: %v", err)
+				return users, err
+			}
+			users = append(users, user)
+		}
+		return users, rows.Err()
+	})
+	return res.([]models.User), err
+}
+
+func (dao KeyRotationPgDao) GetUserKeysPage(afterEmail string, limit int) ([]models.UserKey, error) {
+	logs.DaoLog.Debug("GetUserKeysPage")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		keys := make([]models.UserKey, 0)
+		rows, err := db.Query(getUserKeysPageQuery, afterEmail, limit)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetUserKeysPage() query. Reason: %v", err)
+			return keys, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key models.UserKey
+			if err := scanUserKeyRow(rows, &key); err != nil {
+				logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetUserKeysPage() scan. Reason: %v", err)
+				return keys, err
+			}
+			keys = append(keys, key)
+		}
+		return keys, rows.Err()
+	})
+	return res.([]models.UserKey), err
+}
+
+func (dao KeyRotationPgDao) GetFilesPage(afterId int64, limit int) ([]models.File, error) {
+	logs.DaoLog.Debug("GetFilesPage")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		files := make([]models.File, 0)
+		rows, err := db.Query(getFilesPageQuery, afterId, limit)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetFilesPage() query. Reason: %v", err)
+			return files, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var file models.File
+			if err := scanFileRow(rows, &file); err != nil {
+				logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.GetFilesPage() scan. Reason: %v", err)
+				return files, err
+			}
+			files = append(files, file)
+		}
+		return files, rows.Err()
+	})
+	return res.([]models.File), err
+}
+
+// SaveUsersBatch saves the users' passwords and the rotation's progress, but only if verify accepts the saved users
+func (dao KeyRotationPgDao) SaveUsersBatch(users []models.User, rotation *models.KeyRotation, verify func(saved []models.User) error) (models.KeyRotation, error) {
+	logs.DaoLog.Debug("SaveUsersBatch")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var updatedRotation models.KeyRotation
+		err := withTx(db, func(tx *sql.Tx) error {
+			saved := make([]models.User, len(users))
+			for i, user := range users {
+				row := tx.QueryRow(updateUserPasswordQuery, user.Password, user.Email)
+				if err := scanUserRow(row, &saved[i]); err != nil {
+					return err
+				}
+			}
+			if err := verify(saved); err != nil {
+				return err
+			}
+			return updateKeyRotation(tx, rotation, &updatedRotation)
+		})
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.SaveUsersBatch() transaction. Reason: %v", err)
+		}
+		return updatedRotation, err
+	})
+	return res.(models.KeyRotation), err
+}
+
+// SaveUserKeysBatch saves the wrapped keys and the rotation's progress, but only if verify accepts the saved keys
+func (dao KeyRotationPgDao) SaveUserKeysBatch(keys []models.UserKey, rotation *models.KeyRotation, verify func(saved []models.UserKey) error) (models.KeyRotation, error) {
+	logs.DaoLog.Debug("SaveUserKeysBatch")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var updatedRotation models.KeyRotation
+		err := withTx(db, func(tx *sql.Tx) error {
+			saved := make([]models.UserKey, len(keys))
+			for i, key := range keys {
+				row := tx.QueryRow(updateUserKeyQuery, key.WrappedKey, key.User)
+				if err := scanUserKeyRow(row, &saved[i]); err != nil {
+					return err
+				}
+			}
+			if err := verify(saved); err != nil {
+				return err
+			}
+			return updateKeyRotation(tx, rotation, &updatedRotation)
+		})
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute KeyRotationPgDao.SaveUserKeysBatch() transaction. Reason: %v", err)
+		}
+		return updatedRotation, err
+	})
+	return res.(models.KeyRotation), err
+}
+
+// withTx commits the transaction if f succeeds, and rolls it back otherwise
+func withTx(db *sql.DB, f func(tx *sql.Tx) error) error {
+	logs.DaoLog.Debug("withTx")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryRower is implemented by both sql.DB and sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func updateKeyRotation(db queryRower, rotation *models.KeyRotation, updatedRotation *models.KeyRotation) error {
+	row := db.QueryRow(updateKeyRotationQuery, rotation.Phase, rotation.Cursor, rotation.Processed, rotation.FinishedAt, rotation.Id)
+	return scanKeyRotationRow(row, updatedRotation)
+}
+
+func scanKeyRotationRow(scanner polimorphicScanner, rotation *models.KeyRotation) error {
+	logs.DaoLog.Debug("scanKeyRotationRow")
+	return scanner.Scan(
+		&rotation.Id,
+		&rotation.CreatedAt,
+		&rotation.UpdatedAt,
+		&rotation.FinishedAt,
+		&rotation.OldKeyFingerprint,
+		&rotation.NewKeyFingerprint,
+		&rotation.Phase,
+		&rotation.Cursor,
+		&rotation.Processed)
+}
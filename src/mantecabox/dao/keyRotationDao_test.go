@@ -0,0 +1,134 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestKeyRotationPgDao_Progress(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanDb(db)
+	dao := KeyRotationPgDao{}
+
+	_, err := dao.GetUnfinished()
+	require.Equal(t, sql.ErrNoRows, err)
+
+	rotation, err := dao.Create(&models.KeyRotation{OldKeyFingerprint: "old", NewKeyFingerprint: "new"})
+	require.NoError(t, err)
+	require.Equal(t, models.RotationPhaseUserKeys, rotation.Phase)
+
+	rotation.Phase = models.RotationPhasePasswords
+	rotation.Cursor = "testuser1"
+	rotation.Processed = 3
+	updated, err := dao.UpdateProgress(&rotation)
+	require.NoError(t, err)
+	require.Equal(t, rotation.Phase, updated.Phase)
+	require.Equal(t, rotation.Cursor, updated.Cursor)
+	require.Equal(t, rotation.Processed, updated.Processed)
+
+	unfinished, err := dao.GetUnfinished()
+	require.NoError(t, err)
+	require.Equal(t, rotation.Id, unfinished.Id)
+
+	updated.Phase = models.RotationPhaseDone
+	updated.FinishedAt = null.TimeFrom(time.Now())
+	_, err = dao.UpdateProgress(&updated)
+	require.NoError(t, err)
+	_, err = dao.GetUnfinished()
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestKeyRotationPgDao_GetPages(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO users (deleted_at, email, password) VALUES (NOW(), 'testuser3', 'testpassword3');
+INSERT INTO files (name, owner) VALUES ('testfile1a', 'testuser1'), ('testfile2a', 'testuser2'), ('testfile3a', 'testuser3');`, t)
+	dao := KeyRotationPgDao{}
+
+	users, err := dao.GetUsersPage("", 2)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	require.Equal(t, "testuser1", users[0].Email)
+	require.Equal(t, "testuser2", users[1].Email)
+
+	// The deleted users' passwords are rotated too
+	users, err = dao.GetUsersPage("testuser2", 2)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "testuser3", users[0].Email)
+
+	// But not their files
+	files, err := dao.GetFilesPage(0, 10)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	files, err = dao.GetFilesPage(files[0].Id, 10)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "testfile2a", files[0].Name)
+}
+
+func TestKeyRotationPgDao_SaveUsersBatch(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	dao := KeyRotationPgDao{}
+	testCases := []struct {
+		name         string
+		verifyErr    error
+		wantPassword string
+		wantCursor   string
+	}{
+		{"When the batch is verified, save it along with the progress", nil, "newpassword1", "testuser1"},
+		{"When the batch is not verified, save nothing", errors.New("not verified"), "testpassword1", ""},
+	}
+	for _, testCase := range testCases {
+		cleanAndPopulateDb(db, testUserInsert, t)
+		rotation, err := dao.Create(&models.KeyRotation{OldKeyFingerprint: "old", NewKeyFingerprint: "new"})
+		require.NoError(t, err)
+
+		t.Run(testCase.name, func(t *testing.T) {
+			users := []models.User{{Credentials: models.Credentials{Email: "testuser1", Password: "newpassword1"}}}
+			rotation.Cursor = "testuser1"
+			_, err := dao.SaveUsersBatch(users, &rotation, func(saved []models.User) error {
+				require.Equal(t, "newpassword1", saved[0].Password)
+				return testCase.verifyErr
+			})
+			require.Equal(t, testCase.verifyErr, err)
+
+			user, err := UserPgDao{}.GetByPk("testuser1")
+			require.NoError(t, err)
+			require.Equal(t, testCase.wantPassword, user.Password)
+			unfinished, err := dao.GetUnfinished()
+			require.NoError(t, err)
+			require.Equal(t, testCase.wantCursor, unfinished.Cursor)
+		})
+	}
+}
+
+func TestKeyRotationPgDao_SaveUserKeysBatch(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUserKeyInsert, t)
+	dao := KeyRotationPgDao{}
+	rotation, err := dao.Create(&models.KeyRotation{OldKeyFingerprint: "old", NewKeyFingerprint: "new"})
+	require.NoError(t, err)
+
+	keys := []models.UserKey{{User: "testuser1", WrappedKey: []byte("wrappedkey2")}}
+	rotation.Cursor = "testuser1"
+	updated, err := dao.SaveUserKeysBatch(keys, &rotation, func(saved []models.UserKey) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "testuser1", updated.Cursor)
+
+	key, err := UserKeyPgDao{}.GetByUser("testuser1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("wrappedkey2"), key.WrappedKey)
+}
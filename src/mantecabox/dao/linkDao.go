@@ -0,0 +1,240 @@
+package dao
+
+import (
+	"database/sql"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	insertLinkQuery = `INSERT INTO links (token, owner, logical_id, version, expires_at, max_downloads, password)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *`
+	// The links are listed with the current path of their file
+	getLinksByOwnerQuery = `SELECT
+  l.*,
+  COALESCE((SELECT f.name
+            FROM files f
+            WHERE f.logical_id = l.logical_id
+            ORDER BY f.id DESC
+            LIMIT 1), '')
+FROM links l
+WHERE l.owner = $1
+ORDER BY l.created_at DESC`
+	getLinkByTokenQuery = `SELECT * FROM links WHERE token = $1`
+	revokeLinkQuery     = `UPDATE links SET revoked_at = NOW() WHERE id = $1 AND owner = $2 AND revoked_at IS NULL`
+	// The download is counted only while the link has downloads left, so the concurrent downloads can't go over them
+	useLinkQuery = `UPDATE links SET downloads = downloads + 1
+WHERE id = $1 AND revoked_at IS NULL AND (max_downloads IS NULL OR downloads < max_downloads)`
+	// The link serves its version if it has one, or else the last live version of its file. A link to a version that
+	// has been pruned or trashed serves nothing.
+	getLinkedFileQuery = `SELECT f.*, u.*
+FROM files f
+  JOIN users u ON f.owner = u.email
+WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND f.logical_id = $1 AND ($2::BIGINT IS NULL OR f.id = $2)
+ORDER BY f.updated_at DESC, f.id DESC
+LIMIT 1`
+	insertLinkAccessQuery = `INSERT INTO link_accesses (link_id, ip, user_agent, granted) VALUES ($1, $2, $3, $4)`
+	// A client's first granted access to a link is always counted as a download
+	hasGrantedLinkAccessQuery = `SELECT EXISTS(SELECT 1
+              FROM link_accesses
+              WHERE link_id = $1 AND ip = $2 AND user_agent = $3 AND granted)`
+	getLinkAccessesQuery = `SELECT a.*
+FROM link_accesses a
+  JOIN links l ON a.link_id = l.id
+WHERE l.id = $1 AND l.owner = $2
+ORDER BY a.accessed_at DESC, a.id DESC`
+)
+
+type (
+	// LinkDao keeps the public links to the users' files, and the record of who accessed them
+	LinkDao interface {
+		Create(link *models.Link) (models.Link, error)
+		GetByOwner(owner string) ([]models.Link, error)
+		GetByToken(token string) (models.Link, error)
+		Revoke(id int64, owner string) error
+		Use(id int64) error
+		GetFile(link models.Link) (models.File, error)
+		CreateAccess(access *models.LinkAccess) error
+		HasGrantedAccess(access models.LinkAccess) (bool, error)
+		GetAccesses(id int64, owner string) ([]models.LinkAccess, error)
+	}
+
+	LinkPgDao struct {
+	}
+)
+
+func (dao LinkPgDao) Create(link *models.Link) (models.Link, error) {
+	logs.DaoLog.Debug("Create")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var createdLink models.Link
+		row := db.QueryRow(insertLinkQuery,
+			link.Token,
+			link.Owner,
+			link.LogicalId,
+			link.Version,
+			link.ExpiresAt,
+			link.MaxDownloads,
+			link.Password)
+		err := scanLinkRow(row, &createdLink)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute LinkPgDao.Create(link models.Link) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("%v created link %v to file %v", createdLink.Owner, createdLink.Id, createdLink.LogicalId)
+		}
+		return createdLink, err
+	})
+	return res.(models.Link), err
+}
+
+func (dao LinkPgDao) GetByOwner(owner string) ([]models.Link, error) {
+	logs.DaoLog.Debug("GetByOwner")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		links := make([]models.Link, 0)
+		rows, err := db.Query(getLinksByOwnerQuery, owner)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute LinkPgDao.GetByOwner(owner string) query. Reason: %v", err)
+			return links, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var link models.Link
+			if err := scanLinkRow(rows, &link, &link.Name); err != nil {
+				return links, err
+			}
+			links = append(links, link)
+		}
+		return links, rows.Err()
+	})
+	return res.([]models.Link), err
+}
+
+func (dao LinkPgDao) GetByToken(token string) (models.Link, error) {
+	logs.DaoLog.Debug("GetByToken")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var link models.Link
+		err := scanLinkRow(db.QueryRow(getLinkByTokenQuery, token), &link)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute LinkPgDao.GetByToken(token string) query. Reason: %v", err)
+		}
+		return link, err
+	})
+	return res.(models.Link), err
+}
+
+// Revoke disables the owner's link. If the owner has no live link with the ID, sql.ErrNoRows is returned.
+func (dao LinkPgDao) Revoke(id int64, owner string) error {
+	logs.DaoLog.Debug("Revoke")
+	return execAffectingRow(revokeLinkQuery, id, owner)
+}
+
+// Use counts a download of the link. If the link has been revoked or it has no downloads left, sql.ErrNoRows is
+// returned.
+func (dao LinkPgDao) Use(id int64) error {
+	logs.DaoLog.Debug("Use")
+	return execAffectingRow(useLinkQuery, id)
+}
+
+// GetFile returns the version that the link serves. If it's gone, or the file is in the trash, sql.ErrNoRows is
+// returned.
+func (dao LinkPgDao) GetFile(link models.Link) (models.File, error) {
+	logs.DaoLog.Debug("GetFile")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		file := models.File{}
+		err := scanFileRowWithUser(db.QueryRow(getLinkedFileQuery, link.LogicalId, link.Version), &file)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute LinkPgDao.GetFile(link models.Link) query. Reason: %v", err)
+		}
+		return file, err
+	})
+	return res.(models.File), err
+}
+
+func (dao LinkPgDao) CreateAccess(access *models.LinkAccess) error {
+	logs.DaoLog.Debug("CreateAccess")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		_, err := db.Exec(insertLinkAccessQuery, access.LinkId, access.Ip, access.UserAgent, access.Granted)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute LinkPgDao.CreateAccess(access models.LinkAccess) query. Reason: %v", err)
+		}
+		return nil, err
+	})
+	return err
+}
+
+// HasGrantedAccess tells whether the link has already been downloaded by the client of the access, that is, from the
+// same IP and user agent
+func (dao LinkPgDao) HasGrantedAccess(access models.LinkAccess) (bool, error) {
+	logs.DaoLog.Debug("HasGrantedAccess")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var granted bool
+		err := db.QueryRow(hasGrantedLinkAccessQuery, access.LinkId, access.Ip, access.UserAgent).Scan(&granted)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute LinkPgDao.HasGrantedAccess(access models.LinkAccess) query. Reason: %v", err)
+		}
+		return granted, err
+	})
+	return res.(bool), err
+}
+
+// GetAccesses returns the accesses to the owner's link, the most recent first
+func (dao LinkPgDao) GetAccesses(id int64, owner string) ([]models.LinkAccess, error) {
+	logs.DaoLog.Debug("GetAccesses")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		accesses := make([]models.LinkAccess, 0)
+		rows, err := db.Query(getLinkAccessesQuery, id, owner)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute LinkPgDao.GetAccesses(id int64, owner string) query. Reason: %v", err)
+			return accesses, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var access models.LinkAccess
+			err := rows.Scan(&access.Id,
+				&access.LinkId,
+				&access.AccessedAt,
+				&access.Ip,
+				&access.UserAgent,
+				&access.Granted)
+			if err != nil {
+				return accesses, err
+			}
+			accesses = append(accesses, access)
+		}
+		return accesses, rows.Err()
+	})
+	return res.([]models.LinkAccess), err
+}
+
+// execAffectingRow runs the statement, and returns sql.ErrNoRows if it changes no row
+func execAffectingRow(query string, args ...interface{}) error {
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute query %v. Reason: %v", query, err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		return nil, err
+	})
+	return err
+}
+
+// scanLinkRow scans the link's columns, followed by the extra ones of the query
+func scanLinkRow(scanner polimorphicScanner, link *models.Link, extra ...interface{}) error {
+	return scanner.Scan(append([]interface{}{&link.Id,
+		&link.CreatedAt,
+		&link.Token,
+		&link.Owner,
+		&link.LogicalId,
+		&link.Version,
+		&link.ExpiresAt,
+		&link.MaxDownloads,
+		&link.Downloads,
+		&link.Password,
+		&link.RevokedAt}, extra...)...)
+}
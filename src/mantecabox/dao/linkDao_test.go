@@ -0,0 +1,97 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestLinkPgDao(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner, updated_at)
+VALUES ('testfile1a', 'testuser1', '2018-06-01'),
+  ('testfile1a', 'testuser1', '2018-06-02');`, t)
+	fileDao := FilePgDao{}
+	dao := LinkPgDao{}
+	user := &models.User{Credentials: models.Credentials{Email: "testuser1"}}
+	versions, err := fileDao.GetVersionsByNameAndOwner("testfile1a", user)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	first, last := versions[0], versions[1]
+	if first.Id > last.Id {
+		first, last = last, first
+	}
+
+	link, err := dao.Create(&models.Link{Token: "testtoken1", Owner: "testuser1", LogicalId: last.LogicalId, MaxDownloads: null.IntFrom(1)})
+	require.NoError(t, err)
+	require.NotZero(t, link.Id)
+	versionLink, err := dao.Create(&models.Link{Token: "testtoken2", Owner: "testuser1", LogicalId: first.LogicalId, Version: null.IntFrom(first.Id), Password: null.StringFrom("hash")})
+	require.NoError(t, err)
+	_, err = dao.Create(&models.Link{Token: "testtoken1", Owner: "testuser1", LogicalId: last.LogicalId})
+	require.Error(t, err)
+
+	links, err := dao.GetByOwner("testuser1")
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	require.Equal(t, "testfile1a", links[0].Name)
+	links, err = dao.GetByOwner("testuser2")
+	require.NoError(t, err)
+	require.Empty(t, links)
+
+	got, err := dao.GetByToken("testtoken2")
+	require.NoError(t, err)
+	require.Equal(t, versionLink.Id, got.Id)
+	require.Equal(t, null.StringFrom("hash"), got.Password)
+	_, err = dao.GetByToken("unknown")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	// The links without version serve the last one
+	file, err := dao.GetFile(link)
+	require.NoError(t, err)
+	require.Equal(t, last.Id, file.Id)
+	file, err = dao.GetFile(versionLink)
+	require.NoError(t, err)
+	require.Equal(t, first.Id, file.Id)
+
+	// The downloads stop at the maximum
+	require.NoError(t, dao.Use(link.Id))
+	require.Equal(t, sql.ErrNoRows, dao.Use(link.Id))
+	require.NoError(t, dao.Use(versionLink.Id))
+	require.NoError(t, dao.Use(versionLink.Id))
+
+	require.NoError(t, dao.CreateAccess(&models.LinkAccess{LinkId: link.Id, Ip: "127.0.0.1", UserAgent: "curl", Granted: true}))
+	require.NoError(t, dao.CreateAccess(&models.LinkAccess{LinkId: link.Id, Ip: "127.0.0.1", Granted: false}))
+	// Only the granted accesses of the same client count
+	granted, err := dao.HasGrantedAccess(models.LinkAccess{LinkId: link.Id, Ip: "127.0.0.1", UserAgent: "curl"})
+	require.NoError(t, err)
+	require.True(t, granted)
+	granted, err = dao.HasGrantedAccess(models.LinkAccess{LinkId: link.Id, Ip: "127.0.0.1"})
+	require.NoError(t, err)
+	require.False(t, granted)
+	granted, err = dao.HasGrantedAccess(models.LinkAccess{LinkId: link.Id, Ip: "10.0.0.1", UserAgent: "curl"})
+	require.NoError(t, err)
+	require.False(t, granted)
+	accesses, err := dao.GetAccesses(link.Id, "testuser1")
+	require.NoError(t, err)
+	require.Len(t, accesses, 2)
+	require.False(t, accesses[0].Granted)
+	accesses, err = dao.GetAccesses(link.Id, "testuser2")
+	require.NoError(t, err)
+	require.Empty(t, accesses)
+
+	// Only the owner can revoke the link, and only once
+	require.Equal(t, sql.ErrNoRows, dao.Revoke(versionLink.Id, "testuser2"))
+	require.NoError(t, dao.Revoke(versionLink.Id, "testuser1"))
+	require.Equal(t, sql.ErrNoRows, dao.Revoke(versionLink.Id, "testuser1"))
+	require.Equal(t, sql.ErrNoRows, dao.Use(versionLink.Id))
+
+	// The links to the trashed files serve nothing
+	require.NoError(t, fileDao.Delete("testfile1a", user))
+	_, err = dao.GetFile(link)
+	require.Equal(t, sql.ErrNoRows, err)
+}
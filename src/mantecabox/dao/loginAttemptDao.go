@@ -70,6 +70,10 @@ func scanLoginAttemptWithNestedUser(rows *sql.Rows) ([]models.LoginAttempt, erro
 			&attempt.User.Password,
 			&attempt.User.TwoFactorAuth,
 			&attempt.User.TwoFactorTime,
+			&attempt.User.Quota,
+			&attempt.User.Role,
+			&attempt.User.DisabledAt,
+			&attempt.User.TokensRevokedAt,
 		)
 		if err != nil {
 			logs.DaoLog.Infof("Unable to execute LoginAttemptPgDao.scanLoginAttemptWithNestedUser() scan. Reason: %v", err)
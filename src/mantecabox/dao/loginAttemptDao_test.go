@@ -21,25 +21,25 @@ const (
 var (
 	dao               = LoginAttemptPgDao{}
 	loginAttemptTest1 = models.LoginAttempt{
-		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 		UserAgent:  null.String{NullString: sql.NullString{String: "user-agent1", Valid: true}},
 		IP:         null.String{NullString: sql.NullString{String: "127.0.0.1", Valid: true}},
 		Successful: true,
 	}
 	loginAttemptTest2 = models.LoginAttempt{
-		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 		UserAgent:  null.String{NullString: sql.NullString{String: "user-agent2", Valid: true}},
 		IP:         null.String{NullString: sql.NullString{String: "127.0.0.1", Valid: true}},
 		Successful: true,
 	}
 	loginAttemptTest3 = models.LoginAttempt{
-		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 		UserAgent:  null.String{NullString: sql.NullString{String: "user-agent1", Valid: true}},
 		IP:         null.String{NullString: sql.NullString{String: "192.168.0.160", Valid: true}},
 		Successful: false,
 	}
 	loginAttemptTest4 = models.LoginAttempt{
-		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 		UserAgent:  null.String{NullString: sql.NullString{Valid: false}},
 		IP:         null.String{NullString: sql.NullString{Valid: false}},
 		Successful: false,
@@ -151,7 +151,7 @@ func TestLoginAttemptPgDao_GetLastNByUser(t *testing.T) {
 
 func TestLoginAttemptPgDao_Create(t *testing.T) {
 	successfulAttempt := models.LoginAttempt{
-		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+		User:       models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 		UserAgent:  null.String{NullString: sql.NullString{String: "Mozilla/5.0 (Linux; Android 6.0; Nexus 5X Build/MDB08L) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/46.0.2490.76 Mobile Safari/537.36", Valid: true}},
 		IP:         null.String{NullString: sql.NullString{String: "127.0.0.1", Valid: true}},
 		Successful: true,
@@ -0,0 +1,82 @@
+package dao
+
+import (
+	"database/sql"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	// Saving the policy of a user who already has one replaces it
+	saveRetentionPolicyQuery = `INSERT INTO retention_policies (owner, keep_last, keep_within, keep_daily, keep_monthly)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (owner) DO UPDATE SET updated_at = NOW(), keep_last = EXCLUDED.keep_last, keep_within = EXCLUDED.keep_within,
+  keep_daily = EXCLUDED.keep_daily, keep_monthly = EXCLUDED.keep_monthly
+RETURNING *`
+	getRetentionPolicyQuery    = `SELECT * FROM retention_policies WHERE owner = $1`
+	deleteRetentionPolicyQuery = `DELETE FROM retention_policies WHERE owner = $1`
+)
+
+type (
+	RetentionPolicyDao interface {
+		GetByOwner(owner string) (models.RetentionPolicy, error)
+		Save(policy *models.RetentionPolicy) (models.RetentionPolicy, error)
+		Delete(owner string) error
+	}
+
+	RetentionPolicyPgDao struct {
+	}
+)
+
+func (dao RetentionPolicyPgDao) GetByOwner(owner string) (models.RetentionPolicy, error) {
+	logs.DaoLog.Debug("GetByOwner")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var policy models.RetentionPolicy
+		err := scanRetentionPolicyRow(db.QueryRow(getRetentionPolicyQuery, owner), &policy)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute RetentionPolicyPgDao.GetByOwner(owner string) query. Reason: %v", err)
+		}
+		return policy, err
+	})
+	return res.(models.RetentionPolicy), err
+}
+
+// Save creates the owner's policy, or replaces the one they had
+func (dao RetentionPolicyPgDao) Save(policy *models.RetentionPolicy) (models.RetentionPolicy, error) {
+	logs.DaoLog.Debug("Save")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var savedPolicy models.RetentionPolicy
+		row := db.QueryRow(saveRetentionPolicyQuery, policy.Owner, policy.KeepLast, policy.KeepWithin, policy.KeepDaily, policy.KeepMonthly)
+		err := scanRetentionPolicyRow(row, &savedPolicy)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute RetentionPolicyPgDao.Save(policy models.RetentionPolicy) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Saved %v's retention policy", savedPolicy.Owner)
+		}
+		return savedPolicy, err
+	})
+	return res.(models.RetentionPolicy), err
+}
+
+// Delete removes the owner's policy, so the global one applies again
+func (dao RetentionPolicyPgDao) Delete(owner string) error {
+	logs.DaoLog.Debug("Delete")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		_, err := db.Exec(deleteRetentionPolicyQuery, owner)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute RetentionPolicyPgDao.Delete(owner string) query. Reason: %v", err)
+		}
+		return nil, err
+	})
+	return err
+}
+
+func scanRetentionPolicyRow(scanner polimorphicScanner, policy *models.RetentionPolicy) error {
+	return scanner.Scan(&policy.Owner,
+		&policy.UpdatedAt,
+		&policy.KeepLast,
+		&policy.KeepWithin,
+		&policy.KeepDaily,
+		&policy.KeepMonthly)
+}
@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicyPgDao(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := RetentionPolicyPgDao{}
+
+	_, err := dao.GetByOwner("testuser1")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	saved, err := dao.Save(&models.RetentionPolicy{Owner: "testuser1", KeepLast: 5, KeepWithin: "168h"})
+	require.NoError(t, err)
+	require.Equal(t, 5, saved.KeepLast)
+	require.True(t, saved.UpdatedAt.Valid)
+
+	// Saving it again replaces it
+	_, err = dao.Save(&models.RetentionPolicy{Owner: "testuser1", KeepDaily: 30, KeepMonthly: -1})
+	require.NoError(t, err)
+	policy, err := dao.GetByOwner("testuser1")
+	require.NoError(t, err)
+	require.Equal(t, 0, policy.KeepLast)
+	require.Equal(t, "", policy.KeepWithin)
+	require.Equal(t, 30, policy.KeepDaily)
+	require.Equal(t, -1, policy.KeepMonthly)
+
+	require.NoError(t, dao.Delete("testuser1"))
+	_, err = dao.GetByOwner("testuser1")
+	require.Equal(t, sql.ErrNoRows, err)
+}
@@ -0,0 +1,167 @@
+package dao
+
+import (
+	"database/sql"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	// The files of the deleted users are skipped, as the key rotation does
+	getLiveVersionsPageQuery = `SELECT f.*, u.*
+FROM files f
+  JOIN users u ON f.owner = u.email
+WHERE f.deleted_at IS NULL AND u.deleted_at IS NULL AND f.id > $1
+ORDER BY f.id
+LIMIT $2`
+	getBlobIdsQuery = `SELECT id FROM blobs`
+	// The versions uploaded before the deduplication have their own blob, even if they are in the trash
+	getLegacyVersionIdsQuery = `SELECT id FROM files WHERE blob_id IS NULL AND NOT chunked`
+	getUploadIdsQuery        = `SELECT id FROM uploads`
+	insertScrubReportQuery   = `INSERT INTO scrub_reports (created_at, finished_at, checked_versions, checked_blobs) VALUES ($1, $2, $3, $4)
+RETURNING id`
+	insertScrubIssueQuery   = `INSERT INTO scrub_issues (report_id, kind, key, file_id, detail) VALUES ($1, $2, $3, $4, $5)`
+	getLastScrubReportQuery = `SELECT * FROM scrub_reports ORDER BY id DESC LIMIT 1`
+	getScrubIssuesQuery     = `SELECT kind, key, file_id, detail FROM scrub_issues WHERE report_id = $1 ORDER BY kind, key`
+)
+
+type (
+	// ScrubDao walks the metadata that the scrubber checks the storage against, and keeps the scrubber's reports
+	ScrubDao interface {
+		GetLiveVersionsPage(afterId int64, limit int) ([]models.File, error)
+		GetBlobIds() ([]int64, error)
+		GetLegacyVersionIds() ([]int64, error)
+		GetUploadIds() ([]string, error)
+		CreateReport(report *models.ScrubReport) (models.ScrubReport, error)
+		GetLastReport() (models.ScrubReport, error)
+	}
+
+	ScrubPgDao struct {
+	}
+)
+
+// GetLiveVersionsPage returns the versions that aren't deleted, along with their owner, sorted by ID
+func (dao ScrubPgDao) GetLiveVersionsPage(afterId int64, limit int) ([]models.File, error) {
+	logs.DaoLog.Debug("GetLiveVersionsPage")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		files, err := queryFiles(db, getLiveVersionsPageQuery, afterId, limit)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute ScrubPgDao.GetLiveVersionsPage(afterId int64, limit int) query. Reason: %v", err)
+		}
+		return files, err
+	})
+	return res.([]models.File), err
+}
+
+func (dao ScrubPgDao) GetBlobIds() ([]int64, error) {
+	logs.DaoLog.Debug("GetBlobIds")
+	return queryIds(getBlobIdsQuery)
+}
+
+func (dao ScrubPgDao) GetLegacyVersionIds() ([]int64, error) {
+	logs.DaoLog.Debug("GetLegacyVersionIds")
+	return queryIds(getLegacyVersionIdsQuery)
+}
+
+func (dao ScrubPgDao) GetUploadIds() ([]string, error) {
+	logs.DaoLog.Debug("GetUploadIds")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		ids := make([]string, 0)
+		rows, err := db.Query(getUploadIdsQuery)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute ScrubPgDao.GetUploadIds() query. Reason: %v", err)
+			return ids, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, rows.Err()
+	})
+	return res.([]string), err
+}
+
+// CreateReport saves the report along with its issues
+func (dao ScrubPgDao) CreateReport(report *models.ScrubReport) (models.ScrubReport, error) {
+	logs.DaoLog.Debug("CreateReport")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		createdReport := *report
+		err := withTx(db, func(tx *sql.Tx) error {
+			row := tx.QueryRow(insertScrubReportQuery, report.CreatedAt, report.FinishedAt, report.CheckedVersions, report.CheckedBlobs)
+			if err := row.Scan(&createdReport.Id); err != nil {
+				return err
+			}
+			for _, issue := range report.Issues {
+				if _, err := tx.Exec(insertScrubIssueQuery, createdReport.Id, issue.Kind, issue.Key, issue.FileId, issue.Detail); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute ScrubPgDao.CreateReport(report *models.ScrubReport) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Created scrub report %v with %v issues", createdReport.Id, len(createdReport.Issues))
+		}
+		return createdReport, err
+	})
+	return res.(models.ScrubReport), err
+}
+
+func (dao ScrubPgDao) GetLastReport() (models.ScrubReport, error) {
+	logs.DaoLog.Debug("GetLastReport")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var report models.ScrubReport
+		err := db.QueryRow(getLastScrubReportQuery).Scan(&report.Id,
+			&report.CreatedAt,
+			&report.FinishedAt,
+			&report.CheckedVersions,
+			&report.CheckedBlobs)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute ScrubPgDao.GetLastReport() query. Reason: %v", err)
+			return report, err
+		}
+		report.Issues = make([]models.ScrubIssue, 0)
+		rows, err := db.Query(getScrubIssuesQuery, report.Id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute ScrubPgDao.GetLastReport() query. Reason: %v", err)
+			return report, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var issue models.ScrubIssue
+			if err := rows.Scan(&issue.Kind, &issue.Key, &issue.FileId, &issue.Detail); err != nil {
+				return report, err
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+		return report, rows.Err()
+	})
+	return res.(models.ScrubReport), err
+}
+
+func queryIds(query string) ([]int64, error) {
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		ids := make([]int64, 0)
+		rows, err := db.Query(query)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute query %v. Reason: %v", query, err)
+			return ids, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, rows.Err()
+	})
+	return res.([]int64), err
+}
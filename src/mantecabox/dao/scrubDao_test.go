@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestScrubPgDao_GetLiveVersionsPage(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery+`INSERT INTO files (name, owner)
+VALUES ('testfile1a', 'testuser1'),
+  ('testfile1b', 'testuser1'),
+  ('testfile2a', 'testuser2');`, t)
+	require.NoError(t, FilePgDao{}.Delete("testfile1b", &models.User{Credentials: models.Credentials{Email: "testuser1"}}))
+	dao := ScrubPgDao{}
+
+	versions, err := dao.GetLiveVersionsPage(0, 1)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, "testfile1a", versions[0].Name)
+	require.Equal(t, "testuser1", versions[0].Owner.Email)
+
+	// The trashed versions are skipped
+	versions, err = dao.GetLiveVersionsPage(versions[0].Id, 10)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, "testfile2a", versions[0].Name)
+
+	versions, err = dao.GetLiveVersionsPage(versions[0].Id, 10)
+	require.NoError(t, err)
+	require.Empty(t, versions)
+
+	legacyIds, err := dao.GetLegacyVersionIds()
+	require.NoError(t, err)
+	require.Len(t, legacyIds, 3)
+}
+
+func TestScrubPgDao_Reports(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := ScrubPgDao{}
+
+	_, err := dao.GetLastReport()
+	require.Equal(t, sql.ErrNoRows, err)
+
+	startedAt := time.Date(2018, 7, 10, 3, 0, 0, 0, time.UTC)
+	report := models.ScrubReport{
+		CreatedAt:       startedAt,
+		FinishedAt:      startedAt.Add(time.Minute),
+		CheckedVersions: 10,
+		CheckedBlobs:    8,
+		Issues: []models.ScrubIssue{
+			{Kind: models.ScrubIssueOrphanBlob, Key: "blob-99"},
+			{Kind: models.ScrubIssueMissingBlob, Key: "blob-4", FileId: null.IntFrom(7), Detail: "blob not found"},
+		},
+	}
+	created, err := dao.CreateReport(&report)
+	require.NoError(t, err)
+	require.NotZero(t, created.Id)
+
+	last, err := dao.GetLastReport()
+	require.NoError(t, err)
+	require.Equal(t, created.Id, last.Id)
+	require.Equal(t, int64(10), last.CheckedVersions)
+	require.Equal(t, int64(8), last.CheckedBlobs)
+	require.Equal(t, []models.ScrubIssue{report.Issues[1], report.Issues[0]}, last.Issues)
+}
@@ -0,0 +1,152 @@
+package dao
+
+import (
+	"database/sql"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	// Sharing again a path with the same user changes the access they have
+	saveShareQuery = `INSERT INTO shares (owner, path, grantee, access) VALUES ($1, $2, $3, $4)
+ON CONFLICT (owner, path, grantee) DO UPDATE SET access = EXCLUDED.access
+RETURNING *`
+	getSharesByOwnerQuery   = `SELECT * FROM shares WHERE owner = $1 ORDER BY path, grantee`
+	getSharesByGranteeQuery = `SELECT s.*
+FROM shares s
+  JOIN users u ON s.owner = u.email
+WHERE s.grantee = $1 AND u.deleted_at IS NULL
+ORDER BY s.owner, s.path`
+	deleteShareQuery = `DELETE FROM shares WHERE id = $1 AND owner = $2`
+	// The path is shared if it's the one of the share, or if it's inside the shared folder. The write access wins over
+	// the read one when there are several shares.
+	getShareAccessQuery = `SELECT access
+FROM shares
+WHERE owner = $1 AND grantee = $3 AND (path = $2 OR (RIGHT(path, 1) = '/' AND LEFT($2, LENGTH(path)) = path))
+ORDER BY access = 'write' DESC
+LIMIT 1`
+	// The shares of a file follow it when it's moved
+	moveShareQuery = `UPDATE shares SET path = $3 WHERE owner = $1 AND path = $2`
+)
+
+type (
+	// ShareDao keeps the files and folders that the users share with others. The folders' paths end with a slash.
+	ShareDao interface {
+		Save(share *models.Share) (models.Share, error)
+		GetByOwner(owner string) ([]models.Share, error)
+		GetByGrantee(grantee string) ([]models.Share, error)
+		Delete(id int64, owner string) error
+		GetAccess(owner string, path string, grantee string) (string, error)
+		Move(owner string, path string, newPath string) error
+	}
+
+	SharePgDao struct {
+	}
+)
+
+// Save creates the share, or changes the access of the one that the owner already has with the grantee for the path
+func (dao SharePgDao) Save(share *models.Share) (models.Share, error) {
+	logs.DaoLog.Debug("Save")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var savedShare models.Share
+		row := db.QueryRow(saveShareQuery, share.Owner, share.Path, share.Grantee, share.Access)
+		err := scanShareRow(row, &savedShare)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute SharePgDao.Save(share models.Share) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("%v shared %v with %v (%v)", savedShare.Owner, savedShare.Path, savedShare.Grantee, savedShare.Access)
+		}
+		return savedShare, err
+	})
+	return res.(models.Share), err
+}
+
+func (dao SharePgDao) GetByOwner(owner string) ([]models.Share, error) {
+	logs.DaoLog.Debug("GetByOwner")
+	return queryShares(getSharesByOwnerQuery, owner)
+}
+
+// GetByGrantee returns the shares with the user, except the ones of the deleted users
+func (dao SharePgDao) GetByGrantee(grantee string) ([]models.Share, error) {
+	logs.DaoLog.Debug("GetByGrantee")
+	return queryShares(getSharesByGranteeQuery, grantee)
+}
+
+// Delete revokes the owner's share. If the owner has no share with the ID, sql.ErrNoRows is returned.
+func (dao SharePgDao) Delete(id int64, owner string) error {
+	logs.DaoLog.Debug("Delete")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(deleteShareQuery, id, owner)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute SharePgDao.Delete(id int64, owner string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+		if err == nil {
+			logs.DaoLog.Infof("%v revoked share %v", owner, id)
+		}
+		return nil, err
+	})
+	return err
+}
+
+// GetAccess returns the access that the grantee has to the owner's path. If the path isn't shared with them,
+// sql.ErrNoRows is returned.
+func (dao SharePgDao) GetAccess(owner string, path string, grantee string) (string, error) {
+	logs.DaoLog.Debug("GetAccess")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var access string
+		err := db.QueryRow(getShareAccessQuery, owner, path, grantee).Scan(&access)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute SharePgDao.GetAccess(owner string, path string, grantee string) query. Reason: %v", err)
+		}
+		return access, err
+	})
+	return res.(string), err
+}
+
+func (dao SharePgDao) Move(owner string, path string, newPath string) error {
+	logs.DaoLog.Debug("Move")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		_, err := db.Exec(moveShareQuery, owner, path, newPath)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute SharePgDao.Move(owner string, path string, newPath string) query. Reason: %v", err)
+		}
+		return nil, err
+	})
+	return err
+}
+
+func queryShares(query string, email string) ([]models.Share, error) {
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		shares := make([]models.Share, 0)
+		rows, err := db.Query(query, email)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute query %v. Reason: %v", query, err)
+			return shares, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var share models.Share
+			if err := scanShareRow(rows, &share); err != nil {
+				return shares, err
+			}
+			shares = append(shares, share)
+		}
+		return shares, rows.Err()
+	})
+	return res.([]models.Share), err
+}
+
+func scanShareRow(scanner polimorphicScanner, share *models.Share) error {
+	return scanner.Scan(&share.Id,
+		&share.CreatedAt,
+		&share.Owner,
+		&share.Path,
+		&share.Grantee,
+		&share.Access)
+}
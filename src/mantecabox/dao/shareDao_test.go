@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharePgDao(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := SharePgDao{}
+
+	fileShare, err := dao.Save(&models.Share{Owner: "testuser1", Path: "docs/report.pdf", Grantee: "testuser2", Access: models.ShareAccessRead})
+	require.NoError(t, err)
+	require.NotZero(t, fileShare.Id)
+	folderShare, err := dao.Save(&models.Share{Owner: "testuser1", Path: "backups/", Grantee: "testuser2", Access: models.ShareAccessWrite})
+	require.NoError(t, err)
+
+	// Sharing the path again changes the access
+	changed, err := dao.Save(&models.Share{Owner: "testuser1", Path: "docs/report.pdf", Grantee: "testuser2", Access: models.ShareAccessWrite})
+	require.NoError(t, err)
+	require.Equal(t, fileShare.Id, changed.Id)
+	require.Equal(t, models.ShareAccessWrite, changed.Access)
+
+	shares, err := dao.GetByOwner("testuser1")
+	require.NoError(t, err)
+	require.Len(t, shares, 2)
+	shares, err = dao.GetByGrantee("testuser2")
+	require.NoError(t, err)
+	require.Len(t, shares, 2)
+	shares, err = dao.GetByGrantee("testuser1")
+	require.NoError(t, err)
+	require.Empty(t, shares)
+
+	testCases := []struct {
+		name    string
+		path    string
+		grantee string
+		want    string
+		wantErr error
+	}{
+		{"When the file is shared, return its access", "docs/report.pdf", "testuser2", models.ShareAccessWrite, nil},
+		{"When the file is in a shared folder, return the folder's access", "backups/2018/db.sql", "testuser2", models.ShareAccessWrite, nil},
+		{"When asking for the shared folder, return its access", "backups/", "testuser2", models.ShareAccessWrite, nil},
+		{"When the file's name only starts like the folder, it isn't shared", "backups.tar", "testuser2", "", sql.ErrNoRows},
+		{"When the file isn't shared, return no rows", "docs/other.pdf", "testuser2", "", sql.ErrNoRows},
+		{"When the file is shared with somebody else, return no rows", "docs/report.pdf", "testuser1", "", sql.ErrNoRows},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			access, err := dao.GetAccess("testuser1", testCase.path, testCase.grantee)
+			require.Equal(t, testCase.wantErr, err)
+			require.Equal(t, testCase.want, access)
+		})
+	}
+
+	require.NoError(t, dao.Move("testuser1", "docs/report.pdf", "docs/report-2018.pdf"))
+	access, err := dao.GetAccess("testuser1", "docs/report-2018.pdf", "testuser2")
+	require.NoError(t, err)
+	require.Equal(t, models.ShareAccessWrite, access)
+
+	// Only the owner can revoke the share
+	require.Equal(t, sql.ErrNoRows, dao.Delete(folderShare.Id, "testuser2"))
+	require.NoError(t, dao.Delete(folderShare.Id, "testuser1"))
+	_, err = dao.GetAccess("testuser1", "backups/2018/db.sql", "testuser2")
+	require.Equal(t, sql.ErrNoRows, err)
+}
@@ -0,0 +1,171 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+var UploadOffsetConflictError = errors.New("the upload has received more content in the meantime")
+
+const (
+	insertUploadQuery = `INSERT INTO uploads (id, expires_at, owner, name, permissions_str, size, checksum)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *`
+	getUploadQuery = `SELECT * FROM uploads WHERE id = $1 AND owner = $2 AND expires_at > NOW()`
+	// The part is only added if no other one has been added since the upload was read
+	addUploadPartQuery = `UPDATE uploads SET received = received + $1, expires_at = $2 WHERE id = $3 AND received = $4
+RETURNING *`
+	insertUploadPartQuery  = `INSERT INTO upload_parts (upload_id, position, size) VALUES ($1, $2, $3)`
+	getUploadPartsQuery    = `SELECT * FROM upload_parts WHERE upload_id = $1 ORDER BY position`
+	getExpiredUploadsQuery = `SELECT * FROM uploads WHERE expires_at <= NOW() ORDER BY expires_at LIMIT $1`
+	deleteUploadQuery      = `DELETE FROM uploads WHERE id = $1`
+)
+
+type (
+	UploadDao interface {
+		Create(upload *models.Upload) (models.Upload, error)
+		GetByIdAndOwner(id string, owner string) (models.Upload, error)
+		AddPart(upload *models.Upload, size int64, expiresAt time.Time) (models.Upload, error)
+		GetParts(id string) ([]models.UploadPart, error)
+		GetExpired(limit int) ([]models.Upload, error)
+		Delete(id string) error
+	}
+
+	UploadPgDao struct {
+	}
+)
+
+func (dao UploadPgDao) Create(upload *models.Upload) (models.Upload, error) {
+	logs.DaoLog.Debug("Create")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var createdUpload models.Upload
+		row := db.QueryRow(insertUploadQuery, upload.Id, upload.ExpiresAt, upload.Owner, upload.Name, upload.PermissionsStr, upload.Size, upload.Checksum)
+		err := scanUploadRow(row, &createdUpload)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UploadPgDao.Create(upload models.Upload) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Created upload %v", createdUpload.Id)
+		}
+		return createdUpload, err
+	})
+	return res.(models.Upload), err
+}
+
+// GetByIdAndOwner returns the upload if it belongs to the owner. The expired uploads are never returned.
+func (dao UploadPgDao) GetByIdAndOwner(id string, owner string) (models.Upload, error) {
+	logs.DaoLog.Debug("GetByIdAndOwner")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var upload models.Upload
+		err := scanUploadRow(db.QueryRow(getUploadQuery, id, owner), &upload)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UploadPgDao.GetByIdAndOwner(id string, owner string) query. Reason: %v", err)
+		}
+		return upload, err
+	})
+	return res.(models.Upload), err
+}
+
+// AddPart records a part received right after the upload's content, and extends the upload's expiration. If another
+// part has been added since the upload was read, UploadOffsetConflictError is returned.
+func (dao UploadPgDao) AddPart(upload *models.Upload, size int64, expiresAt time.Time) (models.Upload, error) {
+	logs.DaoLog.Debug("AddPart")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var updatedUpload models.Upload
+		err := withTx(db, func(tx *sql.Tx) error {
+			row := tx.QueryRow(addUploadPartQuery, size, expiresAt, upload.Id, upload.Received)
+			if err := scanUploadRow(row, &updatedUpload); err != nil {
+				if err == sql.ErrNoRows {
+					return UploadOffsetConflictError
+				}
+				return err
+			}
+			_, err := tx.Exec(insertUploadPartQuery, upload.Id, upload.Received, size)
+			return err
+		})
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UploadPgDao.AddPart(upload models.Upload, size int64, expiresAt time.Time) query. Reason: %v", err)
+			return models.Upload{}, err
+		}
+		logs.DaoLog.Infof("Upload %v has received %v of %v bytes", updatedUpload.Id, updatedUpload.Received, updatedUpload.Size)
+		return updatedUpload, nil
+	})
+	return res.(models.Upload), err
+}
+
+func (dao UploadPgDao) GetParts(id string) ([]models.UploadPart, error) {
+	logs.DaoLog.Debug("GetParts")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		parts := make([]models.UploadPart, 0)
+		rows, err := db.Query(getUploadPartsQuery, id)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute UploadPgDao.GetParts(id string) query. Reason: %v", err)
+			return parts, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var part models.UploadPart
+			if err := rows.Scan(&part.UploadId, &part.Position, &part.Size); err != nil {
+				logs.DaoLog.Errorf("Unable to execute UploadPgDao.GetParts(id string) query. Reason: %v", err)
+				return parts, err
+			}
+			parts = append(parts, part)
+		}
+		return parts, rows.Err()
+	})
+	return res.([]models.UploadPart), err
+}
+
+func (dao UploadPgDao) GetExpired(limit int) ([]models.Upload, error) {
+	logs.DaoLog.Debug("GetExpired")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		uploads := make([]models.Upload, 0)
+		rows, err := db.Query(getExpiredUploadsQuery, limit)
+		if err != nil {
+			logs.DaoLog.Errorf("Unable to execute UploadPgDao.GetExpired(limit int) query. Reason: %v", err)
+			return uploads, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var upload models.Upload
+			if err := scanUploadRow(rows, &upload); err != nil {
+				logs.DaoLog.Errorf("Unable to execute UploadPgDao.GetExpired(limit int) query. Reason: %v", err)
+				return uploads, err
+			}
+			uploads = append(uploads, upload)
+		}
+		return uploads, rows.Err()
+	})
+	return res.([]models.Upload), err
+}
+
+// Delete removes the upload and its parts' records. Their content must be removed from the storage backend too.
+func (dao UploadPgDao) Delete(id string) error {
+	logs.DaoLog.Debug("Delete")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		_, err := db.Exec(deleteUploadQuery, id)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UploadPgDao.Delete(id string) query. Reason: %v", err)
+		}
+		return nil, err
+	})
+	return err
+}
+
+func scanUploadRow(scanner polimorphicScanner, upload *models.Upload) error {
+	logs.DaoLog.Debug("scanUploadRow")
+	return scanner.Scan(
+		&upload.Id,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+		&upload.ExpiresAt,
+		&upload.Owner,
+		&upload.Name,
+		&upload.PermissionsStr,
+		&upload.Size,
+		&upload.Received,
+		&upload.Checksum)
+}
@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	testUploadId = "0123456789abcdef0123456789abcdef"
+	testChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+func TestUploadPgDao_AddPart(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := UploadPgDao{}
+
+	upload, err := dao.Create(&models.Upload{
+		Id:             testUploadId,
+		ExpiresAt:      time.Now().Add(time.Hour),
+		Owner:          "testuser1",
+		Name:           "video.mp4",
+		PermissionsStr: "rw-r--r--",
+		Size:           10,
+		Checksum:       null.StringFrom(testChecksum),
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), upload.Received)
+	require.Equal(t, null.StringFrom(testChecksum), upload.Checksum)
+
+	// The uploads of other users can't be found
+	_, err = dao.GetByIdAndOwner(testUploadId, "testuser2")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	updatedUpload, err := dao.AddPart(&upload, 4, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(4), updatedUpload.Received)
+	require.True(t, updatedUpload.ExpiresAt.After(upload.ExpiresAt))
+
+	// The upload read before the part was added is outdated
+	_, err = dao.AddPart(&upload, 4, time.Now().Add(2*time.Hour))
+	require.Equal(t, UploadOffsetConflictError, err)
+
+	_, err = dao.AddPart(&updatedUpload, 6, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	parts, err := dao.GetParts(testUploadId)
+	require.NoError(t, err)
+	require.Equal(t, []models.UploadPart{
+		{UploadId: testUploadId, Position: 0, Size: 4},
+		{UploadId: testUploadId, Position: 4, Size: 6},
+	}, parts)
+
+	require.NoError(t, dao.Delete(testUploadId))
+	parts, err = dao.GetParts(testUploadId)
+	require.NoError(t, err)
+	require.Empty(t, parts)
+}
+
+func TestUploadPgDao_GetExpired(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUsersInsertQuery, t)
+	dao := UploadPgDao{}
+
+	_, err := dao.Create(&models.Upload{Id: testUploadId, ExpiresAt: time.Now().Add(-time.Minute), Owner: "testuser1", Name: "video.mp4", PermissionsStr: "rw-r--r--", Size: 10})
+	require.NoError(t, err)
+	_, err = dao.Create(&models.Upload{Id: "fedcba9876543210fedcba9876543210", ExpiresAt: time.Now().Add(time.Hour), Owner: "testuser1", Name: "video.mp4", Size: 10})
+	require.NoError(t, err)
+	// The uploads without permissions keep them empty
+	live, err := dao.GetByIdAndOwner("fedcba9876543210fedcba9876543210", "testuser1")
+	require.NoError(t, err)
+	require.Equal(t, "", live.PermissionsStr)
+
+	_, err = dao.GetByIdAndOwner(testUploadId, "testuser1")
+	require.Equal(t, sql.ErrNoRows, err)
+	expired, err := dao.GetExpired(10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	require.Equal(t, testUploadId, expired[0].Id)
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"mantecabox/logs"
 	"mantecabox/models"
@@ -12,11 +13,18 @@ import (
 )
 
 const (
-	getAllUsersQuery = "SELECT * FROM users WHERE deleted_at IS NULL"
+	getAllUsersQuery = "SELECT * FROM users WHERE deleted_at IS NULL AND email NOT IN (SELECT name FROM groups)"
 	getUserByPkQuery = "SELECT * FROM users WHERE deleted_at IS NULL AND email = $1"
 	insertUserQuery  = "INSERT INTO users(email,password) VALUES($1,$2) RETURNING *;"
 	updateUserQuery  = "UPDATE users SET email=$1, password=$2, two_factor_auth=$3 WHERE email=$4 RETURNING *"
-	deleteUserQuery  = "UPDATE users SET deleted_at = NOW() WHERE email = $1"
+	// The groups' accounts are only deleted with their groups, and can't be managed as users
+	deleteUserQuery  = "UPDATE users SET deleted_at = NOW() WHERE email = $1 AND email NOT IN (SELECT name FROM groups)"
+	setUserRoleQuery = "UPDATE users SET role = $1 WHERE deleted_at IS NULL AND email = $2 AND email NOT IN (SELECT name FROM groups) RETURNING *"
+	// Disabling a user also discards their pending 2FA code, so they can't finish logging in
+	disableUserQuery  = "UPDATE users SET disabled_at = NOW(), two_factor_auth = NULL, two_factor_time = NULL WHERE deleted_at IS NULL AND email = $1 AND email NOT IN (SELECT name FROM groups) RETURNING *"
+	enableUserQuery   = "UPDATE users SET disabled_at = NULL WHERE deleted_at IS NULL AND email = $1 AND email NOT IN (SELECT name FROM groups) RETURNING *"
+	reset2FAQuery     = "UPDATE users SET two_factor_auth = NULL, two_factor_time = NULL WHERE deleted_at IS NULL AND email = $1 AND email NOT IN (SELECT name FROM groups) RETURNING *"
+	revokeTokensQuery = "UPDATE users SET tokens_revoked_at = $1, two_factor_auth = NULL, two_factor_time = NULL WHERE deleted_at IS NULL AND email = $2 AND email NOT IN (SELECT name FROM groups) RETURNING *"
 )
 
 var daoLog = logrus.WithFields(logrus.Fields{"package": "postgres"})
@@ -31,6 +39,10 @@ type (
 		Create(u *models.User) (models.User, error)
 		Update(username string, u *models.User) (models.User, error)
 		Delete(username string) error
+		SetRole(email string, role string) (models.User, error)
+		SetDisabled(email string, disabled bool) (models.User, error)
+		Reset2FA(email string) (models.User, error)
+		RevokeTokens(email string, revokedAt time.Time) (models.User, error)
 	}
 )
 
@@ -142,6 +154,47 @@ func (dao UserPgDao) Delete(email string) error {
 	return err
 }
 
+func (dao UserPgDao) SetRole(email string, role string) (models.User, error) {
+	logs.DaoLog.Debug("SetRole")
+	return updateUserRow("SetRole", setUserRoleQuery, role, email)
+}
+
+// SetDisabled disables the user, so they can't log in nor use their tokens, or enables them again
+func (dao UserPgDao) SetDisabled(email string, disabled bool) (models.User, error) {
+	logs.DaoLog.Debug("SetDisabled")
+	if disabled {
+		return updateUserRow("SetDisabled", disableUserQuery, email)
+	}
+	return updateUserRow("SetDisabled", enableUserQuery, email)
+}
+
+// Reset2FA discards the user's pending 2FA code, so they have to ask for a new one
+func (dao UserPgDao) Reset2FA(email string) (models.User, error) {
+	logs.DaoLog.Debug("Reset2FA")
+	return updateUserRow("Reset2FA", reset2FAQuery, email)
+}
+
+// RevokeTokens invalidates the tokens issued to the user before the date, and their pending 2FA code
+func (dao UserPgDao) RevokeTokens(email string, revokedAt time.Time) (models.User, error) {
+	logs.DaoLog.Debug("RevokeTokens")
+	return updateUserRow("RevokeTokens", revokeTokensQuery, revokedAt, email)
+}
+
+// updateUserRow runs an update of a user that returns it. If the user doesn't exist, sql.ErrNoRows is returned.
+func updateUserRow(method string, query string, args ...interface{}) (models.User, error) {
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var updatedUser models.User
+		err := scanUserRow(db.QueryRow(query, args...), &updatedUser)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UserPgDao.%v query. Reason: %v", method, err)
+		} else {
+			logs.DaoLog.Infof("User %v updated by UserPgDao.%v", updatedUser.Email, method)
+		}
+		return updatedUser, err
+	})
+	return res.(models.User), err
+}
+
 type polimorphicScanner interface {
 	Scan(dest ...interface{}) error
 }
@@ -155,6 +208,10 @@ func scanUserRow(scanner polimorphicScanner, user *models.User) error {
 		&user.Email,
 		&user.Password,
 		&user.TwoFactorAuth,
-		&user.TwoFactorTime)
+		&user.TwoFactorTime,
+		&user.Quota,
+		&user.Role,
+		&user.DisabledAt,
+		&user.TokensRevokedAt)
 	return err
 }
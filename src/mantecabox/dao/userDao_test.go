@@ -3,6 +3,7 @@ package dao
 import (
 	"database/sql"
 	"testing"
+	"time"
 
 	"mantecabox/models"
 	"mantecabox/utilities"
@@ -14,7 +15,11 @@ import (
 	"gopkg.in/guregu/null.v3"
 )
 
-const testUserInsert = `INSERT INTO users (email, password) VALUES ('testuser1', 'testpassword1');`
+const (
+	testUserInsert         = `INSERT INTO users (email, password) VALUES ('testuser1', 'testpassword1');`
+	testGroupAccountInsert = `INSERT INTO users (email, password) VALUES ('testgroup', '!');
+INSERT INTO groups (name) VALUES ('testgroup');`
+)
 
 func TestUserPgDao_GetAll(t *testing.T) {
 	testCases := []struct {
@@ -28,8 +33,8 @@ func TestUserPgDao_GetAll(t *testing.T) {
 VALUES  ('testuser1', 'testpassword1'),
 		('testuser2', 'testpassword2')`,
 			[]models.User{
-				{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
-				{Credentials: models.Credentials{Email: "testuser2", Password: "testpassword2"}},
+				{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
+				{Credentials: models.Credentials{Email: "testuser2", Password: "testpassword2"}, Role: models.UserRoleUser},
 			},
 		},
 		{
@@ -43,7 +48,7 @@ VALUES  ('testuser1', 'testpassword1'),
 VALUES  (NULL, 'testuser1', 'testpassword1'),
 		(NOW(), 'testuser2', 'testpassword2')`,
 			[]models.User{
-				{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+				{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 			},
 		},
 	}
@@ -89,7 +94,7 @@ func TestUserPgDao_GetByPk(t *testing.T) {
 			"When you ask for an existent user, retrieve it",
 			testUserInsert,
 			args{email: "testuser1"},
-			models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}},
+			models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser},
 			false,
 		},
 		{
@@ -131,7 +136,7 @@ VALUES (NOW(), 'testuser1', 'testpassword1');`,
 }
 
 func TestUserPgDao_Create(t *testing.T) {
-	user := models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}}
+	user := models.User{Credentials: models.Credentials{Email: "testuser1", Password: "testpassword1"}, Role: models.UserRoleUser}
 	type args struct {
 		user *models.User
 	}
@@ -186,7 +191,7 @@ func TestUserPgDao_Create(t *testing.T) {
 	}
 }
 func TestUserPgDao_Update(t *testing.T) {
-	user := models.User{Credentials: models.Credentials{Email: "testuser2", Password: "testpassword2"}}
+	user := models.User{Credentials: models.Credentials{Email: "testuser2", Password: "testpassword2"}, Role: models.UserRoleUser}
 	type args struct {
 		email string
 		user  *models.User
@@ -294,6 +299,12 @@ func TestUserPgDao_Delete(t *testing.T) {
 			args{email: ""},
 			true,
 		},
+		{
+			"When you delete the account of a group, return an error",
+			testUserInsert + testGroupAccountInsert,
+			args{email: "testgroup"},
+			true,
+		},
 	}
 
 	db := getDb(t)
@@ -332,6 +343,81 @@ func getDb(t *testing.T) *sql.DB {
 	return db
 }
 
+func TestUserPgDao_SetRole(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUserInsert, t)
+	dao := UserPgDao{}
+	user, err := dao.SetRole("testuser1", models.UserRoleAdmin)
+	require.NoError(t, err)
+	require.Equal(t, models.UserRoleAdmin, user.Role)
+	_, err = dao.SetRole("testuser1", "root")
+	require.Error(t, err)
+	_, err = dao.SetRole("testuser2", models.UserRoleAdmin)
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestUserPgDao_GroupAccounts(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testGroupAccountInsert, t)
+	dao := UserPgDao{}
+	_, err := dao.SetRole("testgroup", models.UserRoleAdmin)
+	require.Equal(t, sql.ErrNoRows, err)
+	_, err = dao.SetDisabled("testgroup", true)
+	require.Equal(t, sql.ErrNoRows, err)
+	_, err = dao.Reset2FA("testgroup")
+	require.Equal(t, sql.ErrNoRows, err)
+	_, err = dao.RevokeTokens("testgroup", time.Now().UTC())
+	require.Equal(t, sql.ErrNoRows, err)
+	require.Equal(t, sql.ErrNoRows, dao.Delete("testgroup"))
+	_, err = dao.GetByPk("testgroup")
+	require.NoError(t, err)
+}
+
+func TestUserPgDao_SetDisabled(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUserInsert, t)
+	dao := UserPgDao{}
+	user, err := dao.SetDisabled("testuser1", true)
+	require.NoError(t, err)
+	require.True(t, user.DisabledAt.Valid)
+	user, err = dao.GetByPk("testuser1")
+	require.NoError(t, err)
+	require.True(t, user.DisabledAt.Valid)
+	user, err = dao.SetDisabled("testuser1", false)
+	require.NoError(t, err)
+	require.False(t, user.DisabledAt.Valid)
+	_, err = dao.SetDisabled("testuser2", true)
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestUserPgDao_RevokeTokens(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanAndPopulateDb(db, testUserInsert, t)
+	dao := UserPgDao{}
+	_, err := dao.Update("testuser1", &models.User{
+		Credentials: models.Credentials{
+			Email:         "testuser1",
+			Password:      "testpassword1",
+			TwoFactorAuth: null.StringFrom("012345"),
+		},
+	})
+	require.NoError(t, err)
+	revokedAt := time.Now().UTC().Truncate(time.Second)
+	user, err := dao.RevokeTokens("testuser1", revokedAt)
+	require.NoError(t, err)
+	require.True(t, revokedAt.Equal(user.TokensRevokedAt.Time))
+	require.False(t, user.TwoFactorAuth.Valid)
+	user, err = dao.Reset2FA("testuser1")
+	require.NoError(t, err)
+	require.False(t, user.TwoFactorAuth.Valid)
+	_, err = dao.RevokeTokens("testuser2", revokedAt)
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
 func cleanAndPopulateDb(db *sql.DB, insertQuery string, t *testing.T) {
 	cleanDb(db)
 	if insertQuery != "" {
@@ -343,7 +429,17 @@ func cleanAndPopulateDb(db *sql.DB, insertQuery string, t *testing.T) {
 func cleanDb(db *sql.DB) {
 	db.Exec("DELETE FROM users")
 	db.Exec("DELETE FROM files")
+	db.Exec("DELETE FROM blobs")
 	db.Exec("DELETE FROM login_attempts")
+	db.Exec("DELETE FROM user_keys")
+	db.Exec("DELETE FROM key_rotations")
+	db.Exec("DELETE FROM uploads")
+	db.Exec("DELETE FROM folders")
+	db.Exec("DELETE FROM retention_policies")
+	db.Exec("DELETE FROM scrub_reports")
+	db.Exec("DELETE FROM shares")
+	db.Exec("DELETE FROM links")
+	db.Exec("DELETE FROM groups")
 }
 
 func requireUserEqualCheckingErrors(t *testing.T, wantErr bool, err error, expected models.User, actual models.User) {
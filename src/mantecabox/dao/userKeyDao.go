@@ -0,0 +1,95 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	getUserKeyQuery = `SELECT * FROM user_keys WHERE "user" = $1`
+	// If another request has already created the user's key, we get that one, so there's never more than one
+	insertUserKeyQuery = `INSERT INTO user_keys ("user", wrapped_key) VALUES ($1, $2)
+ON CONFLICT ("user") DO UPDATE SET "user" = EXCLUDED."user"
+RETURNING *`
+	deleteUserKeyQuery = `DELETE FROM user_keys WHERE "user" = $1`
+)
+
+type (
+	UserKeyPgDao struct {
+	}
+
+	UserKeyDao interface {
+		GetByUser(email string) (models.UserKey, error)
+		Create(key *models.UserKey) (models.UserKey, error)
+		Delete(email string) error
+	}
+)
+
+func (dao UserKeyPgDao) GetByUser(email string) (models.UserKey, error) {
+	logs.DaoLog.Debug("GetByUser")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var key models.UserKey
+		err := scanUserKeyRow(db.QueryRow(getUserKeyQuery, email), &key)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UserKeyPgDao.GetByUser(email string) query. Reason: %v", err)
+		}
+		return key, err
+	})
+	return res.(models.UserKey), err
+}
+
+func (dao UserKeyPgDao) Create(key *models.UserKey) (models.UserKey, error) {
+	logs.DaoLog.Debug("Create")
+	res, err := withDb(func(db *sql.DB) (interface{}, error) {
+		var createdKey models.UserKey
+		err := scanUserKeyRow(db.QueryRow(insertUserKeyQuery, key.User, key.WrappedKey), &createdKey)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UserKeyPgDao.Create(key models.UserKey) query. Reason: %v", err)
+		} else {
+			logs.DaoLog.Infof("Created data key for user %v", createdKey.User)
+		}
+		return createdKey, err
+	})
+	return res.(models.UserKey), err
+}
+
+// Delete removes the user's data key. Without it, the user's blobs can't be decrypted anymore.
+func (dao UserKeyPgDao) Delete(email string) error {
+	logs.DaoLog.Debug("Delete")
+	_, err := withDb(func(db *sql.DB) (interface{}, error) {
+		result, err := db.Exec(deleteUserKeyQuery, email)
+		if err != nil {
+			logs.DaoLog.Infof("Unable to execute UserKeyPgDao.Delete(email string) query. Reason: %v", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			logs.DaoLog.Info("Some error occured during deleting:", err)
+			return nil, err
+		}
+		switch {
+		case rowsAffected == 0:
+			err = sql.ErrNoRows
+		case rowsAffected > 1:
+			err = errors.New("more than one deleted")
+		}
+		if err != nil {
+			logs.DaoLog.Info("Unable to delete data key of user \""+email+"\" correctly. Reason:", err)
+		} else {
+			logs.DaoLog.Info("Data key of user \"" + email + "\" successfully deleted")
+		}
+		return nil, err
+	})
+	return err
+}
+
+func scanUserKeyRow(scanner polimorphicScanner, key *models.UserKey) error {
+	logs.DaoLog.Debug("scanUserKeyRow")
+	return scanner.Scan(
+		&key.CreatedAt,
+		&key.User,
+		&key.WrappedKey)
+}
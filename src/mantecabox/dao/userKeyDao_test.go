@@ -0,0 +1,145 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testUserKeyInsert = testUserInsert + `INSERT INTO user_keys ("user", wrapped_key) VALUES ('testuser1', 'wrappedkey1');`
+
+func TestUserKeyPgDao_GetByUser(t *testing.T) {
+	testCases := []struct {
+		name        string
+		insertQuery string
+		email       string
+		want        models.UserKey
+		wantErr     bool
+	}{
+		{
+			"When the user has a key, retrieve it",
+			testUserKeyInsert,
+			"testuser1",
+			models.UserKey{User: "testuser1", WrappedKey: []byte("wrappedkey1")},
+			false,
+		},
+		{
+			"When the user has no key, return an error",
+			testUserInsert,
+			"testuser1",
+			models.UserKey{},
+			true,
+		},
+	}
+
+	db := getDb(t)
+	defer db.Close()
+
+	for _, testCase := range testCases {
+		cleanAndPopulateDb(db, testCase.insertQuery, t)
+
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := UserKeyPgDao{}.GetByUser(testCase.email)
+			requireUserKeyEqualCheckingErrors(t, testCase.wantErr, err, testCase.want, got)
+		})
+	}
+}
+
+func TestUserKeyPgDao_Create(t *testing.T) {
+	testCases := []struct {
+		name        string
+		insertQuery string
+		key         models.UserKey
+		want        models.UserKey
+		wantErr     bool
+	}{
+		{
+			"When the user has no key, insert it",
+			testUserInsert,
+			models.UserKey{User: "testuser1", WrappedKey: []byte("wrappedkey2")},
+			models.UserKey{User: "testuser1", WrappedKey: []byte("wrappedkey2")},
+			false,
+		},
+		{
+			"When the user already has a key, return the existing one",
+			testUserKeyInsert,
+			models.UserKey{User: "testuser1", WrappedKey: []byte("wrappedkey2")},
+			models.UserKey{User: "testuser1", WrappedKey: []byte("wrappedkey1")},
+			false,
+		},
+		{
+			"When the user doesn't exist, return an error",
+			"",
+			models.UserKey{User: "testuser1", WrappedKey: []byte("wrappedkey2")},
+			models.UserKey{},
+			true,
+		},
+	}
+
+	db := getDb(t)
+	defer db.Close()
+
+	for _, testCase := range testCases {
+		cleanAndPopulateDb(db, testCase.insertQuery, t)
+
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := UserKeyPgDao{}.Create(&testCase.key)
+			requireUserKeyEqualCheckingErrors(t, testCase.wantErr, err, testCase.want, got)
+		})
+	}
+}
+
+func TestUserKeyPgDao_Delete(t *testing.T) {
+	testCases := []struct {
+		name        string
+		insertQuery string
+		email       string
+		wantErr     bool
+	}{
+		{
+			"When the user has a key, delete it",
+			testUserKeyInsert,
+			"testuser1",
+			false,
+		},
+		{
+			"When the user has no key, return an error",
+			testUserInsert,
+			"testuser1",
+			true,
+		},
+	}
+
+	db := getDb(t)
+	defer db.Close()
+
+	for _, testCase := range testCases {
+		cleanAndPopulateDb(db, testCase.insertQuery, t)
+
+		t.Run(testCase.name, func(t *testing.T) {
+			err := UserKeyPgDao{}.Delete(testCase.email)
+			if testCase.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				_, err = UserKeyPgDao{}.GetByUser(testCase.email)
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func requireUserKeyEqualCheckingErrors(t *testing.T, wantErr bool, err error, expected models.UserKey, actual models.UserKey) {
+	if wantErr {
+		require.Error(t, err)
+	} else {
+		require.NoError(t, err)
+		// We ignore the timestamp, but we check it is valid
+		require.WithinDuration(t, time.Now(), actual.CreatedAt, 24*time.Hour)
+		actual.CreatedAt = time.Time{}
+	}
+	require.Equal(t, expected, actual)
+}
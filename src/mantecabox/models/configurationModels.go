@@ -23,15 +23,42 @@ type Mail struct {
 	Password string `json:"password"`
 }
 
+type S3 struct {
+	Endpoint  string `json:"endpoint"`
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	UseSSL    bool   `json:"use_ssl"`
+	PathStyle bool   `json:"path_style"`
+}
+
+type Storage struct {
+	Engine string `json:"engine"`
+	S3     S3     `json:"s3"`
+}
+
+type Compression struct {
+	Codec string `json:"codec"`
+	Level int    `json:"level"`
+}
+
 type Configuration struct {
-	AesKey                    string   `json:"aes_key"`
-	TokenTimeout              string   `json:"token_timeout"`
-	BlockedLoginTimeLimit     string   `json:"blocked_login_time_limit"`
-	VerificationMailTimeLimit string   `json:"verification_mail_time_limit"`
-	MaxUnsuccessfulAttempts   int      `json:"max_unsuccessful_attempts"`
-	FilesPath                 string   `json:"files_path"`
-	UseGDrive                 bool     `json:"use_gdrive"`
-	Database                  Database `json:"database"`
-	Server                    Server   `json:"server"`
-	Mail                      Mail     `json:"mail"`
+	AesKey                    string          `json:"aes_key"`
+	TokenTimeout              string          `json:"token_timeout"`
+	BlockedLoginTimeLimit     string          `json:"blocked_login_time_limit"`
+	VerificationMailTimeLimit string          `json:"verification_mail_time_limit"`
+	MaxUnsuccessfulAttempts   int             `json:"max_unsuccessful_attempts"`
+	UploadExpiration          string          `json:"upload_expiration"`
+	TrashRetention            string          `json:"trash_retention"`
+	Retention                 RetentionPolicy `json:"retention"`
+	DefaultQuota              int64           `json:"default_quota"`
+	Compression               Compression     `json:"compression"`
+	ScrubInterval             string          `json:"scrub_interval"`
+	Admins                    []string        `json:"admins"`
+	FilesPath                 string          `json:"files_path"`
+	Storage                   Storage         `json:"storage"`
+	Database                  Database        `json:"database"`
+	Server                    Server          `json:"server"`
+	Mail                      Mail            `json:"mail"`
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -24,34 +26,356 @@ type User struct {
 	TimeStamp
 	SoftDelete
 	Credentials
+	// Quota is the maximum number of bytes the user can store. If it's not set, the configured default applies.
+	Quota null.Int `json:"quota"`
+	Role  string   `json:"role"`
+	// DisabledAt is set while the user is disabled, so they can't log in
+	DisabledAt null.Time `json:"disabled_at"`
+	// TokensRevokedAt invalidates the tokens issued before it, logging the user out
+	TokensRevokedAt null.Time `json:"-"`
 }
 
+// The roles of the users: the admins can also manage the other users and the server
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
 type UserDto struct {
 	Email string `json:"email"`
 }
 
+// UserDetailsDto is the user as the admins see them
+type UserDetailsDto struct {
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	Quota      null.Int  `json:"quota"`
+	CreatedAt  null.Time `json:"created_at"`
+	DisabledAt null.Time `json:"disabled_at"`
+}
+
+func UserToDetailsDto(user User) UserDetailsDto {
+	return UserDetailsDto{
+		Email:      user.Email,
+		Role:       user.Role,
+		Quota:      user.Quota,
+		CreatedAt:  user.CreatedAt,
+		DisabledAt: user.DisabledAt,
+	}
+}
+
 type File struct {
 	Id int64 `json:"id"`
 	TimeStamp
 	SoftDelete
-	Name  string `json:"name"`
-	Owner User   `json:"owner"`
-	GdriveID null.String `json:"gdrive_id"`
-	PermissionsStr string `json:"permissions"`
+	Name           string      `json:"name"`
+	Owner          User        `json:"owner"`
+	GdriveID       null.String `json:"gdrive_id"`
+	PermissionsStr string      `json:"permissions"`
+	BlobId         null.Int    `json:"-"`
+	Chunked        bool        `json:"-"`
+	Folder         string      `json:"folder"`
+	LogicalId      int64       `json:"logical_id"`
+	Size           int64       `json:"size"`
+	StoredSize     int64       `json:"stored_size"`
+	Checksum       null.String `json:"checksum"`
+	Compression    string      `json:"compression"`
 }
 
 type FileDTO struct {
 	Id int64 `json:"id"`
 	TimeStamp
+	Name           string      `json:"name"`
+	PermissionsStr string      `json:"permissions"`
+	LogicalId      int64       `json:"logical_id"`
+	Size           int64       `json:"size"`
+	StoredSize     int64       `json:"stored_size"`
+	Checksum       null.String `json:"checksum"`
+	Compression    string      `json:"compression"`
+}
+
+// FileCopy is the destination of a file's copy. If no version is given, the last one is copied.
+type FileCopy struct {
+	Name    string   `json:"name"`
+	Version null.Int `json:"version"`
+}
+
+// FilePatch changes some of the file's attributes. The ones that are not given are left as they are.
+type FilePatch struct {
+	Name           null.String `json:"name"`
+	PermissionsStr null.String `json:"permissions"`
+}
+
+// RetentionPolicy tells which versions of a file are kept. The current version is always kept, and so is any version
+// matched by one of the rules; the others are pruned. A policy without rules keeps all the versions.
+//   - KeepLast keeps the N most recent versions.
+//   - KeepWithin keeps the versions younger than the duration, such as "168h".
+//   - KeepDaily keeps the last version of each of the last N days.
+//   - KeepMonthly keeps the last version of each of the last N months.
+type RetentionPolicy struct {
+	Owner       string    `json:"-"`
+	UpdatedAt   null.Time `json:"updated_at"`
+	KeepLast    int       `json:"keep_last"`
+	KeepWithin  string    `json:"keep_within"`
+	KeepDaily   int       `json:"keep_daily"`
+	KeepMonthly int       `json:"keep_monthly"`
+}
+
+// The access that a share grants: reading the file, or also uploading new versions of it
+const (
+	ShareAccessRead  = "read"
+	ShareAccessWrite = "write"
+)
+
+// Share grants another user access to one of the owner's files, or to everything in one of their folders. The
+// folders' paths end with a slash, as in the /files routes.
+type Share struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Owner     string    `json:"owner"`
+	Path      string    `json:"path"`
+	Grantee   string    `json:"grantee"`
+	Access    string    `json:"access"`
+}
+
+// The roles of the groups' members: the members access the group's files, and the managers also add and remove members
+const (
+	GroupRoleMember  = "member"
+	GroupRoleManager = "manager"
+)
+
+// Group is a storage space shared by its members. Its files belong to the group, so they outlive the members' accounts.
+type Group struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupCreation is a new group, with the user who will be its first manager if one is given
+type GroupCreation struct {
+	Name    string `json:"name"`
+	Manager string `json:"manager"`
+}
+
+// GroupMember is the membership of a user in a group
+type GroupMember struct {
+	Group     string    `json:"group"`
+	Member    string    `json:"member"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LinkOptions are the limits of a new public link. If no version is given, the link serves the file's last version.
+// The expiry is a duration such as "72h", and no expiry, download limit or password means none.
+type LinkOptions struct {
+	Version      null.Int `json:"version"`
+	ExpiresIn    string   `json:"expires_in"`
+	MaxDownloads null.Int `json:"max_downloads"`
+	Password     string   `json:"password"`
+}
+
+// Link lets anyone who knows its token download one of the owner's files without logging in, until it expires, it's
+// revoked or it reaches its maximum downloads. The name is the file's current path, and the URL isn't stored.
+type Link struct {
+	Id           int64       `json:"id"`
+	CreatedAt    time.Time   `json:"created_at"`
+	Token        string      `json:"token"`
+	Owner        string      `json:"owner"`
+	LogicalId    int64       `json:"logical_id"`
+	Version      null.Int    `json:"version"`
+	ExpiresAt    null.Time   `json:"expires_at"`
+	MaxDownloads null.Int    `json:"max_downloads"`
+	Downloads    int64       `json:"downloads"`
+	Password     null.String `json:"-"`
+	RevokedAt    null.Time   `json:"revoked_at"`
+	Name         string      `json:"name"`
+	Url          string      `json:"url"`
+}
+
+// LinkAccess records who tried to download a file through a public link, and whether they could
+type LinkAccess struct {
+	Id         int64     `json:"id"`
+	LinkId     int64     `json:"link_id"`
+	AccessedAt time.Time `json:"accessed_at"`
+	Ip         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Granted    bool      `json:"granted"`
+}
+
+// TrashedFileDTO is a deleted file that can still be restored. It's identified by its logical file, as there may be
+// several trashed files with the same path.
+type TrashedFileDTO struct {
+	Id int64 `json:"id"`
+	SoftDelete
 	Name           string `json:"name"`
 	PermissionsStr string `json:"permissions"`
 }
 
+// StorageUsage is the space taken by some of the user's versions: their plaintext size, and the size of their
+// encrypted content in the storage
+type StorageUsage struct {
+	Versions   int64 `json:"versions"`
+	Size       int64 `json:"size"`
+	StoredSize int64 `json:"stored_size"`
+}
+
+// Usage is the space taken by the user's files, broken down by the current version of the live files, their old
+// versions and the trashed files. The quota is counted against the plaintext size of all of them, and it's null if
+// the user has no limit.
+type Usage struct {
+	Quota       null.Int     `json:"quota"`
+	Used        int64        `json:"used"`
+	Live        StorageUsage `json:"live"`
+	OldVersions StorageUsage `json:"old_versions"`
+	Trash       StorageUsage `json:"trash"`
+}
+
+// Folder is one of the owner's folders. The files are named after their full path, so the folders are only needed to
+// list their content, and to keep them even if they are empty. The root folder is the empty path, and is never stored.
+type Folder struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Owner     string    `json:"owner"`
+	Path      string    `json:"path"`
+	Parent    string    `json:"parent"`
+}
+
+// FolderDTO is the content of a folder: the path of its subfolders and the last version of its files
+type FolderDTO struct {
+	Path    string    `json:"path"`
+	Folders []string  `json:"folders"`
+	Files   []FileDTO `json:"files"`
+}
+
+// UserKey is the user's data key, wrapped with the master key
+type UserKey struct {
+	CreatedAt  time.Time `json:"created_at"`
+	User       string    `json:"user"`
+	WrappedKey []byte    `json:"-"`
+}
+
+// The phases of a master key rotation, in the order they are run
+const (
+	RotationPhaseUserKeys  = "user_keys"
+	RotationPhasePasswords = "passwords"
+	RotationPhaseBlobs     = "blobs"
+	RotationPhaseDone      = "done"
+)
+
+// KeyRotation records the progress of a master key rotation, so it can be resumed if it's interrupted. The keys
+// themselves are never stored, only their fingerprints.
+type KeyRotation struct {
+	Id int64 `json:"id"`
+	TimeStamp
+	FinishedAt        null.Time `json:"finished_at"`
+	OldKeyFingerprint string    `json:"old_key_fingerprint"`
+	NewKeyFingerprint string    `json:"new_key_fingerprint"`
+	Phase             string    `json:"phase"`
+	Cursor            string    `json:"cursor"`
+	Processed         int64     `json:"processed"`
+}
+
+// Blob is the content of one or more of the owner's files. It's identified by the keyed hash of its plaintext, and
+// removed from the storage when no file references it.
+type Blob struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Owner     string    `json:"owner"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	RefCount  int64     `json:"ref_count"`
+	Stored    bool      `json:"stored"`
+	// Compression is the codec the content was compressed with before encrypting it, if any
+	Compression string `json:"compression"`
+	StoredSize  int64  `json:"stored_size"`
+}
+
+// The kinds of problems that the scrubber finds
+const (
+	// ScrubIssueMissingBlob is a live version whose content is not in the storage
+	ScrubIssueMissingBlob = "missing_blob"
+	// ScrubIssueCorruptedBlob is a stored blob that can't be decrypted, or that is incomplete
+	ScrubIssueCorruptedBlob = "corrupted_blob"
+	// ScrubIssueChecksumMismatch is a live version whose content doesn't match its checksum
+	ScrubIssueChecksumMismatch = "checksum_mismatch"
+	// ScrubIssueOrphanBlob is a stored blob that no row references
+	ScrubIssueOrphanBlob = "orphan_blob"
+)
+
+// ScrubReport is the result of checking the stored blobs against the metadata
+type ScrubReport struct {
+	Id              int64        `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	FinishedAt      time.Time    `json:"finished_at"`
+	CheckedVersions int64        `json:"checked_versions"`
+	CheckedBlobs    int64        `json:"checked_blobs"`
+	Issues          []ScrubIssue `json:"issues"`
+}
+
+// ScrubIssue is a problem found in a blob, identified by its storage key. The version is not given for orphan blobs.
+type ScrubIssue struct {
+	Kind   string   `json:"kind"`
+	Key    string   `json:"key"`
+	FileId null.Int `json:"file_id"`
+	Detail string   `json:"detail"`
+}
+
+// ChunkList is the ordered list of a file's chunks, identified by the SHA-256 digest of their content. If the checksum
+// of the whole file is given, the file's content must match it.
+type ChunkList struct {
+	Chunks   []string    `json:"chunks"`
+	Checksum null.String `json:"checksum"`
+}
+
+type MissingChunks struct {
+	Missing []string `json:"missing"`
+}
+
+// Upload is a resumable upload session. The content received so far is kept in parts until the upload is finalized
+// into a new version of the file, whose content must match the checksum if it's given.
+type Upload struct {
+	Id string `json:"id"`
+	TimeStamp
+	ExpiresAt      time.Time   `json:"expires_at"`
+	Owner          string      `json:"owner"`
+	Name           string      `json:"name"`
+	PermissionsStr string      `json:"permissions"`
+	Size           int64       `json:"size"`
+	Received       int64       `json:"received"`
+	Checksum       null.String `json:"checksum"`
+}
+
+// UploadPart is a piece of an upload's content, starting at the given position
+type UploadPart struct {
+	UploadId string `json:"upload_id"`
+	Position int64  `json:"position"`
+	Size     int64  `json:"size"`
+}
+
+type BlobInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
 func FileToDto(file File) FileDTO {
 	return FileDTO{
 		Id:             file.Id,
 		TimeStamp:      file.TimeStamp,
 		Name:           file.Name,
 		PermissionsStr: file.PermissionsStr,
+		LogicalId:      file.LogicalId,
+		Size:           file.Size,
+		StoredSize:     file.StoredSize,
+		Checksum:       file.Checksum,
+		Compression:    file.Compression,
+	}
+}
+
+func TrashedFileToDto(file File) TrashedFileDTO {
+	return TrashedFileDTO{
+		Id:             file.LogicalId,
+		SoftDelete:     file.SoftDelete,
+		Name:           file.Name,
+		PermissionsStr: file.PermissionsStr,
 	}
 }
@@ -6,6 +6,9 @@ import (
 	"gopkg.in/guregu/null.v3"
 )
 
+// ChecksumHeader tells the hex encoded SHA-256 checksum of a file's content
+const ChecksumHeader = "X-Checksum-Sha256"
+
 type JwtResponse struct {
 	Code   int       `json:"code"`
 	Token  string    `json:"token"`
@@ -21,6 +24,27 @@ type LoginAttempt struct {
 	Successful bool        `json:"successful"`
 }
 
+// LoginAttemptDto is the login attempt as the admins see it, without the user's credentials
+type LoginAttemptDto struct {
+	Id         int64       `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	User       string      `json:"user"`
+	UserAgent  null.String `json:"user_agent"`
+	IP         null.String `json:"ip"`
+	Successful bool        `json:"successful"`
+}
+
+func LoginAttemptToDto(attempt LoginAttempt) LoginAttemptDto {
+	return LoginAttemptDto{
+		Id:         attempt.Id,
+		CreatedAt:  attempt.CreatedAt,
+		User:       attempt.User.Email,
+		UserAgent:  attempt.UserAgent,
+		IP:         attempt.IP,
+		Successful: attempt.Successful,
+	}
+}
+
 type ServerError struct {
 	Message string `json:"message"`
 }
@@ -2,14 +2,32 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"time"
 
+	"mantecabox/models"
+	"mantecabox/services"
 	"mantecabox/utilities"
 	"mantecabox/webservice"
 
+	"github.com/alexflint/go-arg"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	var args struct {
+		Operation string `arg:"positional" help:"(serve|rotate-key|scrub)"`
+		OldKey    string `arg:"--old-key" help:"current master key (rotate-key). Defaults to $MANTECABOX_OLD_KEY"`
+		NewKey    string `arg:"--new-key" help:"new master key (rotate-key). Defaults to $MANTECABOX_NEW_KEY"`
+		BatchSize int    `arg:"--batch-size" help:"items processed between progress records (rotate-key)"`
+	}
+	parser := arg.MustParse(&args)
+	switch args.Operation {
+	case "", "serve", "rotate-key", "scrub":
+	default:
+		parser.Fail(fmt.Sprintf(`Operation "%v" not recognized`, args.Operation))
+	}
+
 	config, err := utilities.GetConfiguration()
 	if err != nil {
 		logrus.Fatal(fmt.Sprintf("Unable to read configuration file: %v", err))
@@ -26,10 +44,121 @@ func main() {
 		logrus.Fatal("Unable to run migrations: " + err.Error())
 	}
 
+	if args.Operation == "rotate-key" {
+		rotateKey(&config, args.OldKey, args.NewKey, args.BatchSize)
+		return
+	}
+	if args.Operation == "scrub" {
+		scrub(&config)
+		return
+	}
+
+	userService := services.NewUserService(&config)
+	if err = userService.GrantAdmins(config.Admins); err != nil {
+		logrus.Fatal("Unable to grant admin role: " + err.Error())
+	}
+
 	r := webservice.Router(true, &config)
 	if r == nil {
 		logrus.Fatal(fmt.Sprintf("Unable to start web server: %v", err))
 		return
 	}
+	startBackgroundJobs(&config)
 	r.RunTLS(fmt.Sprintf(":%v", config.Server.Port), config.Server.Cert, config.Server.Key)
 }
+
+// startBackgroundJobs runs the maintenance tasks while the server is up
+func startBackgroundJobs(config *models.Configuration) {
+	uploadService := services.NewUploadService(config)
+	runPeriodically("Expired uploads purge", time.Hour, func() error {
+		purged, err := uploadService.PurgeExpiredUploads()
+		if purged > 0 {
+			logrus.Infof("%v expired uploads purged", purged)
+		}
+		return err
+	})
+	trashService := services.NewTrashService(config)
+	runPeriodically("Expired trash purge", time.Hour, func() error {
+		purged, err := trashService.PurgeExpiredTrash()
+		if purged > 0 {
+			logrus.Infof("%v trashed files purged", purged)
+		}
+		return err
+	})
+	retentionService := services.NewRetentionService(config)
+	runPeriodically("Versions pruning", time.Hour, func() error {
+		pruned, err := retentionService.PruneVersions()
+		if pruned > 0 {
+			logrus.Infof("%v old versions pruned", pruned)
+		}
+		return err
+	})
+	scrubService := services.NewScrubService(config)
+	runPeriodically("Blobs scrub", time.Hour, func() error {
+		_, _, err := scrubService.ScrubIfDue()
+		return err
+	})
+	// The sizes of the versions stored before the blobs are only known by the storage, so they are backfilled once at
+	// startup, instead of by the migration that added the sizes
+	fileService := services.NewFileService(config)
+	go func() {
+		backfilled, err := fileService.BackfillLegacySizes()
+		if backfilled > 0 {
+			logrus.Infof("%v legacy versions sized", backfilled)
+		}
+		if err != nil {
+			logrus.Errorf("Legacy sizes backfill failed: %v", err)
+		}
+	}()
+}
+
+// runPeriodically runs the job in the background right away, and then every interval
+func runPeriodically(name string, interval time.Duration, job func() error) {
+	go func() {
+		for {
+			if err := job(); err != nil {
+				logrus.Errorf("%v failed: %v", name, err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// rotateKey re-encrypts everything that depends on the master key. The keys can be passed through environment
+// variables, so they don't show up in the process list.
+func rotateKey(config *models.Configuration, oldKey, newKey string, batchSize int) {
+	if oldKey == "" {
+		oldKey = os.Getenv("MANTECABOX_OLD_KEY")
+	}
+	if newKey == "" {
+		newKey = os.Getenv("MANTECABOX_NEW_KEY")
+	}
+	keyRotationService := services.NewKeyRotationService(config)
+	if keyRotationService == nil {
+		logrus.Fatal("Unable to start the key rotation: the storage backend is not available")
+	}
+	rotation, err := keyRotationService.RotateMasterKey(oldKey, newKey, batchSize)
+	if err != nil {
+		logrus.Fatal(fmt.Sprintf("Key rotation interrupted (run it again with the same keys to resume it): %v", err))
+	}
+	logrus.Infof("Key rotation %v finished: %v items processed. Set the new key as aes_key in the configuration file.", rotation.Id, rotation.Processed)
+}
+
+// scrub checks the stored blobs right away, and exits with an error if it finds any problem
+func scrub(config *models.Configuration) {
+	scrubService := services.NewScrubService(config)
+	if scrubService == nil {
+		logrus.Fatal("Unable to start the scrub: the storage backend is not available")
+	}
+	report, err := scrubService.Scrub()
+	if err != nil {
+		logrus.Fatal(fmt.Sprintf("Scrub interrupted: %v", err))
+	}
+	for _, issue := range report.Issues {
+		logrus.Warnf("%v: %v (version %v) %v", issue.Kind, issue.Key, issue.FileId.Int64, issue.Detail)
+	}
+	logrus.Infof("Scrub %v finished: %v versions and %v blobs checked, %v issues found", report.Id, report.CheckedVersions, report.CheckedBlobs, len(report.Issues))
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
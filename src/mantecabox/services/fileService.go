@@ -1,7 +1,11 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -9,7 +13,9 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"mantecabox/dao"
 	"mantecabox/logs"
@@ -17,7 +23,29 @@ import (
 	"mantecabox/utilities"
 
 	"github.com/go-http-utils/headers"
-	"google.golang.org/api/drive/v3"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	// sniffLength is the maximum of bytes that http.DetectContentType considers
+	sniffLength = 512
+	// legacySizesBatchSize is how many versions are sized at once when the legacy sizes are backfilled
+	legacySizesBatchSize = 100
+)
+
+var (
+	InvalidChunkDigestError  = errors.New("the chunks' digests must be hex encoded SHA-256 hashes")
+	ChunkDigestMismatchError = errors.New("the chunk's content does not match its digest")
+	ChunkTooLargeError       = errors.New(fmt.Sprintf("the chunks can't be larger than %v bytes", utilities.MaxChunkSize))
+	MissingChunkError        = dao.MissingChunkError
+	InvalidSeekError         = errors.New("invalid seek position")
+	FileTooLargeError        = errors.New("the file is larger than the user's quota")
+	QuotaExceededError       = errors.New("the file doesn't fit in the user's quota")
+	InvalidChecksumError     = errors.New("the checksum must be a hex encoded SHA-256 hash")
+	ChecksumMismatchError    = errors.New("the file's content does not match its checksum")
+
+	// The checksums of the files are written as the digests of the chunks
+	chunkDigestRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
 )
 
 type (
@@ -26,22 +54,73 @@ type (
 		GetFileVersionsByNameAndOwner(filename string, user *models.User) ([]models.File, error)
 		GetLastVersionFileByNameAndOwner(filename string, user *models.User) (models.File, error)
 		GetFileByVersion(filename string, version int64, user *models.User) (models.File, error)
-		GetFileStream(fileDecrypt []byte, file models.File) (contentLength int64, contentType string, reader *bytes.Reader, extraHeaders map[string]string)
-		GetDecryptedLocalFile(file models.File) ([]byte, error)
+		AuthorizeAccess(path string, owner string, user models.User, access string) (models.User, error)
+		GetFileStream(file models.File) (contentLength int64, contentType string, reader FileContent, extraHeaders map[string]string, err error)
 		CreateFile(file *models.File) (models.File, error)
-		SetGdriveId(id int64, gdriveId string) error
 		SaveFile(file multipart.File, uploadedFile models.File) error
+		SaveFileContent(uploadedFile models.File, open func() (io.ReadCloser, error)) error
+		MoveFile(filename string, newName string, user *models.User) (models.File, error)
+		SetPermissions(filename string, permissionsStr string, user *models.User) (models.File, error)
+		CopyFile(filename string, version null.Int, newName string, user *models.User) (models.File, error)
+		RestoreFileVersion(filename string, version int64, user *models.User) (models.File, error)
 		DeleteFile(filename string, user *models.User) (models.File, error)
-		createDirIfNotExists()
-		UploadFileGDrive(srv *drive.Service, filename string, file multipart.File) (*drive.File, error)
-		DownloadFile(srv *drive.Service, filedId string, file models.File) ([]byte, error)
-		GetFileGDrive(file models.File) ([]byte, error)
+		GetMissingChunks(user models.User, digests []string) ([]string, error)
+		SaveChunk(user models.User, digest string, content io.Reader) error
+		CreateChunkedFile(file *models.File, digests []string) (models.File, error)
+		CheckQuota(user models.User, size int64) error
+		GetUsage(user models.User) (models.Usage, error)
+		BackfillLegacySizes() (int, error)
 	}
 
 	FileServiceImpl struct {
 		configuration *models.Configuration
 		fileDao       dao.FileDao
-		aesCipher     utilities.AesCTRCipher
+		blobDao       dao.BlobDao
+		folderDao     dao.FolderDao
+		userDao       dao.UserDao
+		shareDao      dao.ShareDao
+		groupDao      dao.GroupDao
+		folderService FolderService
+		keyService    KeyService
+		storage       StorageBackend
+	}
+
+	// blobReadCloser reads the decrypted content, but closes the blob it comes from
+	blobReadCloser struct {
+		io.Reader
+		io.Closer
+	}
+
+	// decompressedReadCloser reads the decompressed content, and closes both the decompressor and the blob
+	decompressedReadCloser struct {
+		io.ReadCloser
+		blob io.Closer
+	}
+
+	// chunkedReader joins the decrypted content of several blobs, opening each of them only when it's reached. The
+	// first one is read from the offset. The blobs are decompressed with their codec in compressions, if it's given.
+	chunkedReader struct {
+		storage      StorageBackend
+		blobCipher   utilities.BlobCipher
+		keys         []string
+		compressions []string
+		offset       int64
+		current      io.ReadCloser
+	}
+
+	// FileContent is the decrypted content of a file's version, which can be read from any position
+	FileContent interface {
+		io.ReadSeeker
+		io.Closer
+	}
+
+	// seekableContent opens the content again from the new position when it's read after having been moved
+	seekableContent struct {
+		open     func(offset int64) (io.ReadCloser, error)
+		size     int64
+		offset   int64
+		current  io.ReadCloser
+		position int64
 	}
 )
 
@@ -49,24 +128,26 @@ func NewFileService(configuration *models.Configuration) FileService {
 	if configuration == nil {
 		return nil
 	}
-	if configuration.FilesPath == "" {
-		configuration.FilesPath = "files"
-	}
-	// Maybe the config path didn't ended with folder's slash, so we add it
-	if configuration.FilesPath[len(configuration.FilesPath)-1] != '/' {
-		configuration.FilesPath += "/"
+	storage := StorageBackendFactory(configuration)
+	if storage == nil {
+		return nil
 	}
-	fileServiceImpl := FileServiceImpl{
+	return FileServiceImpl{
 		configuration: configuration,
 		fileDao:       dao.FileDaoFactory(configuration.Database.Engine),
-		aesCipher:     utilities.NewAesCTRCipher(configuration.AesKey),
+		blobDao:       dao.BlobDaoFactory(configuration.Database.Engine),
+		folderDao:     dao.FolderDaoFactory(configuration.Database.Engine),
+		userDao:       dao.UserDaoFactory(configuration.Database.Engine),
+		shareDao:      dao.ShareDaoFactory(configuration.Database.Engine),
+		groupDao:      dao.GroupDaoFactory(configuration.Database.Engine),
+		folderService: NewFolderService(configuration),
+		keyService:    NewKeyService(configuration),
+		storage:       storage,
 	}
-	fileServiceImpl.createDirIfNotExists()
-	return fileServiceImpl
 }
 
 func (fileService FileServiceImpl) GetAllFiles(user models.User) ([]models.File, error) {
-	return fileService.fileDao.GetAllByOwner(&user)
+	return fileService.fileDao.GetAllByOwner(&user, null.String{})
 }
 
 func (fileService FileServiceImpl) GetFileVersionsByNameAndOwner(filename string, user *models.User) ([]models.File, error) {
@@ -79,6 +160,9 @@ func (fileService FileServiceImpl) GetLastVersionFileByNameAndOwner(filename str
 
 func (fileService FileServiceImpl) GetFileByVersion(filename string, version int64, user *models.User) (models.File, error) {
 	file, err := fileService.fileDao.GetFileByVersion(version)
+	if err != nil {
+		return models.File{}, err
+	}
 	if file.Owner.Email != user.Email {
 		err := errors.New(fmt.Sprintf(`the file "%v" does not belong to the user "%v"`, file.Name, user.Email))
 		return models.File{}, err
@@ -90,83 +174,1034 @@ func (fileService FileServiceImpl) GetFileByVersion(filename string, version int
 	return file, err
 }
 
-func (fileService FileServiceImpl) GetDecryptedLocalFile(file models.File) ([]byte, error) {
-	fileEncrypt, err := ioutil.ReadFile(fileService.configuration.FilesPath + strconv.FormatInt(file.Id, 10))
+// AuthorizeAccess returns the owner of the files that the user is accessing: the user themselves if no other owner is
+// given, the group if the user is one of its managers, or one of its members and the file's group permissions allow the
+// access, or the owner if they have shared the path with the user with the access and the file's others permissions
+// allow it too. The write share allows reading too. Otherwise, AccessDeniedError is returned. The folders' paths end
+// with a slash.
+func (fileService FileServiceImpl) AuthorizeAccess(path string, owner string, user models.User, access string) (models.User, error) {
+	if owner == "" || owner == user.Email {
+		return user, nil
+	}
+	ownerUser := models.User{Credentials: models.Credentials{Email: owner}}
+	member, err := fileService.groupDao.GetMember(owner, user.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return models.User{}, err
+	}
+	isMember := err == nil
+	// Unlike the shares, the groups give access to their whole space, including its root folder
+	if isMember && (path == "" || path == "/") {
+		return ownerUser, nil
+	}
+	path, err = cleanSharePath(path)
 	if err != nil {
-		return nil, err
+		return models.User{}, err
+	}
+	// The managers look after all the group's files, whatever their permissions
+	if isMember && member.Role == models.GroupRoleManager {
+		return ownerUser, nil
 	}
+	class := groupClass
+	if !isMember {
+		granted, err := fileService.shareDao.GetAccess(owner, path, user.Email)
+		if err == sql.ErrNoRows || (err == nil && access == models.ShareAccessWrite && granted != models.ShareAccessWrite) {
+			return models.User{}, AccessDeniedError
+		}
+		if err != nil {
+			return models.User{}, err
+		}
+		class = otherClass
+	}
+	if err := fileService.authorizeFileAccess(path, ownerUser, class, access); err != nil {
+		return models.User{}, err
+	}
+	return ownerUser, nil
+}
 
-	return fileService.aesCipher.Decrypt(fileEncrypt), err
+// authorizeFileAccess checks the permissions of the class on the owner's file. The folders have no permissions, so
+// they can always be listed, and new files can be created in them.
+func (fileService FileServiceImpl) authorizeFileAccess(path string, owner models.User, class int, access string) error {
+	if strings.HasSuffix(path, "/") {
+		return nil
+	}
+	file, err := fileService.fileDao.GetLastVersionFileByNameAndOwner(path, &owner)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !permits(file.PermissionsStr, class, access) {
+		return AccessDeniedError
+	}
+	return nil
 }
 
-func (fileService FileServiceImpl) GetFileStream(fileDecrypt []byte, file models.File) (contentLength int64, contentType string, reader *bytes.Reader, extraHeaders map[string]string) {
-	reader = bytes.NewReader(fileDecrypt)
-	contentLength = reader.Size()
-	contentType = http.DetectContentType(fileDecrypt)
+// GetFileStream decrypts the file's blob as it's read, so it is never loaded in memory as a whole. The content can be
+// read from any position, and only the part of the blob from there on is decrypted.
+// The caller must close the returned reader. A tampered blob makes it fail with utilities.IntegrityError, either here
+// or while reading the content.
+func (fileService FileServiceImpl) GetFileStream(file models.File) (contentLength int64, contentType string, reader FileContent, extraHeaders map[string]string, err error) {
+	blobCipher, err := fileService.keyService.GetUserCipher(file.Owner.Email)
+	if err != nil {
+		return
+	}
+	decrypted, plaintextSize, open, err := fileService.openContent(file, blobCipher)
+	if err != nil {
+		return
+	}
+	// We only need the first bytes of the content to guess its type
+	bufferedReader := bufio.NewReaderSize(decrypted, sniffLength)
+	sniffed, err := bufferedReader.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		decrypted.Close()
+		return
+	}
+	err = nil
 
+	contentLength = plaintextSize
+	contentType = http.DetectContentType(sniffed)
+	reader = &seekableContent{
+		open:    open,
+		size:    plaintextSize,
+		current: blobReadCloser{Reader: bufferedReader, Closer: decrypted},
+	}
 	extraHeaders = map[string]string{
 		headers.ContentDisposition: `attachment; filename="` + file.Name + `"`,
+		headers.ETag:               fileETag(file),
+	}
+	if file.Checksum.Valid {
+		extraHeaders[models.ChecksumHeader] = file.Checksum.String
 	}
 
 	return
 }
 
-func (fileService FileServiceImpl) CreateFile(file *models.File) (models.File, error) {
-	return fileService.fileDao.Create(file)
+// openContent returns the decrypted content of the file's version, its size, and how to open it again from any offset
+func (fileService FileServiceImpl) openContent(file models.File, blobCipher utilities.BlobCipher) (io.ReadCloser, int64, func(offset int64) (io.ReadCloser, error), error) {
+	if file.Chunked {
+		chunks, err := fileService.blobDao.GetFileChunks(file.Id)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		var size int64
+		keys := make([]string, len(chunks))
+		compressions := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			size += chunk.Size
+			keys[i] = blobStorageKey(chunk.Id)
+			compressions[i] = chunk.Compression
+		}
+		open := func(offset int64) (io.ReadCloser, error) {
+			// The chunks before the offset are skipped without reading them
+			first := 0
+			for first < len(chunks) && offset >= chunks[first].Size {
+				offset -= chunks[first].Size
+				first++
+			}
+			return &chunkedReader{storage: fileService.storage, blobCipher: blobCipher, keys: keys[first:], compressions: compressions[first:], offset: offset}, nil
+		}
+		decrypted, err := open(0)
+		return decrypted, size, open, err
+	}
+	key := blobKey(file)
+	open := func(offset int64) (io.ReadCloser, error) {
+		return openStoredBlob(fileService.storage, key, file.Compression, blobCipher, offset)
+	}
+	if file.Compression != utilities.NoCompression {
+		// The size of the decrypted blob is the compressed one
+		decompressed, err := open(0)
+		return decompressed, file.Size, open, err
+	}
+	decrypted, size, err := openBlobAt(fileService.storage, key, blobCipher, 0)
+	return decrypted, size, open, err
 }
 
-func (fileService FileServiceImpl) SetGdriveId(id int64, gdriveId string) error {
-	return fileService.fileDao.SetGdriveId(id, gdriveId)
+// openStoredBlob returns the blob's content from the given offset, decompressing it if it was compressed. The
+// compressed content can't be read from the middle, so it's decompressed from the start and the bytes before the
+// offset are skipped.
+func openStoredBlob(storage StorageBackend, key string, compression string, blobCipher utilities.BlobCipher, offset int64) (io.ReadCloser, error) {
+	if compression == utilities.NoCompression {
+		decrypted, _, err := openBlobAt(storage, key, blobCipher, offset)
+		return decrypted, err
+	}
+	decrypted, _, err := openBlobAt(storage, key, blobCipher, 0)
+	if err != nil {
+		return nil, err
+	}
+	decompressed, err := utilities.NewDecompressReader(compression, decrypted)
+	if err != nil {
+		decrypted.Close()
+		return nil, err
+	}
+	reader := decompressedReadCloser{ReadCloser: decompressed, blob: decrypted}
+	if _, err := io.CopyN(ioutil.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
 }
 
-func (fileService FileServiceImpl) encryptFile(file multipart.File) ([]byte, error) {
-	// Conversión a bytes del fichero
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, file); err != nil {
-		return nil, err
+// openBlobAt returns the decrypted content of the blob from the given offset, and the blob's plaintext size
+func openBlobAt(storage StorageBackend, key string, blobCipher utilities.BlobCipher, offset int64) (io.ReadCloser, int64, error) {
+	blobInfo, err := storage.Stat(key)
+	if err != nil {
+		return nil, 0, err
 	}
-	encrypted := fileService.aesCipher.Encrypt(buf.Bytes())
+	return keyCipher(blobCipher, key).OpenBlobAt(func(blobOffset int64) (io.ReadCloser, error) {
+		return storage.GetAt(key, blobOffset)
+	}, blobInfo.Size, offset)
+}
 
-	return encrypted, nil
+// CreateFile creates a new version of the file, and the folders it's in if they don't exist yet
+func (fileService FileServiceImpl) CreateFile(file *models.File) (models.File, error) {
+	if err := fileService.prepareFolder(file); err != nil {
+		return models.File{}, err
+	}
+	return fileService.fileDao.Create(file)
 }
 
+// prepareFolder cleans the file's path and creates the folders it's in. The file can't have the path of a folder.
+func (fileService FileServiceImpl) prepareFolder(file *models.File) error {
+	name, err := cleanPath(file.Name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return InvalidPathError
+	}
+	_, err = fileService.folderDao.GetByPathAndOwner(name, file.Owner.Email)
+	if err == nil {
+		return PathConflictError
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	file.Name = name
+	file.Folder = parentPath(name)
+	if file.Folder != "" {
+		_, err = fileService.folderService.CreateFolder(file.Folder, file.Owner)
+	}
+	return err
+}
+
+// SaveFile encrypts the file with its owner's data key as it's being uploaded to the storage backend. If the owner
+// already has a blob with the same content, the file references it instead, and nothing is uploaded.
 func (fileService FileServiceImpl) SaveFile(file multipart.File, uploadedFile models.File) error {
+	return fileService.SaveFileContent(uploadedFile, func() (io.ReadCloser, error) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(file), nil
+	})
+}
 
-	encrypted, err := fileService.encryptFile(file)
+// SaveFileContent works as SaveFile, but the content comes from open, which is called several times: once to hash the
+// content and again to upload it if needed. If the file has a checksum, its content must match it; otherwise, the version
+// is discarded and ChecksumMismatchError is returned.
+func (fileService FileServiceImpl) SaveFileContent(uploadedFile models.File, open func() (io.ReadCloser, error)) error {
+	if err := ValidateChecksum(uploadedFile.Checksum); err != nil {
+		fileService.discardVersion(uploadedFile)
+		return err
+	}
+	blobCipher, err := fileService.keyService.GetUserCipher(uploadedFile.Owner.Email)
+	if err != nil {
+		return err
+	}
+	content, err := open()
+	if err != nil {
+		return err
+	}
+	// The first bytes of the content tell whether it's worth compressing it
+	bufferedReader := bufio.NewReaderSize(content, sniffLength)
+	sniffed, err := bufferedReader.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		content.Close()
+		return err
+	}
+	codec := fileService.compressionCodec(sniffed)
+	contentHash := blobCipher.NewContentHash()
+	checksumHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(contentHash, checksumHash), bufferedReader)
+	content.Close()
 	if err != nil {
 		return err
 	}
+	checksum := hex.EncodeToString(checksumHash.Sum(nil))
+	if uploadedFile.Checksum.Valid && uploadedFile.Checksum.String != checksum {
+		fileService.discardVersion(uploadedFile)
+		return ChecksumMismatchError
+	}
 
-	// Guardamos el fichero encriptado
-	if err := ioutil.WriteFile(fileService.configuration.FilesPath+strconv.FormatInt(uploadedFile.Id, 10), encrypted, 0700); err != nil {
+	blob, err := fileService.blobDao.Acquire(&models.Blob{
+		Owner: uploadedFile.Owner.Email,
+		Hash:  hex.EncodeToString(contentHash.Sum(nil)),
+		Size:  size,
+	})
+	if err != nil {
+		return err
+	}
+	if !blob.Stored {
+		// Guardamos el fichero encriptado
+		if err := fileService.storeBlob(&blob, open, codec, blobCipher); err != nil {
+			fileService.releaseBlob(blob.Id)
+			return err
+		}
+	}
+	err = fileService.fileDao.SetBlob(uploadedFile.Id, blob.Id)
+	if err != nil {
+		fileService.releaseBlob(blob.Id)
 		return err
 	}
+	if err := fileService.fileDao.SetChecksum(uploadedFile.Id, checksum); err != nil {
+		return err
+	}
+	// The version is read as its blob was stored, which may have been before the compression was configured
+	if blob.Compression != utilities.NoCompression {
+		if err := fileService.fileDao.SetCompression(uploadedFile.Id, blob.Compression); err != nil {
+			return err
+		}
+	}
+	return fileService.fileDao.SetSize(uploadedFile.Id, size, blob.StoredSize)
+}
 
+// storeBlob encrypts the content and uploads it as the blob's. The content is compressed with the codec first, into a
+// temporary file, as the storage must know its size in advance. If compressing it doesn't make it smaller, it's stored
+// as it is.
+func (fileService FileServiceImpl) storeBlob(blob *models.Blob, open func() (io.ReadCloser, error), codec string, blobCipher utilities.BlobCipher) error {
+	content, err := open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		content.Close()
+	}()
+	var plaintext io.Reader = content
+	size := blob.Size
+	if codec != utilities.NoCompression {
+		compressed, compressedSize, err := fileService.compressToTempFile(codec, content)
+		if err != nil {
+			return err
+		}
+		defer removeTempFile(compressed)
+		if compressedSize < size {
+			plaintext, size = compressed, compressedSize
+		} else {
+			codec = utilities.NoCompression
+			content.Close()
+			if content, err = open(); err != nil {
+				return err
+			}
+			plaintext = content
+		}
+	}
+	storedSize := blobCipher.EncryptedSize(size)
+	if err := fileService.storage.Put(blobStorageKey(blob.Id), blobCipher.EncryptReader(plaintext), storedSize); err != nil {
+		return err
+	}
+	if err := fileService.blobDao.MarkStored(blob.Id, codec, storedSize); err != nil {
+		return err
+	}
+	blob.Stored = true
+	blob.Compression = codec
+	blob.StoredSize = storedSize
 	return nil
 }
 
-func (fileService FileServiceImpl) DeleteFile(filename string, user *models.User) (models.File, error) {
+// compressionCodec returns the configured codec, unless the content looks already compressed
+func (fileService FileServiceImpl) compressionCodec(sniffed []byte) string {
+	if !utilities.IsCompressible(sniffed) {
+		return utilities.NoCompression
+	}
+	return fileService.configuration.Compression.Codec
+}
+
+// compressContent compresses the content with the codec, at the configured level
+func (fileService FileServiceImpl) compressContent(codec string, content io.Reader, compressed io.Writer) error {
+	writer, err := utilities.NewCompressWriter(codec, fileService.configuration.Compression.Level, compressed)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, content); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// compressToTempFile compresses the content into a temporary file, which is returned ready to be read, along with its
+// size. The caller must remove it.
+func (fileService FileServiceImpl) compressToTempFile(codec string, content io.Reader) (*os.File, int64, error) {
+	compressed, err := ioutil.TempFile("", "mantecabox-blob-")
+	if err != nil {
+		return nil, 0, err
+	}
+	err = fileService.compressContent(codec, content, compressed)
+	var size int64
+	if err == nil {
+		size, err = compressed.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = compressed.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTempFile(compressed)
+		return nil, 0, err
+	}
+	return compressed, size, nil
+}
+
+func removeTempFile(file *os.File) {
+	file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		logs.ServicesLog.Warnf("Unable to remove temporary file %v: %v", file.Name(), err)
+	}
+}
+
+// MoveFile renames the file, or moves it to another folder, along with all its versions. The folders of the new path
+// are created if they don't exist yet, but there can't be a file nor a folder there.
+func (fileService FileServiceImpl) MoveFile(filename string, newName string, user *models.User) (models.File, error) {
 	file, err := fileService.fileDao.GetLastVersionFileByNameAndOwner(filename, user)
 	if err != nil {
 		return file, err
 	}
-	err = fileService.fileDao.Delete(filename, user)
+	newName, err = cleanPath(newName)
 	if err != nil {
 		return file, err
 	}
+	if newName == file.Name {
+		return file, nil
+	}
+	_, err = fileService.fileDao.GetLastVersionFileByNameAndOwner(newName, user)
+	if err == nil {
+		return file, PathConflictError
+	}
+	if err != sql.ErrNoRows {
+		return file, err
+	}
+	moved := models.File{Name: newName, Owner: *user}
+	if err := fileService.prepareFolder(&moved); err != nil {
+		return file, err
+	}
+	if err := fileService.fileDao.Move(file.LogicalId, moved.Name, moved.Folder); err != nil {
+		return file, err
+	}
+	if err := fileService.shareDao.Move(user.Email, file.Name, moved.Name); err != nil {
+		return file, err
+	}
+	return fileService.fileDao.GetLastVersionFileByNameAndOwner(moved.Name, user)
+}
 
-	err = os.Remove(fileService.configuration.FilesPath + strconv.FormatInt(file.Id, 10))
+// SetPermissions changes the permissions of the file, in all its versions, without uploading a new one
+func (fileService FileServiceImpl) SetPermissions(filename string, permissionsStr string, user *models.User) (models.File, error) {
+	if !permissionsRegexp.MatchString(permissionsStr) {
+		return models.File{}, InvalidPermissionsError
+	}
+	file, err := fileService.fileDao.GetLastVersionFileByNameAndOwner(filename, user)
 	if err != nil {
 		return file, err
 	}
+	if err := fileService.fileDao.SetPermissions(file.LogicalId, permissionsStr); err != nil {
+		return file, err
+	}
+	file.PermissionsStr = permissionsStr
+	return file, nil
+}
+
+// CopyFile copies the file's last version, or the given one, to a new version of the file with the new name, which
+// may be the same file. The copy shares its content with the original, taking one more reference to its blob or to
+// each of its chunks. The versions uploaded before the deduplication have no blob to share, so they are decrypted and
+// stored again.
+func (fileService FileServiceImpl) CopyFile(filename string, version null.Int, newName string, user *models.User) (models.File, error) {
+	var source models.File
+	var err error
+	if version.Valid {
+		source, err = fileService.GetFileByVersion(filename, version.Int64, user)
+	} else {
+		source, err = fileService.fileDao.GetLastVersionFileByNameAndOwner(filename, user)
+	}
+	if err != nil {
+		return models.File{}, err
+	}
+	if err := fileService.CheckQuota(*user, source.Size); err != nil {
+		return models.File{}, err
+	}
+	copied := models.File{Name: newName, Owner: *user, PermissionsStr: source.PermissionsStr}
+	if err := fileService.prepareFolder(&copied); err != nil {
+		return models.File{}, err
+	}
 
+	if source.Chunked {
+		chunks, err := fileService.blobDao.GetFileChunks(source.Id)
+		if err != nil {
+			return models.File{}, err
+		}
+		hashes := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			hashes[i] = chunk.Hash
+		}
+		file, err := fileService.fileDao.CreateChunked(&copied, hashes)
+		if err != nil {
+			return file, err
+		}
+		return file, fileService.setContentInfo(&file, source)
+	}
+
+	file, err := fileService.fileDao.Create(&copied)
+	if err != nil {
+		return file, err
+	}
+	if source.BlobId.Valid {
+		if err := fileService.blobDao.Reference(source.BlobId.Int64); err != nil {
+			return file, err
+		}
+		if err := fileService.fileDao.SetBlob(file.Id, source.BlobId.Int64); err != nil {
+			fileService.releaseBlob(source.BlobId.Int64)
+			return file, err
+		}
+		file.BlobId = source.BlobId
+		return file, fileService.setContentInfo(&file, source)
+	}
+	blobCipher, err := fileService.keyService.GetUserCipher(user.Email)
+	if err != nil {
+		return file, err
+	}
+	err = fileService.SaveFileContent(file, func() (io.ReadCloser, error) {
+		decrypted, _, _, err := fileService.openContent(source, blobCipher)
+		return decrypted, err
+	})
 	return file, err
 }
 
-func (fileService FileServiceImpl) createDirIfNotExists() {
-	err := os.MkdirAll(fileService.configuration.FilesPath, 0700)
+// RestoreFileVersion makes the given version the file's current one again, creating a new version that shares its
+// content and keeps its permissions
+func (fileService FileServiceImpl) RestoreFileVersion(filename string, version int64, user *models.User) (models.File, error) {
+	return fileService.CopyFile(filename, null.IntFrom(version), filename, user)
+}
+
+// DeleteFile moves the file to the trash, with all its versions. Their content is kept until the file is purged.
+func (fileService FileServiceImpl) DeleteFile(filename string, user *models.User) (models.File, error) {
+	file, err := fileService.fileDao.GetLastVersionFileByNameAndOwner(filename, user)
+	if err != nil {
+		return file, err
+	}
+	return file, fileService.fileDao.Delete(filename, user)
+}
+
+// GetMissingChunks tells which of the chunks, identified by the SHA-256 digest of their content, haven't been uploaded
+// by the user yet
+func (fileService FileServiceImpl) GetMissingChunks(user models.User, digests []string) ([]string, error) {
+	if err := validateChunkDigests(digests); err != nil {
+		return nil, err
+	}
+	blobCipher, err := fileService.keyService.GetUserCipher(user.Email)
 	if err != nil {
-		logs.ServicesLog.Errorf("Error creating file's directory: %v", err.Error())
-		panic(err)
+		return nil, err
+	}
+	hashes, err := chunkHashes(blobCipher, digests)
+	if err != nil {
+		return nil, err
+	}
+	storedHashes, err := fileService.blobDao.GetStoredHashes(user.Email, hashes)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool, len(storedHashes))
+	for _, hash := range storedHashes {
+		stored[hash] = true
+	}
+	missing := make([]string, 0)
+	for i, digest := range digests {
+		if !stored[hashes[i]] {
+			missing = append(missing, digest)
+			// The same chunk is only asked for once
+			stored[hashes[i]] = true
+		}
+	}
+	return missing, nil
+}
+
+// SaveChunk stores one of the user's chunks, encrypted with their data key, unless it's already stored. The content
+// must match the digest, so nobody can make the chunk of a file different from what they asked for.
+func (fileService FileServiceImpl) SaveChunk(user models.User, digest string, content io.Reader) error {
+	if err := validateChunkDigests([]string{digest}); err != nil {
+		return err
+	}
+	plaintext, err := ioutil.ReadAll(io.LimitReader(content, utilities.MaxChunkSize+1))
+	if err != nil {
+		return err
+	}
+	if len(plaintext) > utilities.MaxChunkSize {
+		return ChunkTooLargeError
+	}
+	sum := sha256.Sum256(plaintext)
+	if hex.EncodeToString(sum[:]) != digest {
+		return ChunkDigestMismatchError
+	}
+	blobCipher, err := fileService.keyService.GetUserCipher(user.Email)
+	if err != nil {
+		return err
+	}
+
+	blob, err := fileService.blobDao.Store(&models.Blob{
+		Owner: user.Email,
+		Hash:  blobCipher.ChunkHash(sum[:]),
+		Size:  int64(len(plaintext)),
+	})
+	if err != nil || blob.Stored {
+		return err
+	}
+	// The chunks are small enough to be compressed in memory
+	stored := plaintext
+	codec := fileService.compressionCodec(plaintext)
+	if codec != utilities.NoCompression {
+		var compressed bytes.Buffer
+		if err := fileService.compressContent(codec, bytes.NewReader(plaintext), &compressed); err != nil {
+			return err
+		}
+		if compressed.Len() < len(plaintext) {
+			stored = compressed.Bytes()
+		} else {
+			codec = utilities.NoCompression
+		}
+	}
+	storedSize := blobCipher.EncryptedSize(int64(len(stored)))
+	err = fileService.storage.Put(blobStorageKey(blob.Id), blobCipher.EncryptReader(bytes.NewReader(stored)), storedSize)
+	if err != nil {
+		return err
+	}
+	return fileService.blobDao.MarkStored(blob.Id, codec, storedSize)
+}
+
+// CreateChunkedFile creates a new version of the file made of the given chunks, which must have been uploaded before.
+// Otherwise, MissingChunkError is returned.
+func (fileService FileServiceImpl) CreateChunkedFile(file *models.File, digests []string) (models.File, error) {
+	if err := validateChunkDigests(digests); err != nil {
+		return models.File{}, err
+	}
+	if err := ValidateChecksum(file.Checksum); err != nil {
+		return models.File{}, err
+	}
+	blobCipher, err := fileService.keyService.GetUserCipher(file.Owner.Email)
+	if err != nil {
+		return models.File{}, err
+	}
+	hashes, err := chunkHashes(blobCipher, digests)
+	if err != nil {
+		return models.File{}, err
+	}
+	if err := fileService.prepareFolder(file); err != nil {
+		return models.File{}, err
+	}
+	created, err := fileService.fileDao.CreateChunked(file, hashes)
+	if err != nil {
+		return created, err
+	}
+
+	// The size of the chunks is only known once the version references them, so it's discarded if it doesn't fit
+	chunks, err := fileService.blobDao.GetFileChunks(created.Id)
+	if err != nil {
+		return created, err
+	}
+	var size, storedSize int64
+	for _, chunk := range chunks {
+		size += chunk.Size
+		storedSize += chunk.StoredSize
+	}
+	if err := fileService.CheckQuota(file.Owner, size); err != nil {
+		if discardErr := fileService.discardVersion(created); discardErr != nil {
+			return models.File{}, discardErr
+		}
+		return models.File{}, err
+	}
+	if err := fileService.setSize(&created, size, storedSize); err != nil {
+		return created, err
+	}
+
+	// The checksum of the whole file can't be known from the chunks' digests, so the content is read again
+	checksum, err := fileService.contentChecksum(created, blobCipher)
+	if err != nil {
+		return created, err
+	}
+	if file.Checksum.Valid && file.Checksum.String != checksum {
+		if discardErr := fileService.discardVersion(created); discardErr != nil {
+			return models.File{}, discardErr
+		}
+		return models.File{}, ChecksumMismatchError
+	}
+	if err := fileService.fileDao.SetChecksum(created.Id, checksum); err != nil {
+		return created, err
+	}
+	created.Checksum = null.StringFrom(checksum)
+	return created, nil
+}
+
+// ValidateChecksum checks that the checksum, if it's given, is a hex encoded SHA-256 hash
+func ValidateChecksum(checksum null.String) error {
+	if checksum.Valid && !chunkDigestRegexp.MatchString(checksum.String) {
+		return InvalidChecksumError
+	}
+	return nil
+}
+
+// contentChecksum computes the SHA-256 checksum of the version's decrypted content
+func (fileService FileServiceImpl) contentChecksum(file models.File, blobCipher utilities.BlobCipher) (string, error) {
+	content, _, _, err := fileService.openContent(file, blobCipher)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	checksumHash := sha256.New()
+	if _, err := io.Copy(checksumHash, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksumHash.Sum(nil)), nil
+}
+
+// CheckQuota tells whether the user can store a new version of the given size. FileTooLargeError is returned if the
+// version alone is larger than their quota, and QuotaExceededError if it doesn't fit in what's left of it.
+func (fileService FileServiceImpl) CheckQuota(user models.User, size int64) error {
+	quota, err := fileService.quota(user)
+	if err != nil || !quota.Valid {
+		return err
+	}
+	// The usage isn't needed to know that the version is too large
+	if err := fitsQuota(quota.Int64, 0, size); err != nil {
+		return err
+	}
+	usage, err := fileService.fileDao.GetUsage(user.Email)
+	if err != nil {
+		return err
+	}
+	return fitsQuota(quota.Int64, usedSize(usage), size)
+}
+
+// GetUsage returns the space taken by the user's files, along with their quota
+func (fileService FileServiceImpl) GetUsage(user models.User) (models.Usage, error) {
+	quota, err := fileService.quota(user)
+	if err != nil {
+		return models.Usage{}, err
+	}
+	usage, err := fileService.fileDao.GetUsage(user.Email)
+	if err != nil {
+		return models.Usage{}, err
+	}
+	usage.Quota = quota
+	usage.Used = usedSize(usage)
+	return usage, nil
+}
+
+// quota returns the user's quota, or the configured default if they have none. A quota of zero means no limit, and
+// is returned as null.
+func (fileService FileServiceImpl) quota(user models.User) (null.Int, error) {
+	storedUser, err := fileService.userDao.GetByPk(user.Email)
+	if err != nil {
+		return null.Int{}, err
+	}
+	quota := fileService.configuration.DefaultQuota
+	if storedUser.Quota.Valid {
+		quota = storedUser.Quota.Int64
+	}
+	return null.NewInt(quota, quota > 0), nil
+}
+
+func fitsQuota(quota int64, used int64, size int64) error {
+	if size > quota {
+		return FileTooLargeError
+	}
+	if used+size > quota {
+		return QuotaExceededError
+	}
+	return nil
+}
+
+// usedSize is the space counted against the quota: the plaintext size of all the versions, even the trashed ones
+func usedSize(usage models.Usage) int64 {
+	return usage.Live.Size + usage.OldVersions.Size + usage.Trash.Size
+}
+
+// BackfillLegacySizes records the size of the versions stored before the blobs, which the migration that added the
+// sizes left at zero, as only the storage knows it. Until then, they aren't counted in the quota. The versions whose
+// content is missing or can't be opened are skipped, and the scrub reports them.
+func (fileService FileServiceImpl) BackfillLegacySizes() (int, error) {
+	backfilled := 0
+	ciphers := make(map[string]utilities.BlobCipher)
+	afterId := int64(0)
+	for {
+		versions, err := fileService.fileDao.GetUnsizedLegacyVersions(afterId, legacySizesBatchSize)
+		if err != nil || len(versions) == 0 {
+			return backfilled, err
+		}
+		for i := range versions {
+			version := &versions[i]
+			afterId = version.Id
+			blobCipher, ok := ciphers[version.Owner.Email]
+			if !ok {
+				blobCipher, err = fileService.keyService.GetUserCipher(version.Owner.Email)
+				if err != nil {
+					return backfilled, err
+				}
+				ciphers[version.Owner.Email] = blobCipher
+			}
+			key := blobKey(*version)
+			blobInfo, err := fileService.storage.Stat(key)
+			if err == BlobNotFoundError {
+				logs.ServicesLog.Warnf("Unable to backfill the size of the version %v: its blob %v is missing", version.Id, key)
+				continue
+			}
+			if err != nil {
+				return backfilled, err
+			}
+			reader, size, err := openBlobAt(fileService.storage, key, blobCipher, 0)
+			if err != nil {
+				logs.ServicesLog.Warnf("Unable to backfill the size of the version %v: %v", version.Id, err)
+				continue
+			}
+			reader.Close()
+			if err := fileService.setSize(version, size, blobInfo.Size); err != nil {
+				return backfilled, err
+			}
+			backfilled++
+		}
+	}
+}
+
+// setSize records the size of the version's content
+func (fileService FileServiceImpl) setSize(file *models.File, size int64, storedSize int64) error {
+	if err := fileService.fileDao.SetSize(file.Id, size, storedSize); err != nil {
+		return err
+	}
+	file.Size = size
+	file.StoredSize = storedSize
+	return nil
+}
+
+// setContentInfo records that the copy has the same content as the source: its size, its compression and its
+// checksum, if it's known
+func (fileService FileServiceImpl) setContentInfo(file *models.File, source models.File) error {
+	if err := fileService.setSize(file, source.Size, source.StoredSize); err != nil {
+		return err
+	}
+	if source.Compression != utilities.NoCompression {
+		if err := fileService.fileDao.SetCompression(file.Id, source.Compression); err != nil {
+			return err
+		}
+		file.Compression = source.Compression
+	}
+	if !source.Checksum.Valid {
+		return nil
+	}
+	if err := fileService.fileDao.SetChecksum(file.Id, source.Checksum.String); err != nil {
+		return err
+	}
+	file.Checksum = source.Checksum
+	return nil
+}
+
+// discardVersion removes a version that has just been created, along with its references to the content
+func (fileService FileServiceImpl) discardVersion(file models.File) error {
+	blobIds, _, err := fileService.versionBlobs(file)
+	if err != nil {
+		return err
+	}
+	if err := fileService.fileDao.DeleteVersion(file.Id); err != nil {
+		return err
+	}
+	return fileService.releaseContent(blobIds, nil)
+}
+
+func validateChunkDigests(digests []string) error {
+	for _, digest := range digests {
+		if !chunkDigestRegexp.MatchString(digest) {
+			return InvalidChunkDigestError
+		}
+	}
+	return nil
+}
+
+// chunkHashes turns the chunks' digests into the keyed hashes their blobs are stored with
+func chunkHashes(blobCipher utilities.BlobCipher, digests []string) ([]string, error) {
+	hashes := make([]string, len(digests))
+	for i, digest := range digests {
+		sum, err := hex.DecodeString(digest)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = blobCipher.ChunkHash(sum)
+	}
+	return hashes, nil
+}
+
+// versionBlobs returns the blobs the version references, one for each of its chunks if it's chunked. The versions
+// uploaded before the deduplication have their own blob, so its storage key is returned instead.
+func (fileService FileServiceImpl) versionBlobs(file models.File) ([]int64, string, error) {
+	if file.Chunked {
+		chunks, err := fileService.blobDao.GetFileChunks(file.Id)
+		if err != nil {
+			return nil, "", err
+		}
+		blobIds := make([]int64, len(chunks))
+		for i, chunk := range chunks {
+			blobIds[i] = chunk.Id
+		}
+		return blobIds, "", nil
+	}
+	if file.BlobId.Valid {
+		return []int64{file.BlobId.Int64}, "", nil
+	}
+	return nil, blobKey(file), nil
+}
+
+// releaseContent drops a reference to each of the blobs, and removes the ones stored under the keys, which were
+// uploaded before the deduplication
+func (fileService FileServiceImpl) releaseContent(blobIds []int64, keys []string) error {
+	for _, blobId := range blobIds {
+		if err := fileService.releaseBlob(blobId); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := fileService.storage.Delete(key); err != nil && err != BlobNotFoundError {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseBlob drops a reference to the blob, removing it from the storage if it was the last one
+func (fileService FileServiceImpl) releaseBlob(blobId int64) error {
+	unreferenced, err := fileService.blobDao.Release(blobId)
+	if err != nil || !unreferenced {
+		return err
+	}
+	err = fileService.storage.Delete(blobStorageKey(blobId))
+	if err == BlobNotFoundError {
+		return nil
+	}
+	return err
+}
+
+// blobKey names the file's blob in the storage backend. The files uploaded before the deduplication have their own
+// blob, named after the file's version ID.
+func blobKey(file models.File) string {
+	if file.BlobId.Valid {
+		return blobStorageKey(file.BlobId.Int64)
+	}
+	return strconv.FormatInt(file.Id, 10)
+}
+
+// keyCipher returns the cipher that opens the blob stored with the key. Only the versions stored before the blobs, which
+// are named after their ID, can be in the legacy AES-CTR format, so the other blobs can't be downgraded to it by
+// overwriting their header.
+func keyCipher(blobCipher utilities.BlobCipher, key string) utilities.BlobCipher {
+	if _, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return blobCipher
+	}
+	return blobCipher.WithoutLegacy()
+}
+
+func blobStorageKey(blobId int64) string {
+	return "blob-" + strconv.FormatInt(blobId, 10)
+}
+
+// fileETag identifies the file's content. The versions with the same content share the same blob, and so the same
+// ETag, while the ones without a blob of their own are identified by the version, which never changes.
+func fileETag(file models.File) string {
+	if file.BlobId.Valid {
+		return `"b` + strconv.FormatInt(file.BlobId.Int64, 10) + `"`
+	}
+	return `"v` + strconv.FormatInt(file.Id, 10) + `"`
+}
+
+func (reader *chunkedReader) Read(p []byte) (int, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.keys) == 0 {
+				return 0, io.EOF
+			}
+			compression := utilities.NoCompression
+			if len(reader.compressions) > 0 {
+				compression = reader.compressions[0]
+				reader.compressions = reader.compressions[1:]
+			}
+			blob, err := openStoredBlob(reader.storage, reader.keys[0], compression, reader.blobCipher, reader.offset)
+			if err != nil {
+				return 0, err
+			}
+			reader.keys = reader.keys[1:]
+			reader.offset = 0
+			reader.current = blob
+		}
+		n, err := reader.current.Read(p)
+		if err == io.EOF {
+			reader.Close()
+			err = nil
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (reader decompressedReadCloser) Close() error {
+	reader.ReadCloser.Close()
+	return reader.blob.Close()
+}
+
+func (reader *chunkedReader) Close() error {
+	if reader.current == nil {
+		return nil
+	}
+	err := reader.current.Close()
+	reader.current = nil
+	return err
+}
+
+func (content *seekableContent) Read(p []byte) (int, error) {
+	if content.current != nil && content.position != content.offset {
+		content.Close()
+	}
+	if content.offset >= content.size {
+		return 0, io.EOF
+	}
+	if content.current == nil {
+		current, err := content.open(content.offset)
+		if err != nil {
+			return 0, err
+		}
+		content.current = current
+		content.position = content.offset
+	}
+	n, err := content.current.Read(p)
+	content.offset += int64(n)
+	content.position = content.offset
+	return n, err
+}
+
+// Seek only moves the position: the content is opened again when it's read
+func (content *seekableContent) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += content.offset
+	case io.SeekEnd:
+		offset += content.size
+	default:
+		return content.offset, InvalidSeekError
+	}
+	if offset < 0 {
+		return content.offset, InvalidSeekError
+	}
+	content.offset = offset
+	return offset, nil
+}
+
+func (content *seekableContent) Close() error {
+	if content.current == nil {
+		return nil
 	}
+	err := content.current.Close()
+	content.current = nil
+	return err
 }
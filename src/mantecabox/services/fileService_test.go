@@ -1,12 +1,43 @@
 package services
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mantecabox/dao"
 	"mantecabox/models"
+	"mantecabox/utilities"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
 )
 
+// fakeUnsizedFileDao serves the legacy versions whose size isn't known, and keeps the sizes set in memory
+type fakeUnsizedFileDao struct {
+	dao.FileDao
+	versions []models.File
+	sizes    map[int64][2]int64
+}
+
+func (fileDao fakeUnsizedFileDao) GetUnsizedLegacyVersions(afterId int64, limit int) ([]models.File, error) {
+	page := make([]models.File, 0)
+	for _, version := range fileDao.versions {
+		if _, sized := fileDao.sizes[version.Id]; !sized && version.Id > afterId && len(page) < limit {
+			page = append(page, version)
+		}
+	}
+	return page, nil
+}
+
+func (fileDao fakeUnsizedFileDao) SetSize(id int64, size int64, storedSize int64) error {
+	fileDao.sizes[id] = [2]int64{size, storedSize}
+	return nil
+}
+
 func TestNewFileService(t *testing.T) {
 	type args struct {
 		configuration *models.Configuration
@@ -33,3 +64,272 @@ func TestNewFileService(t *testing.T) {
 		})
 	}
 }
+
+func TestFileServiceImpl_SaveChunk(t *testing.T) {
+	content := []byte("Trozo inventado de Mantecabox")
+	sum := sha256.Sum256(content)
+	testCases := []struct {
+		name    string
+		digest  string
+		content []byte
+		wantErr error
+	}{
+		{"When the digest isn't a SHA-256 hash, return an error", "not a digest", content, InvalidChunkDigestError},
+		{"When the digest is uppercase, return an error", hex.EncodeToString(bytes.ToUpper(sum[:])), content, InvalidChunkDigestError},
+		{"When the content doesn't match the digest, return an error", hex.EncodeToString(sum[:]), content[1:], ChunkDigestMismatchError},
+		{"When the chunk is too large, return an error", hex.EncodeToString(sum[:]), make([]byte, utilities.MaxChunkSize+1), ChunkTooLargeError},
+	}
+	fileService := FileServiceImpl{}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := fileService.SaveChunk(models.User{}, testCase.digest, bytes.NewReader(testCase.content))
+			require.Equal(t, testCase.wantErr, err)
+		})
+	}
+}
+
+func TestValidateChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("Fichero inventado de Mantecabox"))
+	testCases := []struct {
+		name     string
+		checksum null.String
+		wantErr  error
+	}{
+		{"When there's no checksum, return no error", null.String{}, nil},
+		{"When the checksum is a SHA-256 hash, return no error", null.StringFrom(hex.EncodeToString(sum[:])), nil},
+		{"When the checksum is uppercase, return an error", null.StringFrom(strings.ToUpper(hex.EncodeToString(sum[:]))), InvalidChecksumError},
+		{"When the checksum isn't a SHA-256 hash, return an error", null.StringFrom(hex.EncodeToString(sum[:16])), InvalidChecksumError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.wantErr, ValidateChecksum(testCase.checksum))
+		})
+	}
+}
+
+func TestFitsQuota(t *testing.T) {
+	testCases := []struct {
+		name    string
+		used    int64
+		size    int64
+		wantErr error
+	}{
+		{"When the file fits in what's left of the quota, return no error", 60, 40, nil},
+		{"When the file doesn't fit in what's left of the quota, return an error", 61, 40, QuotaExceededError},
+		{"When the file is larger than the whole quota, return an error", 0, 101, FileTooLargeError},
+		{"When the quota is exceeded already, even an empty file doesn't fit", 101, 0, QuotaExceededError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.wantErr, fitsQuota(100, testCase.used, testCase.size))
+		})
+	}
+}
+
+func TestUsedSize(t *testing.T) {
+	usage := models.Usage{
+		Live:        models.StorageUsage{Versions: 2, Size: 35, StoredSize: 95},
+		OldVersions: models.StorageUsage{Versions: 2, Size: 30, StoredSize: 90},
+		Trash:       models.StorageUsage{Versions: 2, Size: 3, StoredSize: 63},
+	}
+	require.Equal(t, int64(68), usedSize(usage))
+}
+
+func TestChunkedReader(t *testing.T) {
+	blobCipher := utilities.NewBlobCipher("0123456789ABCDEF")
+	storage := NewMemoryStorage()
+	chunks := [][]byte{[]byte("Fichero "), {}, []byte("inventado "), []byte("de Mantecabox")}
+	keys := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		keys[i] = blobStorageKey(int64(i))
+		encrypted := blobCipher.EncryptReader(bytes.NewReader(chunk))
+		require.NoError(t, storage.Put(keys[i], encrypted, blobCipher.EncryptedSize(int64(len(chunk)))))
+	}
+	// The third chunk is repeated
+	keys = append(keys, keys[2])
+
+	reader := &chunkedReader{storage: storage, blobCipher: blobCipher, keys: keys}
+	got, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "Fichero inventado de Mantecaboxinventado ", string(got))
+	require.NoError(t, reader.Close())
+
+	// The offset is skipped in the first chunk only
+	reader = &chunkedReader{storage: storage, blobCipher: blobCipher, keys: keys[2:], offset: 4}
+	got, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "ntado de Mantecaboxinventado ", string(got))
+
+	require.NoError(t, storage.Delete(keys[1]))
+	reader = &chunkedReader{storage: storage, blobCipher: blobCipher, keys: keys}
+	_, err = ioutil.ReadAll(reader)
+	require.Equal(t, BlobNotFoundError, err)
+}
+
+func TestOpenStoredBlob(t *testing.T) {
+	blobCipher := utilities.NewBlobCipher("0123456789ABCDEF")
+	storage := NewMemoryStorage()
+	plaintext := bytes.Repeat([]byte("Fichero inventado de Mantecabox. "), 5000)
+	for _, codec := range []string{utilities.NoCompression, utilities.GzipCompression, utilities.ZstdCompression} {
+		var stored bytes.Buffer
+		if codec == utilities.NoCompression {
+			stored.Write(plaintext)
+		} else {
+			writer, err := utilities.NewCompressWriter(codec, 0, &stored)
+			require.NoError(t, err)
+			writer.Write(plaintext)
+			require.NoError(t, writer.Close())
+		}
+		encrypted := blobCipher.EncryptReader(bytes.NewReader(stored.Bytes()))
+		require.NoError(t, storage.Put("blob-"+codec, encrypted, blobCipher.EncryptedSize(int64(stored.Len()))))
+	}
+	testCases := []struct {
+		name        string
+		compression string
+		offset      int64
+	}{
+		{"When the blob isn't compressed, read it from the start", utilities.NoCompression, 0},
+		{"When the blob isn't compressed, read it from the offset", utilities.NoCompression, 100000},
+		{"When the blob is compressed with gzip, read it from the start", utilities.GzipCompression, 0},
+		{"When the blob is compressed with gzip, read it from the offset", utilities.GzipCompression, 100000},
+		{"When the blob is compressed with zstd, read it from the offset", utilities.ZstdCompression, 100000},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reader, err := openStoredBlob(storage, "blob-"+testCase.compression, testCase.compression, blobCipher, testCase.offset)
+			require.NoError(t, err)
+			got, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.Equal(t, plaintext[testCase.offset:], got)
+		})
+	}
+}
+
+func TestOpenBlobAt_LegacyFormat(t *testing.T) {
+	blobCipher := utilities.NewBlobCipher("0123456789ABCDEF")
+	storage := NewMemoryStorage()
+	plaintext := []byte("Fichero inventado de Mantecabox")
+	legacyBlob := utilities.NewAesCTRCipher("0123456789ABCDEF").Encrypt(append([]byte{}, plaintext...))
+	strippedBlob, err := ioutil.ReadAll(blobCipher.EncryptReader(bytes.NewReader(plaintext)))
+	require.NoError(t, err)
+	copy(strippedBlob, "XXXXX")
+	require.NoError(t, storage.Put("7", bytes.NewReader(legacyBlob), int64(len(legacyBlob))))
+	require.NoError(t, storage.Put("blob-7", bytes.NewReader(legacyBlob), int64(len(legacyBlob))))
+	require.NoError(t, storage.Put("blob-8", bytes.NewReader(strippedBlob), int64(len(strippedBlob))))
+	testCases := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"When the version was stored before the blobs, open it as a legacy one", "7", nil},
+		{"When a blob has no header, return an error", "blob-7", utilities.UnknownBlobFormatError},
+		{"When a blob's header has been overwritten, return an error", "blob-8", utilities.UnknownBlobFormatError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reader, _, err := openBlobAt(storage, testCase.key, blobCipher, 0)
+			require.Equal(t, testCase.wantErr, err)
+			if err != nil {
+				return
+			}
+			got, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.Equal(t, plaintext, got)
+		})
+	}
+}
+
+func TestFileServiceImpl_BackfillLegacySizes(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{7}, 32)
+	blobCipher, err := fakeKeyService{dataKey: dataKey}.GetUserCipher("testuser")
+	require.NoError(t, err)
+	plaintext := []byte("Fichero inventado de Mantecabox")
+	ciphertext, err := ioutil.ReadAll(blobCipher.EncryptReader(bytes.NewReader(plaintext)))
+	require.NoError(t, err)
+	storage := NewMemoryStorage()
+	require.NoError(t, storage.Put("1", bytes.NewReader(ciphertext), int64(len(ciphertext))))
+	require.NoError(t, storage.Put("3", bytes.NewReader(ciphertext[:10]), 10))
+
+	owner := models.User{Credentials: models.Credentials{Email: "testuser"}}
+	fileDao := fakeUnsizedFileDao{
+		versions: []models.File{{Id: 1, Owner: owner}, {Id: 2, Owner: owner}, {Id: 3, Owner: owner}},
+		sizes:    make(map[int64][2]int64),
+	}
+	fileService := FileServiceImpl{fileDao: fileDao, keyService: fakeKeyService{dataKey: dataKey}, storage: storage}
+
+	// The versions whose blob is missing or truncated are skipped
+	backfilled, err := fileService.BackfillLegacySizes()
+	require.NoError(t, err)
+	require.Equal(t, 1, backfilled)
+	require.Equal(t, map[int64][2]int64{1: {int64(len(plaintext)), int64(len(ciphertext))}}, fileDao.sizes)
+}
+
+func TestFileServiceImpl_CompressionCodec(t *testing.T) {
+	testCases := []struct {
+		name    string
+		codec   string
+		sniffed []byte
+		want    string
+	}{
+		{"When the compression is disabled, don't compress", utilities.NoCompression, []byte("SELECT 1;"), utilities.NoCompression},
+		{"When the content is text, compress it with the configured codec", utilities.ZstdCompression, []byte("SELECT 1;"), utilities.ZstdCompression},
+		{"When the content is already compressed, don't compress it", utilities.GzipCompression, []byte("PK\x03\x04"), utilities.NoCompression},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fileService := FileServiceImpl{configuration: &models.Configuration{Compression: models.Compression{Codec: testCase.codec}}}
+			require.Equal(t, testCase.want, fileService.compressionCodec(testCase.sniffed))
+		})
+	}
+}
+
+func TestSeekableContent(t *testing.T) {
+	blobCipher := utilities.NewBlobCipher("0123456789ABCDEF")
+	storage := NewMemoryStorage()
+	plaintext := bytes.Repeat([]byte("Fichero inventado de Mantecabox. "), 5000)
+	encrypted := blobCipher.EncryptReader(bytes.NewReader(plaintext))
+	require.NoError(t, storage.Put("1", encrypted, blobCipher.EncryptedSize(int64(len(plaintext)))))
+	opened := 0
+	content := &seekableContent{
+		open: func(offset int64) (io.ReadCloser, error) {
+			opened++
+			reader, _, err := openBlobAt(storage, "1", blobCipher, offset)
+			return reader, err
+		},
+		size: int64(len(plaintext)),
+	}
+	defer content.Close()
+
+	got := make([]byte, 10)
+	_, err := io.ReadFull(content, got)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[:10], got)
+
+	// Seeking to the current position doesn't open the content again
+	position, err := content.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), position)
+	_, err = io.ReadFull(content, got)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[10:20], got)
+	require.Equal(t, 1, opened)
+
+	position, err = content.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(plaintext)-10), position)
+	rest, err := ioutil.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[len(plaintext)-10:], rest)
+
+	_, err = content.Seek(100000, io.SeekStart)
+	require.NoError(t, err)
+	_, err = io.ReadFull(content, got)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[100000:100010], got)
+	require.Equal(t, 3, opened)
+
+	_, err = content.Seek(-1, io.SeekStart)
+	require.Equal(t, InvalidSeekError, err)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+var (
+	InvalidPathError    = errors.New(`the path must be made of non-empty names, other than ".", "..", "download", "versions", "manifest", "copy" and "links", separated by "/"`)
+	PathConflictError   = errors.New("there is already a file or a folder with the same path")
+	FolderNotEmptyError = dao.FolderNotEmptyError
+
+	// reservedPathNames can't be used for files nor folders, as they name the actions on them in the routes
+	reservedPathNames = map[string]bool{".": true, "..": true, "download": true, "versions": true, "manifest": true, "copy": true, "links": true}
+)
+
+type (
+	// FolderService organizes the user's files in folders. A file's name is its full path, such as "docs/report.pdf",
+	// and the folders it's in are created along with it.
+	FolderService interface {
+		CreateFolder(path string, user models.User) (models.Folder, error)
+		GetFolderContent(path string, user models.User) ([]models.Folder, []models.File, error)
+		DeleteFolder(path string, user models.User) error
+	}
+
+	FolderServiceImpl struct {
+		configuration *models.Configuration
+		folderDao     dao.FolderDao
+		fileDao       dao.FileDao
+	}
+)
+
+func NewFolderService(configuration *models.Configuration) FolderService {
+	if configuration == nil {
+		return nil
+	}
+	return FolderServiceImpl{
+		configuration: configuration,
+		folderDao:     dao.FolderDaoFactory(configuration.Database.Engine),
+		fileDao:       dao.FileDaoFactory(configuration.Database.Engine),
+	}
+}
+
+// CreateFolder creates the folder and the ones it's in, unless they already exist. None of them can have the path of a
+// file.
+func (folderService FolderServiceImpl) CreateFolder(path string, user models.User) (models.Folder, error) {
+	path, err := cleanPath(path)
+	if err != nil {
+		return models.Folder{}, err
+	}
+	if path == "" {
+		return models.Folder{}, InvalidPathError
+	}
+	var folder models.Folder
+	for _, ancestor := range pathAncestors(path) {
+		_, err := folderService.fileDao.GetLastVersionFileByNameAndOwner(ancestor, &user)
+		if err == nil {
+			return models.Folder{}, PathConflictError
+		}
+		if err != sql.ErrNoRows {
+			return models.Folder{}, err
+		}
+		folder, err = folderService.folderDao.Create(&models.Folder{
+			Owner:  user.Email,
+			Path:   ancestor,
+			Parent: parentPath(ancestor),
+		})
+		if err != nil {
+			return models.Folder{}, err
+		}
+	}
+	return folder, nil
+}
+
+// GetFolderContent returns the folders directly inside the given one, and the last version of its files. The root
+// folder is the empty path.
+func (folderService FolderServiceImpl) GetFolderContent(path string, user models.User) ([]models.Folder, []models.File, error) {
+	path, err := cleanPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if path != "" {
+		if _, err := folderService.folderDao.GetByPathAndOwner(path, user.Email); err != nil {
+			return nil, nil, err
+		}
+	}
+	folders, err := folderService.folderDao.GetChildren(path, user.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := folderService.fileDao.GetAllByOwner(&user, null.StringFrom(path))
+	return folders, files, err
+}
+
+// DeleteFolder deletes the folder if it's empty. Otherwise, FolderNotEmptyError is returned.
+func (folderService FolderServiceImpl) DeleteFolder(path string, user models.User) error {
+	path, err := cleanPath(path)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return InvalidPathError
+	}
+	if _, err := folderService.folderDao.GetByPathAndOwner(path, user.Email); err != nil {
+		return err
+	}
+	return folderService.folderDao.DeleteEmpty(path, user.Email)
+}
+
+// cleanPath removes the leading and trailing slashes of the path, and checks its names are valid. The root folder is
+// the empty path.
+func cleanPath(path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", nil
+	}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || reservedPathNames[name] {
+			return "", InvalidPathError
+		}
+	}
+	return path, nil
+}
+
+// parentPath returns the path of the folder the file or folder is in
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// pathAncestors returns the path of every folder from the root down to the given one, which is included
+func pathAncestors(path string) []string {
+	ancestors := make([]string, 0)
+	for i, c := range path {
+		if c == '/' {
+			ancestors = append(ancestors, path[:i])
+		}
+	}
+	return append(ancestors, path)
+}
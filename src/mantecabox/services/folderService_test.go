@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFolderService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          FolderService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{},
+			FolderServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewFolderService(testCase.configuration))
+		})
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	testCases := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"When the path is a name, return it", "report.pdf", "report.pdf", nil},
+		{"When the path is nested, return it", "docs/2018/report.pdf", "docs/2018/report.pdf", nil},
+		{"When the path has leading and trailing slashes, remove them", "/docs/2018/", "docs/2018", nil},
+		{"When the path is empty, return the root", "/", "", nil},
+		{"When the path has an empty name, return an error", "docs//report.pdf", "", InvalidPathError},
+		{"When the path goes to the parent folder, return an error", "docs/../report.pdf", "", InvalidPathError},
+		{"When the path has a reserved name, return an error", "docs/versions/report.pdf", "", InvalidPathError},
+		{"When the file is named after the links action, return an error", "docs/links", "", InvalidPathError},
+		{"When the path ends with a reserved name, return an error", "docs/download", "", InvalidPathError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := cleanPath(testCase.path)
+			require.Equal(t, testCase.wantErr, err)
+			require.Equal(t, testCase.want, got)
+		})
+	}
+}
+
+func TestParentPath(t *testing.T) {
+	require.Equal(t, "", parentPath("report.pdf"))
+	require.Equal(t, "docs", parentPath("docs/report.pdf"))
+	require.Equal(t, "docs/2018", parentPath("docs/2018/report.pdf"))
+}
+
+func TestPathAncestors(t *testing.T) {
+	require.Equal(t, []string{"docs"}, pathAncestors("docs"))
+	require.Equal(t, []string{"docs", "docs/2018", "docs/2018/drafts"}, pathAncestors("docs/2018/drafts"))
+}
+
+func TestFolderServiceImpl_InvalidPaths(t *testing.T) {
+	folderService := FolderServiceImpl{}
+	_, err := folderService.CreateFolder("/", models.User{})
+	require.Equal(t, InvalidPathError, err)
+	_, err = folderService.CreateFolder("docs/../..", models.User{})
+	require.Equal(t, InvalidPathError, err)
+	require.Equal(t, InvalidPathError, folderService.DeleteFolder("", models.User{}))
+	_, _, err = folderService.GetFolderContent("docs/manifest", models.User{})
+	require.Equal(t, InvalidPathError, err)
+}
@@ -1,15 +1,15 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"mantecabox/logs"
 	"mantecabox/models"
@@ -119,65 +119,172 @@ func RemoveFile(srv *drive.Service, filedId string) error {
 	return nil
 }
 
-// File upload
-func (fileService FileServiceImpl) UploadFileGDrive(srv *drive.Service, filename string, file multipart.File) (*drive.File, error) {
-
-	fileEncrypted, err := fileService.encryptFile(file)
-	if err != nil {
-		return nil, err
-	}
+// File update
+func UpdateFile(srv *drive.Service, filedId string, filename string, file io.Reader) error {
 
-	driveFile, err := srv.Files.Create(&drive.File{Name: filename}).Media(bytes.NewReader(fileEncrypted)).Do()
+	_, err := srv.Files.Update(filedId, &drive.File{Name: filename}).Media(file).Do()
 	if err != nil {
-		logs.ServicesLog.Fatalf("Unable to create file: %v", err)
-		return nil, err
+		return err
 	}
 
-	logs.ServicesLog.Infof("uploaded file: %+v (%v)", driveFile.Name, driveFile.Id)
-
-	return driveFile, err
+	return nil
 }
 
-// File update
-func UpdateFile(srv *drive.Service, filedId string, filename string, file io.Reader) error {
+// The blobs are kept in a folder of their own, so that the rest of the Drive's files are neither listed as blobs nor
+// mistaken for them. The folder is created the first time, and its ID is kept in a file, as the token is.
+const (
+	gdriveFolderIdFile   = "gdrive_folder_id"
+	gdriveFolderName     = "mantecabox-blobs"
+	gdriveFolderMimeType = "application/vnd.google-apps.folder"
+)
 
-	_, err := srv.Files.Update(filedId, &drive.File{Name: filename}).Media(file).Do()
+type (
+	// GDriveStorage stores the blobs in Google Drive, naming every Drive file after its blob's key
+	GDriveStorage struct {
+	}
+)
+
+func (gdriveStorage GDriveStorage) Put(key string, reader io.Reader, size int64) error {
+	srv, folderId, err := gdriveStorage.service()
 	if err != nil {
 		return err
 	}
-
+	driveFile, err := srv.Files.Create(&drive.File{Name: key, Parents: []string{folderId}}).Media(reader).Do()
+	if err != nil {
+		logs.ServicesLog.Errorf("Unable to create file: %v", err)
+		return err
+	}
+	logs.ServicesLog.Infof("uploaded file: %+v (%v)", driveFile.Name, driveFile.Id)
 	return nil
 }
 
-// File download
-func (fileService FileServiceImpl) DownloadFile(srv *drive.Service, filedId string, file models.File) ([]byte, error) {
-	_, err := srv.Files.Get(filedId).Do()
+func (gdriveStorage GDriveStorage) Get(key string) (io.ReadCloser, error) {
+	srv, driveFile, err := gdriveStorage.find(key)
 	if err != nil {
 		return nil, err
 	}
+	response, err := srv.Files.Get(driveFile.Id).Download()
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
 
-	response, err := srv.Files.Get(filedId).Download()
-
-	body, err := ioutil.ReadAll(response.Body)
+func (gdriveStorage GDriveStorage) GetAt(key string, offset int64) (io.ReadCloser, error) {
+	srv, driveFile, err := gdriveStorage.find(key)
 	if err != nil {
 		return nil, err
 	}
+	call := srv.Files.Get(driveFile.Id)
+	call.Header().Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	response, err := call.Download()
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
 
-	fileDecrypt := fileService.aesCipher.Decrypt(body)
+func (gdriveStorage GDriveStorage) Delete(key string) error {
+	srv, driveFile, err := gdriveStorage.find(key)
+	if err != nil {
+		return err
+	}
+	return RemoveFile(srv, driveFile.Id)
+}
 
-	return fileDecrypt, nil
+func (gdriveStorage GDriveStorage) Stat(key string) (models.BlobInfo, error) {
+	_, driveFile, err := gdriveStorage.find(key)
+	if err != nil {
+		return models.BlobInfo{}, err
+	}
+	return driveFileToBlobInfo(driveFile), nil
 }
 
-func (fileService FileServiceImpl) GetFileGDrive(file models.File) ([]byte, error) {
-	gService, err := GetGdriveService()
+func (gdriveStorage GDriveStorage) List() ([]models.BlobInfo, error) {
+	srv, folderId, err := gdriveStorage.service()
 	if err != nil {
 		return nil, err
 	}
+	blobs := make([]models.BlobInfo, 0)
+	pageToken := ""
+	for {
+		r, err := srv.Files.List().
+			Q(blobsQuery(folderId, "")).
+			Fields("nextPageToken, files(id, name, size, modifiedTime)").
+			PageToken(pageToken).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, driveFile := range r.Files {
+			blobs = append(blobs, driveFileToBlobInfo(driveFile))
+		}
+		if r.NextPageToken == "" {
+			return blobs, nil
+		}
+		pageToken = r.NextPageToken
+	}
+}
 
-	fileResponse, err := fileService.DownloadFile(gService, file.GdriveID.String, file)
+// find looks for the Drive file named after the key, as Drive identifies its files by its own IDs
+func (gdriveStorage GDriveStorage) find(key string) (*drive.Service, *drive.File, error) {
+	srv, folderId, err := gdriveStorage.service()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	r, err := srv.Files.List().
+		Q(blobsQuery(folderId, key)).
+		Fields("files(id, name, size, modifiedTime)").
+		Do()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(r.Files) == 0 {
+		return nil, nil, BlobNotFoundError
+	}
+	return srv, r.Files[0], nil
+}
+
+// service returns the Drive client and the ID of the blobs' folder, creating the folder if it doesn't exist yet
+func (gdriveStorage GDriveStorage) service() (*drive.Service, string, error) {
+	srv, err := GetGdriveService()
+	if err != nil {
+		return nil, "", err
+	}
+	if folderId, err := ioutil.ReadFile(gdriveFolderIdFile); err == nil {
+		return srv, strings.TrimSpace(string(folderId)), nil
+	} else if !os.IsNotExist(err) {
+		return nil, "", err
+	}
+	folder, err := srv.Files.Create(&drive.File{Name: gdriveFolderName, MimeType: gdriveFolderMimeType}).Fields("id").Do()
+	if err != nil {
+		return nil, "", err
 	}
+	if err := ioutil.WriteFile(gdriveFolderIdFile, []byte(folder.Id), 0600); err != nil {
+		return nil, "", err
+	}
+	logs.ServicesLog.Infof("Created the blobs' folder in Google Drive (%v)", folder.Id)
+	return srv, folder.Id, nil
+}
+
+// blobsQuery searches the blobs' folder for the blob with the key, or for all of them if the key is empty
+func blobsQuery(folderId string, key string) string {
+	query := fmt.Sprintf("'%v' in parents and trashed = false", escapeDriveQuery(folderId))
+	if key != "" {
+		query += fmt.Sprintf(" and name = '%v'", escapeDriveQuery(key))
+	}
+	return query
+}
+
+func escapeDriveQuery(value string) string {
+	return strings.Replace(strings.Replace(value, `\`, `\\`, -1), "'", `\'`, -1)
+}
 
-	return fileResponse, err
+func driveFileToBlobInfo(driveFile *drive.File) models.BlobInfo {
+	modTime, _ := time.Parse(time.RFC3339, driveFile.ModifiedTime)
+	return models.BlobInfo{
+		Key:     driveFile.Name,
+		Size:    driveFile.Size,
+		ModTime: modTime,
+	}
 }
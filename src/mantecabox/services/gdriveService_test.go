@@ -0,0 +1,25 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobsQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		folderId string
+		key      string
+		want     string
+	}{
+		{"When there is no key, search the whole folder", "folder1", "", `'folder1' in parents and trashed = false`},
+		{"When there is a key, search the blob in the folder", "folder1", "abc", `'folder1' in parents and trashed = false and name = 'abc'`},
+		{"When the key has quotes, escape them", "folder1", `a'b\c`, `'folder1' in parents and trashed = false and name = 'a\'b\\c'`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, blobsQuery(testCase.folderId, testCase.key))
+		})
+	}
+}
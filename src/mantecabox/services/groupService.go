@@ -0,0 +1,158 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+)
+
+var (
+	InvalidGroupNameError  = errors.New("the group's name must have up to 40 lowercase letters, digits, dots, dashes or underscores")
+	InvalidGroupRoleError  = errors.New(`the role must be "member" or "manager"`)
+	UnknownMemberError     = errors.New("the user to add to the group doesn't exist")
+	GroupNotEmptyError     = errors.New("the group still has files, in its folders or in its trash")
+	GroupAccessDeniedError = errors.New("the user isn't a member of the group, or isn't one of its managers")
+)
+
+// groupNameRegexp matches the groups' names, which can't be taken for an email
+var groupNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,39}$`)
+
+type (
+	// GroupService manages the groups, whose members share the group's storage space. The admins create and delete
+	// the groups, and the managers of each group add and remove its members.
+	GroupService interface {
+		CreateGroup(name string, manager string) (models.Group, error)
+		GetGroups() ([]models.Group, error)
+		DeleteGroup(name string) error
+		GetUserGroups(user models.User) ([]models.GroupMember, error)
+		GetMembers(group string) ([]models.GroupMember, error)
+		SetMember(member *models.GroupMember) (models.GroupMember, error)
+		RemoveMember(group string, email string) error
+		AuthorizeGroup(group string, user models.User, role string) (models.GroupMember, error)
+	}
+
+	GroupServiceImpl struct {
+		configuration *models.Configuration
+		groupDao      dao.GroupDao
+		userDao       dao.UserDao
+		fileDao       dao.FileDao
+	}
+)
+
+func NewGroupService(configuration *models.Configuration) GroupService {
+	if configuration == nil {
+		return nil
+	}
+	return GroupServiceImpl{
+		configuration: configuration,
+		groupDao:      dao.GroupDaoFactory(configuration.Database.Engine),
+		userDao:       dao.UserDaoFactory(configuration.Database.Engine),
+		fileDao:       dao.FileDaoFactory(configuration.Database.Engine),
+	}
+}
+
+// CreateGroup creates the group, with the user as its first manager if one is given. If the name is taken by a user
+// or by another group, dao.GroupNameTakenError is returned.
+func (groupService GroupServiceImpl) CreateGroup(name string, manager string) (models.Group, error) {
+	if !groupNameRegexp.MatchString(name) {
+		return models.Group{}, InvalidGroupNameError
+	}
+	if manager != "" {
+		if _, err := groupService.member(manager); err != nil {
+			return models.Group{}, err
+		}
+	}
+	group, err := groupService.groupDao.Create(name)
+	if err != nil || manager == "" {
+		return group, err
+	}
+	_, err = groupService.groupDao.SaveMember(&models.GroupMember{Group: name, Member: manager, Role: models.GroupRoleManager})
+	return group, err
+}
+
+func (groupService GroupServiceImpl) GetGroups() ([]models.Group, error) {
+	return groupService.groupDao.GetAll()
+}
+
+// DeleteGroup deletes the group and its members. Its files must be deleted first, and its trash emptied; otherwise,
+// GroupNotEmptyError is returned.
+func (groupService GroupServiceImpl) DeleteGroup(name string) error {
+	if _, err := groupService.groupDao.Get(name); err != nil {
+		return err
+	}
+	usage, err := groupService.fileDao.GetUsage(name)
+	if err != nil {
+		return err
+	}
+	if usage.Live.Versions+usage.OldVersions.Versions+usage.Trash.Versions > 0 {
+		return GroupNotEmptyError
+	}
+	return groupService.groupDao.Delete(name)
+}
+
+// GetUserGroups returns the groups that the user is a member of, with their role in them
+func (groupService GroupServiceImpl) GetUserGroups(user models.User) ([]models.GroupMember, error) {
+	return groupService.groupDao.GetByMember(user.Email)
+}
+
+// GetMembers returns the group's members. If the group doesn't exist, sql.ErrNoRows is returned.
+func (groupService GroupServiceImpl) GetMembers(group string) ([]models.GroupMember, error) {
+	if _, err := groupService.groupDao.Get(group); err != nil {
+		return nil, err
+	}
+	return groupService.groupDao.GetMembers(group)
+}
+
+// SetMember adds the user to the group, or changes their role in it. The members without role are plain members. If
+// the group doesn't exist, sql.ErrNoRows is returned.
+func (groupService GroupServiceImpl) SetMember(member *models.GroupMember) (models.GroupMember, error) {
+	if member.Role == "" {
+		member.Role = models.GroupRoleMember
+	}
+	if member.Role != models.GroupRoleMember && member.Role != models.GroupRoleManager {
+		return models.GroupMember{}, InvalidGroupRoleError
+	}
+	if _, err := groupService.groupDao.Get(member.Group); err != nil {
+		return models.GroupMember{}, err
+	}
+	if _, err := groupService.member(member.Member); err != nil {
+		return models.GroupMember{}, err
+	}
+	return groupService.groupDao.SaveMember(member)
+}
+
+// RemoveMember removes the user from the group. If they aren't a member, sql.ErrNoRows is returned.
+func (groupService GroupServiceImpl) RemoveMember(group string, email string) error {
+	return groupService.groupDao.DeleteMember(group, email)
+}
+
+// AuthorizeGroup returns the user's membership in the group, checking that they are a manager if the role is required.
+// Otherwise, GroupAccessDeniedError is returned.
+func (groupService GroupServiceImpl) AuthorizeGroup(group string, user models.User, role string) (models.GroupMember, error) {
+	member, err := groupService.groupDao.GetMember(group, user.Email)
+	if err == sql.ErrNoRows || (err == nil && role == models.GroupRoleManager && member.Role != models.GroupRoleManager) {
+		return models.GroupMember{}, GroupAccessDeniedError
+	}
+	return member, err
+}
+
+// member returns the user to add to a group, which must be a registered user and not another group
+func (groupService GroupServiceImpl) member(email string) (models.User, error) {
+	user, err := groupService.userDao.GetByPk(email)
+	if err == sql.ErrNoRows {
+		return user, UnknownMemberError
+	}
+	if err != nil {
+		return user, err
+	}
+	if _, err := groupService.groupDao.Get(email); err != sql.ErrNoRows {
+		if err == nil {
+			err = UnknownMemberError
+		}
+		return user, err
+	}
+	return user, nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGroupDao only knows the members of the "project" group
+type fakeGroupDao struct {
+	dao.GroupDao
+	roles map[string]string
+}
+
+func (groupDao fakeGroupDao) Get(name string) (models.Group, error) {
+	if name != "project" {
+		return models.Group{}, sql.ErrNoRows
+	}
+	return models.Group{Name: name}, nil
+}
+
+func (groupDao fakeGroupDao) GetAll() ([]models.Group, error) {
+	return []models.Group{{Name: "project"}}, nil
+}
+
+func (groupDao fakeGroupDao) GetMember(group string, email string) (models.GroupMember, error) {
+	role, ok := groupDao.roles[email]
+	if group != "project" || !ok {
+		return models.GroupMember{}, sql.ErrNoRows
+	}
+	return models.GroupMember{Group: group, Member: email, Role: role}, nil
+}
+
+// fakeFileDao only knows the last versions of some files
+type fakeFileDao struct {
+	dao.FileDao
+	files map[string]models.File
+}
+
+func (fileDao fakeFileDao) GetLastVersionFileByNameAndOwner(filename string, user *models.User) (models.File, error) {
+	file, ok := fileDao.files[user.Email+":"+filename]
+	if !ok {
+		return models.File{}, sql.ErrNoRows
+	}
+	return file, nil
+}
+
+func TestNewGroupService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          GroupService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF"},
+			GroupServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewGroupService(testCase.configuration))
+		})
+	}
+}
+
+func TestGroupServiceImpl_CreateGroup(t *testing.T) {
+	testCases := []struct {
+		name      string
+		groupName string
+	}{
+		{"When the name is empty, return an error", ""},
+		{"When the name looks like an email, return an error", "team@example.com"},
+		{"When the name has capital letters, return an error", "Project"},
+		{"When the name starts with a dot, return an error", ".project"},
+		{"When the name is too long, return an error", "a-very-long-project-name-that-goes-over-40"},
+	}
+	groupService := GroupServiceImpl{}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := groupService.CreateGroup(testCase.groupName, "")
+			require.Equal(t, InvalidGroupNameError, err)
+		})
+	}
+}
+
+func TestGroupServiceImpl_SetMember(t *testing.T) {
+	groupService := GroupServiceImpl{groupDao: fakeGroupDao{}}
+	_, err := groupService.SetMember(&models.GroupMember{Group: "project", Member: "testuser1", Role: "owner"})
+	require.Equal(t, InvalidGroupRoleError, err)
+	_, err = groupService.SetMember(&models.GroupMember{Group: "unknown", Member: "testuser1"})
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestGroupServiceImpl_AuthorizeGroup(t *testing.T) {
+	groupService := GroupServiceImpl{groupDao: fakeGroupDao{roles: map[string]string{
+		"testuser1": models.GroupRoleManager,
+		"testuser2": models.GroupRoleMember,
+	}}}
+	testCases := []struct {
+		name    string
+		group   string
+		email   string
+		role    string
+		wantErr error
+	}{
+		{"When the user is a manager, they can manage the group", "project", "testuser1", models.GroupRoleManager, nil},
+		{"When the user is a member, they can access the group", "project", "testuser2", models.GroupRoleMember, nil},
+		{"When the user is a member, they can't manage the group", "project", "testuser2", models.GroupRoleManager, GroupAccessDeniedError},
+		{"When the user isn't a member, deny the access", "project", "testuser3", models.GroupRoleMember, GroupAccessDeniedError},
+		{"When the group doesn't exist, deny the access", "unknown", "testuser1", models.GroupRoleMember, GroupAccessDeniedError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			user := models.User{Credentials: models.Credentials{Email: testCase.email}}
+			member, err := groupService.AuthorizeGroup(testCase.group, user, testCase.role)
+			require.Equal(t, testCase.wantErr, err)
+			if err == nil {
+				require.Equal(t, testCase.email, member.Member)
+			}
+		})
+	}
+}
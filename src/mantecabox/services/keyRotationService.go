@@ -0,0 +1,431 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/utilities"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	DefaultRotationBatchSize = 100
+	// minimumKeyLength is the shortest key that the AES-CTR cipher accepts
+	minimumKeyLength = aes.BlockSize
+	// rotationSampleSize is how many items of each batch are decrypted back with the new key
+	rotationSampleSize = 3
+	rotatingBlobSuffix = ".rotating"
+)
+
+var (
+	KeyTooShortError          = errors.New(fmt.Sprintf("the keys must have %v characters at least", minimumKeyLength))
+	SameKeysError             = errors.New("the old and the new keys are the same")
+	RotationInProgressError   = errors.New("another key rotation with different keys is in progress")
+	RotationVerificationError = errors.New("the rotated data can't be decrypted with the new key")
+)
+
+type (
+	// KeyRotationService replaces the master key. The data keys are re-wrapped, the passwords re-encrypted, and the
+	// blobs that depend on the master key are re-encrypted with their owner's data key. It must be run while the
+	// server is stopped.
+	KeyRotationService interface {
+		RotateMasterKey(oldKey, newKey string, batchSize int) (models.KeyRotation, error)
+	}
+
+	KeyRotationServiceImpl struct {
+		configuration  *models.Configuration
+		keyRotationDao dao.KeyRotationDao
+		storage        StorageBackend
+	}
+
+	// rotationCiphers holds everything needed to decrypt with the old key and encrypt with the new one
+	rotationCiphers struct {
+		oldAesCipher  utilities.AesCTRCipher
+		newAesCipher  utilities.AesCTRCipher
+		oldWrapper    utilities.KeyWrapper
+		newWrapper    utilities.KeyWrapper
+		oldBlobCipher utilities.BlobCipher
+		newBlobCipher utilities.BlobCipher
+		newKeyService KeyService
+	}
+)
+
+func NewKeyRotationService(configuration *models.Configuration) KeyRotationService {
+	if configuration == nil {
+		return nil
+	}
+	storage := StorageBackendFactory(configuration)
+	if storage == nil {
+		return nil
+	}
+	return KeyRotationServiceImpl{
+		configuration:  configuration,
+		keyRotationDao: dao.KeyRotationDaoFactory(configuration.Database.Engine),
+		storage:        storage,
+	}
+}
+
+// RotateMasterKey processes everything encrypted with the old key in batches of batchSize, recording the progress
+// after each one. If it's interrupted, calling it again with the same keys resumes the rotation.
+func (keyRotationService KeyRotationServiceImpl) RotateMasterKey(oldKey, newKey string, batchSize int) (models.KeyRotation, error) {
+	if len(oldKey) < minimumKeyLength || len(newKey) < minimumKeyLength {
+		return models.KeyRotation{}, KeyTooShortError
+	}
+	if oldKey == newKey {
+		return models.KeyRotation{}, SameKeysError
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultRotationBatchSize
+	}
+	rotation, err := keyRotationService.startOrResume(oldKey, newKey)
+	if err != nil {
+		return rotation, err
+	}
+	ciphers := keyRotationService.newRotationCiphers(oldKey, newKey)
+
+	for rotation.Phase != models.RotationPhaseDone {
+		var phaseDone bool
+		switch rotation.Phase {
+		case models.RotationPhaseUserKeys:
+			phaseDone, err = keyRotationService.rotateUserKeysBatch(&rotation, ciphers, batchSize)
+		case models.RotationPhasePasswords:
+			phaseDone, err = keyRotationService.rotatePasswordsBatch(&rotation, ciphers, batchSize)
+		case models.RotationPhaseBlobs:
+			phaseDone, err = keyRotationService.rotateBlobsBatch(&rotation, ciphers, batchSize)
+		default:
+			err = errors.New(fmt.Sprintf(`unknown key rotation phase "%v"`, rotation.Phase))
+		}
+		if err != nil {
+			logs.ServicesLog.Errorf("Key rotation %v stopped during %v phase: %v", rotation.Id, rotation.Phase, err)
+			return rotation, err
+		}
+		if phaseDone {
+			rotation.Phase = nextRotationPhase(rotation.Phase)
+			rotation.Cursor = ""
+			if rotation.Phase == models.RotationPhaseDone {
+				rotation.FinishedAt = null.TimeFrom(time.Now())
+			}
+			rotation, err = keyRotationService.keyRotationDao.UpdateProgress(&rotation)
+			if err != nil {
+				return rotation, err
+			}
+		}
+		logs.ServicesLog.Infof("Key rotation %v: %v phase, %v items processed", rotation.Id, rotation.Phase, rotation.Processed)
+	}
+	return rotation, nil
+}
+
+// startOrResume returns the unfinished rotation with the same keys, or a new one if there is none
+func (keyRotationService KeyRotationServiceImpl) startOrResume(oldKey, newKey string) (models.KeyRotation, error) {
+	oldFingerprint := utilities.KeyFingerprint(oldKey)
+	newFingerprint := utilities.KeyFingerprint(newKey)
+	rotation, err := keyRotationService.keyRotationDao.GetUnfinished()
+	switch {
+	case err == nil && (rotation.OldKeyFingerprint != oldFingerprint || rotation.NewKeyFingerprint != newFingerprint):
+		return rotation, RotationInProgressError
+	case err == nil:
+		logs.ServicesLog.Infof("Resuming key rotation %v from %v phase", rotation.Id, rotation.Phase)
+		return rotation, nil
+	case err == sql.ErrNoRows:
+		return keyRotationService.keyRotationDao.Create(&models.KeyRotation{
+			OldKeyFingerprint: oldFingerprint,
+			NewKeyFingerprint: newFingerprint,
+		})
+	default:
+		return rotation, err
+	}
+}
+
+func (keyRotationService KeyRotationServiceImpl) newRotationCiphers(oldKey, newKey string) rotationCiphers {
+	newConfiguration := *keyRotationService.configuration
+	newConfiguration.AesKey = newKey
+	return rotationCiphers{
+		oldAesCipher:  utilities.NewAesCTRCipher(oldKey),
+		newAesCipher:  utilities.NewAesCTRCipher(newKey),
+		oldWrapper:    utilities.NewKeyWrapper(oldKey),
+		newWrapper:    utilities.NewKeyWrapper(newKey),
+		oldBlobCipher: utilities.NewBlobCipher(oldKey),
+		newBlobCipher: utilities.NewBlobCipher(newKey),
+		newKeyService: NewKeyService(&newConfiguration),
+	}
+}
+
+func nextRotationPhase(phase string) string {
+	switch phase {
+	case models.RotationPhaseUserKeys:
+		return models.RotationPhasePasswords
+	case models.RotationPhasePasswords:
+		return models.RotationPhaseBlobs
+	default:
+		return models.RotationPhaseDone
+	}
+}
+
+// rotateUserKeysBatch re-wraps the next batch of data keys, returning true when there are no more
+func (keyRotationService KeyRotationServiceImpl) rotateUserKeysBatch(rotation *models.KeyRotation, ciphers rotationCiphers, batchSize int) (bool, error) {
+	keys, err := keyRotationService.keyRotationDao.GetUserKeysPage(rotation.Cursor, batchSize)
+	if err != nil || len(keys) == 0 {
+		return err == nil, err
+	}
+	dataKeys := make(map[string][]byte)
+	for i := range keys {
+		dataKey, err := ciphers.oldWrapper.Unwrap(keys[i].WrappedKey)
+		if err != nil {
+			return false, errors.New(fmt.Sprintf(`unable to unwrap the data key of "%v" with the old key: %v`, keys[i].User, err))
+		}
+		dataKeys[keys[i].User] = dataKey
+		keys[i].WrappedKey = ciphers.newWrapper.Wrap(dataKey)
+	}
+	next := *rotation
+	next.Cursor = keys[len(keys)-1].User
+	next.Processed += int64(len(keys))
+	updated, err := keyRotationService.keyRotationDao.SaveUserKeysBatch(keys, &next, func(saved []models.UserKey) error {
+		for _, i := range sampleIndexes(len(saved)) {
+			dataKey, err := ciphers.newWrapper.Unwrap(saved[i].WrappedKey)
+			if err != nil || !bytes.Equal(dataKey, dataKeys[saved[i].User]) {
+				return RotationVerificationError
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	*rotation = updated
+	return false, nil
+}
+
+// rotatePasswordsBatch re-encrypts the next batch of password hashes, returning true when there are no more
+func (keyRotationService KeyRotationServiceImpl) rotatePasswordsBatch(rotation *models.KeyRotation, ciphers rotationCiphers, batchSize int) (bool, error) {
+	users, err := keyRotationService.keyRotationDao.GetUsersPage(rotation.Cursor, batchSize)
+	if err != nil || len(users) == 0 {
+		return err == nil, err
+	}
+	hashes := make(map[string][]byte)
+	for i := range users {
+		hash, err := decryptPasswordHash(ciphers.oldAesCipher, users[i].Password)
+		if err != nil {
+			return false, errors.New(fmt.Sprintf(`unable to decrypt the password of "%v" with the old key: %v`, users[i].Email, err))
+		}
+		hashes[users[i].Email] = hash
+		users[i].Password = base64.URLEncoding.EncodeToString(ciphers.newAesCipher.Encrypt(hash))
+	}
+	next := *rotation
+	next.Cursor = users[len(users)-1].Email
+	next.Processed += int64(len(users))
+	updated, err := keyRotationService.keyRotationDao.SaveUsersBatch(users, &next, func(saved []models.User) error {
+		for _, i := range sampleIndexes(len(saved)) {
+			hash, err := decryptPasswordHash(ciphers.newAesCipher, saved[i].Password)
+			if err != nil || !bytes.Equal(hash, hashes[saved[i].Email]) {
+				return RotationVerificationError
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	*rotation = updated
+	return false, nil
+}
+
+// decryptPasswordHash checks that the decrypted password is a bcrypt hash, as decrypting with the wrong key doesn't fail
+func decryptPasswordHash(aesCipher utilities.AesCTRCipher, password string) ([]byte, error) {
+	decoded, err := base64.URLEncoding.DecodeString(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) < aes.BlockSize {
+		return nil, utilities.CiphertextTooShortError
+	}
+	hash := aesCipher.Decrypt(decoded)
+	if _, err := bcrypt.Cost(hash); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// rotateBlobsBatch re-encrypts the blobs of the next batch of files, returning true when there are no more
+func (keyRotationService KeyRotationServiceImpl) rotateBlobsBatch(rotation *models.KeyRotation, ciphers rotationCiphers, batchSize int) (bool, error) {
+	var afterId int64
+	if rotation.Cursor != "" {
+		id, err := strconv.ParseInt(rotation.Cursor, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		afterId = id
+	}
+	files, err := keyRotationService.keyRotationDao.GetFilesPage(afterId, batchSize)
+	if err != nil || len(files) == 0 {
+		return err == nil, err
+	}
+	for _, file := range files {
+		if err := keyRotationService.rotateBlob(file, ciphers); err != nil {
+			return false, errors.New(fmt.Sprintf(`unable to rotate the blob of file %v: %v`, file.Id, err))
+		}
+	}
+	for _, i := range sampleIndexes(len(files)) {
+		newCipher, _, err := userRotationCiphers(files[i].Owner.Email, ciphers)
+		if err != nil {
+			return false, err
+		}
+		err = keyRotationService.verifyBlob(blobKey(files[i]), newCipher)
+		if err != nil && err != BlobNotFoundError {
+			return false, err
+		}
+	}
+	next := *rotation
+	next.Cursor = strconv.FormatInt(files[len(files)-1].Id, 10)
+	next.Processed += int64(len(files))
+	updated, err := keyRotationService.keyRotationDao.UpdateProgress(&next)
+	if err != nil {
+		return false, err
+	}
+	*rotation = updated
+	return false, nil
+}
+
+// userRotationCiphers returns the new and the old blob ciphers with the user's data key
+func userRotationCiphers(email string, ciphers rotationCiphers) (utilities.BlobCipher, utilities.BlobCipher, error) {
+	dataKey, err := ciphers.newKeyService.GetUserDataKey(email)
+	if err != nil {
+		return nil, nil, err
+	}
+	newCipher, err := ciphers.newBlobCipher.WithDataKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	oldCipher, err := ciphers.oldBlobCipher.WithDataKey(dataKey)
+	return newCipher, oldCipher, err
+}
+
+// rotateBlob writes the re-encrypted blob aside before replacing the original one, so it's never lost if the
+// rotation is interrupted. The blobs encrypted with a data key don't depend on the master key, so they are skipped.
+func (keyRotationService KeyRotationServiceImpl) rotateBlob(file models.File, ciphers rotationCiphers) error {
+	key := blobKey(file)
+	rotatedKey := key + rotatingBlobSuffix
+	newCipher, oldCipher, err := userRotationCiphers(file.Owner.Email, ciphers)
+	if err != nil {
+		return err
+	}
+
+	_, err = keyRotationService.storage.Stat(rotatedKey)
+	switch err {
+	case nil:
+		// A previous run was interrupted. If the rotated blob is complete, only the replacement is left.
+		if keyRotationService.verifyBlob(rotatedKey, newCipher) == nil {
+			return keyRotationService.replaceBlob(rotatedKey, key)
+		}
+		if err := keyRotationService.storage.Delete(rotatedKey); err != nil {
+			return err
+		}
+	case BlobNotFoundError:
+	default:
+		return err
+	}
+
+	rotated, err := keyRotationService.reencryptBlob(key, rotatedKey, oldCipher, newCipher)
+	if err != nil || !rotated {
+		return err
+	}
+	return keyRotationService.replaceBlob(rotatedKey, key)
+}
+
+// reencryptBlob saves the blob encrypted with the new cipher as rotatedKey. It returns false if there was no need.
+func (keyRotationService KeyRotationServiceImpl) reencryptBlob(key, rotatedKey string, oldCipher, newCipher utilities.BlobCipher) (bool, error) {
+	blobInfo, err := keyRotationService.storage.Stat(key)
+	if err == BlobNotFoundError {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	blob, err := keyRotationService.storage.Get(key)
+	if err != nil {
+		return false, err
+	}
+	defer blob.Close()
+
+	bufferedBlob := bufio.NewReader(blob)
+	header, err := bufferedBlob.Peek(utilities.BlobFormatLength)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if utilities.BlobFormat(header) == utilities.BlobFormatGCMChunkedDataKey {
+		return false, nil
+	}
+	plaintext, plaintextSize, err := keyCipher(oldCipher, key).OpenBlob(bufferedBlob, blobInfo.Size)
+	if err != nil {
+		return false, err
+	}
+	err = keyRotationService.storage.Put(rotatedKey, newCipher.EncryptReader(plaintext), newCipher.EncryptedSize(plaintextSize))
+	if err != nil {
+		keyRotationService.storage.Delete(rotatedKey)
+		return false, err
+	}
+	return true, nil
+}
+
+// replaceBlob copies the blob from one key to another, and then removes the first one
+func (keyRotationService KeyRotationServiceImpl) replaceBlob(fromKey, toKey string) error {
+	blobInfo, err := keyRotationService.storage.Stat(fromKey)
+	if err != nil {
+		return err
+	}
+	blob, err := keyRotationService.storage.Get(fromKey)
+	if err != nil {
+		return err
+	}
+	err = keyRotationService.storage.Put(toKey, blob, blobInfo.Size)
+	blob.Close()
+	if err != nil {
+		return err
+	}
+	return keyRotationService.storage.Delete(fromKey)
+}
+
+// verifyBlob decrypts the whole blob, which makes AES-GCM check that it is complete and untouched
+func (keyRotationService KeyRotationServiceImpl) verifyBlob(key string, blobCipher utilities.BlobCipher) error {
+	blobInfo, err := keyRotationService.storage.Stat(key)
+	if err != nil {
+		return err
+	}
+	blob, err := keyRotationService.storage.Get(key)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	plaintext, plaintextSize, err := keyCipher(blobCipher, key).OpenBlob(blob, blobInfo.Size)
+	if err != nil {
+		return err
+	}
+	read, err := io.Copy(ioutil.Discard, plaintext)
+	if err != nil || read != plaintextSize {
+		return RotationVerificationError
+	}
+	return nil
+}
+
+// sampleIndexes picks some random indexes of a batch to verify
+func sampleIndexes(batchLength int) []int {
+	indexes := rand.Perm(batchLength)
+	if len(indexes) > rotationSampleSize {
+		indexes = indexes[:rotationSampleSize]
+	}
+	return indexes
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+
+	"mantecabox/models"
+	"mantecabox/utilities"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testOldKey = "this is the old master key"
+	testNewKey = "this is the new master key"
+)
+
+// fakeKeyService always returns the same data key, so the rotation can be tested without a database
+type fakeKeyService struct {
+	dataKey []byte
+}
+
+func (keyService fakeKeyService) GetUserCipher(email string) (utilities.BlobCipher, error) {
+	return utilities.NewBlobCipher(testNewKey).WithDataKey(keyService.dataKey)
+}
+
+func (keyService fakeKeyService) GetUserDataKey(email string) ([]byte, error) {
+	return keyService.dataKey, nil
+}
+
+func (keyService fakeKeyService) ShredUserKey(email string) error {
+	return nil
+}
+
+func TestNewKeyRotationService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          KeyRotationService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF", Storage: models.Storage{Engine: "memory"}},
+			KeyRotationServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewKeyRotationService(testCase.configuration))
+		})
+	}
+}
+
+func TestKeyRotationServiceImpl_RotateMasterKey(t *testing.T) {
+	testCases := []struct {
+		name    string
+		oldKey  string
+		newKey  string
+		wantErr error
+	}{
+		{"When the old key is too short, return an error", "short", testNewKey, KeyTooShortError},
+		{"When the new key is too short, return an error", testOldKey, "short", KeyTooShortError},
+		{"When both keys are the same, return an error", testOldKey, testOldKey, SameKeysError},
+	}
+	keyRotationService := NewKeyRotationService(&models.Configuration{AesKey: testOldKey, Storage: models.Storage{Engine: "memory"}})
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := keyRotationService.RotateMasterKey(testCase.oldKey, testCase.newKey, 0)
+			require.Equal(t, testCase.wantErr, err)
+		})
+	}
+}
+
+func TestKeyRotationServiceImpl_rotateBlob(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("Fichero inventado de Mantecabox"), 5000)
+	file := models.File{Id: 1, Owner: models.User{Credentials: models.Credentials{Email: "testuser1"}}}
+	dataKey, _ := utilities.NewKeyWrapper(testNewKey).GenerateDataKey()
+	oldCipher, _ := utilities.NewBlobCipher(testOldKey).WithDataKey(dataKey)
+	newCipher, _ := utilities.NewBlobCipher(testNewKey).WithDataKey(dataKey)
+	encrypt := func(blobCipher utilities.BlobCipher) []byte {
+		blob, err := ioutil.ReadAll(blobCipher.EncryptReader(bytes.NewReader(plaintext)))
+		require.NoError(t, err)
+		return blob
+	}
+	dataKeyBlob := encrypt(oldCipher)
+	rotatedBlob := encrypt(newCipher)
+
+	testCases := []struct {
+		name  string
+		blobs map[string][]byte
+	}{
+		{
+			"When the blob is a legacy AES-CTR one, re-encrypt it",
+			map[string][]byte{"1": utilities.NewAesCTRCipher(testOldKey).Encrypt(plaintext)},
+		},
+		{
+			"When the blob is encrypted with the master key, re-encrypt it",
+			map[string][]byte{"1": encrypt(utilities.NewBlobCipher(testOldKey))},
+		},
+		{
+			"When the blob is encrypted with the data key, leave it as it is",
+			map[string][]byte{"1": dataKeyBlob},
+		},
+		{
+			"When a previous rotation was interrupted while replacing the blob, finish the replacement",
+			map[string][]byte{"1": rotatedBlob[:100], "1" + rotatingBlobSuffix: rotatedBlob},
+		},
+		{
+			"When a previous rotation was interrupted while re-encrypting the blob, start again",
+			map[string][]byte{"1": encrypt(utilities.NewBlobCipher(testOldKey)), "1" + rotatingBlobSuffix: rotatedBlob[:len(rotatedBlob)-1]},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			storage := NewMemoryStorage()
+			for key, blob := range testCase.blobs {
+				require.NoError(t, storage.Put(key, bytes.NewReader(blob), int64(len(blob))))
+			}
+			keyRotationService := KeyRotationServiceImpl{configuration: &models.Configuration{}, storage: storage}
+			ciphers := keyRotationService.newRotationCiphers(testOldKey, testNewKey)
+			ciphers.newKeyService = fakeKeyService{dataKey: dataKey}
+
+			require.NoError(t, keyRotationService.rotateBlob(file, ciphers))
+
+			blobs, err := storage.List()
+			require.NoError(t, err)
+			require.Len(t, blobs, 1)
+			require.NoError(t, keyRotationService.verifyBlob("1", newCipher))
+			blob, err := storage.Get("1")
+			require.NoError(t, err)
+			defer blob.Close()
+			decrypted, _, err := newCipher.OpenBlob(blob, blobs[0].Size)
+			require.NoError(t, err)
+			got, err := ioutil.ReadAll(decrypted)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, got)
+		})
+	}
+
+	t.Run("When the blob doesn't exist, skip it", func(t *testing.T) {
+		keyRotationService := KeyRotationServiceImpl{configuration: &models.Configuration{}, storage: NewMemoryStorage()}
+		ciphers := keyRotationService.newRotationCiphers(testOldKey, testNewKey)
+		ciphers.newKeyService = fakeKeyService{dataKey: dataKey}
+		require.NoError(t, keyRotationService.rotateBlob(file, ciphers))
+	})
+}
+
+func TestDecryptPasswordHash(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	password := base64.URLEncoding.EncodeToString(utilities.NewAesCTRCipher(testOldKey).Encrypt(hash))
+
+	got, err := decryptPasswordHash(utilities.NewAesCTRCipher(testOldKey), password)
+	require.NoError(t, err)
+	require.Equal(t, hash, got)
+
+	_, err = decryptPasswordHash(utilities.NewAesCTRCipher(testNewKey), password)
+	require.Error(t, err)
+
+	_, err = decryptPasswordHash(utilities.NewAesCTRCipher(testOldKey), "c2hvcnQ=")
+	require.Equal(t, utilities.CiphertextTooShortError, err)
+}
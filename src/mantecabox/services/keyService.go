@@ -0,0 +1,67 @@
+package services
+
+import (
+	"database/sql"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+	"mantecabox/utilities"
+)
+
+type (
+	// KeyService manages the users' data keys. They are created the first time they are needed, and only stored
+	// wrapped with the master key.
+	KeyService interface {
+		GetUserCipher(email string) (utilities.BlobCipher, error)
+		GetUserDataKey(email string) ([]byte, error)
+		ShredUserKey(email string) error
+	}
+
+	KeyServiceImpl struct {
+		userKeyDao dao.UserKeyDao
+		keyWrapper utilities.KeyWrapper
+		blobCipher utilities.BlobCipher
+	}
+)
+
+func NewKeyService(configuration *models.Configuration) KeyService {
+	if configuration == nil {
+		return nil
+	}
+	return KeyServiceImpl{
+		userKeyDao: dao.UserKeyDaoFactory(configuration.Database.Engine),
+		keyWrapper: utilities.NewKeyWrapper(configuration.AesKey),
+		blobCipher: utilities.NewBlobCipher(configuration.AesKey),
+	}
+}
+
+// GetUserCipher returns a cipher that encrypts with the user's data key
+func (keyService KeyServiceImpl) GetUserCipher(email string) (utilities.BlobCipher, error) {
+	dataKey, err := keyService.GetUserDataKey(email)
+	if err != nil {
+		return nil, err
+	}
+	return keyService.blobCipher.WithDataKey(dataKey)
+}
+
+// GetUserDataKey unwraps the user's data key, creating it if the user doesn't have one yet
+func (keyService KeyServiceImpl) GetUserDataKey(email string) ([]byte, error) {
+	key, err := keyService.userKeyDao.GetByUser(email)
+	if err == sql.ErrNoRows {
+		_, wrappedKey := keyService.keyWrapper.GenerateDataKey()
+		key, err = keyService.userKeyDao.Create(&models.UserKey{User: email, WrappedKey: wrappedKey})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keyService.keyWrapper.Unwrap(key.WrappedKey)
+}
+
+// ShredUserKey removes the user's data key, so the blobs encrypted with it can't ever be decrypted again
+func (keyService KeyServiceImpl) ShredUserKey(email string) error {
+	err := keyService.userKeyDao.Delete(email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
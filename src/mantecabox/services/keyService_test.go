@@ -0,0 +1,35 @@
+package services
+
+import (
+	"mantecabox/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyService(t *testing.T) {
+	type args struct {
+		configuration *models.Configuration
+	}
+	testCases := []struct {
+		name string
+		args args
+		want KeyService
+	}{
+		{
+			name: "When passing the configuration, return the service",
+			args: args{configuration: &models.Configuration{AesKey: "0123456789ABCDEF"}},
+			want: KeyServiceImpl{},
+		},
+		{
+			name: "When passing no configuration, return nil",
+			args: args{configuration: nil},
+			want: nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewKeyService(testCase.args.configuration))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"io"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
+)
+
+const linkTokenBytes = 24
+
+var (
+	InvalidLinkExpiryError       = errors.New(`the link's expiry must be a positive duration, such as "72h"`)
+	InvalidLinkMaxDownloadsError = errors.New("the link's maximum downloads must be positive")
+	LinkExpiredError             = errors.New("the link has expired or has been revoked")
+	LinkExhaustedError           = errors.New("the link has no downloads left")
+	LinkPasswordError            = errors.New("wrong link password")
+)
+
+type (
+	// LinkService lets the users hand their files to people outside the system through public links, which anyone who
+	// knows them can download without logging in. Every access to a link is recorded.
+	LinkService interface {
+		CreateLink(filename string, options models.LinkOptions, user models.User) (models.Link, error)
+		GetLinks(user models.User) ([]models.Link, error)
+		RevokeLink(id int64, user models.User) error
+		GetAccesses(id int64, user models.User) ([]models.LinkAccess, error)
+		OpenLink(token string, password string, resume bool, access models.LinkAccess) (models.File, error)
+	}
+
+	LinkServiceImpl struct {
+		configuration *models.Configuration
+		linkDao       dao.LinkDao
+		fileService   FileService
+	}
+)
+
+func NewLinkService(configuration *models.Configuration) LinkService {
+	if configuration == nil {
+		return nil
+	}
+	fileService := NewFileService(configuration)
+	if fileService == nil {
+		return nil
+	}
+	return LinkServiceImpl{
+		configuration: configuration,
+		linkDao:       dao.LinkDaoFactory(configuration.Database.Engine),
+		fileService:   fileService,
+	}
+}
+
+// CreateLink creates a public link to the user's file, or to one of its versions. If the file or the version doesn't
+// exist, sql.ErrNoRows is returned.
+func (linkService LinkServiceImpl) CreateLink(filename string, options models.LinkOptions, user models.User) (models.Link, error) {
+	link, err := newLink(options, user)
+	if err != nil {
+		return models.Link{}, err
+	}
+	var file models.File
+	if options.Version.Valid {
+		file, err = linkService.fileService.GetFileByVersion(filename, options.Version.Int64, &user)
+		if err == nil && file.DeletedAt.Valid {
+			err = sql.ErrNoRows
+		}
+	} else {
+		file, err = linkService.fileService.GetLastVersionFileByNameAndOwner(filename, &user)
+	}
+	if err != nil {
+		return models.Link{}, err
+	}
+	link.LogicalId = file.LogicalId
+	createdLink, err := linkService.linkDao.Create(&link)
+	createdLink.Name = file.Name
+	return createdLink, err
+}
+
+func (linkService LinkServiceImpl) GetLinks(user models.User) ([]models.Link, error) {
+	return linkService.linkDao.GetByOwner(user.Email)
+}
+
+// RevokeLink disables one of the user's links, keeping the record of its accesses. If they have no live link with the
+// ID, sql.ErrNoRows is returned.
+func (linkService LinkServiceImpl) RevokeLink(id int64, user models.User) error {
+	return linkService.linkDao.Revoke(id, user.Email)
+}
+
+func (linkService LinkServiceImpl) GetAccesses(id int64, user models.User) ([]models.LinkAccess, error) {
+	return linkService.linkDao.GetAccesses(id, user.Email)
+}
+
+// OpenLink returns the version that the link serves, if it can still be downloaded with the password, and counts the
+// download unless it resumes one that the same client already made, as the partial requests of a single download do.
+// The links without downloads left are refused, even to resume one. The access is recorded whether it's granted or
+// not. If there is no link with the token, or the version it serves is gone, sql.ErrNoRows is returned.
+func (linkService LinkServiceImpl) OpenLink(token string, password string, resume bool, access models.LinkAccess) (models.File, error) {
+	link, err := linkService.linkDao.GetByToken(token)
+	if err != nil {
+		return models.File{}, err
+	}
+	access.LinkId = link.Id
+	file, err := linkService.openLink(link, password, resume, access)
+	access.Granted = err == nil
+	if err := linkService.linkDao.CreateAccess(&access); err != nil {
+		logs.ServicesLog.Errorf("Unable to record the access to link %v: %v", link.Id, err)
+	}
+	return file, err
+}
+
+func (linkService LinkServiceImpl) openLink(link models.Link, password string, resume bool, access models.LinkAccess) (models.File, error) {
+	if link.RevokedAt.Valid || (link.ExpiresAt.Valid && !time.Now().Before(link.ExpiresAt.Time)) {
+		return models.File{}, LinkExpiredError
+	}
+	if link.Password.Valid && bcrypt.CompareHashAndPassword([]byte(link.Password.String), []byte(password)) != nil {
+		return models.File{}, LinkPasswordError
+	}
+	if link.MaxDownloads.Valid && link.Downloads >= link.MaxDownloads.Int64 {
+		return models.File{}, LinkExhaustedError
+	}
+	file, err := linkService.linkDao.GetFile(link)
+	if err != nil {
+		return models.File{}, err
+	}
+	if resume {
+		counted, err := linkService.linkDao.HasGrantedAccess(access)
+		if err != nil {
+			return models.File{}, err
+		}
+		if counted {
+			return file, nil
+		}
+	}
+	if err := linkService.linkDao.Use(link.Id); err != nil {
+		if err == sql.ErrNoRows {
+			return models.File{}, LinkExhaustedError
+		}
+		return models.File{}, err
+	}
+	return file, nil
+}
+
+// newLink checks the link's options, and gives it a random token and the hash of its password
+func newLink(options models.LinkOptions, user models.User) (models.Link, error) {
+	link := models.Link{Owner: user.Email, Version: options.Version, MaxDownloads: options.MaxDownloads}
+	if options.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(options.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			return models.Link{}, InvalidLinkExpiryError
+		}
+		link.ExpiresAt = null.TimeFrom(time.Now().Add(expiresIn))
+	}
+	if options.MaxDownloads.Valid && options.MaxDownloads.Int64 <= 0 {
+		return models.Link{}, InvalidLinkMaxDownloadsError
+	}
+	if options.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(options.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return models.Link{}, err
+		}
+		link.Password = null.StringFrom(string(hashedPassword))
+	}
+	token := make([]byte, linkTokenBytes)
+	if _, err := io.ReadFull(rand.Reader, token); err != nil {
+		return models.Link{}, err
+	}
+	link.Token = base64.RawURLEncoding.EncodeToString(token)
+	return link, nil
+}
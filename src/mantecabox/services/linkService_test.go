@@ -0,0 +1,205 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
+)
+
+// fakeLinkDao keeps the links by their token, and serves the same file for all of them
+type fakeLinkDao struct {
+	links    map[string]*models.Link
+	accesses *[]models.LinkAccess
+}
+
+func (dao fakeLinkDao) Create(link *models.Link) (models.Link, error) {
+	dao.links[link.Token] = link
+	return *link, nil
+}
+
+func (dao fakeLinkDao) GetByOwner(owner string) ([]models.Link, error) {
+	return []models.Link{}, nil
+}
+
+func (dao fakeLinkDao) GetByToken(token string) (models.Link, error) {
+	link, ok := dao.links[token]
+	if !ok {
+		return models.Link{}, sql.ErrNoRows
+	}
+	return *link, nil
+}
+
+func (dao fakeLinkDao) Revoke(id int64, owner string) error {
+	return nil
+}
+
+func (dao fakeLinkDao) Use(id int64) error {
+	for _, link := range dao.links {
+		if link.Id == id {
+			if link.MaxDownloads.Valid && link.Downloads >= link.MaxDownloads.Int64 {
+				return sql.ErrNoRows
+			}
+			link.Downloads++
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (dao fakeLinkDao) GetFile(link models.Link) (models.File, error) {
+	return models.File{Id: 1, Name: "backup.tar", LogicalId: link.LogicalId}, nil
+}
+
+func (dao fakeLinkDao) CreateAccess(access *models.LinkAccess) error {
+	*dao.accesses = append(*dao.accesses, *access)
+	return nil
+}
+
+func (dao fakeLinkDao) HasGrantedAccess(access models.LinkAccess) (bool, error) {
+	for _, recorded := range *dao.accesses {
+		if recorded.LinkId == access.LinkId && recorded.Ip == access.Ip && recorded.UserAgent == access.UserAgent && recorded.Granted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (dao fakeLinkDao) GetAccesses(id int64, owner string) ([]models.LinkAccess, error) {
+	return *dao.accesses, nil
+}
+
+func TestNewLinkService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          LinkService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF"},
+			LinkServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewLinkService(testCase.configuration))
+		})
+	}
+}
+
+func TestNewLink(t *testing.T) {
+	user := models.User{Credentials: models.Credentials{Email: "testuser1"}}
+	testCases := []struct {
+		name    string
+		options models.LinkOptions
+		wantErr error
+	}{
+		{"When no limit is given, create a link without them", models.LinkOptions{}, nil},
+		{"When all the limits are given, create a link with them", models.LinkOptions{Version: null.IntFrom(3), ExpiresIn: "72h", MaxDownloads: null.IntFrom(5), Password: "secret"}, nil},
+		{"When the expiry isn't a duration, return an error", models.LinkOptions{ExpiresIn: "tomorrow"}, InvalidLinkExpiryError},
+		{"When the expiry is negative, return an error", models.LinkOptions{ExpiresIn: "-1h"}, InvalidLinkExpiryError},
+		{"When the maximum downloads aren't positive, return an error", models.LinkOptions{MaxDownloads: null.IntFrom(0)}, InvalidLinkMaxDownloadsError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			link, err := newLink(testCase.options, user)
+			require.Equal(t, testCase.wantErr, err)
+			if err != nil {
+				return
+			}
+			require.Equal(t, "testuser1", link.Owner)
+			require.Len(t, link.Token, 32)
+			require.Equal(t, testCase.options.Version, link.Version)
+			require.Equal(t, testCase.options.MaxDownloads, link.MaxDownloads)
+			require.Equal(t, testCase.options.ExpiresIn != "", link.ExpiresAt.Valid)
+			require.Equal(t, testCase.options.Password != "", link.Password.Valid)
+			if link.Password.Valid {
+				require.NoError(t, bcrypt.CompareHashAndPassword([]byte(link.Password.String), []byte(testCase.options.Password)))
+			}
+		})
+	}
+
+	first, err := newLink(models.LinkOptions{}, user)
+	require.NoError(t, err)
+	second, err := newLink(models.LinkOptions{}, user)
+	require.NoError(t, err)
+	require.NotEqual(t, first.Token, second.Token)
+}
+
+func TestLinkServiceImpl_OpenLink(t *testing.T) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	var accesses []models.LinkAccess
+	linkService := LinkServiceImpl{linkDao: fakeLinkDao{
+		accesses: &accesses,
+		links: map[string]*models.Link{
+			"open":      {Id: 1},
+			"once":      {Id: 2, MaxDownloads: null.IntFrom(1)},
+			"protected": {Id: 3, Password: null.StringFrom(string(hashedPassword))},
+			"expired":   {Id: 4, ExpiresAt: null.TimeFrom(time.Now().Add(-time.Minute))},
+			"revoked":   {Id: 5, RevokedAt: null.TimeFrom(time.Now())},
+			"future":    {Id: 6, ExpiresAt: null.TimeFrom(time.Now().Add(time.Hour))},
+			"twice":     {Id: 7, MaxDownloads: null.IntFrom(2)},
+		},
+	}}
+	testCases := []struct {
+		name          string
+		token         string
+		password      string
+		resume        bool
+		ip            string
+		wantErr       error
+		wantDownloads int64
+	}{
+		{"When the link has no limits, open it", "open", "", false, "127.0.0.1", nil, 1},
+		{"When the link has downloads left, open it", "once", "", false, "127.0.0.1", nil, 1},
+		{"When the link has no downloads left, return an error", "once", "", false, "127.0.0.1", LinkExhaustedError, 1},
+		{"When the link has no downloads left, don't resume a download", "once", "", true, "127.0.0.1", LinkExhaustedError, 1},
+		{"When a new client asks for a part of the file, count the download", "twice", "", true, "127.0.0.1", nil, 1},
+		{"When the same client resumes its download, don't count it", "twice", "", true, "127.0.0.1", nil, 1},
+		{"When another client asks for a part of the file, count the download", "twice", "", true, "10.0.0.1", nil, 2},
+		{"When the password is right, open the link", "protected", "secret", false, "127.0.0.1", nil, 1},
+		{"When the password is wrong, return an error", "protected", "wrong", false, "127.0.0.1", LinkPasswordError, 1},
+		{"When the password is missing, return an error", "protected", "", false, "127.0.0.1", LinkPasswordError, 1},
+		{"When the password is missing, don't resume a download", "protected", "", true, "127.0.0.1", LinkPasswordError, 1},
+		{"When the link has expired, return an error", "expired", "", false, "127.0.0.1", LinkExpiredError, 0},
+		{"When the link has expired, don't resume a download", "expired", "", true, "127.0.0.1", LinkExpiredError, 0},
+		{"When the link has been revoked, return an error", "revoked", "", false, "127.0.0.1", LinkExpiredError, 0},
+		{"When the link hasn't expired yet, open it", "future", "", false, "127.0.0.1", nil, 1},
+		{"When the link doesn't exist, return no rows", "unknown", "", false, "127.0.0.1", sql.ErrNoRows, 0},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			recorded := len(accesses)
+			file, err := linkService.OpenLink(testCase.token, testCase.password, testCase.resume, models.LinkAccess{Ip: testCase.ip, UserAgent: "curl"})
+			require.Equal(t, testCase.wantErr, err)
+			if err == nil {
+				require.Equal(t, "backup.tar", file.Name)
+			}
+			if link, ok := linkService.linkDao.(fakeLinkDao).links[testCase.token]; ok {
+				require.Equal(t, testCase.wantDownloads, link.Downloads)
+			}
+			if testCase.wantErr == sql.ErrNoRows {
+				require.Len(t, accesses, recorded)
+				return
+			}
+			// Every access to an existing link is recorded
+			require.Len(t, accesses, recorded+1)
+			access := accesses[recorded]
+			require.Equal(t, testCase.wantErr == nil, access.Granted)
+			require.Equal(t, testCase.ip, access.Ip)
+			require.Equal(t, "curl", access.UserAgent)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+type (
+	LocalStorage struct {
+		path string
+	}
+)
+
+func NewLocalStorage(path string) StorageBackend {
+	if path == "" {
+		path = "files"
+	}
+	// Maybe the config path didn't ended with folder's slash, so we add it
+	if path[len(path)-1] != '/' {
+		path += "/"
+	}
+	localStorage := LocalStorage{
+		path: path,
+	}
+	localStorage.createDirIfNotExists()
+	return localStorage
+}
+
+func (localStorage LocalStorage) Put(key string, reader io.Reader, size int64) error {
+	blobPath, err := localStorage.blobPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(blobPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0700)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+func (localStorage LocalStorage) Get(key string) (io.ReadCloser, error) {
+	blobPath, err := localStorage.blobPath(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(blobPath)
+	if os.IsNotExist(err) {
+		return nil, BlobNotFoundError
+	}
+	return file, err
+}
+
+func (localStorage LocalStorage) GetAt(key string, offset int64) (io.ReadCloser, error) {
+	file, err := localStorage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.(*os.File).Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (localStorage LocalStorage) Delete(key string) error {
+	blobPath, err := localStorage.blobPath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(blobPath)
+	if os.IsNotExist(err) {
+		return BlobNotFoundError
+	}
+	return err
+}
+
+func (localStorage LocalStorage) Stat(key string) (models.BlobInfo, error) {
+	blobPath, err := localStorage.blobPath(key)
+	if err != nil {
+		return models.BlobInfo{}, err
+	}
+	fileInfo, err := os.Stat(blobPath)
+	if os.IsNotExist(err) {
+		return models.BlobInfo{}, BlobNotFoundError
+	}
+	if err != nil {
+		return models.BlobInfo{}, err
+	}
+	return models.BlobInfo{
+		Key:     key,
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime(),
+	}, nil
+}
+
+func (localStorage LocalStorage) List() ([]models.BlobInfo, error) {
+	blobs := make([]models.BlobInfo, 0)
+	err := filepath.Walk(localStorage.path, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() {
+			return err
+		}
+		key, err := filepath.Rel(localStorage.path, path)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, models.BlobInfo{
+			Key:     filepath.ToSlash(key),
+			Size:    fileInfo.Size(),
+			ModTime: fileInfo.ModTime(),
+		})
+		return nil
+	})
+	return blobs, err
+}
+
+// blobPath avoids keys escaping from the storage's directory
+func (localStorage LocalStorage) blobPath(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "..") {
+		return "", InvalidBlobKeyError
+	}
+	return localStorage.path + key, nil
+}
+
+func (localStorage LocalStorage) createDirIfNotExists() {
+	err := os.MkdirAll(localStorage.path, 0700)
+	if err != nil {
+		logs.ServicesLog.Errorf("Error creating file's directory: %v", err.Error())
+		panic(err)
+	}
+}
@@ -24,6 +24,7 @@ var (
 type (
 	LoginAttemptService interface {
 		ProcessLoginAttempt(attempt *models.LoginAttempt) error
+		GetLoginAttempts(email string) ([]models.LoginAttempt, error)
 		sendNewRegisteredDeviceActivity(attempt *models.LoginAttempt) error
 		sendSuspiciousActivityReport(unsuccessfulAttempt *models.LoginAttempt) error
 		Configuration() *models.Configuration
@@ -46,6 +47,11 @@ func NewLoginAttemptService(configuration *models.Configuration) LoginAttemptSer
 	}
 }
 
+// GetLoginAttempts returns all the login attempts of the user, successful or not
+func (loginAttemptService LoginAttemptServiceImpl) GetLoginAttempts(email string) ([]models.LoginAttempt, error) {
+	return loginAttemptDao.GetByUser(email)
+}
+
 func (loginAttemptService LoginAttemptServiceImpl) ProcessLoginAttempt(attempt *models.LoginAttempt) error {
 	MaxUnsuccessfulAttempts := loginAttemptService.configuration.MaxUnsuccessfulAttempts
 	timeLimit, err := time.ParseDuration(loginAttemptService.configuration.BlockedLoginTimeLimit)
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"mantecabox/models"
+)
+
+type (
+	// MemoryStorage keeps the blobs in a map. It is not persistent, so it's only useful for testing.
+	MemoryStorage struct {
+		mutex *sync.RWMutex
+		blobs map[string]memoryBlob
+	}
+
+	memoryBlob struct {
+		data    []byte
+		modTime time.Time
+	}
+)
+
+func NewMemoryStorage() StorageBackend {
+	return MemoryStorage{
+		mutex: &sync.RWMutex{},
+		blobs: make(map[string]memoryBlob),
+	}
+}
+
+func (memoryStorage MemoryStorage) Put(key string, reader io.Reader, size int64) error {
+	if key == "" {
+		return InvalidBlobKeyError
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	memoryStorage.mutex.Lock()
+	defer memoryStorage.mutex.Unlock()
+	memoryStorage.blobs[key] = memoryBlob{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (memoryStorage MemoryStorage) Get(key string) (io.ReadCloser, error) {
+	memoryStorage.mutex.RLock()
+	defer memoryStorage.mutex.RUnlock()
+	blob, exists := memoryStorage.blobs[key]
+	if !exists {
+		return nil, BlobNotFoundError
+	}
+	return ioutil.NopCloser(bytes.NewReader(blob.data)), nil
+}
+
+func (memoryStorage MemoryStorage) GetAt(key string, offset int64) (io.ReadCloser, error) {
+	memoryStorage.mutex.RLock()
+	defer memoryStorage.mutex.RUnlock()
+	blob, exists := memoryStorage.blobs[key]
+	if !exists {
+		return nil, BlobNotFoundError
+	}
+	if offset > int64(len(blob.data)) {
+		offset = int64(len(blob.data))
+	}
+	return ioutil.NopCloser(bytes.NewReader(blob.data[offset:])), nil
+}
+
+func (memoryStorage MemoryStorage) Delete(key string) error {
+	memoryStorage.mutex.Lock()
+	defer memoryStorage.mutex.Unlock()
+	if _, exists := memoryStorage.blobs[key]; !exists {
+		return BlobNotFoundError
+	}
+	delete(memoryStorage.blobs, key)
+	return nil
+}
+
+func (memoryStorage MemoryStorage) Stat(key string) (models.BlobInfo, error) {
+	memoryStorage.mutex.RLock()
+	defer memoryStorage.mutex.RUnlock()
+	blob, exists := memoryStorage.blobs[key]
+	if !exists {
+		return models.BlobInfo{}, BlobNotFoundError
+	}
+	return models.BlobInfo{Key: key, Size: int64(len(blob.data)), ModTime: blob.modTime}, nil
+}
+
+func (memoryStorage MemoryStorage) List() ([]models.BlobInfo, error) {
+	memoryStorage.mutex.RLock()
+	defer memoryStorage.mutex.RUnlock()
+	blobs := make([]models.BlobInfo, 0, len(memoryStorage.blobs))
+	for key, blob := range memoryStorage.blobs {
+		blobs = append(blobs, models.BlobInfo{Key: key, Size: int64(len(blob.data)), ModTime: blob.modTime})
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Key < blobs[j].Key
+	})
+	return blobs, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+
+	"mantecabox/models"
+)
+
+var InvalidPermissionsError = errors.New(`wrong permissions flags (must be three "rwx" groups, with "-" for the missing ones)`)
+
+// defaultPermissions are the ones of the files uploaded without them
+const defaultPermissions = "rw-r--r--"
+
+// permissionsRegexp matches the Unix-like permissions of the files, such as "rw-r-----"
+var permissionsRegexp = regexp.MustCompile(`^([r-][w-][x-]){3}$`)
+
+// The permission classes are the positions of the group's and the others' "rwx" in the permissions. The owner can
+// always access their files; the members of a group get the group's permissions, and the users that a file has been
+// shared with get the others' ones.
+const (
+	groupClass = 3
+	otherClass = 6
+)
+
+// ValidatePermissions checks the grammar of the file's permissions, which may be empty to keep the current ones
+func ValidatePermissions(permissionsStr string) error {
+	if permissionsStr != "" && !permissionsRegexp.MatchString(permissionsStr) {
+		return InvalidPermissionsError
+	}
+	return nil
+}
+
+// permits tells whether the permissions of a class allow the access: the read bit for reading, and the write bit for
+// uploading new versions. The files stored with malformed permissions get the default ones.
+func permits(permissionsStr string, class int, access string) bool {
+	if !permissionsRegexp.MatchString(permissionsStr) {
+		permissionsStr = defaultPermissions
+	}
+	if access == models.ShareAccessWrite {
+		return permissionsStr[class+1] == 'w'
+	}
+	return permissionsStr[class] == 'r'
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePermissions(t *testing.T) {
+	testCases := []struct {
+		name           string
+		permissionsStr string
+		want           error
+	}{
+		{"When the permissions are right, accept them", "rwxr-x---", nil},
+		{"When there are no permissions, accept them", "", nil},
+		{"When the permissions are too short, return an error", "rw-", InvalidPermissionsError},
+		{"When the permissions have other letters, return an error", "abcdefghi", InvalidPermissionsError},
+		{"When the permissions are out of order, return an error", "wr-r--r--", InvalidPermissionsError},
+		{"When the permissions are numeric, return an error", "644", InvalidPermissionsError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, ValidatePermissions(testCase.permissionsStr))
+		})
+	}
+}
+
+func TestPermits(t *testing.T) {
+	testCases := []struct {
+		name           string
+		permissionsStr string
+		class          int
+		access         string
+		want           bool
+	}{
+		{"When the group can read, allow reading", "rw-r-----", groupClass, models.ShareAccessRead, true},
+		{"When the group can read, deny writing", "rw-r-----", groupClass, models.ShareAccessWrite, false},
+		{"When the group can read and write, allow writing", "rw-rw----", groupClass, models.ShareAccessWrite, true},
+		{"When the group can only write, deny reading", "rw--w----", groupClass, models.ShareAccessRead, false},
+		{"When only the others can read, deny the group reading", "rw----r--", groupClass, models.ShareAccessRead, false},
+		{"When the others can read, allow reading", "rw----r--", otherClass, models.ShareAccessRead, true},
+		{"When the others can write, allow writing", "rw-----w-", otherClass, models.ShareAccessWrite, true},
+		{"When only the group can write, deny the others writing", "rw-rw-r--", otherClass, models.ShareAccessWrite, false},
+		{"When there are no permissions, use the default ones", "", otherClass, models.ShareAccessRead, true},
+		{"When the permissions are malformed, use the default ones", "abcdefghi", groupClass, models.ShareAccessWrite, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, permits(testCase.permissionsStr, testCase.class, testCase.access))
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	retentionDayLayout   = "2006-01-02"
+	retentionMonthLayout = "2006-01"
+)
+
+var InvalidRetentionPolicyError = errors.New(`the retention policy can't keep a negative number of last versions, days or months, and its "keep within" must be a duration such as "168h"`)
+
+type (
+	// RetentionService prunes the old versions of the files, following the user's retention policy or, if they have
+	// none, the global one
+	RetentionService interface {
+		GetPolicy(user models.User) (models.RetentionPolicy, error)
+		SetPolicy(policy *models.RetentionPolicy) (models.RetentionPolicy, error)
+		DeletePolicy(user models.User) error
+		GetPrunableVersions(user models.User) ([]models.File, error)
+		PruneVersions() (int, error)
+	}
+
+	RetentionServiceImpl struct {
+		configuration *models.Configuration
+		policyDao     dao.RetentionPolicyDao
+		userDao       dao.UserDao
+		groupDao      dao.GroupDao
+		fileDao       dao.FileDao
+		fileService   FileServiceImpl
+	}
+)
+
+func NewRetentionService(configuration *models.Configuration) RetentionService {
+	if configuration == nil {
+		return nil
+	}
+	fileService, ok := NewFileService(configuration).(FileServiceImpl)
+	if !ok {
+		return nil
+	}
+	return RetentionServiceImpl{
+		configuration: configuration,
+		policyDao:     dao.RetentionPolicyDaoFactory(configuration.Database.Engine),
+		userDao:       dao.UserDaoFactory(configuration.Database.Engine),
+		groupDao:      dao.GroupDaoFactory(configuration.Database.Engine),
+		fileDao:       dao.FileDaoFactory(configuration.Database.Engine),
+		fileService:   fileService,
+	}
+}
+
+// GetPolicy returns the user's retention policy, or the global one if they have none
+func (retentionService RetentionServiceImpl) GetPolicy(user models.User) (models.RetentionPolicy, error) {
+	policy, err := retentionService.policyDao.GetByOwner(user.Email)
+	if err == sql.ErrNoRows {
+		return retentionService.configuration.Retention, nil
+	}
+	return policy, err
+}
+
+func (retentionService RetentionServiceImpl) SetPolicy(policy *models.RetentionPolicy) (models.RetentionPolicy, error) {
+	if err := validateRetentionPolicy(*policy); err != nil {
+		return models.RetentionPolicy{}, err
+	}
+	return retentionService.policyDao.Save(policy)
+}
+
+// DeletePolicy removes the user's retention policy, so the global one applies to them again
+func (retentionService RetentionServiceImpl) DeletePolicy(user models.User) error {
+	return retentionService.policyDao.Delete(user.Email)
+}
+
+// GetPrunableVersions returns the versions of the user's files that their policy would prune right now
+func (retentionService RetentionServiceImpl) GetPrunableVersions(user models.User) ([]models.File, error) {
+	prunable := make([]models.File, 0)
+	err := retentionService.forEachPrunableVersion(user, func(version models.File) error {
+		prunable = append(prunable, version)
+		return nil
+	})
+	return prunable, err
+}
+
+// PruneVersions removes the versions of every user's and group's files that their policy doesn't keep, along with their
+// content, and tells how many were removed
+func (retentionService RetentionServiceImpl) PruneVersions() (int, error) {
+	users, err := retentionService.owners()
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, user := range users {
+		err := retentionService.forEachPrunableVersion(user, func(version models.File) error {
+			if err := retentionService.pruneVersion(version); err != nil {
+				return err
+			}
+			logs.ServicesLog.Infof("Pruned version %v of %v's file %v", version.Id, user.Email, version.Name)
+			pruned++
+			return nil
+		})
+		if err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// owners returns the accounts that own files: the users and the groups
+func (retentionService RetentionServiceImpl) owners() ([]models.User, error) {
+	users, err := retentionService.userDao.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := retentionService.groupDao.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		users = append(users, models.User{Credentials: models.Credentials{Email: group.Name}})
+	}
+	return users, nil
+}
+
+func (retentionService RetentionServiceImpl) forEachPrunableVersion(user models.User, action func(version models.File) error) error {
+	policy, err := retentionService.GetPolicy(user)
+	if err != nil {
+		return err
+	}
+	if keepsAllVersions(policy) {
+		return nil
+	}
+	files, err := retentionService.fileDao.GetAllByOwner(&user, null.String{})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		versions, err := retentionService.fileDao.GetVersionsByNameAndOwner(file.Name, &user)
+		if err != nil {
+			return err
+		}
+		prunable, err := prunableVersions(versions, policy, now)
+		if err != nil {
+			return err
+		}
+		for _, version := range prunable {
+			if err := action(version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneVersion removes the version's records before releasing its blobs, as the trash does
+func (retentionService RetentionServiceImpl) pruneVersion(version models.File) error {
+	blobIds, key, err := retentionService.fileService.versionBlobs(version)
+	if err != nil {
+		return err
+	}
+	if err := retentionService.fileDao.DeleteVersion(version.Id); err != nil {
+		return err
+	}
+	keys := make([]string, 0)
+	if key != "" {
+		keys = append(keys, key)
+	}
+	return retentionService.fileService.releaseContent(blobIds, keys)
+}
+
+func validateRetentionPolicy(policy models.RetentionPolicy) error {
+	if policy.KeepLast < 0 || policy.KeepDaily < 0 || policy.KeepMonthly < 0 {
+		return InvalidRetentionPolicyError
+	}
+	if policy.KeepWithin != "" {
+		within, err := time.ParseDuration(policy.KeepWithin)
+		if err != nil || within < 0 {
+			return InvalidRetentionPolicyError
+		}
+	}
+	return nil
+}
+
+// keepsAllVersions tells whether the policy has no rules, so it doesn't prune anything
+func keepsAllVersions(policy models.RetentionPolicy) bool {
+	return policy.KeepLast == 0 && policy.KeepWithin == "" && policy.KeepDaily == 0 && policy.KeepMonthly == 0
+}
+
+// prunableVersions returns the versions of a file that the policy doesn't keep. The versions are dated by their last
+// update, and grouped in days and months in UTC.
+func prunableVersions(versions []models.File, policy models.RetentionPolicy, now time.Time) ([]models.File, error) {
+	if err := validateRetentionPolicy(policy); err != nil {
+		return nil, err
+	}
+	prunable := make([]models.File, 0)
+	if keepsAllVersions(policy) {
+		return prunable, nil
+	}
+	var within time.Duration
+	if policy.KeepWithin != "" {
+		within, _ = time.ParseDuration(policy.KeepWithin)
+	}
+	now = now.UTC()
+	oldestDay, oldestMonth := "", ""
+	if policy.KeepDaily > 0 {
+		oldestDay = now.AddDate(0, 0, 1-policy.KeepDaily).Format(retentionDayLayout)
+	}
+	if policy.KeepMonthly > 0 {
+		oldestMonth = time.Date(now.Year(), now.Month()+1-time.Month(policy.KeepMonthly), 1, 0, 0, 0, 0, time.UTC).Format(retentionMonthLayout)
+	}
+
+	sorted := make([]models.File, len(versions))
+	copy(sorted, versions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].UpdatedAt.Time.Equal(sorted[j].UpdatedAt.Time) {
+			return sorted[i].UpdatedAt.Time.After(sorted[j].UpdatedAt.Time)
+		}
+		return sorted[i].Id > sorted[j].Id
+	})
+	keptDays := make(map[string]bool)
+	keptMonths := make(map[string]bool)
+	for i, version := range sorted {
+		date := version.UpdatedAt.Time.UTC()
+		// The current version is always kept
+		keep := i == 0 || i < policy.KeepLast || (within > 0 && now.Sub(date) <= within)
+		// The first version found of each day and month is the last one, as they are sorted from the newest
+		if day := date.Format(retentionDayLayout); policy.KeepDaily > 0 && day >= oldestDay && !keptDays[day] {
+			keptDays[day] = true
+			keep = true
+		}
+		if month := date.Format(retentionMonthLayout); policy.KeepMonthly > 0 && month >= oldestMonth && !keptMonths[month] {
+			keptMonths[month] = true
+			keep = true
+		}
+		if !keep {
+			prunable = append(prunable, version)
+		}
+	}
+	return prunable, nil
+}
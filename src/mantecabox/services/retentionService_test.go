@@ -0,0 +1,139 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNewRetentionService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          RetentionService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF"},
+			RetentionServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewRetentionService(testCase.configuration))
+		})
+	}
+}
+
+func TestPrunableVersions(t *testing.T) {
+	now := time.Date(2018, 7, 15, 12, 0, 0, 0, time.UTC)
+	version := func(id int64, date time.Time) models.File {
+		return models.File{Id: id, TimeStamp: models.TimeStamp{UpdatedAt: null.TimeFrom(date)}}
+	}
+	// A version every 12 hours from the 1st of May, the newest one being the current version. The odd IDs are the
+	// versions made at midnight, and the last version of each month is the one made at noon of its last day.
+	versions := make([]models.File, 0)
+	for date, id := now, int64(200); !date.Before(time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)); date, id = date.Add(-12*time.Hour), id-1 {
+		versions = append(versions, version(id, date))
+	}
+
+	testCases := []struct {
+		name   string
+		policy models.RetentionPolicy
+		want   []int64
+	}{
+		{
+			"When the policy has no rules, keep all the versions",
+			models.RetentionPolicy{},
+			[]int64{},
+		},
+		{
+			"When the policy keeps the last versions, prune the older ones",
+			models.RetentionPolicy{KeepLast: 150},
+			idRange(49, 50),
+		},
+		{
+			"When the policy keeps the versions within a duration, prune the older ones",
+			models.RetentionPolicy{KeepWithin: "1h"},
+			idRange(49, 199),
+		},
+		{
+			"When the policy keeps the last version of each day, prune the others",
+			models.RetentionPolicy{KeepDaily: 365},
+			oddIds(49, 199),
+		},
+		{
+			"When the policy keeps some days and months, prune the rest",
+			models.RetentionPolicy{KeepWithin: "48h", KeepDaily: 7, KeepMonthly: 2},
+			append(append(idRange(49, 169), idRange(171, 187)...), 189, 191, 193, 195),
+		},
+		{
+			"When the policy keeps every month, keep the last version of each month",
+			models.RetentionPolicy{KeepMonthly: 12},
+			append(append(idRange(49, 109), idRange(111, 169)...), idRange(171, 199)...),
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			prunable, err := prunableVersions(versions, testCase.policy, now)
+			require.NoError(t, err)
+			ids := make([]int64, 0)
+			for _, version := range prunable {
+				ids = append(ids, version.Id)
+			}
+			require.ElementsMatch(t, testCase.want, ids)
+		})
+	}
+}
+
+func TestRetentionServiceImpl_Owners(t *testing.T) {
+	retentionService := RetentionServiceImpl{
+		userDao: fakeUserDao{users: map[string]models.User{
+			"testuser1": {Credentials: models.Credentials{Email: "testuser1"}},
+		}},
+		groupDao: fakeGroupDao{},
+	}
+	owners, err := retentionService.owners()
+	require.NoError(t, err)
+	emails := make([]string, 0)
+	for _, owner := range owners {
+		emails = append(emails, owner.Email)
+	}
+	require.ElementsMatch(t, []string{"testuser1", "project"}, emails)
+}
+
+func TestPrunableVersionsInvalidPolicy(t *testing.T) {
+	for _, policy := range []models.RetentionPolicy{{KeepLast: -1}, {KeepWithin: "a week"}, {KeepWithin: "-1h"}, {KeepDaily: -1}, {KeepMonthly: -1}} {
+		_, err := prunableVersions(nil, policy, time.Now())
+		require.Equal(t, InvalidRetentionPolicyError, err)
+	}
+}
+
+// idRange returns the IDs from the first to the last one, both included
+func idRange(first, last int64) []int64 {
+	ids := make([]int64, 0)
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// oddIds returns the odd IDs from the first to the last one, both included
+func oddIds(first, last int64) []int64 {
+	ids := make([]int64, 0)
+	for _, id := range idRange(first, last) {
+		if id%2 == 1 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
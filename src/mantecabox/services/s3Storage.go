@@ -0,0 +1,131 @@
+package services
+
+import (
+	"io"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+)
+
+type (
+	// S3Storage stores the blobs as objects of a bucket in any S3-compatible endpoint (AWS, MinIO...)
+	S3Storage struct {
+		client *minio.Client
+		bucket string
+	}
+)
+
+func NewS3Storage(configuration *models.S3) (StorageBackend, error) {
+	bucketLookup := minio.BucketLookupAuto
+	if configuration.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.NewWithOptions(configuration.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(configuration.AccessKey, configuration.SecretKey, ""),
+		Secure:       configuration.UseSSL,
+		Region:       configuration.Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := client.BucketExists(configuration.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = client.MakeBucket(configuration.Bucket, configuration.Region)
+		if err != nil {
+			return nil, err
+		}
+		logs.ServicesLog.Infof("Created S3 bucket %v", configuration.Bucket)
+	}
+	return S3Storage{
+		client: client,
+		bucket: configuration.Bucket,
+	}, nil
+}
+
+func (s3Storage S3Storage) Put(key string, reader io.Reader, size int64) error {
+	_, err := s3Storage.client.PutObject(s3Storage.bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return s3Error(err)
+}
+
+func (s3Storage S3Storage) Get(key string) (io.ReadCloser, error) {
+	object, err := s3Storage.client.GetObject(s3Storage.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	// GetObject is lazy, so we ask for its info to know if it really exists
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (s3Storage S3Storage) GetAt(key string, offset int64) (io.ReadCloser, error) {
+	object, err := s3Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	// The objects are read lazily, so the next read only asks for the bytes from the offset
+	if _, err := object.(*minio.Object).Seek(offset, io.SeekStart); err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (s3Storage S3Storage) Delete(key string) error {
+	// S3 doesn't complain when removing non-existent objects, but the other backends do
+	if _, err := s3Storage.Stat(key); err != nil {
+		return err
+	}
+	return s3Error(s3Storage.client.RemoveObject(s3Storage.bucket, key))
+}
+
+func (s3Storage S3Storage) Stat(key string) (models.BlobInfo, error) {
+	objectInfo, err := s3Storage.client.StatObject(s3Storage.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return models.BlobInfo{}, s3Error(err)
+	}
+	return objectInfoToBlobInfo(objectInfo), nil
+}
+
+func (s3Storage S3Storage) List() ([]models.BlobInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	blobs := make([]models.BlobInfo, 0)
+	for objectInfo := range s3Storage.client.ListObjectsV2(s3Storage.bucket, "", true, doneCh) {
+		if objectInfo.Err != nil {
+			return nil, s3Error(objectInfo.Err)
+		}
+		blobs = append(blobs, objectInfoToBlobInfo(objectInfo))
+	}
+	return blobs, nil
+}
+
+func objectInfoToBlobInfo(objectInfo minio.ObjectInfo) models.BlobInfo {
+	return models.BlobInfo{
+		Key:     objectInfo.Key,
+		Size:    objectInfo.Size,
+		ModTime: objectInfo.LastModified,
+	}
+}
+
+// s3Error translates the S3's "not found" errors into BlobNotFoundError
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return BlobNotFoundError
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBucket = "mantecabox-test"
+
+// fakeS3Server implements the tiny subset of the S3 API used by S3Storage, so we don't need a MinIO instance running.
+// It doesn't check signatures.
+type fakeS3Server struct {
+	mutex   sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeS3Object
+}
+
+type fakeS3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+func (server *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucketName := parts[0]
+	bucket, bucketExists := server.buckets[bucketName]
+	if len(parts) == 1 || parts[1] == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			server.buckets[bucketName] = make(map[string][]byte)
+		case !bucketExists:
+			writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		case r.Method == http.MethodGet:
+			result := fakeS3ListResult{Name: bucketName, MaxKeys: 1000}
+			for key, data := range bucket {
+				result.Contents = append(result.Contents, fakeS3Object{
+					Key:          key,
+					LastModified: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+					ETag:         `"etag"`,
+					Size:         int64(len(data)),
+					StorageClass: "STANDARD",
+				})
+			}
+			sort.Slice(result.Contents, func(i, j int) bool {
+				return result.Contents[i].Key < result.Contents[j].Key
+			})
+			result.KeyCount = len(result.Contents)
+			xml.NewEncoder(w).Encode(result)
+		}
+		return
+	}
+	key := parts[1]
+	data, objectExists := bucket[key]
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+			body = decodeAwsChunked(body)
+		}
+		bucket[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet, http.MethodHead:
+		if !objectExists {
+			writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		var offset int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err == nil && offset < len(data) {
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)-offset))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", offset, len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			data = data[offset:]
+		}
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}
+}
+
+// decodeAwsChunked strips the chunk signatures that the client adds when uploading through plain HTTP
+func decodeAwsChunked(body []byte) []byte {
+	decoded := make([]byte, 0, len(body))
+	for {
+		lineEnd := bytes.Index(body, []byte("\r\n"))
+		if lineEnd < 0 {
+			return decoded
+		}
+		var size int
+		fmt.Sscanf(string(body[:lineEnd]), "%x;", &size)
+		if size == 0 {
+			return decoded
+		}
+		body = body[lineEnd+2:]
+		decoded = append(decoded, body[:size]...)
+		body = body[size+2:]
+	}
+}
+
+func writeFakeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<Error><Code>%v</Code><Message>%v</Message></Error>`, code, code)
+	}
+}
+
+func newTestS3Storage(t *testing.T) (StorageBackend, *httptest.Server) {
+	server := httptest.NewServer(&fakeS3Server{buckets: make(map[string]map[string][]byte)})
+	storage, err := NewS3Storage(&models.S3{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    testBucket,
+		Region:    "us-east-1",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+		PathStyle: true,
+	})
+	require.NoError(t, err)
+	return storage, server
+}
+
+func TestNewS3Storage(t *testing.T) {
+	storage, server := newTestS3Storage(t)
+	defer server.Close()
+	require.IsType(t, S3Storage{}, storage)
+}
+
+func TestS3Storage(t *testing.T) {
+	storage, server := newTestS3Storage(t)
+	defer server.Close()
+	content := []byte("Fichero inventado de Mantecabox")
+
+	require.NoError(t, storage.Put("1", bytes.NewReader(content), int64(len(content))))
+
+	reader, err := storage.Get("1")
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+
+	reader, err = storage.GetAt("1", 8)
+	require.NoError(t, err)
+	got, err = ioutil.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, content[8:], got)
+
+	info, err := storage.Stat("1")
+	require.NoError(t, err)
+	require.Equal(t, "1", info.Key)
+	require.Equal(t, int64(len(content)), info.Size)
+
+	blobs, err := storage.List()
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+	require.Equal(t, "1", blobs[0].Key)
+
+	require.NoError(t, storage.Delete("1"))
+	_, err = storage.Get("1")
+	require.Equal(t, BlobNotFoundError, err)
+	_, err = storage.Stat("1")
+	require.Equal(t, BlobNotFoundError, err)
+	require.Equal(t, BlobNotFoundError, storage.Delete("1"))
+}
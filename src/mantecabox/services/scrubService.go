@@ -0,0 +1,356 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/utilities"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	defaultScrubInterval = 7 * 24 * time.Hour
+	scrubBatchSize       = 100
+)
+
+var (
+	scrubIssuesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mantecabox_scrub_issues",
+		Help: "Problems found by the last scrub of the stored blobs, by kind.",
+	}, []string{"kind"})
+	scrubCheckedVersionsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mantecabox_scrub_checked_versions",
+		Help: "Live versions checked by the last scrub.",
+	})
+	scrubCheckedBlobsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mantecabox_scrub_checked_blobs",
+		Help: "Blobs decrypted by the last scrub.",
+	})
+	scrubFinishedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mantecabox_scrub_last_finished_timestamp_seconds",
+		Help: "When the last scrub finished.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(scrubIssuesGauge, scrubCheckedVersionsGauge, scrubCheckedBlobsGauge, scrubFinishedGauge)
+}
+
+type (
+	// ScrubService checks the stored blobs against the metadata, so missing or corrupted content is found before a
+	// user tries to download it. Every live version's content is decrypted and checked against its checksum, and the
+	// stored blobs that no row references are reported as orphans. The reports are kept, and the last one is exposed
+	// as metrics.
+	ScrubService interface {
+		Scrub() (models.ScrubReport, error)
+		ScrubIfDue() (models.ScrubReport, bool, error)
+		GetLastReport() (models.ScrubReport, error)
+	}
+
+	ScrubServiceImpl struct {
+		configuration *models.Configuration
+		scrubDao      dao.ScrubDao
+		fileService   FileServiceImpl
+	}
+
+	// scrubber holds the state of a scrub. Every blob is checked once, even if several versions share it.
+	scrubber struct {
+		fileService  FileServiceImpl
+		ciphers      map[string]utilities.BlobCipher
+		checkedBlobs map[string]blobCheck
+		report       *models.ScrubReport
+	}
+
+	// blobCheck is the result of decrypting a blob: the problem found, if any, or the checksum of its plaintext
+	blobCheck struct {
+		issue    string
+		detail   string
+		checksum string
+	}
+)
+
+func NewScrubService(configuration *models.Configuration) ScrubService {
+	if configuration == nil {
+		return nil
+	}
+	fileService, ok := NewFileService(configuration).(FileServiceImpl)
+	if !ok {
+		return nil
+	}
+	return ScrubServiceImpl{
+		configuration: configuration,
+		scrubDao:      dao.ScrubDaoFactory(configuration.Database.Engine),
+		fileService:   fileService,
+	}
+}
+
+// Scrub checks every live version and every stored blob, and saves the report
+func (scrubService ScrubServiceImpl) Scrub() (models.ScrubReport, error) {
+	report := models.ScrubReport{CreatedAt: time.Now(), Issues: make([]models.ScrubIssue, 0)}
+	// The storage is listed before reading the rows, so the blobs uploaded in the meantime are not taken as orphans
+	stored, err := scrubService.fileService.storage.List()
+	if err != nil {
+		return report, err
+	}
+	orphans, err := scrubService.findOrphans(stored)
+	if err != nil {
+		return report, err
+	}
+
+	scrubber := scrubber{
+		fileService:  scrubService.fileService,
+		ciphers:      make(map[string]utilities.BlobCipher),
+		checkedBlobs: make(map[string]blobCheck),
+		report:       &report,
+	}
+	var afterId int64
+	for {
+		versions, err := scrubService.scrubDao.GetLiveVersionsPage(afterId, scrubBatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(versions) == 0 {
+			break
+		}
+		for _, version := range versions {
+			if err := scrubber.checkVersion(version); err != nil {
+				return report, fmt.Errorf("unable to check version %v: %v", version.Id, err)
+			}
+		}
+		afterId = versions[len(versions)-1].Id
+	}
+	report.Issues = append(report.Issues, orphans...)
+	report.CheckedBlobs = int64(len(scrubber.checkedBlobs))
+	report.FinishedAt = time.Now()
+
+	created, err := scrubService.scrubDao.CreateReport(&report)
+	if err != nil {
+		return report, err
+	}
+	recordScrubMetrics(created)
+	logs.ServicesLog.Infof("Scrub %v finished: %v versions and %v blobs checked, %v issues found", created.Id, created.CheckedVersions, created.CheckedBlobs, len(created.Issues))
+	return created, nil
+}
+
+// ScrubIfDue scrubs if the last scrub is older than the configured interval. Otherwise, it only exposes the last
+// report as metrics, as it may have been made by another process. It tells whether it has scrubbed.
+func (scrubService ScrubServiceImpl) ScrubIfDue() (models.ScrubReport, bool, error) {
+	last, err := scrubService.scrubDao.GetLastReport()
+	if err == nil && time.Since(last.FinishedAt) < scrubService.interval() {
+		recordScrubMetrics(last)
+		return last, false, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return last, false, err
+	}
+	report, err := scrubService.Scrub()
+	return report, err == nil, err
+}
+
+func (scrubService ScrubServiceImpl) GetLastReport() (models.ScrubReport, error) {
+	return scrubService.scrubDao.GetLastReport()
+}
+
+// findOrphans reports the stored blobs that no blob, version or upload references
+func (scrubService ScrubServiceImpl) findOrphans(stored []models.BlobInfo) ([]models.ScrubIssue, error) {
+	blobIds, err := scrubService.scrubDao.GetBlobIds()
+	if err != nil {
+		return nil, err
+	}
+	legacyIds, err := scrubService.scrubDao.GetLegacyVersionIds()
+	if err != nil {
+		return nil, err
+	}
+	uploadIds, err := scrubService.scrubDao.GetUploadIds()
+	if err != nil {
+		return nil, err
+	}
+	return orphanBlobs(stored, blobIds, legacyIds, uploadIds), nil
+}
+
+func (scrubService ScrubServiceImpl) interval() time.Duration {
+	if scrubService.configuration.ScrubInterval == "" {
+		return defaultScrubInterval
+	}
+	interval, err := time.ParseDuration(scrubService.configuration.ScrubInterval)
+	if err != nil {
+		logs.ServicesLog.Fatalf("unable to parse scrub interval configuration value: %v", err.Error())
+	}
+	return interval
+}
+
+// orphanBlobs returns the stored blobs whose key doesn't match any of the referenced ones. The blobs left behind by an
+// interrupted key rotation are orphans too.
+func orphanBlobs(stored []models.BlobInfo, blobIds []int64, legacyIds []int64, uploadIds []string) []models.ScrubIssue {
+	referenced := make(map[string]bool, len(blobIds)+len(legacyIds))
+	for _, id := range blobIds {
+		referenced[blobStorageKey(id)] = true
+	}
+	for _, id := range legacyIds {
+		referenced[strconv.FormatInt(id, 10)] = true
+	}
+	uploads := make(map[string]bool, len(uploadIds))
+	for _, id := range uploadIds {
+		uploads[id] = true
+	}
+	orphans := make([]models.ScrubIssue, 0)
+	for _, blob := range stored {
+		if referenced[blob.Key] {
+			continue
+		}
+		// The upload parts are named "uploads/<upload>/<position>"
+		if parts := strings.Split(blob.Key, "/"); len(parts) == 3 && parts[0] == "uploads" && uploads[parts[1]] {
+			continue
+		}
+		orphans = append(orphans, models.ScrubIssue{Kind: models.ScrubIssueOrphanBlob, Key: blob.Key})
+	}
+	return orphans
+}
+
+func recordScrubMetrics(report models.ScrubReport) {
+	issues := map[string]int{
+		models.ScrubIssueMissingBlob:      0,
+		models.ScrubIssueCorruptedBlob:    0,
+		models.ScrubIssueChecksumMismatch: 0,
+		models.ScrubIssueOrphanBlob:       0,
+	}
+	for _, issue := range report.Issues {
+		issues[issue.Kind]++
+	}
+	for kind, count := range issues {
+		scrubIssuesGauge.WithLabelValues(kind).Set(float64(count))
+	}
+	scrubCheckedVersionsGauge.Set(float64(report.CheckedVersions))
+	scrubCheckedBlobsGauge.Set(float64(report.CheckedBlobs))
+	scrubFinishedGauge.Set(float64(report.FinishedAt.Unix()))
+}
+
+// checkVersion decrypts the version's blobs, and checks its content against its checksum if they are all right
+func (scrubber *scrubber) checkVersion(version models.File) error {
+	blobCipher, err := scrubber.cipher(version.Owner.Email)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	if version.Chunked {
+		chunks, err := scrubber.fileService.blobDao.GetFileChunks(version.Id)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			keys = append(keys, blobStorageKey(chunk.Id))
+		}
+	} else {
+		keys = []string{blobKey(version)}
+	}
+	scrubber.report.CheckedVersions++
+
+	var check blobCheck
+	for _, key := range keys {
+		check, err = scrubber.checkBlob(key, blobCipher)
+		if err != nil {
+			return err
+		}
+		if check.issue != "" {
+			scrubber.addIssue(check.issue, key, version, check.detail)
+			return nil
+		}
+	}
+	if !version.Checksum.Valid {
+		return nil
+	}
+	checksum := check.checksum
+	if version.Chunked || version.Compression != utilities.NoCompression {
+		// The checksum of the content is only known by reading its chunks in order, and decompressing them
+		checksum, err = scrubber.fileService.contentChecksum(version, blobCipher)
+		if err != nil {
+			return err
+		}
+	}
+	if checksum != version.Checksum.String {
+		scrubber.addIssue(models.ScrubIssueChecksumMismatch, keys[0], version, "content checksum "+checksum)
+	}
+	return nil
+}
+
+// checkBlob decrypts the whole blob, which makes AES-GCM check that it is complete and untouched. The errors reading
+// the storage are returned, as they don't tell anything about the blob.
+func (scrubber *scrubber) checkBlob(key string, blobCipher utilities.BlobCipher) (blobCheck, error) {
+	if check, ok := scrubber.checkedBlobs[key]; ok {
+		return check, nil
+	}
+	check, err := verifyBlobContent(scrubber.fileService.storage, key, blobCipher)
+	if err != nil {
+		return check, err
+	}
+	scrubber.checkedBlobs[key] = check
+	return check, nil
+}
+
+func (scrubber *scrubber) cipher(email string) (utilities.BlobCipher, error) {
+	if blobCipher, ok := scrubber.ciphers[email]; ok {
+		return blobCipher, nil
+	}
+	blobCipher, err := scrubber.fileService.keyService.GetUserCipher(email)
+	if err != nil {
+		return nil, err
+	}
+	scrubber.ciphers[email] = blobCipher
+	return blobCipher, nil
+}
+
+func (scrubber *scrubber) addIssue(kind string, key string, version models.File, detail string) {
+	logs.ServicesLog.Warnf("Scrub found %v in blob %v of version %v: %v", kind, key, version.Id, detail)
+	scrubber.report.Issues = append(scrubber.report.Issues, models.ScrubIssue{
+		Kind:   kind,
+		Key:    key,
+		FileId: null.IntFrom(version.Id),
+		Detail: detail,
+	})
+}
+
+// verifyBlobContent decrypts the blob, and returns the checksum of its plaintext or the problem found in it
+func verifyBlobContent(storage StorageBackend, key string, blobCipher utilities.BlobCipher) (blobCheck, error) {
+	plaintext, size, err := openBlobAt(storage, key, blobCipher, 0)
+	if err == BlobNotFoundError {
+		return blobCheck{issue: models.ScrubIssueMissingBlob, detail: err.Error()}, nil
+	}
+	if isCorruptionError(err) {
+		return blobCheck{issue: models.ScrubIssueCorruptedBlob, detail: err.Error()}, nil
+	}
+	if err != nil {
+		return blobCheck{}, err
+	}
+	defer plaintext.Close()
+	checksumHash := sha256.New()
+	read, err := io.Copy(checksumHash, plaintext)
+	if isCorruptionError(err) {
+		return blobCheck{issue: models.ScrubIssueCorruptedBlob, detail: err.Error()}, nil
+	}
+	if err != nil {
+		return blobCheck{}, err
+	}
+	if read != size {
+		return blobCheck{issue: models.ScrubIssueCorruptedBlob, detail: fmt.Sprintf("%v bytes read of %v", read, size)}, nil
+	}
+	return blobCheck{checksum: hex.EncodeToString(checksumHash.Sum(nil))}, nil
+}
+
+func isCorruptionError(err error) bool {
+	switch err {
+	case utilities.IntegrityError, utilities.UnknownBlobFormatError, utilities.MissingDataKeyError, io.ErrUnexpectedEOF, io.EOF:
+		return true
+	}
+	return false
+}
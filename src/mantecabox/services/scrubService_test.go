@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"mantecabox/models"
+	"mantecabox/utilities"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+// fakeScrubDao serves the given versions and keeps the reports in memory
+type fakeScrubDao struct {
+	versions []models.File
+	blobIds  []int64
+	reports  *[]models.ScrubReport
+}
+
+func (dao fakeScrubDao) GetLiveVersionsPage(afterId int64, limit int) ([]models.File, error) {
+	page := make([]models.File, 0)
+	for _, version := range dao.versions {
+		if version.Id > afterId && len(page) < limit {
+			page = append(page, version)
+		}
+	}
+	return page, nil
+}
+
+func (dao fakeScrubDao) GetBlobIds() ([]int64, error) {
+	return dao.blobIds, nil
+}
+
+func (dao fakeScrubDao) GetLegacyVersionIds() ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (dao fakeScrubDao) GetUploadIds() ([]string, error) {
+	return []string{}, nil
+}
+
+func (dao fakeScrubDao) CreateReport(report *models.ScrubReport) (models.ScrubReport, error) {
+	created := *report
+	created.Id = int64(len(*dao.reports) + 1)
+	*dao.reports = append(*dao.reports, created)
+	return created, nil
+}
+
+func (dao fakeScrubDao) GetLastReport() (models.ScrubReport, error) {
+	if len(*dao.reports) == 0 {
+		return models.ScrubReport{}, sql.ErrNoRows
+	}
+	return (*dao.reports)[len(*dao.reports)-1], nil
+}
+
+func TestNewScrubService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          ScrubService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF", Storage: models.Storage{Engine: "memory"}},
+			ScrubServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewScrubService(testCase.configuration))
+		})
+	}
+}
+
+func TestOrphanBlobs(t *testing.T) {
+	stored := []models.BlobInfo{
+		{Key: "blob-1"},
+		{Key: "blob-2"},
+		{Key: "7"},
+		{Key: "8"},
+		{Key: "uploads/abc/0"},
+		{Key: "uploads/def/0"},
+		{Key: "blob-1.rotating"},
+		{Key: "unknown"},
+	}
+	orphans := orphanBlobs(stored, []int64{1}, []int64{7}, []string{"abc"})
+	var keys []string
+	for _, orphan := range orphans {
+		require.Equal(t, models.ScrubIssueOrphanBlob, orphan.Kind)
+		require.False(t, orphan.FileId.Valid)
+		keys = append(keys, orphan.Key)
+	}
+	require.Equal(t, []string{"blob-2", "8", "uploads/def/0", "blob-1.rotating", "unknown"}, keys)
+}
+
+func TestVerifyBlobContent(t *testing.T) {
+	content := bytes.Repeat([]byte("mantecabox "), 1000)
+	checksum := sha256.Sum256(content)
+	blobCipher := utilities.NewBlobCipher(testOldKey)
+	ciphertext, err := ioutil.ReadAll(blobCipher.EncryptReader(bytes.NewReader(content)))
+	require.NoError(t, err)
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)/2] ^= 1
+
+	storage := NewMemoryStorage()
+	require.NoError(t, storage.Put("blob-1", bytes.NewReader(ciphertext), int64(len(ciphertext))))
+	require.NoError(t, storage.Put("blob-2", bytes.NewReader(tampered), int64(len(tampered))))
+	require.NoError(t, storage.Put("blob-3", bytes.NewReader(ciphertext[:len(ciphertext)/2]), int64(len(ciphertext)/2)))
+
+	testCases := []struct {
+		name string
+		key  string
+		want blobCheck
+	}{
+		{"When the blob is right, return its checksum", "blob-1", blobCheck{checksum: hex.EncodeToString(checksum[:])}},
+		{"When the blob has been modified, report it as corrupted", "blob-2", blobCheck{issue: models.ScrubIssueCorruptedBlob}},
+		{"When the blob is truncated, report it as corrupted", "blob-3", blobCheck{issue: models.ScrubIssueCorruptedBlob}},
+		{"When the blob doesn't exist, report it as missing", "blob-4", blobCheck{issue: models.ScrubIssueMissingBlob}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			check, err := verifyBlobContent(storage, testCase.key, blobCipher)
+			require.NoError(t, err)
+			require.Equal(t, testCase.want.issue, check.issue)
+			require.Equal(t, testCase.want.checksum, check.checksum)
+		})
+	}
+}
+
+func TestScrubServiceImpl_ScrubIfDue(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{7}, 32)
+	blobCipher, err := fakeKeyService{dataKey: dataKey}.GetUserCipher("testuser")
+	require.NoError(t, err)
+	content := []byte("mantecabox rocks")
+	checksum := sha256.Sum256(content)
+	ciphertext, err := ioutil.ReadAll(blobCipher.EncryptReader(bytes.NewReader(content)))
+	require.NoError(t, err)
+	storage := NewMemoryStorage()
+	for _, key := range []string{"blob-1", "blob-9"} {
+		require.NoError(t, storage.Put(key, bytes.NewReader(ciphertext), int64(len(ciphertext))))
+	}
+
+	owner := models.User{Credentials: models.Credentials{Email: "testuser"}}
+	reports := make([]models.ScrubReport, 0)
+	scrubService := ScrubServiceImpl{
+		configuration: &models.Configuration{ScrubInterval: "1h"},
+		scrubDao: fakeScrubDao{
+			versions: []models.File{
+				{Id: 1, Owner: owner, BlobId: null.IntFrom(1), Checksum: null.StringFrom(hex.EncodeToString(checksum[:]))},
+				{Id: 2, Owner: owner, BlobId: null.IntFrom(1), Checksum: null.StringFrom(hex.EncodeToString(make([]byte, 32)))},
+				{Id: 3, Owner: owner, BlobId: null.IntFrom(2)},
+			},
+			blobIds: []int64{1, 2},
+			reports: &reports,
+		},
+		fileService: FileServiceImpl{keyService: fakeKeyService{dataKey: dataKey}, storage: storage},
+	}
+
+	report, scrubbed, err := scrubService.ScrubIfDue()
+	require.NoError(t, err)
+	require.True(t, scrubbed)
+	require.Equal(t, int64(3), report.CheckedVersions)
+	require.Equal(t, int64(2), report.CheckedBlobs)
+	require.Equal(t, []models.ScrubIssue{
+		{Kind: models.ScrubIssueChecksumMismatch, Key: "blob-1", FileId: null.IntFrom(2), Detail: "content checksum " + hex.EncodeToString(checksum[:])},
+		{Kind: models.ScrubIssueMissingBlob, Key: "blob-2", FileId: null.IntFrom(3), Detail: BlobNotFoundError.Error()},
+		{Kind: models.ScrubIssueOrphanBlob, Key: "blob-9"},
+	}, report.Issues)
+
+	// The last scrub is recent, so it isn't repeated
+	last, scrubbed, err := scrubService.ScrubIfDue()
+	require.NoError(t, err)
+	require.False(t, scrubbed)
+	require.Equal(t, report.Id, last.Id)
+
+	reports[0].FinishedAt = time.Now().Add(-2 * time.Hour)
+	_, scrubbed, err = scrubService.ScrubIfDue()
+	require.NoError(t, err)
+	require.True(t, scrubbed)
+	require.Len(t, reports, 2)
+}
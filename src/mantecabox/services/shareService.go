@@ -0,0 +1,112 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+)
+
+var (
+	InvalidShareAccessError = errors.New(`the access must be "read" or "write"`)
+	ShareWithOwnerError     = errors.New("the files can't be shared with their owner")
+	UnknownGranteeError     = errors.New("the user to share with doesn't exist")
+	AccessDeniedError       = errors.New("the user has no access to the file")
+)
+
+type (
+	// ShareService lets the users share their files and folders with other users, either to read them or to upload
+	// new versions of them too. The folders' paths end with a slash, and sharing a folder shares everything in it.
+	ShareService interface {
+		ShareFile(share *models.Share) (models.Share, error)
+		GetShares(user models.User) ([]models.Share, error)
+		GetSharedWithMe(user models.User) ([]models.Share, error)
+		RevokeShare(id int64, user models.User) error
+	}
+
+	ShareServiceImpl struct {
+		configuration *models.Configuration
+		shareDao      dao.ShareDao
+		userDao       dao.UserDao
+		fileDao       dao.FileDao
+		folderDao     dao.FolderDao
+	}
+)
+
+func NewShareService(configuration *models.Configuration) ShareService {
+	if configuration == nil {
+		return nil
+	}
+	return ShareServiceImpl{
+		configuration: configuration,
+		shareDao:      dao.ShareDaoFactory(configuration.Database.Engine),
+		userDao:       dao.UserDaoFactory(configuration.Database.Engine),
+		fileDao:       dao.FileDaoFactory(configuration.Database.Engine),
+		folderDao:     dao.FolderDaoFactory(configuration.Database.Engine),
+	}
+}
+
+// ShareFile shares the owner's file or folder with the grantee, or changes the access they had to it. The file or
+// folder must exist; otherwise, sql.ErrNoRows is returned.
+func (shareService ShareServiceImpl) ShareFile(share *models.Share) (models.Share, error) {
+	if share.Access != models.ShareAccessRead && share.Access != models.ShareAccessWrite {
+		return models.Share{}, InvalidShareAccessError
+	}
+	if share.Grantee == share.Owner {
+		return models.Share{}, ShareWithOwnerError
+	}
+	path, err := cleanSharePath(share.Path)
+	if err != nil {
+		return models.Share{}, err
+	}
+	if _, err := shareService.userDao.GetByPk(share.Grantee); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Share{}, UnknownGranteeError
+		}
+		return models.Share{}, err
+	}
+	if strings.HasSuffix(path, "/") {
+		_, err = shareService.folderDao.GetByPathAndOwner(strings.TrimSuffix(path, "/"), share.Owner)
+	} else {
+		owner := models.User{Credentials: models.Credentials{Email: share.Owner}}
+		_, err = shareService.fileDao.GetLastVersionFileByNameAndOwner(path, &owner)
+	}
+	if err != nil {
+		return models.Share{}, err
+	}
+	share.Path = path
+	return shareService.shareDao.Save(share)
+}
+
+// GetShares returns the shares that the user has made
+func (shareService ShareServiceImpl) GetShares(user models.User) ([]models.Share, error) {
+	return shareService.shareDao.GetByOwner(user.Email)
+}
+
+// GetSharedWithMe returns the shares that other users have made with the user
+func (shareService ShareServiceImpl) GetSharedWithMe(user models.User) ([]models.Share, error) {
+	return shareService.shareDao.GetByGrantee(user.Email)
+}
+
+// RevokeShare removes one of the user's shares. If they have no share with the ID, sql.ErrNoRows is returned.
+func (shareService ShareServiceImpl) RevokeShare(id int64, user models.User) error {
+	return shareService.shareDao.Delete(id, user.Email)
+}
+
+// cleanSharePath cleans the path of a shared file or folder, keeping the slash at the end of the folders' paths. The
+// root folder can't be shared.
+func cleanSharePath(path string) (string, error) {
+	cleaned, err := cleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	if cleaned == "" {
+		return "", InvalidPathError
+	}
+	if strings.HasSuffix(path, "/") {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
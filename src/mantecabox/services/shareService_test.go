@@ -0,0 +1,185 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeShareDao only knows the access that testuser2 has to testuser1's paths
+type fakeShareDao struct {
+	access map[string]string
+}
+
+func (dao fakeShareDao) Save(share *models.Share) (models.Share, error) {
+	return *share, nil
+}
+
+func (dao fakeShareDao) GetByOwner(owner string) ([]models.Share, error) {
+	return []models.Share{}, nil
+}
+
+func (dao fakeShareDao) GetByGrantee(grantee string) ([]models.Share, error) {
+	return []models.Share{}, nil
+}
+
+func (dao fakeShareDao) Delete(id int64, owner string) error {
+	return nil
+}
+
+func (dao fakeShareDao) GetAccess(owner string, path string, grantee string) (string, error) {
+	access, ok := dao.access[path]
+	if !ok || owner != "testuser1" || grantee != "testuser2" {
+		return "", sql.ErrNoRows
+	}
+	return access, nil
+}
+
+func (dao fakeShareDao) Move(owner string, path string, newPath string) error {
+	return nil
+}
+
+func TestNewShareService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          ShareService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF"},
+			ShareServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewShareService(testCase.configuration))
+		})
+	}
+}
+
+func TestShareServiceImpl_ShareFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		share   models.Share
+		wantErr error
+	}{
+		{
+			"When the access is unknown, return an error",
+			models.Share{Owner: "testuser1", Path: "docs/", Grantee: "testuser2", Access: "admin"},
+			InvalidShareAccessError,
+		},
+		{
+			"When sharing with the owner, return an error",
+			models.Share{Owner: "testuser1", Path: "docs/", Grantee: "testuser1", Access: models.ShareAccessRead},
+			ShareWithOwnerError,
+		},
+		{
+			"When sharing the root folder, return an error",
+			models.Share{Owner: "testuser1", Path: "/", Grantee: "testuser2", Access: models.ShareAccessRead},
+			InvalidPathError,
+		},
+	}
+	shareService := ShareServiceImpl{}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := shareService.ShareFile(&testCase.share)
+			require.Equal(t, testCase.wantErr, err)
+		})
+	}
+}
+
+func TestCleanSharePath(t *testing.T) {
+	testCases := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"When the path is a file, return it clean", "/docs/report.pdf", "docs/report.pdf", nil},
+		{"When the path is a folder, keep its slash", "/docs/2018/", "docs/2018/", nil},
+		{"When the path has reserved names, return an error", "docs/../secret/", "", InvalidPathError},
+		{"When the path is the root folder, return an error", "/", "", InvalidPathError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path, err := cleanSharePath(testCase.path)
+			require.Equal(t, testCase.wantErr, err)
+			require.Equal(t, testCase.want, path)
+		})
+	}
+}
+
+func TestFileServiceImpl_AuthorizeAccess(t *testing.T) {
+	fileService := FileServiceImpl{
+		shareDao: fakeShareDao{access: map[string]string{
+			"docs/report.pdf": models.ShareAccessRead,
+			"backups/":        models.ShareAccessWrite,
+			"backups/db.dump": models.ShareAccessWrite,
+			"backups/log.txt": models.ShareAccessWrite,
+			"docs/secret.txt": models.ShareAccessRead,
+		}},
+		groupDao: fakeGroupDao{roles: map[string]string{"testuser2": models.GroupRoleMember, "testuser3": models.GroupRoleManager}},
+		fileDao: fakeFileDao{files: map[string]models.File{
+			"project:plan.txt":          {Name: "plan.txt", PermissionsStr: "rw-rw----"},
+			"project:notes.txt":         {Name: "notes.txt", PermissionsStr: "rw-r-----"},
+			"project:keys.txt":          {Name: "keys.txt", PermissionsStr: "rw-------"},
+			"testuser1:backups/db.dump": {Name: "backups/db.dump", PermissionsStr: "rw-r--r--"},
+			"testuser1:backups/log.txt": {Name: "backups/log.txt", PermissionsStr: "rw-rw-rw-"},
+			"testuser1:docs/secret.txt": {Name: "docs/secret.txt", PermissionsStr: "rw-r-----"},
+		}},
+	}
+	owner := models.User{Credentials: models.Credentials{Email: "testuser1"}}
+	grantee := models.User{Credentials: models.Credentials{Email: "testuser2"}}
+	group := models.User{Credentials: models.Credentials{Email: "project"}}
+	manager := models.User{Credentials: models.Credentials{Email: "testuser3"}}
+	testCases := []struct {
+		name    string
+		path    string
+		owner   string
+		user    models.User
+		access  string
+		want    models.User
+		wantErr error
+	}{
+		{"When no owner is given, the user accesses their own files", "docs/report.pdf", "", grantee, models.ShareAccessWrite, grantee, nil},
+		{"When the owner is the user, they access their own files", "docs/report.pdf", "testuser1", owner, models.ShareAccessWrite, owner, nil},
+		{"When the file is shared for reading, it can be read", "/docs/report.pdf", "testuser1", grantee, models.ShareAccessRead, owner, nil},
+		{"When the file is shared for reading, it can't be written", "docs/report.pdf", "testuser1", grantee, models.ShareAccessWrite, models.User{}, AccessDeniedError},
+		{"When the folder is shared for writing, it can be read", "backups/", "testuser1", grantee, models.ShareAccessRead, owner, nil},
+		{"When the file isn't shared, deny the access", "docs/other.pdf", "testuser1", grantee, models.ShareAccessRead, models.User{}, AccessDeniedError},
+		{"When the others can only read the shared file, it can be read", "backups/db.dump", "testuser1", grantee, models.ShareAccessRead, owner, nil},
+		{"When the others can only read the shared file, it can't be written", "backups/db.dump", "testuser1", grantee, models.ShareAccessWrite, models.User{}, AccessDeniedError},
+		{"When the others can write the shared file, it can be written", "backups/log.txt", "testuser1", grantee, models.ShareAccessWrite, owner, nil},
+		{"When the others can't read the shared file, it can't be read", "docs/secret.txt", "testuser1", grantee, models.ShareAccessRead, models.User{}, AccessDeniedError},
+		{"When the path is wrong, return an error", "docs/../other.pdf", "testuser1", grantee, models.ShareAccessRead, models.User{}, InvalidPathError},
+		{"When the group can write the file, its members can write it", "plan.txt", "project", grantee, models.ShareAccessWrite, group, nil},
+		{"When the group can read the file, its members can read it", "notes.txt", "project", grantee, models.ShareAccessRead, group, nil},
+		{"When the group can only read the file, its members can't write it", "notes.txt", "project", grantee, models.ShareAccessWrite, models.User{}, AccessDeniedError},
+		{"When the group can't read the file, its members can't read it", "keys.txt", "project", grantee, models.ShareAccessRead, models.User{}, AccessDeniedError},
+		{"When the group's file doesn't exist, its members can create it", "new.txt", "project", grantee, models.ShareAccessWrite, group, nil},
+		{"When the path is a group's folder, its members can list it", "docs/", "project", grantee, models.ShareAccessRead, group, nil},
+		{"When the group can't write the file, its managers can write it", "notes.txt", "project", manager, models.ShareAccessWrite, group, nil},
+		{"When the group can't read the file, its managers can read it", "keys.txt", "project", manager, models.ShareAccessRead, group, nil},
+		{"When the path is wrong, its managers can't access it", "docs/../keys.txt", "project", manager, models.ShareAccessRead, models.User{}, InvalidPathError},
+		{"When the user isn't a member of the group, deny the access", "plan.txt", "project", owner, models.ShareAccessRead, models.User{}, AccessDeniedError},
+		{"When the path is the group's root folder, its members can list it", "/", "project", grantee, models.ShareAccessRead, group, nil},
+		{"When the path is the group's root folder, its members can upload to it", "", "project", grantee, models.ShareAccessWrite, group, nil},
+		{"When the path is the owner's root folder, it can't be shared", "/", "testuser1", grantee, models.ShareAccessRead, models.User{}, InvalidPathError},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := fileService.AuthorizeAccess(testCase.path, testCase.owner, testCase.user, testCase.access)
+			require.Equal(t, testCase.wantErr, err)
+			require.Equal(t, testCase.want, got)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"io"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+var (
+	BlobNotFoundError   = errors.New("blob not found")
+	InvalidBlobKeyError = errors.New("invalid blob key")
+)
+
+type (
+	// StorageBackend stores the encrypted blobs by key. The backends know nothing about files, versions or users:
+	// they only move bytes around, so new ones can be added without touching the services or the controllers.
+	// Put's size may be -1 when it's not known beforehand. GetAt reads the blob from the offset to its end.
+	StorageBackend interface {
+		Put(key string, reader io.Reader, size int64) error
+		Get(key string) (io.ReadCloser, error)
+		GetAt(key string, offset int64) (io.ReadCloser, error)
+		Delete(key string) error
+		Stat(key string) (models.BlobInfo, error)
+		List() ([]models.BlobInfo, error)
+	}
+)
+
+func StorageBackendFactory(configuration *models.Configuration) StorageBackend {
+	logs.ServicesLog.Debug("StorageBackendFactory")
+	switch configuration.Storage.Engine {
+	case "", "local":
+		return NewLocalStorage(configuration.FilesPath)
+	case "gdrive":
+		return GDriveStorage{}
+	case "memory":
+		return NewMemoryStorage()
+	case "s3":
+		s3Storage, err := NewS3Storage(&configuration.Storage.S3)
+		if err != nil {
+			logs.ServicesLog.Errorf("Unable to connect with S3 storage: %v", err)
+			return nil
+		}
+		return s3Storage
+	default:
+		logs.ServicesLog.Info(configuration.Storage.Engine, " storage engine is not yet implemented")
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testStoragePath = "test_files/"
+
+func TestStorageBackendFactory(t *testing.T) {
+	defer os.RemoveAll(testStoragePath)
+	testCases := []struct {
+		name   string
+		engine string
+		want   StorageBackend
+	}{
+		{
+			`When asking for no engine, return the local storage`,
+			"",
+			LocalStorage{},
+		},
+		{
+			`When asking for "local" engine, return the local storage`,
+			"local",
+			LocalStorage{},
+		},
+		{
+			`When asking for "gdrive" engine, return the Google Drive storage`,
+			"gdrive",
+			GDriveStorage{},
+		},
+		{
+			`When asking for "memory" engine, return the in-memory storage`,
+			"memory",
+			MemoryStorage{},
+		},
+		{
+			`When asking for "floppy" engine, return nil`,
+			"floppy",
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			configuration := models.Configuration{FilesPath: testStoragePath, Storage: models.Storage{Engine: testCase.engine}}
+			require.IsType(t, testCase.want, StorageBackendFactory(&configuration))
+		})
+	}
+}
+
+func TestStorageBackends(t *testing.T) {
+	defer os.RemoveAll(testStoragePath)
+	testCases := []struct {
+		name    string
+		storage StorageBackend
+	}{
+		{"Local storage", NewLocalStorage(testStoragePath)},
+		{"In-memory storage", NewMemoryStorage()},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			storage := testCase.storage
+			content := []byte("Fichero inventado de Mantecabox")
+
+			require.NoError(t, storage.Put("1", bytes.NewReader(content), int64(len(content))))
+
+			reader, err := storage.Get("1")
+			require.NoError(t, err)
+			got, err := ioutil.ReadAll(reader)
+			reader.Close()
+			require.NoError(t, err)
+			require.Equal(t, content, got)
+
+			reader, err = storage.GetAt("1", 8)
+			require.NoError(t, err)
+			got, err = ioutil.ReadAll(reader)
+			reader.Close()
+			require.NoError(t, err)
+			require.Equal(t, content[8:], got)
+
+			info, err := storage.Stat("1")
+			require.NoError(t, err)
+			require.Equal(t, "1", info.Key)
+			require.Equal(t, int64(len(content)), info.Size)
+
+			blobs, err := storage.List()
+			require.NoError(t, err)
+			require.Len(t, blobs, 1)
+			require.Equal(t, "1", blobs[0].Key)
+
+			require.NoError(t, storage.Delete("1"))
+			_, err = storage.Get("1")
+			require.Equal(t, BlobNotFoundError, err)
+			_, err = storage.GetAt("1", 8)
+			require.Equal(t, BlobNotFoundError, err)
+			_, err = storage.Stat("1")
+			require.Equal(t, BlobNotFoundError, err)
+			require.Equal(t, BlobNotFoundError, storage.Delete("1"))
+		})
+	}
+}
+
+func TestLocalStorage_InvalidKeys(t *testing.T) {
+	defer os.RemoveAll(testStoragePath)
+	storage := NewLocalStorage(testStoragePath)
+	for _, key := range []string{"", "/etc/passwd", "../configuration.json"} {
+		t.Run(key, func(t *testing.T) {
+			require.Equal(t, InvalidBlobKeyError, storage.Put(key, bytes.NewReader(nil), 0))
+		})
+	}
+}
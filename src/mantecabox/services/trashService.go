@@ -0,0 +1,161 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	defaultTrashRetention = 30 * 24 * time.Hour
+	expiredTrashBatchSize = 100
+)
+
+type (
+	// TrashService keeps the deleted files, with all their versions, so they can be restored. They are purged for good
+	// when the user empties the trash, or once they have been in it for the configured retention period.
+	TrashService interface {
+		GetTrash(user models.User) ([]models.File, error)
+		RestoreFile(logicalId int64, user models.User) (models.File, error)
+		PurgeFile(logicalId int64, user models.User) error
+		EmptyTrash(user models.User) (int, error)
+		PurgeExpiredTrash() (int, error)
+	}
+
+	TrashServiceImpl struct {
+		configuration *models.Configuration
+		fileDao       dao.FileDao
+		fileService   FileServiceImpl
+	}
+)
+
+func NewTrashService(configuration *models.Configuration) TrashService {
+	if configuration == nil {
+		return nil
+	}
+	fileService, ok := NewFileService(configuration).(FileServiceImpl)
+	if !ok {
+		return nil
+	}
+	return TrashServiceImpl{
+		configuration: configuration,
+		fileDao:       dao.FileDaoFactory(configuration.Database.Engine),
+		fileService:   fileService,
+	}
+}
+
+// GetTrash returns the last version of the user's deleted files, the most recently deleted first
+func (trashService TrashServiceImpl) GetTrash(user models.User) ([]models.File, error) {
+	return trashService.fileDao.GetTrash(user.Email)
+}
+
+// RestoreFile takes the file out of the trash, with all its versions, and creates again the folders it was in. If
+// another file or folder has taken its path in the meantime, PathConflictError is returned.
+func (trashService TrashServiceImpl) RestoreFile(logicalId int64, user models.User) (models.File, error) {
+	file, err := trashService.fileDao.GetTrashedFile(logicalId, user.Email)
+	if err != nil {
+		return file, err
+	}
+	_, err = trashService.fileDao.GetLastVersionFileByNameAndOwner(file.Name, &user)
+	if err == nil {
+		return file, PathConflictError
+	}
+	if err != sql.ErrNoRows {
+		return file, err
+	}
+	if err := trashService.fileService.prepareFolder(&file); err != nil {
+		return file, err
+	}
+	if err := trashService.fileDao.Restore(logicalId, user.Email); err != nil {
+		return file, err
+	}
+	return trashService.fileDao.GetLastVersionFileByNameAndOwner(file.Name, &user)
+}
+
+// PurgeFile removes the trashed file for good, releasing the content of all its versions
+func (trashService TrashServiceImpl) PurgeFile(logicalId int64, user models.User) error {
+	if _, err := trashService.fileDao.GetTrashedFile(logicalId, user.Email); err != nil {
+		return err
+	}
+	return trashService.purge(logicalId)
+}
+
+// EmptyTrash purges all the user's trashed files, and tells how many were purged
+func (trashService TrashServiceImpl) EmptyTrash(user models.User) (int, error) {
+	files, err := trashService.fileDao.GetTrash(user.Email)
+	if err != nil {
+		return 0, err
+	}
+	for i, file := range files {
+		if err := trashService.purge(file.LogicalId); err != nil {
+			return i, err
+		}
+	}
+	return len(files), nil
+}
+
+// PurgeExpiredTrash purges the files that have been in the trash for longer than the retention period, and tells how
+// many were purged
+func (trashService TrashServiceImpl) PurgeExpiredTrash() (int, error) {
+	purged := 0
+	deletedBefore := time.Now().Add(-trashService.retention())
+	for {
+		files, err := trashService.fileDao.GetExpiredTrash(deletedBefore, expiredTrashBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(files) == 0 {
+			return purged, nil
+		}
+		for _, file := range files {
+			if err := trashService.purge(file.LogicalId); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
+
+// purge removes the file's records before releasing its blobs, so an interruption leaves some unreferenced content
+// behind, but never releases a blob twice
+func (trashService TrashServiceImpl) purge(logicalId int64) error {
+	versions, err := trashService.fileDao.GetTrashedVersions(logicalId)
+	if err != nil {
+		return err
+	}
+	blobIds := make([]int64, 0)
+	keys := make([]string, 0)
+	for _, version := range versions {
+		versionBlobIds, key, err := trashService.fileService.versionBlobs(version)
+		if err != nil {
+			return err
+		}
+		blobIds = append(blobIds, versionBlobIds...)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if err := trashService.fileDao.Purge(logicalId); err != nil {
+		return err
+	}
+
+	if err := trashService.fileService.releaseContent(blobIds, keys); err != nil {
+		return err
+	}
+	logs.ServicesLog.Infof("File %v purged, with %v versions", logicalId, len(versions))
+	return nil
+}
+
+func (trashService TrashServiceImpl) retention() time.Duration {
+	if trashService.configuration.TrashRetention == "" {
+		return defaultTrashRetention
+	}
+	retention, err := time.ParseDuration(trashService.configuration.TrashRetention)
+	if err != nil {
+		logs.ServicesLog.Fatalf("unable to parse trash retention configuration value: %v", err.Error())
+	}
+	return retention
+}
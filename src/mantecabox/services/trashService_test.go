@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTrashService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          TrashService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF"},
+			TrashServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewTrashService(testCase.configuration))
+		})
+	}
+}
+
+func TestTrashServiceImpl_retention(t *testing.T) {
+	testCases := []struct {
+		name           string
+		trashRetention string
+		want           time.Duration
+	}{
+		{"When the retention is not configured, return the default one", "", defaultTrashRetention},
+		{"When the retention is configured, return it", "48h", 48 * time.Hour},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			trashService := TrashServiceImpl{configuration: &models.Configuration{TrashRetention: testCase.trashRetention}}
+			require.Equal(t, testCase.want, trashService.retention())
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+)
+
+const (
+	defaultUploadExpiration = 24 * time.Hour
+	expiredUploadsBatchSize = 100
+)
+
+var (
+	InvalidUploadError        = errors.New("the upload must have a name, a size and 9 permission flags at most")
+	UploadOffsetMismatchError = errors.New("the offset doesn't match the upload's received content")
+	UploadTooLargeError       = errors.New("the content exceeds the upload's size")
+	UploadIncompleteError     = errors.New("the upload hasn't received all its content yet")
+	UploadOffsetConflictError = dao.UploadOffsetConflictError
+)
+
+type (
+	// UploadService receives the files in several requests, so an interrupted upload can be resumed from the last
+	// part received instead of starting again. Every part is stored encrypted until the upload is finalized.
+	UploadService interface {
+		CreateUpload(upload *models.Upload) (models.Upload, error)
+		GetUpload(id string, user models.User) (models.Upload, error)
+		WriteUploadPart(id string, user models.User, offset int64, content io.Reader, length int64) (models.Upload, error)
+		FinalizeUpload(id string, user models.User) (models.File, error)
+		DeleteUpload(id string, user models.User) error
+		PurgeExpiredUploads() (int, error)
+	}
+
+	UploadServiceImpl struct {
+		configuration *models.Configuration
+		uploadDao     dao.UploadDao
+		fileService   FileService
+		keyService    KeyService
+		storage       StorageBackend
+	}
+
+	// exactReader fails if the reader ends before giving the expected number of bytes
+	exactReader struct {
+		reader    io.Reader
+		remaining int64
+	}
+)
+
+func NewUploadService(configuration *models.Configuration) UploadService {
+	if configuration == nil {
+		return nil
+	}
+	fileService := NewFileService(configuration)
+	if fileService == nil {
+		return nil
+	}
+	return UploadServiceImpl{
+		configuration: configuration,
+		uploadDao:     dao.UploadDaoFactory(configuration.Database.Engine),
+		fileService:   fileService,
+		keyService:    NewKeyService(configuration),
+		storage:       StorageBackendFactory(configuration),
+	}
+}
+
+func (uploadService UploadServiceImpl) CreateUpload(upload *models.Upload) (models.Upload, error) {
+	if upload.Name == "" || upload.Size < 0 || ValidatePermissions(upload.PermissionsStr) != nil {
+		return models.Upload{}, InvalidUploadError
+	}
+	// The upload is named after the file's path, which is checked now so it doesn't fail once the content is received
+	name, err := cleanPath(upload.Name)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	upload.Name = name
+	if err := ValidateChecksum(upload.Checksum); err != nil {
+		return models.Upload{}, err
+	}
+	if err := uploadService.fileService.CheckQuota(models.User{Credentials: models.Credentials{Email: upload.Owner}}, upload.Size); err != nil {
+		return models.Upload{}, err
+	}
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return models.Upload{}, err
+	}
+	upload.Id = hex.EncodeToString(id)
+	// The uploads without permissions keep them empty, so the new version keeps the file's current ones
+	upload.ExpiresAt = time.Now().Add(uploadService.expiration())
+	return uploadService.uploadDao.Create(upload)
+}
+
+// GetUpload returns the user's upload, unless it has expired
+func (uploadService UploadServiceImpl) GetUpload(id string, user models.User) (models.Upload, error) {
+	return uploadService.uploadDao.GetByIdAndOwner(id, user.Email)
+}
+
+// WriteUploadPart stores the content that follows what the upload has already received. The offset must be the
+// upload's received size, so a part that was only partially received is sent again from its beginning.
+func (uploadService UploadServiceImpl) WriteUploadPart(id string, user models.User, offset int64, content io.Reader, length int64) (models.Upload, error) {
+	upload, err := uploadService.uploadDao.GetByIdAndOwner(id, user.Email)
+	if err != nil {
+		return upload, err
+	}
+	if offset != upload.Received {
+		return upload, UploadOffsetMismatchError
+	}
+	if length < 0 || offset+length > upload.Size {
+		return upload, UploadTooLargeError
+	}
+	if length == 0 {
+		return upload, nil
+	}
+	blobCipher, err := uploadService.keyService.GetUserCipher(user.Email)
+	if err != nil {
+		return upload, err
+	}
+
+	key := uploadPartKey(upload.Id, offset)
+	encrypted := blobCipher.EncryptReader(&exactReader{reader: content, remaining: length})
+	if err := uploadService.storage.Put(key, encrypted, blobCipher.EncryptedSize(length)); err != nil {
+		uploadService.storage.Delete(key)
+		return upload, err
+	}
+	return uploadService.uploadDao.AddPart(&upload, length, time.Now().Add(uploadService.expiration()))
+}
+
+// FinalizeUpload creates a new version of the file with the upload's content, and removes the upload. If the content
+// doesn't match the upload's checksum, the upload is removed without creating the version.
+func (uploadService UploadServiceImpl) FinalizeUpload(id string, user models.User) (models.File, error) {
+	upload, err := uploadService.uploadDao.GetByIdAndOwner(id, user.Email)
+	if err != nil {
+		return models.File{}, err
+	}
+	if upload.Received != upload.Size {
+		return models.File{}, UploadIncompleteError
+	}
+	parts, err := uploadService.uploadDao.GetParts(upload.Id)
+	if err != nil {
+		return models.File{}, err
+	}
+	blobCipher, err := uploadService.keyService.GetUserCipher(user.Email)
+	if err != nil {
+		return models.File{}, err
+	}
+	keys := make([]string, len(parts))
+	for i, part := range parts {
+		keys[i] = uploadPartKey(upload.Id, part.Position)
+	}
+
+	// The quota is checked again, as other files may have been uploaded since the upload was created
+	if err := uploadService.fileService.CheckQuota(user, upload.Size); err != nil {
+		return models.File{}, err
+	}
+	file, err := uploadService.fileService.CreateFile(&models.File{
+		Name:           upload.Name,
+		Owner:          user,
+		PermissionsStr: upload.PermissionsStr,
+	})
+	if err != nil {
+		return file, err
+	}
+	file.Checksum = upload.Checksum
+	err = uploadService.fileService.SaveFileContent(file, func() (io.ReadCloser, error) {
+		return &chunkedReader{storage: uploadService.storage, blobCipher: blobCipher, keys: keys}, nil
+	})
+	if err == ChecksumMismatchError {
+		// The content received can't change, so the upload will never match its checksum
+		if err := uploadService.removeUpload(upload.Id, parts); err != nil {
+			logs.ServicesLog.Errorf("Unable to remove mismatched upload %v: %v", upload.Id, err)
+		}
+	}
+	if err != nil {
+		return file, err
+	}
+	if err := uploadService.removeUpload(upload.Id, parts); err != nil {
+		logs.ServicesLog.Errorf("Unable to remove finished upload %v: %v", upload.Id, err)
+	}
+	// The version is read again to return its size and checksum
+	return uploadService.fileService.GetFileByVersion(file.Name, file.Id, &user)
+}
+
+// DeleteUpload cancels the user's upload, removing all the content received
+func (uploadService UploadServiceImpl) DeleteUpload(id string, user models.User) error {
+	upload, err := uploadService.uploadDao.GetByIdAndOwner(id, user.Email)
+	if err != nil {
+		return err
+	}
+	parts, err := uploadService.uploadDao.GetParts(upload.Id)
+	if err != nil {
+		return err
+	}
+	return uploadService.removeUpload(upload.Id, parts)
+}
+
+// PurgeExpiredUploads removes the uploads that haven't received any content for a while, and tells how many were
+// removed
+func (uploadService UploadServiceImpl) PurgeExpiredUploads() (int, error) {
+	purged := 0
+	for {
+		uploads, err := uploadService.uploadDao.GetExpired(expiredUploadsBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(uploads) == 0 {
+			return purged, nil
+		}
+		for _, upload := range uploads {
+			parts, err := uploadService.uploadDao.GetParts(upload.Id)
+			if err != nil {
+				return purged, err
+			}
+			if err := uploadService.removeUpload(upload.Id, parts); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
+
+// removeUpload removes the parts' content before the upload, so no content is left behind if it's interrupted
+func (uploadService UploadServiceImpl) removeUpload(id string, parts []models.UploadPart) error {
+	for _, part := range parts {
+		err := uploadService.storage.Delete(uploadPartKey(id, part.Position))
+		if err != nil && err != BlobNotFoundError {
+			return err
+		}
+	}
+	return uploadService.uploadDao.Delete(id)
+}
+
+func (uploadService UploadServiceImpl) expiration() time.Duration {
+	if uploadService.configuration.UploadExpiration == "" {
+		return defaultUploadExpiration
+	}
+	expiration, err := time.ParseDuration(uploadService.configuration.UploadExpiration)
+	if err != nil {
+		logs.ServicesLog.Fatalf("unable to parse upload expiration configuration value: %v", err.Error())
+	}
+	return expiration
+}
+
+func uploadPartKey(uploadId string, position int64) string {
+	return "uploads/" + uploadId + "/" + strconv.FormatInt(position, 10)
+}
+
+func (reader *exactReader) Read(p []byte) (int, error) {
+	if reader.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > reader.remaining {
+		p = p[:reader.remaining]
+	}
+	n, err := reader.reader.Read(p)
+	reader.remaining -= int64(n)
+	if err == io.EOF && reader.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
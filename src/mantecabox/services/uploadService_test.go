@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUploadService(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configuration *models.Configuration
+		want          UploadService
+	}{
+		{
+			"When passing the configuration, return the service",
+			&models.Configuration{AesKey: "0123456789ABCDEF"},
+			UploadServiceImpl{},
+		},
+		{
+			"When passing no configuration, return nil",
+			nil,
+			nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewUploadService(testCase.configuration))
+		})
+	}
+}
+
+func TestUploadServiceImpl_CreateUpload(t *testing.T) {
+	testCases := []struct {
+		name   string
+		upload models.Upload
+	}{
+		{"When the upload has no name, return an error", models.Upload{Size: 10}},
+		{"When the upload's size is negative, return an error", models.Upload{Name: "video.mp4", Size: -1}},
+		{"When the upload's permissions are wrong, return an error", models.Upload{Name: "video.mp4", Size: 10, PermissionsStr: "rw-"}},
+		{"When the upload's permissions are malformed, return an error", models.Upload{Name: "video.mp4", Size: 10, PermissionsStr: "abcdefghi"}},
+	}
+	uploadService := UploadServiceImpl{configuration: &models.Configuration{}}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := uploadService.CreateUpload(&testCase.upload)
+			require.Equal(t, InvalidUploadError, err)
+		})
+	}
+}
+
+// fakeUploadDao keeps the last upload created
+type fakeUploadDao struct {
+	dao.UploadDao
+	created *models.Upload
+}
+
+func (uploadDao fakeUploadDao) Create(upload *models.Upload) (models.Upload, error) {
+	*uploadDao.created = *upload
+	return *upload, nil
+}
+
+// fakeQuotaFileService lets all the uploads fit
+type fakeQuotaFileService struct {
+	FileService
+}
+
+func (fileService fakeQuotaFileService) CheckQuota(user models.User, size int64) error {
+	return nil
+}
+
+func TestUploadServiceImpl_CreateUploadPermissions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		permissions string
+	}{
+		{"When the upload has permissions, keep them", "rw-------"},
+		{"When the upload has no permissions, keep them empty so the file keeps its current ones", ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var created models.Upload
+			uploadService := UploadServiceImpl{
+				configuration: &models.Configuration{},
+				uploadDao:     fakeUploadDao{created: &created},
+				fileService:   fakeQuotaFileService{},
+			}
+			_, err := uploadService.CreateUpload(&models.Upload{Name: "video.mp4", Size: 10, PermissionsStr: testCase.permissions})
+			require.NoError(t, err)
+			require.Equal(t, testCase.permissions, created.PermissionsStr)
+		})
+	}
+}
+
+func TestUploadServiceImpl_CreateUploadInvalidPath(t *testing.T) {
+	uploadService := UploadServiceImpl{configuration: &models.Configuration{}}
+	_, err := uploadService.CreateUpload(&models.Upload{Name: "docs/../video.mp4", Size: 10})
+	require.Equal(t, InvalidPathError, err)
+}
+
+func TestUploadServiceImpl_expiration(t *testing.T) {
+	uploadService := UploadServiceImpl{configuration: &models.Configuration{}}
+	require.Equal(t, defaultUploadExpiration, uploadService.expiration())
+	uploadService.configuration.UploadExpiration = "90m"
+	require.Equal(t, 90*time.Minute, uploadService.expiration())
+}
+
+func TestExactReader(t *testing.T) {
+	got, err := ioutil.ReadAll(&exactReader{reader: bytes.NewReader([]byte("Mantecabox")), remaining: 5})
+	require.NoError(t, err)
+	require.Equal(t, "Mante", string(got))
+
+	_, err = ioutil.ReadAll(&exactReader{reader: bytes.NewReader([]byte("Mantecabox")), remaining: 11})
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"mantecabox/dao"
+	"mantecabox/logs"
 	"mantecabox/models"
 	"mantecabox/utilities"
 
@@ -23,6 +25,9 @@ var (
 	InvalidPasswordError = errors.New("password input is not SHA-512 hashed")
 	Generating2FAError   = errors.New("unable to generate a 2FA secure code")
 	Empty2FACodeError    = errors.New("the 2FA secure code is empty")
+	InvalidRoleError     = errors.New(`the role must be "user" or "admin"`)
+	UserDisabledError    = errors.New("the user is disabled")
+	TokenRevokedError    = errors.New("the token has been revoked")
 )
 
 type (
@@ -35,6 +40,12 @@ type (
 		UserExists(email, password string) (models.User, bool)
 		Generate2FACodeAndSaveToUser(user *models.User) (models.User, error)
 		TwoFactorMatchesAndIsNotOutdated(expected, actual string, expire time.Time) bool
+		AuthorizeToken(email string, loginAt time.Time) (models.User, error)
+		SetRole(email string, role string) (models.User, error)
+		SetDisabled(email string, disabled bool) (models.User, error)
+		Reset2FA(email string) (models.User, error)
+		ForceLogout(email string) (models.User, error)
+		GrantAdmins(emails []string) error
 		UserDao() dao.UserDao
 		AesCipher() utilities.AesCTRCipher
 	}
@@ -42,6 +53,7 @@ type (
 	UserServiceImpl struct {
 		configuration *models.Configuration
 		userDao       dao.UserDao
+		keyService    KeyService
 		aesCipher     utilities.AesCTRCipher
 	}
 )
@@ -61,6 +73,7 @@ func NewUserService(configuration *models.Configuration) UserService {
 	return UserServiceImpl{
 		configuration: configuration,
 		userDao:       dao.UserDaoFactory(configuration.Database.Engine),
+		keyService:    NewKeyService(configuration),
 		aesCipher:     utilities.NewAesCTRCipher(configuration.AesKey),
 	}
 }
@@ -117,16 +130,24 @@ func (userService UserServiceImpl) ModifyUser(username string, u *models.User) (
 	return userService.userDao.Update(username, &user)
 }
 
+// DeleteUser also shreds the user's data key, so their files can't be decrypted anymore
 func (userService UserServiceImpl) DeleteUser(username string) error {
-	return userService.userDao.Delete(username)
+	if err := userService.userDao.Delete(username); err != nil {
+		return err
+	}
+	return userService.keyService.ShredUserKey(username)
 }
 
+// UserExists checks the user's credentials. The disabled users can't log in, even with the right ones.
 func (userService UserServiceImpl) UserExists(email, password string) (models.User, bool) {
 	user, err := userService.userDao.GetByPk(email)
 	if err != nil {
 		user.Email = email
 		return user, false
 	}
+	if user.DisabledAt.Valid {
+		return user, false
+	}
 	decodedExpectedPassword, err := base64.URLEncoding.DecodeString(password)
 	if err != nil {
 		return user, false
@@ -161,6 +182,76 @@ func (userService UserServiceImpl) TwoFactorMatchesAndIsNotOutdated(expected, ac
 	return expected == actual && time.Now().Sub(expire) < timeLimit
 }
 
+// TokenTimePrecision is the precision of the login times that the tokens carry, and of the tokens' revocations
+const TokenTimePrecision = time.Millisecond
+
+// AuthorizeToken checks that the user who logged in at the given time can still use their token: they must not have
+// been deleted nor disabled, and their tokens must not have been revoked since. As the tokens issued in the same
+// millisecond as the revocation can't be told apart, they are revoked too.
+func (userService UserServiceImpl) AuthorizeToken(email string, loginAt time.Time) (models.User, error) {
+	user, err := userService.userDao.GetByPk(email)
+	if err != nil {
+		return user, err
+	}
+	if user.DisabledAt.Valid {
+		return user, UserDisabledError
+	}
+	if user.TokensRevokedAt.Valid && !loginAt.After(user.TokensRevokedAt.Time) {
+		return user, TokenRevokedError
+	}
+	return user, nil
+}
+
+// SetRole changes the user's role. As the role is carried in the user's tokens, they are revoked, so it takes effect
+// when the user logs in again.
+func (userService UserServiceImpl) SetRole(email string, role string) (models.User, error) {
+	if role != models.UserRoleUser && role != models.UserRoleAdmin {
+		return models.User{}, InvalidRoleError
+	}
+	if _, err := userService.userDao.SetRole(email, role); err != nil {
+		return models.User{}, err
+	}
+	return userService.ForceLogout(email)
+}
+
+// SetDisabled disables the user, who can't log in nor use their tokens anymore, or enables them again
+func (userService UserServiceImpl) SetDisabled(email string, disabled bool) (models.User, error) {
+	return userService.userDao.SetDisabled(email, disabled)
+}
+
+// Reset2FA discards the user's pending verification code, so they have to ask for a new one to log in
+func (userService UserServiceImpl) Reset2FA(email string) (models.User, error) {
+	return userService.userDao.Reset2FA(email)
+}
+
+// ForceLogout revokes all the tokens issued to the user until now
+func (userService UserServiceImpl) ForceLogout(email string) (models.User, error) {
+	return userService.userDao.RevokeTokens(email, time.Now().UTC().Truncate(TokenTimePrecision))
+}
+
+// GrantAdmins makes admins the users listed as such in the configuration, which is how the first admins are chosen.
+// The users that don't exist yet, and the groups, are skipped.
+func (userService UserServiceImpl) GrantAdmins(emails []string) error {
+	for _, email := range emails {
+		user, err := userService.userDao.GetByPk(email)
+		if err == nil && user.Role == models.UserRoleAdmin {
+			continue
+		}
+		if err == nil {
+			_, err = userService.SetRole(email, models.UserRoleAdmin)
+		}
+		if err == sql.ErrNoRows {
+			logs.ServicesLog.Warnf("Unable to make %v an admin: the user doesn't exist", email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logs.ServicesLog.Infof("User %v is now an admin", email)
+	}
+	return nil
+}
+
 func (userService UserServiceImpl) UserDao() dao.UserDao {
 	return userService.userDao
 }
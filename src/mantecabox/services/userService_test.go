@@ -10,12 +10,14 @@ import (
 	"testing"
 	"time"
 
+	"mantecabox/dao"
 	"mantecabox/models"
 	"mantecabox/utilities"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
 )
 
 const (
@@ -380,6 +382,16 @@ func TestUserExists(t *testing.T) {
 				require.False(t, exists)
 			},
 		},
+		{
+			name: "When the user is disabled, return false even if the password is correct",
+			test: func(t *testing.T) {
+				_, err := testUserService.SetDisabled(testUserEmail, true)
+				require.NoError(t, err)
+				user, exists := testUserService.UserExists(testUserEmail, correctPassword)
+				require.Equal(t, testUserEmail, user.Email)
+				require.False(t, exists)
+			},
+		},
 		{
 			name: "When the user doesn't exist, return false",
 			test: func(t *testing.T) {
@@ -399,6 +411,69 @@ func TestUserExists(t *testing.T) {
 	}
 }
 
+// fakeUserDao only knows some users, by their email
+type fakeUserDao struct {
+	dao.UserDao
+	users map[string]models.User
+}
+
+func (userDao fakeUserDao) GetByPk(email string) (models.User, error) {
+	user, ok := userDao.users[email]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (userDao fakeUserDao) GetAll() ([]models.User, error) {
+	users := make([]models.User, 0)
+	for _, user := range userDao.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func TestUserServiceImpl_AuthorizeToken(t *testing.T) {
+	revokedAt := time.Date(2018, time.July, 20, 12, 0, 0, 0, time.UTC)
+	userService := UserServiceImpl{userDao: fakeUserDao{users: map[string]models.User{
+		"testuser1": {Credentials: models.Credentials{Email: "testuser1"}},
+		"testuser2": {Credentials: models.Credentials{Email: "testuser2"}, DisabledAt: null.TimeFrom(revokedAt)},
+		"testuser3": {Credentials: models.Credentials{Email: "testuser3"}, TokensRevokedAt: null.TimeFrom(revokedAt)},
+	}}}
+	testCases := []struct {
+		name    string
+		email   string
+		loginAt time.Time
+		wantErr error
+	}{
+		{"When the user is active, authorize the token", "testuser1", revokedAt, nil},
+		{"When the user is disabled, reject the token", "testuser2", revokedAt.Add(time.Hour), UserDisabledError},
+		{"When the user logged in before the revocation, reject the token", "testuser3", revokedAt.Add(-time.Millisecond), TokenRevokedError},
+		{"When the user logged in in the same millisecond as the revocation, reject the token", "testuser3", revokedAt, TokenRevokedError},
+		{"When the user logged in after the revocation, authorize the token", "testuser3", revokedAt.Add(time.Millisecond), nil},
+		{"When the user doesn't exist, reject the token", "testuser4", revokedAt, sql.ErrNoRows},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := userService.AuthorizeToken(testCase.email, testCase.loginAt)
+			require.Equal(t, testCase.wantErr, err)
+		})
+	}
+}
+
+func TestUserServiceImpl_SetRole(t *testing.T) {
+	userService := UserServiceImpl{userDao: fakeUserDao{}}
+	_, err := userService.SetRole("testuser1", "root")
+	require.Equal(t, InvalidRoleError, err)
+}
+
+func TestUserServiceImpl_GrantAdmins(t *testing.T) {
+	userService := UserServiceImpl{userDao: fakeUserDao{users: map[string]models.User{
+		"testuser1": {Credentials: models.Credentials{Email: "testuser1"}, Role: models.UserRoleAdmin},
+	}}}
+	require.NoError(t, userService.GrantAdmins([]string{"testuser1", "nonexistent"}))
+}
+
 func TestTwoFactorMatchesAndIsNotOutdated(t *testing.T) {
 	type args struct {
 		code1  string
@@ -3,18 +3,26 @@
 package utilities
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 )
 
+var CiphertextTooShortError = errors.New("ciphertext too short")
+
 type (
 	AesCTRCipher interface {
 		Encrypt(plaintext []byte) []byte
 		Decrypt(ciphertext []byte) []byte
+		EncryptReader(plaintext io.Reader) io.Reader
+		DecryptReader(ciphertext io.Reader) (io.Reader, error)
+		EncryptWriter(ciphertext io.Writer) (io.Writer, error)
+		DecryptWriter(plaintext io.Writer) io.Writer
 		Key() []byte
 	}
 
@@ -22,6 +30,14 @@ type (
 		key   []byte
 		block cipher.Block
 	}
+
+	// ctrDecryptWriter holds the first bytes written until it has the whole IV
+	ctrDecryptWriter struct {
+		block  cipher.Block
+		iv     []byte
+		writer io.Writer
+		stream cipher.Stream
+	}
 )
 
 func NewAesCTRCipher(key string) AesCTRCipher {
@@ -79,6 +95,72 @@ func (aesCtrCipher AesCTRCipherImpl) Decrypt(ciphertext []byte) []byte {
 	return ciphertext
 }
 
+// EncryptReader works as Encrypt, but the plaintext is read and encrypted as the returned reader is consumed, so
+// big files don't need to be loaded in memory.
+func (aesCtrCipher AesCTRCipherImpl) EncryptReader(plaintext io.Reader) io.Reader {
+	iv := aesCtrCipher.newIV()
+	stream := cipher.NewCTR(aesCtrCipher.block, iv)
+	return io.MultiReader(bytes.NewReader(iv), cipher.StreamReader{S: stream, R: plaintext})
+}
+
+// DecryptReader reads the IV from the beginning of the ciphertext and decrypts the rest as it's consumed.
+func (aesCtrCipher AesCTRCipherImpl) DecryptReader(ciphertext io.Reader) (io.Reader, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(ciphertext, iv); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, CiphertextTooShortError
+		}
+		return nil, err
+	}
+	stream := cipher.NewCTR(aesCtrCipher.block, iv)
+	return cipher.StreamReader{S: stream, R: ciphertext}, nil
+}
+
+// EncryptWriter writes the IV to the ciphertext writer and returns a writer that encrypts everything written to it.
+func (aesCtrCipher AesCTRCipherImpl) EncryptWriter(ciphertext io.Writer) (io.Writer, error) {
+	iv := aesCtrCipher.newIV()
+	if _, err := ciphertext.Write(iv); err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(aesCtrCipher.block, iv)
+	return cipher.StreamWriter{S: stream, W: ciphertext}, nil
+}
+
+// DecryptWriter returns a writer that decrypts everything written to it (IV included) into the plaintext writer.
+func (aesCtrCipher AesCTRCipherImpl) DecryptWriter(plaintext io.Writer) io.Writer {
+	return &ctrDecryptWriter{
+		block:  aesCtrCipher.block,
+		iv:     make([]byte, 0, aes.BlockSize),
+		writer: plaintext,
+	}
+}
+
+func (aesCtrCipher AesCTRCipherImpl) newIV() []byte {
+	iv := make([]byte, aes.BlockSize)
+	_, err := io.ReadFull(rand.Reader, iv)
+	if err != nil {
+		panic("unable to create IV's cihper: " + err.Error())
+	}
+	return iv
+}
+
+func (writer *ctrDecryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	if writer.stream == nil {
+		missing := aes.BlockSize - len(writer.iv)
+		if len(p) < missing {
+			writer.iv = append(writer.iv, p...)
+			return len(p), nil
+		}
+		writer.iv = append(writer.iv, p[:missing]...)
+		writer.stream = cipher.NewCTR(writer.block, writer.iv)
+		written = missing
+		p = p[missing:]
+	}
+	n, err := cipher.StreamWriter{S: writer.stream, W: writer.writer}.Write(p)
+	return written + n, err
+}
+
 func (aesCtrCipher AesCTRCipherImpl) Key() []byte {
 	return aesCtrCipher.key
 }
@@ -30,6 +30,73 @@ func TestFileNewCTR(t *testing.T) {
 	require.Equal(t, testFile, decrypted)
 }
 
+func TestStreamNewCTR(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("Fichero inventado de Mantecabox"), 1000)
+
+	testCases := []struct {
+		name    string
+		encrypt func(t *testing.T) []byte
+		decrypt func(t *testing.T, ciphertext []byte) []byte
+	}{
+		{
+			"When encrypting with a reader, decrypt it with Decrypt",
+			func(t *testing.T) []byte {
+				encrypted, err := ioutil.ReadAll(testAesCTRCipher.EncryptReader(bytes.NewReader(plaintext)))
+				require.NoError(t, err)
+				return encrypted
+			},
+			func(t *testing.T, ciphertext []byte) []byte {
+				return testAesCTRCipher.Decrypt(ciphertext)
+			},
+		},
+		{
+			"When encrypting with Encrypt, decrypt it with a reader",
+			func(t *testing.T) []byte {
+				return testAesCTRCipher.Encrypt(plaintext)
+			},
+			func(t *testing.T, ciphertext []byte) []byte {
+				reader, err := testAesCTRCipher.DecryptReader(bytes.NewReader(ciphertext))
+				require.NoError(t, err)
+				decrypted, err := ioutil.ReadAll(reader)
+				require.NoError(t, err)
+				return decrypted
+			},
+		},
+		{
+			"When encrypting with a writer, decrypt it with a writer written byte by byte",
+			func(t *testing.T) []byte {
+				var ciphertext bytes.Buffer
+				writer, err := testAesCTRCipher.EncryptWriter(&ciphertext)
+				require.NoError(t, err)
+				_, err = writer.Write(plaintext)
+				require.NoError(t, err)
+				return ciphertext.Bytes()
+			},
+			func(t *testing.T, ciphertext []byte) []byte {
+				var decrypted bytes.Buffer
+				writer := testAesCTRCipher.DecryptWriter(&decrypted)
+				for _, b := range ciphertext {
+					_, err := writer.Write([]byte{b})
+					require.NoError(t, err)
+				}
+				return decrypted.Bytes()
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			encrypted := testCase.encrypt(t)
+			require.Len(t, encrypted, len(plaintext)+16)
+			require.Equal(t, plaintext, testCase.decrypt(t, encrypted))
+		})
+	}
+}
+
+func TestDecryptReaderTooShort(t *testing.T) {
+	_, err := testAesCTRCipher.DecryptReader(bytes.NewReader([]byte("short")))
+	require.Equal(t, CiphertextTooShortError, err)
+}
+
 func TestNewAesCTRCipher(t *testing.T) {
 	type args struct {
 		key string
@@ -0,0 +1,483 @@
+package utilities
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// The blobs are stored in the following format (all integers in big endian):
+//
+//	header: magic "MNBX" (4) | version (1) | chunk size (4) | nonce prefix (7)
+//	body:   every chunk of plaintext sealed with AES-GCM, the last one being flagged in its nonce
+//
+// Each chunk's nonce is the prefix, followed by the chunk's counter (4) and a last-chunk flag (1), and the header is
+// authenticated with every chunk, so reordering, truncating or tampering with any of them makes the decryption fail.
+// The blobs without this header were stored with plain AES-CTR, where the first 16 bytes are the IV. The format 1 blobs
+// are encrypted with a key derived from the master key, and the format 2 ones with their owner's data key.
+const (
+	blobMagic                   = "MNBX"
+	BlobFormatLength            = len(blobMagic) + 1
+	BlobFormatLegacyCTR         = 0
+	BlobFormatGCMChunked        = 1
+	BlobFormatGCMChunkedDataKey = 2
+	blobHeaderSize              = 16
+	blobNoncePrefixSize         = 7
+	defaultBlobChunkSize        = 64 * 1024
+	contentHashLabel            = "mantecabox content hash:"
+	chunkHashLabel              = "mantecabox chunk hash:"
+)
+
+// maxBlobChunkSize bounds the chunk size read from the header, which isn't authenticated until the first chunk is
+// opened, so that a forged one can't make the chunks' buffer huge
+const maxBlobChunkSize = 1024 * 1024
+
+var (
+	IntegrityError         = errors.New("blob integrity check failed")
+	UnknownBlobFormatError = errors.New("unknown blob format")
+	MissingDataKeyError    = errors.New("the blob is encrypted with a data key that has not been provided")
+)
+
+type (
+	// BlobCipher encrypts the stored files' content. It always encrypts with the newest format, but it can decrypt
+	// any of them.
+	BlobCipher interface {
+		EncryptReader(plaintext io.Reader) io.Reader
+		EncryptedSize(plaintextSize int64) int64
+		OpenBlob(ciphertext io.Reader, ciphertextSize int64) (plaintext io.Reader, plaintextSize int64, err error)
+		OpenBlobAt(open func(offset int64) (io.ReadCloser, error), ciphertextSize int64, offset int64) (plaintext io.ReadCloser, plaintextSize int64, err error)
+		WithDataKey(dataKey []byte) (BlobCipher, error)
+		WithoutLegacy() BlobCipher
+		NewContentHash() hash.Hash
+		ChunkHash(digest []byte) string
+	}
+
+	BlobCipherImpl struct {
+		legacyCipher AesCTRCipher
+		masterAead   cipher.AEAD
+		dataAead     cipher.AEAD
+		hashKey      []byte
+		chunkHashKey []byte
+		chunkSize    int
+		rejectLegacy bool
+	}
+
+	gcmEncryptReader struct {
+		aead    cipher.AEAD
+		header  []byte
+		source  *bufio.Reader
+		chunk   []byte
+		pending []byte
+		counter uint32
+		done    bool
+	}
+
+	// blobPlaintext reads the decrypted content, but closes the blob it comes from
+	blobPlaintext struct {
+		io.Reader
+		io.Closer
+	}
+
+	gcmDecryptReader struct {
+		aead    cipher.AEAD
+		header  []byte
+		source  *bufio.Reader
+		sealed  []byte
+		pending []byte
+		counter uint32
+		done    bool
+	}
+)
+
+// NewBlobCipher derives a 256 bits key from the configuration's key for the new blobs. The legacy ones still use the
+// 128 bits AES-CTR key.
+func NewBlobCipher(key string) BlobCipher {
+	return newBlobCipherWithChunkSize(key, defaultBlobChunkSize)
+}
+
+func newBlobCipherWithChunkSize(key string, chunkSize int) BlobCipher {
+	derivedKey := sha256.Sum256([]byte(key))
+	aead, err := newGCM(derivedKey[:])
+	if err != nil {
+		panic(err.Error())
+	}
+	return BlobCipherImpl{
+		legacyCipher: NewAesCTRCipher(key),
+		masterAead:   aead,
+		hashKey:      deriveHashKey([]byte(key), contentHashLabel),
+		chunkHashKey: deriveHashKey([]byte(key), chunkHashLabel),
+		chunkSize:    chunkSize,
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("unable to create cipher from key: " + err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.New("unable to create GCM cipher: " + err.Error())
+	}
+	return aead, nil
+}
+
+// WithDataKey returns a copy of the cipher that encrypts the new blobs with the given data key instead of the master
+// key. The blobs encrypted with the master key are still readable.
+func (blobCipher BlobCipherImpl) WithDataKey(dataKey []byte) (BlobCipher, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	blobCipher.dataAead = aead
+	blobCipher.hashKey = deriveHashKey(dataKey, contentHashLabel)
+	blobCipher.chunkHashKey = deriveHashKey(dataKey, chunkHashLabel)
+	return blobCipher, nil
+}
+
+// WithoutLegacy returns a copy of the cipher that only opens the GCM blobs, returning UnknownBlobFormatError for the
+// others. As the legacy blobs have no header, a GCM one whose header has been overwritten would be taken for a legacy
+// one, and decrypted without any integrity check.
+func (blobCipher BlobCipherImpl) WithoutLegacy() BlobCipher {
+	blobCipher.rejectLegacy = true
+	return blobCipher
+}
+
+func deriveHashKey(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// NewContentHash returns a keyed hash to identify the blobs by their content, without revealing it to anyone who
+// doesn't have the key
+func (blobCipher BlobCipherImpl) NewContentHash() hash.Hash {
+	return hmac.New(sha256.New, blobCipher.hashKey)
+}
+
+// ChunkHash identifies a chunk by the SHA-256 digest the clients know it by. It uses a different key than
+// NewContentHash, so a chunk and a whole file can never be taken for each other.
+func (blobCipher BlobCipherImpl) ChunkHash(digest []byte) string {
+	mac := hmac.New(sha256.New, blobCipher.chunkHashKey)
+	mac.Write(digest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// currentFormat tells the format and AEAD used for the new blobs
+func (blobCipher BlobCipherImpl) currentFormat() (byte, cipher.AEAD) {
+	if blobCipher.dataAead != nil {
+		return BlobFormatGCMChunkedDataKey, blobCipher.dataAead
+	}
+	return BlobFormatGCMChunked, blobCipher.masterAead
+}
+
+func (blobCipher BlobCipherImpl) EncryptReader(plaintext io.Reader) io.Reader {
+	format, aead := blobCipher.currentFormat()
+	header := make([]byte, blobHeaderSize)
+	copy(header, blobMagic)
+	header[4] = format
+	binary.BigEndian.PutUint32(header[5:9], uint32(blobCipher.chunkSize))
+	if _, err := io.ReadFull(rand.Reader, header[9:]); err != nil {
+		panic("unable to create blob's nonce: " + err.Error())
+	}
+	return &gcmEncryptReader{
+		aead:    aead,
+		header:  header,
+		source:  bufio.NewReader(plaintext),
+		chunk:   make([]byte, blobCipher.chunkSize),
+		pending: header,
+	}
+}
+
+func (blobCipher BlobCipherImpl) EncryptedSize(plaintextSize int64) int64 {
+	chunks := plaintextSize / int64(blobCipher.chunkSize)
+	if plaintextSize%int64(blobCipher.chunkSize) != 0 || plaintextSize == 0 {
+		chunks++
+	}
+	_, aead := blobCipher.currentFormat()
+	return blobHeaderSize + plaintextSize + chunks*int64(aead.Overhead())
+}
+
+// OpenBlob reads the blob's header to choose how to decrypt it. The integrity errors of the GCM blobs are returned by
+// the plaintext reader as soon as the broken chunk is reached.
+func (blobCipher BlobCipherImpl) OpenBlob(ciphertext io.Reader, ciphertextSize int64) (io.Reader, int64, error) {
+	header, err := readBlobHeader(ciphertext)
+	if err != nil {
+		return nil, 0, err
+	}
+	format := BlobFormat(header)
+	if format == BlobFormatLegacyCTR && blobCipher.rejectLegacy {
+		return nil, 0, UnknownBlobFormatError
+	}
+	if format == BlobFormatLegacyCTR {
+		// Legacy AES-CTR blob: the header we've just read is its IV
+		plaintext, err := blobCipher.legacyCipher.DecryptReader(io.MultiReader(bytes.NewReader(header), ciphertext))
+		return plaintext, ciphertextSize - aes.BlockSize, err
+	}
+	aead, chunkSize, plaintextSize, err := blobCipher.chunkedLayout(header, ciphertextSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &gcmDecryptReader{
+		aead:   aead,
+		header: header,
+		source: bufio.NewReader(ciphertext),
+		sealed: make([]byte, sealedBufferSize(chunkSize+int64(aead.Overhead()), ciphertextSize-blobHeaderSize)),
+	}, plaintextSize, nil
+}
+
+// OpenBlobAt works as OpenBlob, but the plaintext starts at the given offset. open must return the blob's content from
+// its own offset on, so that only the part of the blob that holds the plaintext from the given offset is read: the
+// chunks of the GCM blobs and the blocks of the legacy ones can be decrypted on their own.
+func (blobCipher BlobCipherImpl) OpenBlobAt(open func(offset int64) (io.ReadCloser, error), ciphertextSize int64, offset int64) (io.ReadCloser, int64, error) {
+	blob, err := open(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	header, err := readBlobHeader(blob)
+	if err != nil {
+		blob.Close()
+		return nil, 0, err
+	}
+
+	var plaintext io.Reader
+	var plaintextSize, skip int64
+	// reopen moves to the ciphertext's offset, unless it's where the header has left the blob
+	reopen := func(ciphertextOffset int64) error {
+		if ciphertextOffset == blobHeaderSize {
+			return nil
+		}
+		blob.Close()
+		blob, err = open(ciphertextOffset)
+		return err
+	}
+	format := BlobFormat(header)
+	if format == BlobFormatLegacyCTR && blobCipher.rejectLegacy {
+		blob.Close()
+		return nil, 0, UnknownBlobFormatError
+	}
+	if format == BlobFormatLegacyCTR {
+		plaintextSize = ciphertextSize - aes.BlockSize
+		if offset >= plaintextSize {
+			blob.Close()
+			return ioutil.NopCloser(bytes.NewReader(nil)), plaintextSize, nil
+		}
+		// The counter of every block is the IV plus the block's number
+		firstBlock := offset / aes.BlockSize
+		if err := reopen(aes.BlockSize + firstBlock*aes.BlockSize); err != nil {
+			return nil, 0, err
+		}
+		block, err := aes.NewCipher(blobCipher.legacyCipher.Key())
+		if err != nil {
+			blob.Close()
+			return nil, 0, err
+		}
+		plaintext = cipher.StreamReader{S: cipher.NewCTR(block, addToCounter(header, uint64(firstBlock))), R: blob}
+		skip = offset - firstBlock*aes.BlockSize
+	} else {
+		aead, chunkSize, size, err := blobCipher.chunkedLayout(header, ciphertextSize)
+		if err != nil {
+			blob.Close()
+			return nil, 0, err
+		}
+		plaintextSize = size
+		if offset >= plaintextSize {
+			blob.Close()
+			return ioutil.NopCloser(bytes.NewReader(nil)), plaintextSize, nil
+		}
+		firstChunk := offset / chunkSize
+		sealedChunkSize := chunkSize + int64(aead.Overhead())
+		if err := reopen(blobHeaderSize + firstChunk*sealedChunkSize); err != nil {
+			return nil, 0, err
+		}
+		plaintext = &gcmDecryptReader{
+			aead:    aead,
+			header:  header,
+			source:  bufio.NewReader(blob),
+			sealed:  make([]byte, sealedBufferSize(sealedChunkSize, ciphertextSize-blobHeaderSize-firstChunk*sealedChunkSize)),
+			counter: uint32(firstChunk),
+		}
+		skip = offset - firstChunk*chunkSize
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, plaintext, skip); err != nil {
+		blob.Close()
+		return nil, 0, err
+	}
+	return blobPlaintext{Reader: plaintext, Closer: blob}, plaintextSize, nil
+}
+
+func readBlobHeader(ciphertext io.Reader) ([]byte, error) {
+	header := make([]byte, blobHeaderSize)
+	if _, err := io.ReadFull(ciphertext, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, CiphertextTooShortError
+		}
+		return nil, err
+	}
+	return header, nil
+}
+
+// chunkedLayout tells the AEAD, the chunk size and the plaintext size of a GCM blob
+func (blobCipher BlobCipherImpl) chunkedLayout(header []byte, ciphertextSize int64) (cipher.AEAD, int64, int64, error) {
+	var aead cipher.AEAD
+	switch BlobFormat(header) {
+	case BlobFormatGCMChunked:
+		aead = blobCipher.masterAead
+	case BlobFormatGCMChunkedDataKey:
+		if blobCipher.dataAead == nil {
+			return nil, 0, 0, MissingDataKeyError
+		}
+		aead = blobCipher.dataAead
+	default:
+		return nil, 0, 0, UnknownBlobFormatError
+	}
+	chunkSize := int64(binary.BigEndian.Uint32(header[5:9]))
+	if chunkSize == 0 || chunkSize > maxBlobChunkSize {
+		return nil, 0, 0, IntegrityError
+	}
+	overhead := int64(aead.Overhead())
+	body := ciphertextSize - blobHeaderSize
+	// Even the empty blobs have a sealed chunk
+	if body < overhead {
+		return nil, 0, 0, IntegrityError
+	}
+	chunks := body / (chunkSize + overhead)
+	if remainder := body % (chunkSize + overhead); remainder != 0 {
+		if remainder < overhead {
+			return nil, 0, 0, IntegrityError
+		}
+		chunks++
+	}
+	return aead, chunkSize, body - chunks*overhead, nil
+}
+
+// sealedBufferSize is the size of the buffer for the sealed chunks, which needs no more than what's left of the body
+// when the blob is shorter than a chunk
+func sealedBufferSize(sealedChunkSize int64, bodyLeft int64) int64 {
+	if bodyLeft < sealedChunkSize {
+		return bodyLeft
+	}
+	return sealedChunkSize
+}
+
+// addToCounter returns the big endian counter plus n, as AES-CTR increments it
+func addToCounter(counter []byte, n uint64) []byte {
+	result := make([]byte, len(counter))
+	copy(result, counter)
+	for i := len(result) - 1; i >= 0 && n > 0; i-- {
+		sum := uint64(result[i]) + n&0xff
+		result[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+	return result
+}
+
+// BlobFormat tells the format of the blob that starts with the given header, of which only the first
+// BlobFormatLength bytes are needed
+func BlobFormat(header []byte) byte {
+	if len(header) < BlobFormatLength || !bytes.Equal(header[:len(blobMagic)], []byte(blobMagic)) {
+		return BlobFormatLegacyCTR
+	}
+	return header[len(blobMagic)]
+}
+
+func chunkNonce(header []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, blobNoncePrefixSize+5)
+	copy(nonce, header[blobHeaderSize-blobNoncePrefixSize:])
+	binary.BigEndian.PutUint32(nonce[blobNoncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func (reader *gcmEncryptReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		if err := reader.sealNextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+func (reader *gcmEncryptReader) sealNextChunk() error {
+	n, err := io.ReadFull(reader.source, reader.chunk)
+	last := false
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	case nil:
+		// Only the chunk followed by nothing is the last one
+		if _, err := reader.source.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	nonce := chunkNonce(reader.header, reader.counter, last)
+	reader.pending = reader.aead.Seal(nil, nonce, reader.chunk[:n], reader.header)
+	reader.counter++
+	reader.done = last
+	return nil
+}
+
+func (reader *gcmDecryptReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		if err := reader.openNextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+func (reader *gcmDecryptReader) openNextChunk() error {
+	n, err := io.ReadFull(reader.source, reader.sealed)
+	last := false
+	switch err {
+	case io.EOF:
+		// The last chunk never came: the blob has been truncated
+		return IntegrityError
+	case io.ErrUnexpectedEOF:
+		last = true
+	case nil:
+		if _, err := reader.source.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	nonce := chunkNonce(reader.header, reader.counter, last)
+	plaintext, err := reader.aead.Open(nil, nonce, reader.sealed[:n], reader.header)
+	if err != nil {
+		return IntegrityError
+	}
+	reader.pending = plaintext
+	reader.counter++
+	reader.done = last
+	return nil
+}
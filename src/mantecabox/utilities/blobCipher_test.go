@@ -0,0 +1,321 @@
+package utilities
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBlobChunkSize = 64
+
+var testBlobCipher = newBlobCipherWithChunkSize("this is an AES cipher in GCM mode key", testBlobChunkSize)
+
+func encryptTestBlob(t *testing.T, plaintext []byte) []byte {
+	encrypted, err := ioutil.ReadAll(testBlobCipher.EncryptReader(bytes.NewReader(plaintext)))
+	require.NoError(t, err)
+	require.Equal(t, testBlobCipher.EncryptedSize(int64(len(plaintext))), int64(len(encrypted)))
+	return encrypted
+}
+
+func decryptTestBlob(blob []byte) ([]byte, int64, error) {
+	reader, size, err := testBlobCipher.OpenBlob(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		return nil, size, err
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	return decrypted, size, err
+}
+
+func TestBlobCipher_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name string
+		size int
+	}{
+		{"When the content is empty", 0},
+		{"When the content is shorter than a chunk", testBlobChunkSize - 1},
+		{"When the content is exactly a chunk", testBlobChunkSize},
+		{"When the content is a bit longer than a chunk", testBlobChunkSize + 1},
+		{"When the content is exactly some chunks", testBlobChunkSize * 3},
+		{"When the content is some chunks and a half", testBlobChunkSize*3 + testBlobChunkSize/2},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			plaintext := bytes.Repeat([]byte{'m'}, testCase.size)
+			decrypted, size, err := decryptTestBlob(encryptTestBlob(t, plaintext))
+			require.NoError(t, err)
+			require.Equal(t, int64(testCase.size), size)
+			require.Equal(t, plaintext, append([]byte{}, decrypted...))
+		})
+	}
+}
+
+func TestBlobCipher_Tampering(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("Mantecabox"), 30)
+	blob := encryptTestBlob(t, plaintext)
+	testCases := []struct {
+		name   string
+		tamper func(blob []byte) []byte
+	}{
+		{
+			"When a byte of the header's nonce is changed",
+			func(blob []byte) []byte {
+				blob[blobHeaderSize-1] ^= 1
+				return blob
+			},
+		},
+		{
+			"When a byte of the first chunk is changed",
+			func(blob []byte) []byte {
+				blob[blobHeaderSize] ^= 1
+				return blob
+			},
+		},
+		{
+			"When a byte of the last chunk is changed",
+			func(blob []byte) []byte {
+				blob[len(blob)-1] ^= 1
+				return blob
+			},
+		},
+		{
+			"When the last chunk is removed",
+			func(blob []byte) []byte {
+				return blob[:blobHeaderSize+2*(testBlobChunkSize+16)]
+			},
+		},
+		{
+			"When two chunks are swapped",
+			func(blob []byte) []byte {
+				sealedSize := testBlobChunkSize + 16
+				first := append([]byte{}, blob[blobHeaderSize:blobHeaderSize+sealedSize]...)
+				copy(blob[blobHeaderSize:], blob[blobHeaderSize+sealedSize:blobHeaderSize+2*sealedSize])
+				copy(blob[blobHeaderSize+sealedSize:], first)
+				return blob
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tampered := testCase.tamper(append([]byte{}, blob...))
+			_, _, err := decryptTestBlob(tampered)
+			require.Equal(t, IntegrityError, err)
+		})
+	}
+}
+
+func TestBlobCipher_ForgedChunkSize(t *testing.T) {
+	blob := encryptTestBlob(t, bytes.Repeat([]byte("Mantecabox"), 30))
+	testCases := []struct {
+		name      string
+		chunkSize uint32
+	}{
+		{"When the chunk size is zero", 0},
+		{"When the chunk size is huge", 0xFFFFFFFF},
+		{"When the chunk size is over the maximum", maxBlobChunkSize + 1},
+		{"When the chunk size is larger than the body", testBlobChunkSize * 100},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			forged := append([]byte{}, blob...)
+			binary.BigEndian.PutUint32(forged[5:9], testCase.chunkSize)
+			_, _, err := decryptTestBlob(forged)
+			require.Equal(t, IntegrityError, err)
+			_, _, err = testBlobCipher.OpenBlobAt(func(offset int64) (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(forged[offset:])), nil
+			}, int64(len(forged)), testBlobChunkSize)
+			require.Equal(t, IntegrityError, err)
+		})
+	}
+}
+
+func TestBlobCipher_LegacyBlobs(t *testing.T) {
+	plaintext := []byte("Fichero inventado de Mantecabox")
+	legacyBlob := NewAesCTRCipher("this is an AES cipher in GCM mode key").Encrypt(plaintext)
+	decrypted, size, err := decryptTestBlob(legacyBlob)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(plaintext)), size)
+	require.Equal(t, plaintext, decrypted)
+}
+
+func TestBlobCipher_WithoutLegacy(t *testing.T) {
+	plaintext := []byte("Fichero inventado de Mantecabox")
+	legacyBlob := NewAesCTRCipher("this is an AES cipher in GCM mode key").Encrypt(append([]byte{}, plaintext...))
+	// Overwriting the header of a GCM blob would make it a legacy one
+	strippedBlob := encryptTestBlob(t, plaintext)
+	copy(strippedBlob, "XXXXX")
+	_, _, err := decryptTestBlob(strippedBlob)
+	require.NoError(t, err)
+
+	strictCipher := testBlobCipher.WithoutLegacy()
+	for _, blob := range [][]byte{legacyBlob, strippedBlob} {
+		_, _, err := strictCipher.OpenBlob(bytes.NewReader(blob), int64(len(blob)))
+		require.Equal(t, UnknownBlobFormatError, err)
+		_, _, err = strictCipher.OpenBlobAt(func(offset int64) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(blob[offset:])), nil
+		}, int64(len(blob)), 0)
+		require.Equal(t, UnknownBlobFormatError, err)
+	}
+
+	// The GCM blobs are still opened
+	blob := encryptTestBlob(t, plaintext)
+	decrypted, size, err := strictCipher.OpenBlob(bytes.NewReader(blob), int64(len(blob)))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(plaintext)), size)
+	content, err := ioutil.ReadAll(decrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, content)
+}
+
+func TestBlobCipher_UnknownFormat(t *testing.T) {
+	blob := encryptTestBlob(t, []byte("Mantecabox"))
+	blob[4] = 42
+	_, _, err := decryptTestBlob(blob)
+	require.Equal(t, UnknownBlobFormatError, err)
+}
+
+func TestBlobCipher_TooShort(t *testing.T) {
+	_, _, err := decryptTestBlob([]byte("short"))
+	require.Equal(t, CiphertextTooShortError, err)
+}
+
+func TestBlobCipher_DataKey(t *testing.T) {
+	dataKey, _ := NewKeyWrapper("this is the master key of Mantecabox").GenerateDataKey()
+	dataKeyCipher, err := testBlobCipher.WithDataKey(dataKey)
+	require.NoError(t, err)
+
+	plaintext := bytes.Repeat([]byte("Mantecabox"), 30)
+	blob, err := ioutil.ReadAll(dataKeyCipher.EncryptReader(bytes.NewReader(plaintext)))
+	require.NoError(t, err)
+	require.Equal(t, dataKeyCipher.EncryptedSize(int64(len(plaintext))), int64(len(blob)))
+	require.Equal(t, byte(BlobFormatGCMChunkedDataKey), blob[4])
+
+	reader, _, err := dataKeyCipher.OpenBlob(bytes.NewReader(blob), int64(len(blob)))
+	require.NoError(t, err)
+	decrypted, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	// The blobs encrypted with the master key can still be read
+	masterKeyBlob := encryptTestBlob(t, plaintext)
+	reader, _, err = dataKeyCipher.OpenBlob(bytes.NewReader(masterKeyBlob), int64(len(masterKeyBlob)))
+	require.NoError(t, err)
+	decrypted, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	// But the ones encrypted with a data key can't be read without it
+	_, _, err = decryptTestBlob(blob)
+	require.Equal(t, MissingDataKeyError, err)
+
+	otherDataKey, _ := NewKeyWrapper("this is the master key of Mantecabox").GenerateDataKey()
+	otherDataKeyCipher, err := testBlobCipher.WithDataKey(otherDataKey)
+	require.NoError(t, err)
+	reader, _, err = otherDataKeyCipher.OpenBlob(bytes.NewReader(blob), int64(len(blob)))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.Equal(t, IntegrityError, err)
+}
+
+func TestBlobCipher_OpenBlobAt(t *testing.T) {
+	plaintext := make([]byte, 5*testBlobChunkSize+10)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+	dataKey, _ := NewKeyWrapper("this is the master key of Mantecabox").GenerateDataKey()
+	dataKeyCipher, err := testBlobCipher.WithDataKey(dataKey)
+	require.NoError(t, err)
+	dataKeyBlob, err := ioutil.ReadAll(dataKeyCipher.EncryptReader(bytes.NewReader(plaintext)))
+	require.NoError(t, err)
+	// The legacy IV is chosen so that its counter overflows its last byte
+	legacyBlob := NewAesCTRCipher("this is an AES cipher in GCM mode key").Encrypt(plaintext)
+	legacyBlob[15] = 0xfe
+	legacyPlaintext := NewAesCTRCipher("this is an AES cipher in GCM mode key").Decrypt(append([]byte{}, legacyBlob...))
+
+	blobs := []struct {
+		name      string
+		blob      []byte
+		plaintext []byte
+	}{
+		{"legacy blob", legacyBlob, legacyPlaintext},
+		{"master key blob", encryptTestBlob(t, plaintext), plaintext},
+		{"data key blob", dataKeyBlob, plaintext},
+	}
+	offsets := []int64{0, 1, 15, 16, testBlobChunkSize, testBlobChunkSize + 3, 4*testBlobChunkSize + 63, 5 * testBlobChunkSize, int64(len(plaintext)) - 1, int64(len(plaintext)), int64(len(plaintext)) + 100}
+	for _, blob := range blobs {
+		for _, offset := range offsets {
+			t.Run(fmt.Sprintf("When reading a %v from %v", blob.name, offset), func(t *testing.T) {
+				var opened []int64
+				open := func(blobOffset int64) (io.ReadCloser, error) {
+					opened = append(opened, blobOffset)
+					return ioutil.NopCloser(bytes.NewReader(blob.blob[blobOffset:])), nil
+				}
+				reader, size, err := dataKeyCipher.OpenBlobAt(open, int64(len(blob.blob)), offset)
+				require.NoError(t, err)
+				require.Equal(t, int64(len(plaintext)), size)
+				got, err := ioutil.ReadAll(reader)
+				require.NoError(t, err)
+				require.NoError(t, reader.Close())
+				want := []byte{}
+				if offset < int64(len(plaintext)) {
+					want = blob.plaintext[offset:]
+				}
+				require.Equal(t, want, got)
+				// The blob is read from the start for the header, and then from the chunk or block where the offset is
+				require.Equal(t, int64(0), opened[0])
+				if offset >= testBlobChunkSize && offset < int64(len(plaintext)) {
+					require.Len(t, opened, 2)
+					require.True(t, opened[1] > blobHeaderSize)
+				}
+			})
+		}
+	}
+}
+
+func TestAddToCounter(t *testing.T) {
+	require.Equal(t, []byte{0, 0, 1, 0}, addToCounter([]byte{0, 0, 0, 0xff}, 1))
+	require.Equal(t, []byte{0, 1, 0, 0x01}, addToCounter([]byte{0, 0, 0xff, 0xff}, 2))
+	require.Equal(t, []byte{0, 0, 0x12, 0x34}, addToCounter([]byte{0, 0, 0, 0}, 0x1234))
+}
+
+func TestBlobCipher_NewContentHash(t *testing.T) {
+	keyWrapper := NewKeyWrapper("this is the master key of Mantecabox")
+	dataKey, _ := keyWrapper.GenerateDataKey()
+	otherDataKey, _ := keyWrapper.GenerateDataKey()
+	dataKeyCipher, err := testBlobCipher.WithDataKey(dataKey)
+	require.NoError(t, err)
+	otherDataKeyCipher, err := testBlobCipher.WithDataKey(otherDataKey)
+	require.NoError(t, err)
+	contentHash := func(blobCipher BlobCipher, content string) []byte {
+		hash := blobCipher.NewContentHash()
+		hash.Write([]byte(content))
+		return hash.Sum(nil)
+	}
+
+	require.Equal(t, contentHash(dataKeyCipher, "Mantecabox"), contentHash(dataKeyCipher, "Mantecabox"))
+	require.NotEqual(t, contentHash(dataKeyCipher, "Mantecabox"), contentHash(dataKeyCipher, "Mantecabox!"))
+	require.NotEqual(t, contentHash(dataKeyCipher, "Mantecabox"), contentHash(otherDataKeyCipher, "Mantecabox"))
+	require.NotEqual(t, contentHash(dataKeyCipher, "Mantecabox"), contentHash(testBlobCipher, "Mantecabox"))
+}
+
+func TestBlobCipher_ChunkHash(t *testing.T) {
+	dataKey, _ := NewKeyWrapper("this is the master key of Mantecabox").GenerateDataKey()
+	dataKeyCipher, err := testBlobCipher.WithDataKey(dataKey)
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("Mantecabox"))
+
+	require.Equal(t, dataKeyCipher.ChunkHash(digest[:]), dataKeyCipher.ChunkHash(digest[:]))
+	require.Len(t, dataKeyCipher.ChunkHash(digest[:]), 64)
+	require.NotEqual(t, testBlobCipher.ChunkHash(digest[:]), dataKeyCipher.ChunkHash(digest[:]))
+
+	// A file whose content is a chunk's digest doesn't get the chunk's hash
+	contentHash := dataKeyCipher.NewContentHash()
+	contentHash.Write(digest[:])
+	require.NotEqual(t, hex.EncodeToString(contentHash.Sum(nil)), dataKeyCipher.ChunkHash(digest[:]))
+}
@@ -0,0 +1,70 @@
+package utilities
+
+import (
+	"bufio"
+	"io"
+)
+
+// The chunks' boundaries are chosen by their content (content-defined chunking), so inserting or removing some bytes
+// only changes the chunks around them, and the rest of the file can still be deduplicated.
+const (
+	MinChunkSize     = 512 * 1024
+	AverageChunkSize = 1024 * 1024
+	MaxChunkSize     = 4 * 1024 * 1024
+	// A boundary is found when the top 20 bits of the fingerprint are 0, which happens every 2^20 bytes on average
+	chunkBoundaryMask = uint64(AverageChunkSize-1) << 44
+)
+
+// gearTable holds a pseudo-random number for every byte value. It must never change, or the same content would be
+// split in different chunks.
+var gearTable = newGearTable()
+
+type Chunker struct {
+	reader *bufio.Reader
+	buffer []byte
+}
+
+func NewChunker(reader io.Reader) *Chunker {
+	return &Chunker{
+		reader: bufio.NewReaderSize(reader, 64*1024),
+		buffer: make([]byte, 0, MaxChunkSize),
+	}
+}
+
+// Next returns the next chunk, or io.EOF when there are no more. The returned slice is only valid until the next call.
+func (chunker *Chunker) Next() ([]byte, error) {
+	chunk := chunker.buffer[:0]
+	var fingerprint uint64
+	for {
+		b, err := chunker.reader.ReadByte()
+		if err == io.EOF {
+			if len(chunk) == 0 {
+				return nil, io.EOF
+			}
+			return chunk, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunk = append(chunk, b)
+		// Gear rolling hash: the bytes older than 64 positions are shifted out of the fingerprint
+		fingerprint = (fingerprint << 1) + gearTable[b]
+		if (len(chunk) >= MinChunkSize && fingerprint&chunkBoundaryMask == 0) || len(chunk) >= MaxChunkSize {
+			return chunk, nil
+		}
+	}
+}
+
+// newGearTable fills the table with SplitMix64, seeded with a constant
+func newGearTable() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x6d616e7465636162) // "mantecab"
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
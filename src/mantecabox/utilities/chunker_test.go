@@ -0,0 +1,70 @@
+package utilities
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func chunkHashes(t *testing.T, content []byte) [][sha256.Size]byte {
+	chunker := NewChunker(bytes.NewReader(content))
+	hashes := make([][sha256.Size]byte, 0)
+	total := 0
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.True(t, len(chunk) <= MaxChunkSize)
+		total += len(chunk)
+		hashes = append(hashes, sha256.Sum256(chunk))
+	}
+	require.Equal(t, len(content), total)
+	return hashes
+}
+
+func TestChunker(t *testing.T) {
+	content := make([]byte, 16*1024*1024)
+	rand.New(rand.NewSource(42)).Read(content)
+
+	hashes := chunkHashes(t, content)
+	require.True(t, len(hashes) > 4)
+	require.Equal(t, hashes, chunkHashes(t, content))
+
+	// Inserting some bytes at the beginning only changes the first chunk
+	edited := append([]byte("Mantecabox"), content...)
+	editedHashes := chunkHashes(t, edited)
+	require.Equal(t, hashes[1:], editedHashes[1:])
+}
+
+func TestChunker_Limits(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content []byte
+		want    []int
+	}{
+		{"When the content is empty, there are no chunks", []byte{}, []int{}},
+		{"When the content is shorter than the minimum, there is one chunk", make([]byte, 1000), []int{1000}},
+		{"When the content never has a boundary, it's cut at the maximum", make([]byte, MaxChunkSize+1000), []int{MaxChunkSize, 1000}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			chunker := NewChunker(bytes.NewReader(testCase.content))
+			got := make([]int, 0)
+			for {
+				chunk, err := chunker.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, len(chunk))
+			}
+			require.Equal(t, testCase.want, got)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package utilities
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The codecs the content can be compressed with before it's encrypted. The content stored before the compression
+// existed has no codec.
+const (
+	NoCompression   = ""
+	GzipCompression = "gzip"
+	ZstdCompression = "zstd"
+)
+
+var UnknownCompressionError = errors.New("unknown compression codec")
+
+// incompressibleContentTypes are the types detected by http.DetectContentType whose content is already compressed, so
+// compressing it again would only waste time
+var incompressibleContentTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"video/",
+	"audio/mpeg",
+	"audio/aiff",
+	"application/ogg",
+	"application/zip",
+	"application/x-gzip",
+	"application/x-rar-compressed",
+	"application/pdf",
+	"application/wasm",
+	"font/woff",
+	"font/woff2",
+}
+
+func ValidateCompression(codec string) error {
+	switch codec {
+	case NoCompression, GzipCompression, ZstdCompression:
+		return nil
+	}
+	return UnknownCompressionError
+}
+
+// IsCompressible guesses from the first bytes of the content whether it's worth compressing it
+func IsCompressible(sniffed []byte) bool {
+	contentType := http.DetectContentType(sniffed)
+	for _, incompressible := range incompressibleContentTypes {
+		if strings.HasPrefix(contentType, incompressible) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCompressWriter compresses what is written to it into compressed. The level is the codec's own one, with 0 meaning
+// its default. It must be closed to flush the compressed content.
+func NewCompressWriter(codec string, level int, compressed io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case GzipCompression:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(compressed, level)
+	case ZstdCompression:
+		encoderLevel := zstd.SpeedDefault
+		if level != 0 {
+			encoderLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		return zstd.NewWriter(compressed, zstd.WithEncoderLevel(encoderLevel))
+	}
+	return nil, UnknownCompressionError
+}
+
+// NewDecompressReader decompresses the content compressed with the codec. Closing it doesn't close compressed.
+func NewDecompressReader(codec string, compressed io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case GzipCompression:
+		return gzip.NewReader(compressed)
+	case ZstdCompression:
+		decoder, err := zstd.NewReader(compressed)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, UnknownCompressionError
+}
@@ -0,0 +1,74 @@
+package utilities
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression_RoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte("INSERT INTO files (name, owner) VALUES ('report.pdf', 'mantecabox');\n"), 1000)
+	testCases := []struct {
+		name  string
+		codec string
+		level int
+	}{
+		{"When compressing with gzip's default level", GzipCompression, 0},
+		{"When compressing with gzip's best level", GzipCompression, gzip.BestCompression},
+		{"When compressing with zstd's default level", ZstdCompression, 0},
+		{"When compressing with zstd's best level", ZstdCompression, 19},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			writer, err := NewCompressWriter(testCase.codec, testCase.level, &compressed)
+			require.NoError(t, err)
+			_, err = writer.Write(content)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+			require.True(t, compressed.Len() < len(content)/10)
+
+			reader, err := NewDecompressReader(testCase.codec, &compressed)
+			require.NoError(t, err)
+			decompressed, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.Equal(t, content, decompressed)
+		})
+	}
+}
+
+func TestCompression_UnknownCodec(t *testing.T) {
+	require.Equal(t, UnknownCompressionError, ValidateCompression("lz4"))
+	require.NoError(t, ValidateCompression(NoCompression))
+	_, err := NewCompressWriter("lz4", 0, &bytes.Buffer{})
+	require.Equal(t, UnknownCompressionError, err)
+	_, err = NewDecompressReader("lz4", &bytes.Buffer{})
+	require.Equal(t, UnknownCompressionError, err)
+}
+
+func TestIsCompressible(t *testing.T) {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write([]byte("mantecabox"))
+	writer.Close()
+	testCases := []struct {
+		name    string
+		sniffed []byte
+		want    bool
+	}{
+		{"When the content is text, compress it", []byte("2018-07-12 10:00:00 INFO server started\n"), true},
+		{"When the content is empty, compress it", []byte{}, true},
+		{"When the content is gzipped, don't compress it", gzipped.Bytes(), false},
+		{"When the content is a PNG image, don't compress it", []byte("\x89PNG\x0D\x0A\x1A\x0A"), false},
+		{"When the content is a ZIP file, don't compress it", []byte("PK\x03\x04"), false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.want, IsCompressible(testCase.sniffed))
+		})
+	}
+}
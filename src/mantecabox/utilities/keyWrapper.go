@@ -0,0 +1,78 @@
+package utilities
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+const (
+	DataKeySize = 32
+	// keyWrappingLabel separates the key that wraps the data keys from the one that encrypts the legacy blobs
+	keyWrappingLabel = "mantecabox key wrapping:"
+	fingerprintLabel = "mantecabox key fingerprint:"
+)
+
+var InvalidWrappedKeyError = errors.New("unable to unwrap the data key")
+
+type (
+	// KeyWrapper encrypts the data keys with the master key (envelope encryption), so only the wrapped ones are stored
+	KeyWrapper interface {
+		GenerateDataKey() (dataKey []byte, wrappedKey []byte)
+		Wrap(dataKey []byte) []byte
+		Unwrap(wrappedKey []byte) ([]byte, error)
+	}
+
+	KeyWrapperImpl struct {
+		aead cipher.AEAD
+	}
+)
+
+func NewKeyWrapper(masterKey string) KeyWrapper {
+	derivedKey := sha256.Sum256([]byte(keyWrappingLabel + masterKey))
+	aead, err := newGCM(derivedKey[:])
+	if err != nil {
+		panic(err.Error())
+	}
+	return KeyWrapperImpl{
+		aead: aead,
+	}
+}
+
+func (keyWrapper KeyWrapperImpl) GenerateDataKey() ([]byte, []byte) {
+	dataKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		panic("unable to create data key: " + err.Error())
+	}
+	return dataKey, keyWrapper.Wrap(dataKey)
+}
+
+// Wrap returns the nonce followed by the sealed data key
+func (keyWrapper KeyWrapperImpl) Wrap(dataKey []byte) []byte {
+	nonce := make([]byte, keyWrapper.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic("unable to create data key's nonce: " + err.Error())
+	}
+	return keyWrapper.aead.Seal(nonce, nonce, dataKey, nil)
+}
+
+func (keyWrapper KeyWrapperImpl) Unwrap(wrappedKey []byte) ([]byte, error) {
+	nonceSize := keyWrapper.aead.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return nil, InvalidWrappedKeyError
+	}
+	dataKey, err := keyWrapper.aead.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], nil)
+	if err != nil {
+		return nil, InvalidWrappedKeyError
+	}
+	return dataKey, nil
+}
+
+// KeyFingerprint identifies a master key without revealing it
+func KeyFingerprint(masterKey string) string {
+	fingerprint := sha256.Sum256([]byte(fingerprintLabel + masterKey))
+	return hex.EncodeToString(fingerprint[:])
+}
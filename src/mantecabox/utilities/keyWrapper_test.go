@@ -0,0 +1,44 @@
+package utilities
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyWrapper(t *testing.T) {
+	keyWrapper := NewKeyWrapper("this is the master key of Mantecabox")
+	dataKey, wrappedKey := keyWrapper.GenerateDataKey()
+	require.Len(t, dataKey, DataKeySize)
+	require.NotContains(t, string(wrappedKey), string(dataKey))
+
+	unwrappedKey, err := keyWrapper.Unwrap(wrappedKey)
+	require.NoError(t, err)
+	require.Equal(t, dataKey, unwrappedKey)
+
+	otherDataKey, _ := keyWrapper.GenerateDataKey()
+	require.NotEqual(t, dataKey, otherDataKey)
+}
+
+func TestKeyWrapper_Unwrap(t *testing.T) {
+	keyWrapper := NewKeyWrapper("this is the master key of Mantecabox")
+	_, wrappedKey := keyWrapper.GenerateDataKey()
+	tamperedKey := append([]byte{}, wrappedKey...)
+	tamperedKey[len(tamperedKey)-1] ^= 1
+
+	testCases := []struct {
+		name       string
+		keyWrapper KeyWrapper
+		wrappedKey []byte
+	}{
+		{"When the wrapped key is too short", keyWrapper, []byte("short")},
+		{"When the wrapped key has been tampered", keyWrapper, tamperedKey},
+		{"When the master key is not the same", NewKeyWrapper("this is another master key"), wrappedKey},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := testCase.keyWrapper.Unwrap(testCase.wrappedKey)
+			require.Equal(t, InvalidWrappedKeyError, err)
+		})
+	}
+}
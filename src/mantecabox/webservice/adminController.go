@@ -0,0 +1,230 @@
+package webservice
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// AdminController serves the maintenance and user management endpoints, which only the admins can reach
+	AdminController interface {
+		AdminMiddleware() gin.HandlerFunc
+		GetScrubReport(context *gin.Context)
+		GetUsers(context *gin.Context)
+		GetUser(context *gin.Context)
+		SetRole(context *gin.Context)
+		DisableUser(context *gin.Context)
+		EnableUser(context *gin.Context)
+		DeleteUser(context *gin.Context)
+		Reset2FA(context *gin.Context)
+		GetLoginAttempts(context *gin.Context)
+		ForceLogout(context *gin.Context)
+	}
+
+	AdminControllerImpl struct {
+		configuration       *models.Configuration
+		scrubService        services.ScrubService
+		userService         services.UserService
+		loginAttemptService services.LoginAttemptService
+	}
+
+	// RoleChange is the body of the requests that change the role of a user
+	RoleChange struct {
+		Role string `json:"role" binding:"required"`
+	}
+)
+
+var SelfManagementError = errors.New("admins can't disable, delete or demote themselves")
+
+func NewAdminController(configuration *models.Configuration) AdminController {
+	scrubService := services.NewScrubService(configuration)
+	userService := services.NewUserService(configuration)
+	loginAttemptService := services.NewLoginAttemptService(configuration)
+	if scrubService == nil || userService == nil || loginAttemptService == nil {
+		return nil
+	}
+	return AdminControllerImpl{
+		configuration:       configuration,
+		scrubService:        scrubService,
+		userService:         userService,
+		loginAttemptService: loginAttemptService,
+	}
+}
+
+// AdminMiddleware rejects the users that aren't admins, according to the role of their token. It must run after the
+// authentication one.
+func (adminController AdminControllerImpl) AdminMiddleware() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if jwt.ExtractClaims(context)["role"] == models.UserRoleAdmin {
+			context.Next()
+			return
+		}
+		email := getUser(context).Email
+		sendJsonMsg(context, http.StatusForbidden, "Only admins can access this resource")
+		logs.ControllerLog.Warnf("User %v tried to access %v without being admin", email, context.Request.URL.Path)
+	}
+}
+
+// GetScrubReport returns the report of the last scrub of the stored blobs
+func (adminController AdminControllerImpl) GetScrubReport(context *gin.Context) {
+	report, err := adminController.scrubService.GetLastReport()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "The blobs haven't been scrubbed yet")
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve scrub report: "+err.Error())
+		}
+		logs.ControllerLog.Error("Unable to retrieve scrub report: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, report)
+}
+
+func (adminController AdminControllerImpl) GetUsers(context *gin.Context) {
+	users, err := adminController.userService.GetUsers()
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve users: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve users: " + err.Error())
+		return
+	}
+	dtos := make([]models.UserDetailsDto, 0, len(users))
+	for _, user := range users {
+		dtos = append(dtos, models.UserToDetailsDto(user))
+	}
+	context.JSON(http.StatusOK, dtos)
+}
+
+func (adminController AdminControllerImpl) GetUser(context *gin.Context) {
+	email := context.Param("email")
+	user, err := adminController.userService.GetUser(email)
+	if err != nil {
+		sendUserError(context, email, "Unable to retrieve user", err)
+		return
+	}
+	context.JSON(http.StatusOK, models.UserToDetailsDto(user))
+}
+
+// SetRole makes the user of the route an admin or a regular user. Their tokens are revoked, so they must log in again.
+func (adminController AdminControllerImpl) SetRole(context *gin.Context) {
+	var change RoleChange
+	if err := context.ShouldBindJSON(&change); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse role: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse role: " + err.Error())
+		return
+	}
+	email := context.Param("email")
+	if change.Role != models.UserRoleAdmin && adminController.isSelf(context, email) {
+		return
+	}
+	user, err := adminController.userService.SetRole(email, change.Role)
+	if err != nil {
+		sendUserError(context, email, "Unable to change role", err)
+		return
+	}
+	context.JSON(http.StatusOK, models.UserToDetailsDto(user))
+}
+
+// DisableUser keeps the user of the route from logging in and from using the tokens that they already have
+func (adminController AdminControllerImpl) DisableUser(context *gin.Context) {
+	adminController.setDisabled(context, true)
+}
+
+func (adminController AdminControllerImpl) EnableUser(context *gin.Context) {
+	adminController.setDisabled(context, false)
+}
+
+func (adminController AdminControllerImpl) setDisabled(context *gin.Context, disabled bool) {
+	email := context.Param("email")
+	if disabled && adminController.isSelf(context, email) {
+		return
+	}
+	user, err := adminController.userService.SetDisabled(email, disabled)
+	if err != nil {
+		sendUserError(context, email, "Unable to change user", err)
+		return
+	}
+	context.JSON(http.StatusOK, models.UserToDetailsDto(user))
+}
+
+func (adminController AdminControllerImpl) DeleteUser(context *gin.Context) {
+	email := context.Param("email")
+	if adminController.isSelf(context, email) {
+		return
+	}
+	if err := adminController.userService.DeleteUser(email); err != nil {
+		sendUserError(context, email, "Unable to delete user", err)
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// Reset2FA discards the verification code of the user of the route, who has to ask for a new one to log in
+func (adminController AdminControllerImpl) Reset2FA(context *gin.Context) {
+	email := context.Param("email")
+	if _, err := adminController.userService.Reset2FA(email); err != nil {
+		sendUserError(context, email, "Unable to reset verification code", err)
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+func (adminController AdminControllerImpl) GetLoginAttempts(context *gin.Context) {
+	email := context.Param("email")
+	if _, err := adminController.userService.GetUser(email); err != nil {
+		sendUserError(context, email, "Unable to retrieve login attempts", err)
+		return
+	}
+	attempts, err := adminController.loginAttemptService.GetLoginAttempts(email)
+	if err != nil {
+		sendUserError(context, email, "Unable to retrieve login attempts", err)
+		return
+	}
+	dtos := make([]models.LoginAttemptDto, 0, len(attempts))
+	for _, attempt := range attempts {
+		dtos = append(dtos, models.LoginAttemptToDto(attempt))
+	}
+	context.JSON(http.StatusOK, dtos)
+}
+
+// ForceLogout revokes the tokens of the user of the route, who must log in again
+func (adminController AdminControllerImpl) ForceLogout(context *gin.Context) {
+	email := context.Param("email")
+	if _, err := adminController.userService.ForceLogout(email); err != nil {
+		sendUserError(context, email, "Unable to log out user", err)
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// isSelf answers the request if the user of the route is the admin that sent it
+func (adminController AdminControllerImpl) isSelf(context *gin.Context, email string) bool {
+	admin := getUser(context).Email
+	if admin != email {
+		return false
+	}
+	sendJsonMsg(context, http.StatusBadRequest, SelfManagementError.Error())
+	logs.ControllerLog.Warnf("Admin %v tried to %v %v on themselves", admin, context.Request.Method, context.Request.URL.Path)
+	return true
+}
+
+// sendUserError answers the requests about a user that failed
+func sendUserError(context *gin.Context, email string, msg string, err error) {
+	switch err {
+	case sql.ErrNoRows:
+		sendJsonMsg(context, http.StatusNotFound, "Unable to find user: "+email)
+	case services.InvalidRoleError:
+		sendJsonMsg(context, http.StatusBadRequest, err.Error())
+	default:
+		sendJsonMsg(context, http.StatusInternalServerError, msg+": "+err.Error())
+	}
+	logs.ControllerLog.Error(fmt.Sprintf("%v %v: %v", msg, email, err))
+}
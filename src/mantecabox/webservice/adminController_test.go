@@ -0,0 +1,144 @@
+package webservice
+
+import (
+	"net/http"
+	"testing"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+
+	"github.com/appleboy/gofight"
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/require"
+)
+
+const adminEmail = "admin@example.com"
+
+func TestNewAdminController(t *testing.T) {
+	type args struct {
+		configuration *models.Configuration
+	}
+	testCases := []struct {
+		name string
+		args args
+		want AdminController
+	}{
+		{
+			name: "When passing the configuration, return the service",
+			args: args{configuration: &models.Configuration{AesKey: "0123456789ABCDEF"}},
+			want: AdminControllerImpl{},
+		},
+		{
+			name: "When passing no configuration, return nil",
+			args: args{configuration: nil},
+			want: nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewAdminController(testCase.args.configuration))
+		})
+	}
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	tests := []subtest{
+		{
+			name: "When an admin deletes a user, delete it",
+			test: func(t *testing.T) {
+				r := gofight.New()
+				r.DELETE("/admin/users/"+testUserEmail).
+					SetDebug(true).
+					SetHeader(gofight.H{
+						headers.Authorization: "Bearer " + loginAs(t, adminEmail, models.UserRoleAdmin),
+					}).
+					Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+						require.Equal(t, http.StatusNoContent, res.Code)
+					})
+			},
+		},
+		{
+			name: "When an admin deletes a group's account, refuse it",
+			test: func(t *testing.T) {
+				_, err := dao.GroupPgDao{}.Create("project")
+				require.NoError(t, err)
+				r := gofight.New()
+				r.DELETE("/admin/users/project").
+					SetDebug(true).
+					SetHeader(gofight.H{
+						headers.Authorization: "Bearer " + loginAs(t, adminEmail, models.UserRoleAdmin),
+					}).
+					Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+						require.Equal(t, http.StatusNotFound, res.Code)
+					})
+				_, err = dao.GroupPgDao{}.Get("project")
+				require.NoError(t, err)
+				_, err = userDao.GetByPk("project")
+				require.NoError(t, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		cleanDb(db)
+		userDao.Create(&models.User{Credentials: models.Credentials{Email: testUserEmail, Password: "testpassword"}})
+		t.Run(tt.name, tt.test)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   gofight.D
+		role   string
+		want   int
+	}{
+		{"When a regular user lists the users, deny it", "GET", "/admin/users", nil, models.UserRoleUser, http.StatusForbidden},
+		{"When a regular user disables a user, deny it", "POST", "/admin/users/" + testUserEmail + "/disable", nil, models.UserRoleUser, http.StatusForbidden},
+		{"When an admin lists the users, list them", "GET", "/admin/users", nil, models.UserRoleAdmin, http.StatusOK},
+		{"When an admin disables a user, disable them", "POST", "/admin/users/" + testUserEmail + "/disable", nil, models.UserRoleAdmin, http.StatusOK},
+		{"When an admin enables a user, enable them", "POST", "/admin/users/" + testUserEmail + "/enable", nil, models.UserRoleAdmin, http.StatusOK},
+		{"When an admin disables themselves, refuse it", "POST", "/admin/users/" + adminEmail + "/disable", nil, models.UserRoleAdmin, http.StatusBadRequest},
+		{"When an admin deletes themselves, refuse it", "DELETE", "/admin/users/" + adminEmail, nil, models.UserRoleAdmin, http.StatusBadRequest},
+		{"When an admin demotes themselves, refuse it", "PUT", "/admin/users/" + adminEmail + "/role", gofight.D{"role": models.UserRoleUser}, models.UserRoleAdmin, http.StatusBadRequest},
+		{"When an admin promotes a user, promote them", "PUT", "/admin/users/" + testUserEmail + "/role", gofight.D{"role": models.UserRoleAdmin}, models.UserRoleAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		cleanDb(db)
+		userDao.Create(&models.User{Credentials: models.Credentials{Email: testUserEmail, Password: "testpassword"}})
+		t.Run(tt.name, func(t *testing.T) {
+			token := loginAs(t, adminEmail, tt.role)
+			r := gofight.New()
+			var request *gofight.RequestConfig
+			switch tt.method {
+			case "GET":
+				request = r.GET(tt.path)
+			case "POST":
+				request = r.POST(tt.path)
+			case "PUT":
+				request = r.PUT(tt.path).SetJSON(tt.body)
+			case "DELETE":
+				request = r.DELETE(tt.path)
+			}
+			request.
+				SetDebug(true).
+				SetHeader(gofight.H{
+					headers.Authorization: "Bearer " + token,
+				}).
+				Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+					require.Equal(t, tt.want, res.Code)
+				})
+			if tt.want == http.StatusBadRequest {
+				admin, err := userDao.GetByPk(adminEmail)
+				require.NoError(t, err)
+				require.Equal(t, models.UserRoleAdmin, admin.Role)
+				require.False(t, admin.DisabledAt.Valid)
+			}
+		})
+	}
+}
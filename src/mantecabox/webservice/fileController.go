@@ -3,8 +3,10 @@ package webservice
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"mantecabox/logs"
 	"mantecabox/models"
@@ -13,6 +15,8 @@ import (
 	"github.com/appleboy/gin-jwt"
 	"github.com/benashford/go-func"
 	"github.com/gin-gonic/gin"
+	"github.com/go-http-utils/headers"
+	"gopkg.in/guregu/null.v3"
 )
 
 type (
@@ -26,12 +30,50 @@ type (
 		download(filename string, file models.File, err error, context *gin.Context)
 		UploadFile(context *gin.Context)
 		DeleteFile(context *gin.Context)
+		PatchFile(context *gin.Context)
+		CopyFile(context *gin.Context)
+		CreateLink(context *gin.Context)
+		RestoreFileVersion(context *gin.Context)
+		GetMissingChunks(context *gin.Context)
+		UploadChunk(context *gin.Context)
+		UploadManifest(context *gin.Context)
+		GetFolderContent(context *gin.Context)
+		CreateFolder(context *gin.Context)
+		DeleteFolder(context *gin.Context)
+		GetPath(context *gin.Context)
+		PostPath(context *gin.Context)
+		PostSharedPath(context *gin.Context)
+		PutPath(context *gin.Context)
+		PatchPath(context *gin.Context)
+		PatchSharedPath(context *gin.Context)
+		DeletePath(context *gin.Context)
+		DeleteSharedPath(context *gin.Context)
+		GetUsage(context *gin.Context)
 	}
 
 	FileControllerImpl struct {
 		configuration *models.Configuration
 		fileService   services.FileService
+		folderService services.FolderService
+		linkService   services.LinkService
 	}
+
+	// filePathKind tells what a path of the /files/*path routes addresses
+	filePathKind int
+)
+
+const (
+	unknownPath filePathKind = iota
+	folderPath
+	filePath
+	downloadPath
+	versionsPath
+	versionPath
+	versionDownloadPath
+	manifestPath
+	copyPath
+	versionRestorePath
+	linksPath
 )
 
 func NewFileController(configuration *models.Configuration) FileController {
@@ -42,6 +84,8 @@ func NewFileController(configuration *models.Configuration) FileController {
 	return FileControllerImpl{
 		configuration: configuration,
 		fileService:   fileService,
+		folderService: services.NewFolderService(configuration),
+		linkService:   services.NewLinkService(configuration),
 	}
 }
 
@@ -58,7 +102,10 @@ func (fileController FileControllerImpl) GetAllFiles(context *gin.Context) {
 
 func (fileController FileControllerImpl) GetAllFileVersions(context *gin.Context) {
 	filename := context.Param("file")
-	user := getUser(context)
+	user, ok := fileController.fileOwner(context, filename, models.ShareAccessRead)
+	if !ok {
+		return
+	}
 	files, err := fileController.fileService.GetFileVersionsByNameAndOwner(filename, &user)
 	if err != nil {
 		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve files: "+err.Error())
@@ -71,7 +118,10 @@ func (fileController FileControllerImpl) GetAllFileVersions(context *gin.Context
 
 func (fileController FileControllerImpl) GetFile(context *gin.Context) {
 	filename := context.Param("file")
-	user := getUser(context)
+	user, ok := fileController.fileOwner(context, filename, models.ShareAccessRead)
+	if !ok {
+		return
+	}
 	file, err := fileController.fileService.GetLastVersionFileByNameAndOwner(filename, &user)
 
 	if err != nil {
@@ -91,7 +141,10 @@ func (fileController FileControllerImpl) GetFile(context *gin.Context) {
 func (fileController FileControllerImpl) GetFileVersion(context *gin.Context) {
 	filename := context.Param("file")
 	versionStr := context.Param("version")
-	user := getUser(context)
+	user, ok := fileController.fileOwner(context, filename, models.ShareAccessRead)
+	if !ok {
+		return
+	}
 	version, err := strconv.ParseInt(versionStr, 10, 64)
 	if err != nil {
 		sendJsonMsg(context, http.StatusInternalServerError, "Unable to parse version number: "+err.Error())
@@ -151,7 +204,10 @@ context.JSON(200, models.FileToDto(file))
 
 func (fileController FileControllerImpl) DownloadFile(context *gin.Context) {
 	filename := context.Param("file")
-	user := getUser(context)
+	user, ok := fileController.fileOwner(context, filename, models.ShareAccessRead)
+	if !ok {
+		return
+	}
 
 	file, err := fileController.fileService.GetLastVersionFileByNameAndOwner(filename, &user)
 	fileController.download(filename, file, err, context)
@@ -160,7 +216,10 @@ func (fileController FileControllerImpl) DownloadFile(context *gin.Context) {
 func (fileController FileControllerImpl) DownloadFileVersion(context *gin.Context) {
 	filename := context.Param("file")
 	versionStr := context.Param("version")
-	user := getUser(context)
+	user, ok := fileController.fileOwner(context, filename, models.ShareAccessRead)
+	if !ok {
+		return
+	}
 	version, err := strconv.ParseInt(versionStr, 10, 64)
 	if err != nil {
 		sendJsonMsg(context, http.StatusInternalServerError, "Unable to parse version number: "+err.Error())
@@ -185,28 +244,36 @@ func (fileController FileControllerImpl) download(filename string, file models.F
 		}
 	}
 
-	var fileDecrypt []byte
-	if fileController.configuration.UseGDrive {
-		fileDecrypt, err = fileController.fileService.GetFileGDrive(file)
-	} else {
-		fileDecrypt, err = fileController.fileService.GetDecryptedLocalFile(file)
-	}
-
+	_, contentType, reader, extraHeaders, err := fileController.fileService.GetFileStream(file)
 	if err != nil {
 		sendJsonMsg(context, http.StatusInternalServerError, fmt.Sprintf(`Unable to find file "%v": %v`, filename, err))
 		logs.ControllerLog.Error(fmt.Sprintf(`Unable to find file "%v": %v`, filename, err))
+		return
 	}
-
-	contentLength, contentType, reader, extraHeaders := fileController.fileService.GetFileStream(fileDecrypt, file)
-	context.DataFromReader(http.StatusOK, contentLength, contentType, reader, extraHeaders)
+	defer reader.Close()
+	for key, value := range extraHeaders {
+		context.Header(key, value)
+	}
+	context.Header(headers.ContentType, contentType)
+	// ServeContent answers the Range requests and the conditional ones, checking them against the ETag and the
+	// version's modification time
+	http.ServeContent(context.Writer, context.Request, file.Name, file.UpdatedAt.Time, reader)
 }
 
 func (fileController FileControllerImpl) UploadFile(context *gin.Context) {
 	file, header, err := context.Request.FormFile("file")
 	permissionsStr, _ := context.GetPostForm("permissions")
-	if permissionsStr != "" && len(permissionsStr) != 9 {
-		sendJsonMsg(context, http.StatusBadRequest, "Wrong permissions flags (must have 9 characters exactly)")
-		logs.ControllerLog.Error("Wrong permissions flags (must have 9 characters exactly)")
+	if err := services.ValidatePermissions(permissionsStr); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		logs.ControllerLog.Error(err.Error())
+		return
+	}
+	// The client may give the checksum of the file, so its content is checked once it's received
+	checksumStr, _ := context.GetPostForm("checksum")
+	checksum := null.NewString(checksumStr, checksumStr != "")
+	if err := services.ValidateChecksum(checksum); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		logs.ControllerLog.Error(err.Error())
 		return
 	}
 	if err != nil {
@@ -215,49 +282,69 @@ func (fileController FileControllerImpl) UploadFile(context *gin.Context) {
 		return
 	}
 
+	// The file is uploaded into the folder of the route, if any. If it's a shared one, the new version belongs to the
+	// folder's owner and takes their space.
+	filename := header.Filename
+	if folder := context.Param("folder"); folder != "" {
+		filename = folder + "/" + filename
+	}
+	owner, ok := fileController.fileOwner(context, filename, models.ShareAccessWrite)
+	if !ok {
+		return
+	}
+	// Those who can write someone else's file can add versions to it, but not change who can access it
+	if permissionsStr != "" && !canSetPermissions(context, owner) {
+		return
+	}
+	if err := fileController.fileService.CheckQuota(owner, header.Size); err != nil {
+		sendJsonMsg(context, pathErrorStatus(err), err.Error())
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to upload file "%v": %v`, filename, err))
+		return
+	}
 	fileModel, err := fileController.fileService.CreateFile(&models.File{
-		Name:           header.Filename,
-		Owner:          getUser(context),
+		Name:           filename,
+		Owner:          owner,
 		PermissionsStr: permissionsStr,
 	})
 	if err != nil {
-		sendJsonMsg(context, http.StatusInternalServerError, err.Error())
+		sendJsonMsg(context, pathErrorStatus(err), err.Error())
 		logs.ControllerLog.Error(err.Error())
 		return
 	}
 
-	if fileController.configuration.UseGDrive {
-		gService, err := services.GetGdriveService()
-		if err != nil {
+	fileModel.Checksum = checksum
+	err = fileController.fileService.SaveFile(file, fileModel)
+	if err != nil {
+		if err == services.ChecksumMismatchError {
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		} else {
 			sendJsonMsg(context, http.StatusInternalServerError, err.Error())
-			logs.ControllerLog.Error(err.Error())
-			return
 		}
-		fileDrive, err := fileController.fileService.UploadFileGDrive(gService, strconv.FormatInt(fileModel.Id, 10), file)
-		if err != nil {
-			sendJsonMsg(context, http.StatusInternalServerError, "Unable to upload file to google drive: "+err.Error())
-			logs.ControllerLog.Error("Unable to upload file to google drive: "+err.Error())
-			return
-		}
-		err = fileController.fileService.SetGdriveId(fileModel.Id, fileDrive.Id)
-	} else {
-		err = fileController.fileService.SaveFile(file, fileModel)
+		logs.ControllerLog.Error(err.Error())
+		return
 	}
-
+	// The version is read again to return its size and checksum
+	fileModel, err = fileController.fileService.GetFileByVersion(fileModel.Name, fileModel.Id, &fileModel.Owner)
 	if err != nil {
 		sendJsonMsg(context, http.StatusInternalServerError, err.Error())
 		logs.ControllerLog.Error(err.Error())
 		return
 	}
 
+	setChecksumHeader(context, fileModel)
 	context.JSON(http.StatusCreated, models.FileToDto(fileModel))
 }
 
+// DeleteFile moves the file to the trash, with all its versions. The group's files can be deleted by the members who
+// can write them.
 func (fileController FileControllerImpl) DeleteFile(context *gin.Context) {
 	filename := context.Param("file")
-	user := getUser(context)
+	owner, ok := fileController.fileOwner(context, filename, models.ShareAccessWrite)
+	if !ok {
+		return
+	}
 
-	_, err := fileController.fileService.DeleteFile(filename, &user)
+	_, err := fileController.fileService.DeleteFile(filename, &owner)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			sendJsonMsg(context, http.StatusNotFound, "Unable to find file: "+filename)
@@ -271,6 +358,502 @@ func (fileController FileControllerImpl) DeleteFile(context *gin.Context) {
 	context.Writer.WriteHeader(http.StatusNoContent)
 }
 
+// PatchFile changes the file's permissions, or renames it or moves it to another folder, keeping all its versions. The
+// permissions are changed first, so the file can be moved at the same time. The group's files can be moved by the
+// members who can write them, but only the managers change their permissions.
+func (fileController FileControllerImpl) PatchFile(context *gin.Context) {
+	filename := context.Param("file")
+	var filePatch models.FilePatch
+	if err := context.ShouldBindJSON(&filePatch); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse file changes: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse file changes: " + err.Error())
+		return
+	}
+	if !filePatch.Name.Valid && !filePatch.PermissionsStr.Valid {
+		sendJsonMsg(context, http.StatusBadRequest, "The file's new name or permissions are required")
+		logs.ControllerLog.Error("The file's new name or permissions are required")
+		return
+	}
+	owner, ok := fileController.fileOwner(context, filename, models.ShareAccessWrite)
+	if !ok {
+		return
+	}
+	var file models.File
+	var err error
+	if filePatch.PermissionsStr.Valid {
+		if !canSetPermissions(context, owner) {
+			return
+		}
+		file, err = fileController.fileService.SetPermissions(filename, filePatch.PermissionsStr.String, &owner)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				sendJsonMsg(context, http.StatusNotFound, "Unable to find file: "+filename)
+			} else {
+				sendJsonMsg(context, pathErrorStatus(err), "Unable to change permissions: "+err.Error())
+			}
+			logs.ControllerLog.Error(fmt.Sprintf(`Unable to change the permissions of file "%v" to "%v": %v`, filename, filePatch.PermissionsStr.String, err))
+			return
+		}
+	}
+	if filePatch.Name.Valid {
+		if _, ok := fileController.fileOwner(context, filePatch.Name.String, models.ShareAccessWrite); !ok {
+			return
+		}
+		file, err = fileController.fileService.MoveFile(filename, filePatch.Name.String, &owner)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				sendJsonMsg(context, http.StatusNotFound, "Unable to find file: "+filename)
+			} else {
+				sendJsonMsg(context, pathErrorStatus(err), "Unable to move file: "+err.Error())
+			}
+			logs.ControllerLog.Error(fmt.Sprintf(`Unable to move file "%v" to "%v": %v`, filename, filePatch.Name.String, err))
+			return
+		}
+	}
+	context.JSON(http.StatusOK, models.FileToDto(file))
+}
+
+// CopyFile copies the file's last version, or the given one, to a new version of the file with the given name
+func (fileController FileControllerImpl) CopyFile(context *gin.Context) {
+	filename := context.Param("file")
+	var fileCopy models.FileCopy
+	if err := context.ShouldBindJSON(&fileCopy); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse file copy: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse file copy: " + err.Error())
+		return
+	}
+	user := getUser(context)
+	file, err := fileController.fileService.CopyFile(filename, fileCopy.Version, fileCopy.Name, &user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find file: "+filename)
+		} else {
+			sendJsonMsg(context, pathErrorStatus(err), "Unable to copy file: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to copy file "%v" to "%v": %v`, filename, fileCopy.Name, err))
+		return
+	}
+	context.JSON(http.StatusCreated, models.FileToDto(file))
+}
+
+// CreateLink creates a public link to the user's file, or to one of its versions, that can be downloaded without
+// logging in
+func (fileController FileControllerImpl) CreateLink(context *gin.Context) {
+	filename := context.Param("file")
+	var options models.LinkOptions
+	if err := context.ShouldBindJSON(&options); err != nil && err != io.EOF {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse link options: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse link options: " + err.Error())
+		return
+	}
+	link, err := fileController.linkService.CreateLink(filename, options, getUser(context))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find file: "+filename)
+		case services.InvalidLinkExpiryError, services.InvalidLinkMaxDownloadsError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to create link: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to create link to file "%v": %v`, filename, err))
+		return
+	}
+	link.Url = linkUrl(context, link.Token)
+	context.JSON(http.StatusCreated, link)
+}
+
+// RestoreFileVersion makes the given version the file's current one again, as a new version with its content and
+// permissions
+func (fileController FileControllerImpl) RestoreFileVersion(context *gin.Context) {
+	filename := context.Param("file")
+	version, err := strconv.ParseInt(context.Param("version"), 10, 64)
+	if err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse version number: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse version number: " + err.Error())
+		return
+	}
+	user := getUser(context)
+	file, err := fileController.fileService.RestoreFileVersion(filename, version, &user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, fmt.Sprintf(`Unable to find file "%v" version %v`, filename, version))
+		} else {
+			sendJsonMsg(context, pathErrorStatus(err), "Unable to restore file version: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to restore file "%v" version %v: %v`, filename, version, err))
+		return
+	}
+	context.JSON(http.StatusCreated, models.FileToDto(file))
+}
+
+// GetMissingChunks receives the chunks of a file that is going to be uploaded, and answers which of them the server
+// doesn't have yet
+func (fileController FileControllerImpl) GetMissingChunks(context *gin.Context) {
+	var chunkList models.ChunkList
+	if err := context.ShouldBindJSON(&chunkList); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse chunk list: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse chunk list: " + err.Error())
+		return
+	}
+	missing, err := fileController.fileService.GetMissingChunks(getUser(context), chunkList.Chunks)
+	if err != nil {
+		if err == services.InvalidChunkDigestError {
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to check chunks: "+err.Error())
+		}
+		logs.ControllerLog.Error("Unable to check chunks: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, models.MissingChunks{Missing: missing})
+}
+
+// UploadChunk stores the request's body as the chunk with the given digest
+func (fileController FileControllerImpl) UploadChunk(context *gin.Context) {
+	digest := context.Param("digest")
+	err := fileController.fileService.SaveChunk(getUser(context), digest, context.Request.Body)
+	if err != nil {
+		switch err {
+		case services.InvalidChunkDigestError, services.ChunkDigestMismatchError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		case services.ChunkTooLargeError:
+			sendJsonMsg(context, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to save chunk: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to save chunk "%v": %v`, digest, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// UploadManifest creates a new version of the file made of chunks that have already been uploaded
+func (fileController FileControllerImpl) UploadManifest(context *gin.Context) {
+	filename := context.Param("file")
+	var chunkList models.ChunkList
+	if err := context.ShouldBindJSON(&chunkList); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse chunk list: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse chunk list: " + err.Error())
+		return
+	}
+	permissionsStr := context.Query("permissions")
+	if err := services.ValidatePermissions(permissionsStr); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		logs.ControllerLog.Error(err.Error())
+		return
+	}
+
+	fileModel, err := fileController.fileService.CreateChunkedFile(&models.File{
+		Name:           filename,
+		Owner:          getUser(context),
+		PermissionsStr: permissionsStr,
+		Checksum:       chunkList.Checksum,
+	}, chunkList.Chunks)
+	if err != nil {
+		switch err {
+		case services.InvalidChunkDigestError, services.InvalidChecksumError, services.ChecksumMismatchError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		case services.MissingChunkError:
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		default:
+			sendJsonMsg(context, pathErrorStatus(err), err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to create file "%v" from its chunks: %v`, filename, err))
+		return
+	}
+
+	setChecksumHeader(context, fileModel)
+	context.JSON(http.StatusCreated, models.FileToDto(fileModel))
+}
+
+// GetFolderContent lists the subfolders of the folder and the last version of its files
+func (fileController FileControllerImpl) GetFolderContent(context *gin.Context) {
+	path := context.Param("folder")
+	owner, ok := fileController.fileOwner(context, path+"/", models.ShareAccessRead)
+	if !ok {
+		return
+	}
+	folders, files, err := fileController.folderService.GetFolderContent(path, owner)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find folder: "+path)
+		} else {
+			sendJsonMsg(context, pathErrorStatus(err), "Unable to retrieve folder: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to retrieve folder "%v": %v`, path, err))
+		return
+	}
+	folderDto := models.FolderDTO{
+		Path:    strings.Trim(path, "/"),
+		Folders: make([]string, len(folders)),
+		Files:   funcs.Maps(files, models.FileToDto).([]models.FileDTO),
+	}
+	for i, folder := range folders {
+		folderDto.Folders[i] = folder.Path
+	}
+	context.JSON(http.StatusOK, folderDto)
+}
+
+// CreateFolder creates the folder, and the ones it's in if they don't exist yet
+func (fileController FileControllerImpl) CreateFolder(context *gin.Context) {
+	path := context.Param("folder")
+	folder, err := fileController.folderService.CreateFolder(path, getUser(context))
+	if err != nil {
+		sendJsonMsg(context, pathErrorStatus(err), "Unable to create folder: "+err.Error())
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to create folder "%v": %v`, path, err))
+		return
+	}
+	context.JSON(http.StatusCreated, folder)
+}
+
+// DeleteFolder deletes the folder, which must be empty
+func (fileController FileControllerImpl) DeleteFolder(context *gin.Context) {
+	path := context.Param("folder")
+	err := fileController.folderService.DeleteFolder(path, getUser(context))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find folder: "+path)
+		case services.FolderNotEmptyError:
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		default:
+			sendJsonMsg(context, pathErrorStatus(err), "Unable to delete folder: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to delete folder "%v": %v`, path, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetPath answers the GET requests of a file or folder path, depending on what the path addresses
+func (fileController FileControllerImpl) GetPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case folderPath:
+		fileController.GetFolderContent(context)
+	case filePath:
+		fileController.GetFile(context)
+	case downloadPath:
+		fileController.DownloadFile(context)
+	case versionsPath:
+		fileController.GetAllFileVersions(context)
+	case versionPath:
+		fileController.GetFileVersion(context)
+	case versionDownloadPath:
+		fileController.DownloadFileVersion(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// PostPath uploads a file into a folder, or the manifest of a chunked file, or copies a file, restores one of its
+// versions or creates a public link to it
+func (fileController FileControllerImpl) PostPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case folderPath:
+		fileController.UploadFile(context)
+	case manifestPath:
+		fileController.UploadManifest(context)
+	case copyPath:
+		fileController.CopyFile(context)
+	case versionRestorePath:
+		fileController.RestoreFileVersion(context)
+	case linksPath:
+		fileController.CreateLink(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// PostSharedPath uploads a file into a folder shared with the user, or into a group's folder. The shared files can only be written by uploading
+// them whole, as the chunks and the uploads belong to the user who sends them.
+func (fileController FileControllerImpl) PostSharedPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case folderPath:
+		fileController.UploadFile(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// PatchSharedPath changes the attributes of a group's file
+func (fileController FileControllerImpl) PatchSharedPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case filePath:
+		fileController.PatchFile(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// DeleteSharedPath deletes a group's file, with all its versions
+func (fileController FileControllerImpl) DeleteSharedPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case filePath:
+		fileController.DeleteFile(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// PutPath creates a folder
+func (fileController FileControllerImpl) PutPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case folderPath:
+		fileController.CreateFolder(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// PatchPath changes a file's attributes
+func (fileController FileControllerImpl) PatchPath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case filePath:
+		fileController.PatchFile(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// DeletePath deletes a file, with all its versions, or an empty folder
+func (fileController FileControllerImpl) DeletePath(context *gin.Context) {
+	switch parseFilePath(context) {
+	case folderPath:
+		fileController.DeleteFolder(context)
+	case filePath:
+		fileController.DeleteFile(context)
+	default:
+		sendUnknownPath(context)
+	}
+}
+
+// parseFilePath reads the path of the /files/*path routes. A path ending with a slash is a folder, and anything else is
+// a file, followed by the action on it, as in "docs/report.pdf/versions/3/download". The file or folder, and the
+// version, are set as the params of the request, so the handlers read them as if the route had them.
+func parseFilePath(context *gin.Context) filePathKind {
+	path := context.Param("path")
+	if strings.HasSuffix(path, "/") {
+		context.Params = append(context.Params, gin.Param{Key: "folder", Value: strings.Trim(path, "/")})
+		return folderPath
+	}
+	names := strings.Split(strings.Trim(path, "/"), "/")
+	n := len(names)
+	kind := filePath
+	switch {
+	case n >= 4 && names[n-3] == "versions" && names[n-1] == "download":
+		kind = versionDownloadPath
+		context.Params = append(context.Params, gin.Param{Key: "version", Value: names[n-2]})
+		names = names[:n-3]
+	case n >= 4 && names[n-3] == "versions" && names[n-1] == "restore":
+		kind = versionRestorePath
+		context.Params = append(context.Params, gin.Param{Key: "version", Value: names[n-2]})
+		names = names[:n-3]
+	case n >= 3 && names[n-2] == "versions":
+		kind = versionPath
+		context.Params = append(context.Params, gin.Param{Key: "version", Value: names[n-1]})
+		names = names[:n-2]
+	case n >= 2 && names[n-1] == "versions":
+		kind = versionsPath
+		names = names[:n-1]
+	case n >= 2 && names[n-1] == "download":
+		kind = downloadPath
+		names = names[:n-1]
+	case n >= 2 && names[n-1] == "manifest":
+		kind = manifestPath
+		names = names[:n-1]
+	case n >= 2 && names[n-1] == "copy":
+		kind = copyPath
+		names = names[:n-1]
+	case n >= 2 && names[n-1] == "links":
+		kind = linksPath
+		names = names[:n-1]
+	case names[0] == "":
+		return unknownPath
+	}
+	context.Params = append(context.Params, gin.Param{Key: "file", Value: strings.Join(names, "/")})
+	return kind
+}
+
+func sendUnknownPath(context *gin.Context) {
+	sendJsonMsg(context, http.StatusNotFound, "Unable to find path: "+context.Param("path"))
+	logs.ControllerLog.Error("Unable to find path: " + context.Param("path"))
+}
+
+// GetUsage tells how much space the user's files take, and how much their quota allows. The users can only see their
+// own usage, as the authorization middleware checks the email of the route.
+func (fileController FileControllerImpl) GetUsage(context *gin.Context) {
+	email := context.Param("email")
+	usage, err := fileController.fileService.GetUsage(models.User{Credentials: models.Credentials{Email: email}})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find user: "+email)
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve usage: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to retrieve %v's usage: %v", email, err))
+		return
+	}
+	context.JSON(http.StatusOK, usage)
+}
+
+// setChecksumHeader tells the checksum of the version's content, if it's known
+func setChecksumHeader(context *gin.Context, file models.File) {
+	if file.Checksum.Valid {
+		context.Header(models.ChecksumHeader, file.Checksum.String)
+	}
+}
+
+// fileOwner returns the owner of the files that the request addresses: the user, the owner in the route of the shared
+// files if they have shared the path with the user with the access, or the group in the route if the user is one of
+// its members and the file's group permissions allow the access. Otherwise, the request is answered.
+func (fileController FileControllerImpl) fileOwner(context *gin.Context, path string, access string) (models.User, bool) {
+	ownerEmail := context.Param("owner")
+	if group := context.Param("group"); group != "" {
+		ownerEmail = group
+	}
+	owner, err := fileController.fileService.AuthorizeAccess(path, ownerEmail, getUser(context), access)
+	if err != nil {
+		sendJsonMsg(context, pathErrorStatus(err), fmt.Sprintf(`Unable to access "%v": %v`, path, err))
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to access "%v" of "%v": %v`, path, ownerEmail, err))
+		return owner, false
+	}
+	return owner, true
+}
+
+// canSetPermissions tells whether the user can change the permissions of the owner's files: only the owner can, or the
+// group's managers if the owner is a group. Otherwise, the request is answered.
+func canSetPermissions(context *gin.Context, owner models.User) bool {
+	user := getUser(context)
+	if owner.Email == user.Email {
+		return true
+	}
+	if member, ok := context.Get(groupMemberKey); ok && member.(models.GroupMember).Role == models.GroupRoleManager {
+		return true
+	}
+	sendJsonMsg(context, http.StatusForbidden, "Only the owner of the file can change its permissions")
+	logs.ControllerLog.Warnf(`User %v tried to change the permissions of a file of "%v"`, user.Email, owner.Email)
+	return false
+}
+
+// pathErrorStatus is the status of the errors about the files' and folders' paths
+func pathErrorStatus(err error) int {
+	switch err {
+	case services.InvalidPathError, services.InvalidPermissionsError:
+		return http.StatusBadRequest
+	case services.PathConflictError:
+		return http.StatusConflict
+	case services.FileTooLargeError:
+		return http.StatusRequestEntityTooLarge
+	case services.QuotaExceededError:
+		return http.StatusInsufficientStorage
+	case services.AccessDeniedError:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func getUser(context *gin.Context) models.User {
 	var user models.User
 	user.Email = jwt.ExtractClaims(context)["id"].(string)
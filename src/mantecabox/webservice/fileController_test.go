@@ -2,8 +2,10 @@ package webservice
 
 import (
 	"mantecabox/models"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 )
 
@@ -33,3 +35,37 @@ func TestNewFileController(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFilePath(t *testing.T) {
+	testCases := []struct {
+		name        string
+		path        string
+		wantKind    filePathKind
+		wantFile    string
+		wantFolder  string
+		wantVersion string
+	}{
+		{"When the path is the root folder, return it", "/", folderPath, "", "", ""},
+		{"When the path ends with a slash, return the folder", "/docs/2018/", folderPath, "", "docs/2018", ""},
+		{"When the path is a file, return it", "/docs/report.pdf", filePath, "docs/report.pdf", "", ""},
+		{"When the path is a top level file, return it", "/report.pdf", filePath, "report.pdf", "", ""},
+		{"When the path is a download, return the file", "/docs/report.pdf/download", downloadPath, "docs/report.pdf", "", ""},
+		{"When the path is the versions' list, return the file", "/docs/report.pdf/versions", versionsPath, "docs/report.pdf", "", ""},
+		{"When the path is a version, return the file and the version", "/docs/report.pdf/versions/3", versionPath, "docs/report.pdf", "", "3"},
+		{"When the path is a version's download, return the file and the version", "/report.pdf/versions/3/download", versionDownloadPath, "report.pdf", "", "3"},
+		{"When the path is a manifest, return the file", "/docs/report.pdf/manifest", manifestPath, "docs/report.pdf", "", ""},
+		{"When the path is a copy, return the file", "/docs/report.pdf/copy", copyPath, "docs/report.pdf", "", ""},
+		{"When the path is a version's restore, return the file and the version", "/docs/report.pdf/versions/3/restore", versionRestorePath, "docs/report.pdf", "", "3"},
+		{"When the path is only the name of an action, return it as a file", "/download", filePath, "download", "", ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			context, _ := gin.CreateTestContext(httptest.NewRecorder())
+			context.Params = gin.Params{gin.Param{Key: "path", Value: testCase.path}}
+			require.Equal(t, testCase.wantKind, parseFilePath(context))
+			require.Equal(t, testCase.wantFile, context.Param("file"))
+			require.Equal(t, testCase.wantFolder, context.Param("folder"))
+			require.Equal(t, testCase.wantVersion, context.Param("version"))
+		})
+	}
+}
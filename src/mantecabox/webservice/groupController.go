@@ -0,0 +1,197 @@
+package webservice
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"mantecabox/dao"
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupMemberKey keeps in the context the membership of the user in the group of the route
+const groupMemberKey = "groupMember"
+
+type (
+	GroupController interface {
+		GroupMiddleware(role string) gin.HandlerFunc
+		GetUserGroups(context *gin.Context)
+		GetGroups(context *gin.Context)
+		CreateGroup(context *gin.Context)
+		DeleteGroup(context *gin.Context)
+		GetMembers(context *gin.Context)
+		SetMember(context *gin.Context)
+		RemoveMember(context *gin.Context)
+	}
+
+	GroupControllerImpl struct {
+		configuration *models.Configuration
+		groupService  services.GroupService
+	}
+)
+
+func NewGroupController(configuration *models.Configuration) GroupController {
+	groupService := services.NewGroupService(configuration)
+	if groupService == nil {
+		return nil
+	}
+	return GroupControllerImpl{
+		configuration: configuration,
+		groupService:  groupService,
+	}
+}
+
+// GroupMiddleware rejects the users that aren't members of the group of the route, or managers if the role is
+// required. It must run after the authentication one. The admins' routes don't use it, so they manage any group.
+func (groupController GroupControllerImpl) GroupMiddleware(role string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		group := context.Param("group")
+		user := getUser(context)
+		member, err := groupController.groupService.AuthorizeGroup(group, user, role)
+		if err != nil {
+			if err == services.GroupAccessDeniedError {
+				sendJsonMsg(context, http.StatusForbidden, err.Error())
+			} else {
+				sendJsonMsg(context, http.StatusInternalServerError, "Unable to check group membership: "+err.Error())
+			}
+			logs.ControllerLog.Warnf("User %v tried to access %v: %v", user.Email, context.Request.URL.Path, err)
+			return
+		}
+		context.Set(groupMemberKey, member)
+		context.Next()
+	}
+}
+
+// GetUserGroups lists the groups that the user is a member of, with their role in them
+func (groupController GroupControllerImpl) GetUserGroups(context *gin.Context) {
+	groups, err := groupController.groupService.GetUserGroups(getUser(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve groups: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve groups: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, groups)
+}
+
+func (groupController GroupControllerImpl) GetGroups(context *gin.Context) {
+	groups, err := groupController.groupService.GetGroups()
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve groups: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve groups: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, groups)
+}
+
+func (groupController GroupControllerImpl) CreateGroup(context *gin.Context) {
+	var creation models.GroupCreation
+	if err := context.ShouldBindJSON(&creation); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse group: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse group: " + err.Error())
+		return
+	}
+	group, err := groupController.groupService.CreateGroup(creation.Name, creation.Manager)
+	if err != nil {
+		switch err {
+		case services.InvalidGroupNameError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		case services.UnknownMemberError:
+			sendJsonMsg(context, http.StatusNotFound, err.Error())
+		case dao.GroupNameTakenError:
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to create group: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to create group "%v": %v`, creation.Name, err))
+		return
+	}
+	context.JSON(http.StatusCreated, group)
+}
+
+// DeleteGroup deletes an empty group and its members
+func (groupController GroupControllerImpl) DeleteGroup(context *gin.Context) {
+	group := context.Param("group")
+	if err := groupController.groupService.DeleteGroup(group); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find group: "+group)
+		case services.GroupNotEmptyError:
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to delete group: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to delete group "%v": %v`, group, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+func (groupController GroupControllerImpl) GetMembers(context *gin.Context) {
+	group := context.Param("group")
+	members, err := groupController.groupService.GetMembers(group)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find group: "+group)
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve members: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to retrieve members of group "%v": %v`, group, err))
+		return
+	}
+	context.JSON(http.StatusOK, members)
+}
+
+// SetMember adds the user of the route to the group, or changes their role in it
+func (groupController GroupControllerImpl) SetMember(context *gin.Context) {
+	var member models.GroupMember
+	if err := context.ShouldBindJSON(&member); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse member: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse member: " + err.Error())
+		return
+	}
+	member.Group = context.Param("group")
+	member.Member = context.Param("member")
+	savedMember, err := groupController.groupService.SetMember(&member)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find group: "+member.Group)
+		case services.UnknownMemberError:
+			sendJsonMsg(context, http.StatusNotFound, err.Error())
+		case services.InvalidGroupRoleError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to save member: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to add "%v" to group "%v": %v`, member.Member, member.Group, err))
+		return
+	}
+	context.JSON(http.StatusOK, savedMember)
+}
+
+// RemoveMember removes the user of the route from the group. Besides the managers, the members can remove themselves.
+func (groupController GroupControllerImpl) RemoveMember(context *gin.Context) {
+	group := context.Param("group")
+	email := context.Param("member")
+	if member, ok := context.Get(groupMemberKey); ok {
+		if member := member.(models.GroupMember); member.Role != models.GroupRoleManager && member.Member != email {
+			sendJsonMsg(context, http.StatusForbidden, services.GroupAccessDeniedError.Error())
+			logs.ControllerLog.Warnf(`User %v tried to remove "%v" from group "%v"`, member.Member, email, group)
+			return
+		}
+	}
+	if err := groupController.groupService.RemoveMember(group, email); err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, fmt.Sprintf(`Unable to find member "%v" of group "%v"`, email, group))
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to remove member: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to remove "%v" from group "%v": %v`, email, group, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,212 @@
+package webservice
+
+import (
+	"bytes"
+	"database/sql"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+
+	"github.com/appleboy/gofight"
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testGroup         = "project"
+	testManagerEmail  = "manager@example.com"
+	testMemberEmail   = "member@example.com"
+	testOutsiderEmail = "outsider@example.com"
+)
+
+func TestNewGroupController(t *testing.T) {
+	type args struct {
+		configuration *models.Configuration
+	}
+	testCases := []struct {
+		name string
+		args args
+		want GroupController
+	}{
+		{
+			name: "When passing the configuration, return the service",
+			args: args{configuration: &models.Configuration{AesKey: "0123456789ABCDEF"}},
+			want: GroupControllerImpl{},
+		},
+		{
+			name: "When passing no configuration, return nil",
+			args: args{configuration: nil},
+			want: nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewGroupController(testCase.args.configuration))
+		})
+	}
+}
+
+func TestGroupRoutes(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   gofight.D
+		user   string
+		want   int
+	}{
+		{"When a non-member lists the members, deny it", "GET", "/groups/project/members", nil, testOutsiderEmail, http.StatusForbidden},
+		{"When a member lists the members, list them", "GET", "/groups/project/members", nil, testMemberEmail, http.StatusOK},
+		{"When a manager adds a member, add them", "PUT", "/groups/project/members/" + testOutsiderEmail, gofight.D{"role": models.GroupRoleMember}, testManagerEmail, http.StatusOK},
+		{"When a member adds a member, deny it", "PUT", "/groups/project/members/" + testOutsiderEmail, gofight.D{"role": models.GroupRoleMember}, testMemberEmail, http.StatusForbidden},
+		{"When a member removes another member, deny it", "DELETE", "/groups/project/members/" + testManagerEmail, nil, testMemberEmail, http.StatusForbidden},
+		{"When a member removes themselves, remove them", "DELETE", "/groups/project/members/" + testMemberEmail, nil, testMemberEmail, http.StatusNoContent},
+		{"When a manager removes a member, remove them", "DELETE", "/groups/project/members/" + testMemberEmail, nil, testManagerEmail, http.StatusNoContent},
+		{"When a member lists the group's root folder, list it", "GET", "/groups/project/files/", nil, testMemberEmail, http.StatusOK},
+		{"When a non-member lists the group's root folder, deny it", "GET", "/groups/project/files/", nil, testOutsiderEmail, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		cleanDb(db)
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := map[string]string{
+				testManagerEmail:  loginAs(t, testManagerEmail, models.UserRoleUser),
+				testMemberEmail:   loginAs(t, testMemberEmail, models.UserRoleUser),
+				testOutsiderEmail: loginAs(t, testOutsiderEmail, models.UserRoleUser),
+			}
+			groupDao := dao.GroupPgDao{}
+			_, err := groupDao.Create(testGroup)
+			require.NoError(t, err)
+			_, err = groupDao.SaveMember(&models.GroupMember{Group: testGroup, Member: testManagerEmail, Role: models.GroupRoleManager})
+			require.NoError(t, err)
+			_, err = groupDao.SaveMember(&models.GroupMember{Group: testGroup, Member: testMemberEmail, Role: models.GroupRoleMember})
+			require.NoError(t, err)
+
+			r := gofight.New()
+			var request *gofight.RequestConfig
+			switch tt.method {
+			case "GET":
+				request = r.GET(tt.path)
+			case "PUT":
+				request = r.PUT(tt.path).SetJSON(tt.body)
+			case "DELETE":
+				request = r.DELETE(tt.path)
+			}
+			request.
+				SetDebug(true).
+				SetHeader(gofight.H{
+					headers.Authorization: "Bearer " + tokens[tt.user],
+				}).
+				Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+					require.Equal(t, tt.want, res.Code)
+				})
+		})
+	}
+}
+
+func TestGroupFileLifecycle(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanDb(db)
+	managerToken := loginAs(t, testManagerEmail, models.UserRoleUser)
+	memberToken := loginAs(t, testMemberEmail, models.UserRoleUser)
+	adminToken := loginAs(t, adminEmail, models.UserRoleAdmin)
+	groupDao := dao.GroupPgDao{}
+	_, err := groupDao.Create(testGroup)
+	require.NoError(t, err)
+	_, err = groupDao.SaveMember(&models.GroupMember{Group: testGroup, Member: testManagerEmail, Role: models.GroupRoleManager})
+	require.NoError(t, err)
+	_, err = groupDao.SaveMember(&models.GroupMember{Group: testGroup, Member: testMemberEmail, Role: models.GroupRoleMember})
+	require.NoError(t, err)
+
+	body, contentType := multipartUpload(t, "plan.txt", "The plan", "")
+	require.Equal(t, http.StatusCreated, send("POST", "/groups/project/files/", memberToken, body, contentType))
+
+	// The group can't be deleted while it has files, in its folders or in its trash
+	require.Equal(t, http.StatusConflict, send("DELETE", "/admin/groups/project", adminToken, "", ""))
+
+	// With the default permissions, the members can't move nor delete the group's files, but the managers can
+	require.Equal(t, http.StatusForbidden, send("PATCH", "/groups/project/files/plan.txt", memberToken, `{"name": "old-plan.txt"}`, "application/json"))
+	require.Equal(t, http.StatusForbidden, send("DELETE", "/groups/project/files/plan.txt", memberToken, "", ""))
+	require.Equal(t, http.StatusOK, send("PATCH", "/groups/project/files/plan.txt", managerToken, `{"name": "old-plan.txt"}`, "application/json"))
+	require.Equal(t, http.StatusNoContent, send("DELETE", "/groups/project/files/old-plan.txt", managerToken, "", ""))
+	require.Equal(t, http.StatusConflict, send("DELETE", "/admin/groups/project", adminToken, "", ""))
+
+	// Only the managers empty the group's trash, and then the group can be deleted
+	require.Equal(t, http.StatusForbidden, send("DELETE", "/groups/project/trash", memberToken, "", ""))
+	require.Equal(t, http.StatusNoContent, send("DELETE", "/groups/project/trash", managerToken, "", ""))
+	require.Equal(t, http.StatusNoContent, send("DELETE", "/admin/groups/project", adminToken, "", ""))
+	_, err = groupDao.Get(testGroup)
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestGroupUploadPermissions(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	cleanDb(db)
+	managerToken := loginAs(t, testManagerEmail, models.UserRoleUser)
+	memberToken := loginAs(t, testMemberEmail, models.UserRoleUser)
+	groupDao := dao.GroupPgDao{}
+	_, err := groupDao.Create(testGroup)
+	require.NoError(t, err)
+	_, err = groupDao.SaveMember(&models.GroupMember{Group: testGroup, Member: testManagerEmail, Role: models.GroupRoleManager})
+	require.NoError(t, err)
+	_, err = groupDao.SaveMember(&models.GroupMember{Group: testGroup, Member: testMemberEmail, Role: models.GroupRoleMember})
+	require.NoError(t, err)
+
+	// The members add versions to the group's files, but only the managers change their permissions
+	body, contentType := multipartUpload(t, "plan.txt", "The plan", "rw-rw-rw-")
+	require.Equal(t, http.StatusForbidden, send("POST", "/groups/project/files/", memberToken, body, contentType))
+	body, contentType = multipartUpload(t, "plan.txt", "The plan", "rw-rw----")
+	require.Equal(t, http.StatusCreated, send("POST", "/groups/project/files/", managerToken, body, contentType))
+	body, contentType = multipartUpload(t, "plan.txt", "The new plan", "")
+	require.Equal(t, http.StatusCreated, send("POST", "/groups/project/files/", memberToken, body, contentType))
+	file, err := dao.FilePgDao{}.GetLastVersionFileByNameAndOwner("plan.txt", &models.User{Credentials: models.Credentials{Email: testGroup}})
+	require.NoError(t, err)
+	require.Equal(t, "rw-rw----", file.PermissionsStr)
+}
+
+// multipartUpload returns the body of the upload of a file, with its permissions if given, and its content type
+func multipartUpload(t *testing.T, filename string, content string, permissions string) (string, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	if permissions != "" {
+		require.NoError(t, writer.WriteField("permissions", permissions))
+	}
+	require.NoError(t, writer.Close())
+	return body.String(), writer.FormDataContentType()
+}
+
+// send sends the request with the user's token, and returns the status of the response
+func send(method string, path string, token string, body string, contentType string) int {
+	r := gofight.New()
+	var request *gofight.RequestConfig
+	switch method {
+	case "POST":
+		request = r.POST(path)
+	case "PATCH":
+		request = r.PATCH(path)
+	case "DELETE":
+		request = r.DELETE(path)
+	}
+	code := 0
+	request.
+		SetDebug(true).
+		SetHeader(gofight.H{
+			headers.Authorization: "Bearer " + token,
+			headers.ContentType:   contentType,
+		}).
+		SetBody(body).
+		Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+			code = res.Code
+		})
+	return code
+}
@@ -0,0 +1,136 @@
+package webservice
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-http-utils/headers"
+)
+
+type (
+	LinkController interface {
+		GetLinks(context *gin.Context)
+		RevokeLink(context *gin.Context)
+		GetLinkAccesses(context *gin.Context)
+		DownloadLink(context *gin.Context)
+	}
+
+	LinkControllerImpl struct {
+		configuration  *models.Configuration
+		linkService    services.LinkService
+		fileController FileController
+	}
+)
+
+func NewLinkController(configuration *models.Configuration) LinkController {
+	linkService := services.NewLinkService(configuration)
+	if linkService == nil {
+		return nil
+	}
+	fileController := NewFileController(configuration)
+	if fileController == nil {
+		return nil
+	}
+	return LinkControllerImpl{
+		configuration:  configuration,
+		linkService:    linkService,
+		fileController: fileController,
+	}
+}
+
+// GetLinks lists the public links that the user has created, including the expired and revoked ones
+func (linkController LinkControllerImpl) GetLinks(context *gin.Context) {
+	links, err := linkController.linkService.GetLinks(getUser(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve links: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve links: " + err.Error())
+		return
+	}
+	for i := range links {
+		links[i].Url = linkUrl(context, links[i].Token)
+	}
+	context.JSON(http.StatusOK, links)
+}
+
+func (linkController LinkControllerImpl) RevokeLink(context *gin.Context) {
+	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse link ID: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse link ID: " + err.Error())
+		return
+	}
+	if err := linkController.linkService.RevokeLink(id, getUser(context)); err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find link: "+context.Param("id"))
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to revoke link: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to revoke link %v: %v", id, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetLinkAccesses lists who tried to download the file through one of the user's links, the most recent first
+func (linkController LinkControllerImpl) GetLinkAccesses(context *gin.Context) {
+	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse link ID: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse link ID: " + err.Error())
+		return
+	}
+	accesses, err := linkController.linkService.GetAccesses(id, getUser(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve link accesses: "+err.Error())
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to retrieve link %v accesses: %v", id, err))
+		return
+	}
+	context.JSON(http.StatusOK, accesses)
+}
+
+// DownloadLink serves the file of a public link to anyone who knows its token. The links with password are downloaded
+// by posting it in the "password" form field.
+func (linkController LinkControllerImpl) DownloadLink(context *gin.Context) {
+	token := context.Param("token")
+	access := models.LinkAccess{Ip: context.ClientIP(), UserAgent: context.Request.UserAgent()}
+	file, err := linkController.linkService.OpenLink(token, context.PostForm("password"), resumesDownload(context), access)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find link")
+		case services.LinkPasswordError:
+			sendJsonMsg(context, http.StatusUnauthorized, err.Error())
+		case services.LinkExpiredError, services.LinkExhaustedError:
+			sendJsonMsg(context, http.StatusGone, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to open link: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to open link from %v: %v", access.Ip, err))
+		return
+	}
+	linkController.fileController.download(file.Name, file, nil, context)
+}
+
+// resumesDownload tells whether the request asks for a part of the file that isn't its beginning, as the clients do to
+// resume a download or to fetch it in several parts
+func resumesDownload(context *gin.Context) bool {
+	byteRange := strings.TrimSpace(context.GetHeader(headers.Range))
+	return byteRange != "" && !strings.HasPrefix(byteRange, "bytes=0-")
+}
+
+// linkUrl returns the public URL of the link, on the host that the request was sent to
+func linkUrl(context *gin.Context, token string) string {
+	scheme := "https"
+	if context.Request.TLS == nil {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%v://%v/s/%v", scheme, context.Request.Host, token)
+}
@@ -0,0 +1,143 @@
+package webservice
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mantecabox/dao"
+	"mantecabox/models"
+
+	"github.com/appleboy/gofight"
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNewLinkController(t *testing.T) {
+	type args struct {
+		configuration *models.Configuration
+	}
+	testCases := []struct {
+		name string
+		args args
+		want LinkController
+	}{
+		{
+			name: "When passing the configuration, return the service",
+			args: args{configuration: &models.Configuration{AesKey: "0123456789ABCDEF"}},
+			want: LinkControllerImpl{},
+		},
+		{
+			name: "When passing no configuration, return nil",
+			args: args{configuration: nil},
+			want: nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.IsType(t, testCase.want, NewLinkController(testCase.args.configuration))
+		})
+	}
+}
+
+func TestDownloadLink(t *testing.T) {
+	db := getDb(t)
+	defer db.Close()
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("linkpassword"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		token    string
+		link     models.Link
+		password string
+		revoke   bool
+		use      bool
+		resume   bool
+		want     int
+	}{
+		{
+			name:  "When there is no link with the token, return not found",
+			token: "unknowntoken",
+			link:  models.Link{Token: "testtoken"},
+			want:  http.StatusNotFound,
+		},
+		{
+			name:     "When the password is wrong, refuse the download",
+			token:    "testtoken",
+			link:     models.Link{Token: "testtoken", Password: null.StringFrom(string(hashedPassword))},
+			password: "wrongpassword",
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:  "When the password is missing, refuse the download",
+			token: "testtoken",
+			link:  models.Link{Token: "testtoken", Password: null.StringFrom(string(hashedPassword))},
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "When the link has expired, it's gone",
+			token: "testtoken",
+			link:  models.Link{Token: "testtoken", ExpiresAt: null.TimeFrom(time.Now().Add(-time.Hour))},
+			want:  http.StatusGone,
+		},
+		{
+			name:   "When the link has been revoked, it's gone",
+			token:  "testtoken",
+			link:   models.Link{Token: "testtoken"},
+			revoke: true,
+			want:   http.StatusGone,
+		},
+		{
+			name:  "When the link has no downloads left, it's gone",
+			token: "testtoken",
+			link:  models.Link{Token: "testtoken", MaxDownloads: null.IntFrom(1)},
+			use:   true,
+			want:  http.StatusGone,
+		},
+		{
+			name:   "When the link has no downloads left, don't resume a download",
+			token:  "testtoken",
+			link:   models.Link{Token: "testtoken", MaxDownloads: null.IntFrom(1)},
+			use:    true,
+			resume: true,
+			want:   http.StatusGone,
+		},
+	}
+	for _, tt := range tests {
+		cleanDb(db)
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := userDao.Create(&models.User{Credentials: models.Credentials{Email: testUserEmail, Password: "testpassword"}})
+			require.NoError(t, err)
+			file, err := dao.FilePgDao{}.Create(&models.File{Name: "report.pdf", Owner: user})
+			require.NoError(t, err)
+			linkDao := dao.LinkPgDao{}
+			tt.link.Owner = user.Email
+			tt.link.LogicalId = file.LogicalId
+			link, err := linkDao.Create(&tt.link)
+			require.NoError(t, err)
+			if tt.revoke {
+				require.NoError(t, linkDao.Revoke(link.Id, user.Email))
+			}
+			if tt.use {
+				require.NoError(t, linkDao.Use(link.Id))
+			}
+
+			requestHeaders := gofight.H{}
+			if tt.resume {
+				requestHeaders[headers.Range] = "bytes=1-"
+			}
+			r := gofight.New()
+			r.POST("/s/"+tt.token).
+				SetDebug(true).
+				SetHeader(requestHeaders).
+				SetForm(gofight.H{
+					"password": tt.password,
+				}).
+				Run(router, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+					require.Equal(t, tt.want, res.Code)
+				})
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package webservice
+
+import (
+	"net/http"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/benashford/go-func"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	RetentionController interface {
+		GetPolicy(context *gin.Context)
+		SetPolicy(context *gin.Context)
+		DeletePolicy(context *gin.Context)
+		GetPrunableVersions(context *gin.Context)
+	}
+
+	RetentionControllerImpl struct {
+		configuration    *models.Configuration
+		retentionService services.RetentionService
+	}
+)
+
+func NewRetentionController(configuration *models.Configuration) RetentionController {
+	retentionService := services.NewRetentionService(configuration)
+	if retentionService == nil {
+		return nil
+	}
+	return RetentionControllerImpl{
+		configuration:    configuration,
+		retentionService: retentionService,
+	}
+}
+
+// GetPolicy returns the user's retention policy, or the global one if they have none
+func (retentionController RetentionControllerImpl) GetPolicy(context *gin.Context) {
+	policy, err := retentionController.retentionService.GetPolicy(getUser(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve retention policy: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve retention policy: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, policy)
+}
+
+func (retentionController RetentionControllerImpl) SetPolicy(context *gin.Context) {
+	var policy models.RetentionPolicy
+	if err := context.ShouldBindJSON(&policy); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse retention policy: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse retention policy: " + err.Error())
+		return
+	}
+	policy.Owner = getUser(context).Email
+	savedPolicy, err := retentionController.retentionService.SetPolicy(&policy)
+	if err != nil {
+		if err == services.InvalidRetentionPolicyError {
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to save retention policy: "+err.Error())
+		}
+		logs.ControllerLog.Error("Unable to save retention policy: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, savedPolicy)
+}
+
+// DeletePolicy removes the user's retention policy, so the global one applies to them again
+func (retentionController RetentionControllerImpl) DeletePolicy(context *gin.Context) {
+	if err := retentionController.retentionService.DeletePolicy(getUser(context)); err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to delete retention policy: "+err.Error())
+		logs.ControllerLog.Error("Unable to delete retention policy: " + err.Error())
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetPrunableVersions lists the versions that the retention policy would prune now, without pruning them
+func (retentionController RetentionControllerImpl) GetPrunableVersions(context *gin.Context) {
+	versions, err := retentionController.retentionService.GetPrunableVersions(getUser(context))
+	if err != nil {
+		if err == services.InvalidRetentionPolicyError {
+			sendJsonMsg(context, http.StatusConflict, "The global retention policy is wrong: "+err.Error())
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve prunable versions: "+err.Error())
+		}
+		logs.ControllerLog.Error("Unable to retrieve prunable versions: " + err.Error())
+		return
+	}
+	versionsDto := funcs.Maps(versions, models.FileToDto).([]models.FileDTO)
+	context.JSON(http.StatusOK, versionsDto)
+}
@@ -16,6 +16,34 @@ func Router(useJWT bool, configuration *models.Configuration) *gin.Engine {
 	if fileController == nil {
 		return nil
 	}
+	uploadController := NewUploadController(configuration)
+	if uploadController == nil {
+		return nil
+	}
+	trashController := NewTrashController(configuration)
+	if trashController == nil {
+		return nil
+	}
+	retentionController := NewRetentionController(configuration)
+	if retentionController == nil {
+		return nil
+	}
+	shareController := NewShareController(configuration)
+	if shareController == nil {
+		return nil
+	}
+	linkController := NewLinkController(configuration)
+	if linkController == nil {
+		return nil
+	}
+	groupController := NewGroupController(configuration)
+	if groupController == nil {
+		return nil
+	}
+	adminController := NewAdminController(configuration)
+	if adminController == nil {
+		return nil
+	}
 
 	r := gin.Default()
 	p := ginprometheus.NewPrometheus("gin")
@@ -26,31 +54,159 @@ func Router(useJWT bool, configuration *models.Configuration) *gin.Engine {
 	r.POST("/login", userController.AuthMiddleware().LoginHandler)
 	r.GET("/refresh-token", userController.AuthMiddleware().RefreshHandler)
 
+	// The users can only reach their own account. The admins manage the others' through /admin/users.
 	users := r.Group("/users")
 	if useJWT {
-		users.Use(userController.AuthMiddleware().MiddlewareFunc())
+		users.Use(userController.AuthMiddleware().MiddlewareFunc(), userController.SelfMiddleware())
 	}
 
-	users.GET("", userController.GetUsers) // Useful?
 	users.GET("/:email", userController.GetUser)
 	users.PUT("/:email", userController.ModifyUser)
 	users.DELETE("/:email", userController.DeleteUser)
+	users.GET("/:email/usage", fileController.GetUsage)
 
 	files := r.Group("/files")
 	if useJWT {
 		files.Use(userController.AuthMiddleware().MiddlewareFunc())
 	}
 
-	files.GET("/:file", fileController.GetFile)
-	files.GET("/:file/download", fileController.DownloadFile)
-
-	files.GET("/:file/versions", fileController.GetAllFileVersions)
-	files.GET("/:file/versions/:version", fileController.GetFileVersion)
-	files.GET("/:file/versions/:version/download", fileController.DownloadFileVersion)
-
 	files.GET("", fileController.GetAllFiles)
 	files.POST("", fileController.UploadFile)
-	files.DELETE("/:file", fileController.DeleteFile)
+
+	// The files are addressed by their full path, followed by the action on them: /files/docs/report.pdf/download.
+	// The paths ending with a slash are folders: /files/docs/
+	files.GET("/*path", fileController.GetPath)
+	files.POST("/*path", fileController.PostPath)
+	files.PUT("/*path", fileController.PutPath)
+	files.PATCH("/*path", fileController.PatchPath)
+	files.DELETE("/*path", fileController.DeletePath)
+
+	chunks := r.Group("/chunks")
+	if useJWT {
+		chunks.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	chunks.POST("", fileController.GetMissingChunks)
+	chunks.PUT("/:digest", fileController.UploadChunk)
+
+	uploads := r.Group("/uploads")
+	if useJWT {
+		uploads.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	uploads.POST("", uploadController.CreateUpload)
+	uploads.GET("/:upload", uploadController.GetUpload)
+	uploads.HEAD("/:upload", uploadController.GetUploadOffset)
+	uploads.PATCH("/:upload", uploadController.UploadPart)
+	uploads.POST("/:upload/finalize", uploadController.FinalizeUpload)
+	uploads.DELETE("/:upload", uploadController.DeleteUpload)
+
+	// The deleted files stay in the trash until they are restored or purged. They are identified by their logical file.
+	trash := r.Group("/trash")
+	if useJWT {
+		trash.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	trash.GET("", trashController.GetTrash)
+	trash.DELETE("", trashController.EmptyTrash)
+	trash.POST("/:id/restore", trashController.RestoreFile)
+	trash.DELETE("/:id", trashController.PurgeFile)
+
+	// The user's retention policy tells which old versions of their files are pruned
+	retention := r.Group("/retention")
+	if useJWT {
+		retention.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	retention.GET("", retentionController.GetPolicy)
+	retention.PUT("", retentionController.SetPolicy)
+	retention.DELETE("", retentionController.DeletePolicy)
+	retention.GET("/dry-run", retentionController.GetPrunableVersions)
+
+	// The users share their files and folders with other users, who reach them by their owner and their path, as in
+	// /shared/owner@example.com/docs/report.pdf/download
+	shares := r.Group("/shares")
+	if useJWT {
+		shares.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	shares.GET("", shareController.GetShares)
+	shares.POST("", shareController.ShareFile)
+	shares.DELETE("/:id", shareController.RevokeShare)
+
+	sharedWithMe := r.Group("/shared-with-me")
+	if useJWT {
+		sharedWithMe.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	sharedWithMe.GET("", shareController.GetSharedWithMe)
+
+	shared := r.Group("/shared")
+	if useJWT {
+		shared.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	shared.GET("/:owner/*path", fileController.GetPath)
+	shared.POST("/:owner/*path", fileController.PostSharedPath)
+
+	// The groups' members reach the group's files by its name, as in /groups/project/files/docs/plan.pdf/download,
+	// according to the files' group permissions
+	groups := r.Group("/groups")
+	if useJWT {
+		groups.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	groups.GET("", groupController.GetUserGroups)
+	groups.GET("/:group/members", groupController.GroupMiddleware(models.GroupRoleMember), groupController.GetMembers)
+	// The managers add and remove other users, so the member isn't an :email param, which is only for the own account
+	groups.PUT("/:group/members/:member", groupController.GroupMiddleware(models.GroupRoleManager), groupController.SetMember)
+	groups.DELETE("/:group/members/:member", groupController.GroupMiddleware(models.GroupRoleMember), groupController.RemoveMember)
+	groups.GET("/:group/files/*path", fileController.GetPath)
+	groups.POST("/:group/files/*path", groupController.GroupMiddleware(models.GroupRoleMember), fileController.PostSharedPath)
+	groups.PATCH("/:group/files/*path", groupController.GroupMiddleware(models.GroupRoleMember), fileController.PatchSharedPath)
+	groups.DELETE("/:group/files/*path", fileController.DeleteSharedPath)
+	// The managers look after the group's trash, so the group's deleted files can be restored or purged
+	groups.GET("/:group/trash", groupController.GroupMiddleware(models.GroupRoleManager), trashController.GetTrash)
+	groups.DELETE("/:group/trash", groupController.GroupMiddleware(models.GroupRoleManager), trashController.EmptyTrash)
+	groups.POST("/:group/trash/:id/restore", groupController.GroupMiddleware(models.GroupRoleManager), trashController.RestoreFile)
+	groups.DELETE("/:group/trash/:id", groupController.GroupMiddleware(models.GroupRoleManager), trashController.PurgeFile)
+
+	// The public links are created with POST /files/<file>/links, and downloaded by anyone through /s/<token>
+	links := r.Group("/links")
+	if useJWT {
+		links.Use(userController.AuthMiddleware().MiddlewareFunc())
+	}
+
+	links.GET("", linkController.GetLinks)
+	links.DELETE("/:id", linkController.RevokeLink)
+	links.GET("/:id/accesses", linkController.GetLinkAccesses)
+
+	r.GET("/s/:token", linkController.DownloadLink)
+	r.POST("/s/:token", linkController.DownloadLink)
+
+	// The maintenance and user management endpoints are only for the users with the admin role
+	admin := r.Group("/admin")
+	if useJWT {
+		admin.Use(userController.AuthMiddleware().MiddlewareFunc(), adminController.AdminMiddleware())
+	}
+
+	admin.GET("/scrub", adminController.GetScrubReport)
+	admin.GET("/users", adminController.GetUsers)
+	admin.GET("/users/:email", adminController.GetUser)
+	admin.PUT("/users/:email/role", adminController.SetRole)
+	admin.POST("/users/:email/disable", adminController.DisableUser)
+	admin.POST("/users/:email/enable", adminController.EnableUser)
+	admin.DELETE("/users/:email", adminController.DeleteUser)
+	admin.DELETE("/users/:email/2fa", adminController.Reset2FA)
+	admin.GET("/users/:email/usage", fileController.GetUsage)
+	admin.GET("/users/:email/login-attempts", adminController.GetLoginAttempts)
+	admin.POST("/users/:email/logout", adminController.ForceLogout)
+	admin.GET("/groups", groupController.GetGroups)
+	admin.POST("/groups", groupController.CreateGroup)
+	admin.DELETE("/groups/:group", groupController.DeleteGroup)
+	admin.GET("/groups/:group/members", groupController.GetMembers)
+	admin.PUT("/groups/:group/members/:member", groupController.SetMember)
+	admin.DELETE("/groups/:group/members/:member", groupController.RemoveMember)
 
 	return r
 }
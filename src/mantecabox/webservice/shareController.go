@@ -0,0 +1,108 @@
+package webservice
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	ShareController interface {
+		ShareFile(context *gin.Context)
+		GetShares(context *gin.Context)
+		RevokeShare(context *gin.Context)
+		GetSharedWithMe(context *gin.Context)
+	}
+
+	ShareControllerImpl struct {
+		configuration *models.Configuration
+		shareService  services.ShareService
+	}
+)
+
+func NewShareController(configuration *models.Configuration) ShareController {
+	shareService := services.NewShareService(configuration)
+	if shareService == nil {
+		return nil
+	}
+	return ShareControllerImpl{
+		configuration: configuration,
+		shareService:  shareService,
+	}
+}
+
+// ShareFile shares one of the user's files or folders with another user, or changes the access they had to it
+func (shareController ShareControllerImpl) ShareFile(context *gin.Context) {
+	var share models.Share
+	if err := context.ShouldBindJSON(&share); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse share: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse share: " + err.Error())
+		return
+	}
+	share.Owner = getUser(context).Email
+	savedShare, err := shareController.shareService.ShareFile(&share)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find path: "+share.Path)
+		case services.UnknownGranteeError:
+			sendJsonMsg(context, http.StatusNotFound, err.Error())
+		case services.InvalidShareAccessError, services.ShareWithOwnerError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		default:
+			sendJsonMsg(context, pathErrorStatus(err), "Unable to share file: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to share "%v" with "%v": %v`, share.Path, share.Grantee, err))
+		return
+	}
+	context.JSON(http.StatusCreated, savedShare)
+}
+
+// GetShares lists the shares that the user has made
+func (shareController ShareControllerImpl) GetShares(context *gin.Context) {
+	shares, err := shareController.shareService.GetShares(getUser(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve shares: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve shares: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, shares)
+}
+
+func (shareController ShareControllerImpl) RevokeShare(context *gin.Context) {
+	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse share ID: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse share ID: " + err.Error())
+		return
+	}
+	if err := shareController.shareService.RevokeShare(id, getUser(context)); err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find share: "+context.Param("id"))
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to revoke share: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to revoke share %v: %v", id, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedWithMe lists the files and folders that other users have shared with the user. They are reached through
+// /shared/<owner>/<path>.
+func (shareController ShareControllerImpl) GetSharedWithMe(context *gin.Context) {
+	shares, err := shareController.shareService.GetSharedWithMe(getUser(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve shared files: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve shared files: " + err.Error())
+		return
+	}
+	context.JSON(http.StatusOK, shares)
+}
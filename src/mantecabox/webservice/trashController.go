@@ -0,0 +1,121 @@
+package webservice
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/benashford/go-func"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	TrashController interface {
+		GetTrash(context *gin.Context)
+		RestoreFile(context *gin.Context)
+		PurgeFile(context *gin.Context)
+		EmptyTrash(context *gin.Context)
+	}
+
+	TrashControllerImpl struct {
+		configuration *models.Configuration
+		trashService  services.TrashService
+	}
+)
+
+func NewTrashController(configuration *models.Configuration) TrashController {
+	trashService := services.NewTrashService(configuration)
+	if trashService == nil {
+		return nil
+	}
+	return TrashControllerImpl{
+		configuration: configuration,
+		trashService:  trashService,
+	}
+}
+
+func (trashController TrashControllerImpl) GetTrash(context *gin.Context) {
+	files, err := trashController.trashService.GetTrash(trashOwner(context))
+	if err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve trash: "+err.Error())
+		logs.ControllerLog.Error("Unable to retrieve trash: " + err.Error())
+		return
+	}
+	filesDto := funcs.Maps(files, models.TrashedFileToDto).([]models.TrashedFileDTO)
+	context.JSON(http.StatusOK, filesDto)
+}
+
+// RestoreFile takes the trashed file back to its path, with all its versions
+func (trashController TrashControllerImpl) RestoreFile(context *gin.Context) {
+	id, ok := getTrashedFileId(context)
+	if !ok {
+		return
+	}
+	file, err := trashController.trashService.RestoreFile(id, trashOwner(context))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, fmt.Sprintf("Unable to find trashed file: %v", id))
+		case services.PathConflictError:
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to restore file: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to restore trashed file %v: %v", id, err))
+		return
+	}
+	context.JSON(http.StatusOK, models.FileToDto(file))
+}
+
+// PurgeFile removes the trashed file for good
+func (trashController TrashControllerImpl) PurgeFile(context *gin.Context) {
+	id, ok := getTrashedFileId(context)
+	if !ok {
+		return
+	}
+	if err := trashController.trashService.PurgeFile(id, trashOwner(context)); err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, fmt.Sprintf("Unable to find trashed file: %v", id))
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to purge file: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf("Unable to purge trashed file %v: %v", id, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// EmptyTrash removes all the trashed files for good
+func (trashController TrashControllerImpl) EmptyTrash(context *gin.Context) {
+	if _, err := trashController.trashService.EmptyTrash(trashOwner(context)); err != nil {
+		sendJsonMsg(context, http.StatusInternalServerError, "Unable to empty trash: "+err.Error())
+		logs.ControllerLog.Error("Unable to empty trash: " + err.Error())
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// trashOwner returns the owner of the trash that the request addresses: the group in the route, whose managers reach
+// its trash, or else the user
+func trashOwner(context *gin.Context) models.User {
+	if group := context.Param("group"); group != "" {
+		return models.User{Credentials: models.Credentials{Email: group}}
+	}
+	return getUser(context)
+}
+
+// getTrashedFileId reads the trashed file's ID, which is the one of its logical file
+func getTrashedFileId(context *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse trashed file ID: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse trashed file ID: " + err.Error())
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,187 @@
+package webservice
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mantecabox/logs"
+	"mantecabox/models"
+	"mantecabox/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	uploadOffsetHeader = "Upload-Offset"
+	uploadLengthHeader = "Upload-Length"
+)
+
+type (
+	UploadController interface {
+		CreateUpload(context *gin.Context)
+		GetUpload(context *gin.Context)
+		GetUploadOffset(context *gin.Context)
+		UploadPart(context *gin.Context)
+		FinalizeUpload(context *gin.Context)
+		DeleteUpload(context *gin.Context)
+	}
+
+	UploadControllerImpl struct {
+		configuration *models.Configuration
+		uploadService services.UploadService
+	}
+)
+
+func NewUploadController(configuration *models.Configuration) UploadController {
+	uploadService := services.NewUploadService(configuration)
+	if uploadService == nil {
+		return nil
+	}
+	return UploadControllerImpl{
+		configuration: configuration,
+		uploadService: uploadService,
+	}
+}
+
+// CreateUpload starts a resumable upload. Its content is sent afterwards with UploadPart.
+func (uploadController UploadControllerImpl) CreateUpload(context *gin.Context) {
+	var upload models.Upload
+	if err := context.ShouldBindJSON(&upload); err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse upload: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse upload: " + err.Error())
+		return
+	}
+	upload.Owner = getUser(context).Email
+	createdUpload, err := uploadController.uploadService.CreateUpload(&upload)
+	if err != nil {
+		switch err {
+		case services.InvalidUploadError, services.InvalidPathError, services.InvalidChecksumError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		case services.FileTooLargeError, services.QuotaExceededError:
+			sendJsonMsg(context, pathErrorStatus(err), err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to create upload: "+err.Error())
+		}
+		logs.ControllerLog.Error("Unable to create upload: " + err.Error())
+		return
+	}
+	context.Header("Location", "/uploads/"+createdUpload.Id)
+	setUploadHeaders(context, createdUpload)
+	context.JSON(http.StatusCreated, createdUpload)
+}
+
+func (uploadController UploadControllerImpl) GetUpload(context *gin.Context) {
+	upload, ok := uploadController.getUpload(context)
+	if !ok {
+		return
+	}
+	setUploadHeaders(context, upload)
+	context.JSON(http.StatusOK, upload)
+}
+
+// GetUploadOffset tells how much content the upload has received, so the client knows where to resume it from
+func (uploadController UploadControllerImpl) GetUploadOffset(context *gin.Context) {
+	upload, ok := uploadController.getUpload(context)
+	if !ok {
+		return
+	}
+	setUploadHeaders(context, upload)
+	context.Header("Cache-Control", "no-store")
+	context.Status(http.StatusOK)
+}
+
+// UploadPart appends the request's body to the upload. The Upload-Offset header must match the content received.
+func (uploadController UploadControllerImpl) UploadPart(context *gin.Context) {
+	id := context.Param("upload")
+	offset, err := strconv.ParseInt(context.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		sendJsonMsg(context, http.StatusBadRequest, "Unable to parse upload offset: "+err.Error())
+		logs.ControllerLog.Error("Unable to parse upload offset: " + err.Error())
+		return
+	}
+	if context.Request.ContentLength < 0 {
+		sendJsonMsg(context, http.StatusLengthRequired, "The part's length is required")
+		logs.ControllerLog.Error("The part's length is required")
+		return
+	}
+
+	upload, err := uploadController.uploadService.WriteUploadPart(id, getUser(context), offset, context.Request.Body, context.Request.ContentLength)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find upload: "+id)
+		case services.UploadOffsetMismatchError, services.UploadOffsetConflictError:
+			context.Header(uploadOffsetHeader, strconv.FormatInt(upload.Received, 10))
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		case services.UploadTooLargeError:
+			sendJsonMsg(context, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to save upload part: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to save part of upload "%v": %v`, id, err))
+		return
+	}
+	setUploadHeaders(context, upload)
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// FinalizeUpload turns the complete upload into a new version of its file
+func (uploadController UploadControllerImpl) FinalizeUpload(context *gin.Context) {
+	id := context.Param("upload")
+	file, err := uploadController.uploadService.FinalizeUpload(id, getUser(context))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find upload: "+id)
+		case services.UploadIncompleteError, services.PathConflictError:
+			sendJsonMsg(context, http.StatusConflict, err.Error())
+		case services.ChecksumMismatchError:
+			sendJsonMsg(context, http.StatusBadRequest, err.Error())
+		case services.FileTooLargeError, services.QuotaExceededError:
+			sendJsonMsg(context, pathErrorStatus(err), err.Error())
+		default:
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to finalize upload: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to finalize upload "%v": %v`, id, err))
+		return
+	}
+	setChecksumHeader(context, file)
+	context.JSON(http.StatusCreated, models.FileToDto(file))
+}
+
+func (uploadController UploadControllerImpl) DeleteUpload(context *gin.Context) {
+	id := context.Param("upload")
+	err := uploadController.uploadService.DeleteUpload(id, getUser(context))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find upload: "+id)
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to delete upload: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to delete upload "%v": %v`, id, err))
+		return
+	}
+	context.Writer.WriteHeader(http.StatusNoContent)
+}
+
+func (uploadController UploadControllerImpl) getUpload(context *gin.Context) (models.Upload, bool) {
+	id := context.Param("upload")
+	upload, err := uploadController.uploadService.GetUpload(id, getUser(context))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendJsonMsg(context, http.StatusNotFound, "Unable to find upload: "+id)
+		} else {
+			sendJsonMsg(context, http.StatusInternalServerError, "Unable to retrieve upload: "+err.Error())
+		}
+		logs.ControllerLog.Error(fmt.Sprintf(`Unable to retrieve upload "%v": %v`, id, err))
+		return upload, false
+	}
+	return upload, true
+}
+
+func setUploadHeaders(context *gin.Context, upload models.Upload) {
+	context.Header(uploadOffsetHeader, strconv.FormatInt(upload.Received, 10))
+	context.Header(uploadLengthHeader, strconv.FormatInt(upload.Size, 10))
+}
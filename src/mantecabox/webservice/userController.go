@@ -17,13 +17,13 @@ import (
 
 type (
 	UserController interface {
-		GetUsers(c *gin.Context)
 		GetUser(c *gin.Context)
 		RegisterUser(c *gin.Context)
 		ModifyUser(c *gin.Context)
 		DeleteUser(c *gin.Context)
 		Generate2FAAndSendMail(c *gin.Context)
 		AuthMiddleware() *jwt.GinJWTMiddleware
+		SelfMiddleware() gin.HandlerFunc
 	}
 
 	UserControllerImpl struct {
@@ -76,27 +76,29 @@ func NewUserController(configuration *models.Configuration) UserController {
 					twoFactorAuth,
 					userFound.TwoFactorTime.ValueOrZero())
 			},
+			// The tokens carry the user's role and the time they logged in, so that they are revoked when the user is
+			// forced to log out
+			PayloadFunc: func(data interface{}) jwt.MapClaims {
+				user := data.(*models.User)
+				return jwt.MapClaims{
+					"id":       user.Email,
+					"role":     user.Role,
+					"login_at": time.Now().UnixNano() / int64(services.TokenTimePrecision),
+				}
+			},
 			Authorizator: func(user interface{}, c *gin.Context) bool {
-				userparam := c.Param("email")
 				username := user.(string)
-				return userparam == "" || userparam == username
+				loginAt, _ := jwt.ExtractClaims(c)["login_at"].(float64)
+				if _, err := userService.AuthorizeToken(username, time.Unix(0, int64(loginAt)*int64(services.TokenTimePrecision))); err != nil {
+					logs.ControllerLog.Warnf("User %v tried to access %v: %v", username, c.Request.URL.Path, err)
+					return false
+				}
+				return true
 			},
 		},
 	}
 }
 
-func (userController UserControllerImpl) GetUsers(c *gin.Context) {
-	users, err := userController.userService.GetUsers()
-	if err != nil {
-		sendJsonMsg(c, http.StatusInternalServerError, "Unable to retrieve users: "+err.Error())
-		logs.ControllerLog.Error("Unable to retrieve users: "+err.Error())
-		return
-	}
-	var dtos []models.UserDto
-	automapper.Map(users, &dtos)
-	c.JSON(http.StatusOK, dtos)
-}
-
 func (userController UserControllerImpl) GetUser(c *gin.Context) {
 	username := c.Param("email")
 	user, err := userController.userService.GetUser(username)
@@ -215,6 +217,20 @@ func (userController UserControllerImpl) AuthMiddleware() *jwt.GinJWTMiddleware
 	return userController.authMiddleware
 }
 
+// SelfMiddleware rejects the requests about other users than the one of the token. It must run after the
+// authentication one.
+func (userController UserControllerImpl) SelfMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := getUser(c).Email
+		if c.Param("email") != email {
+			sendJsonMsg(c, http.StatusForbidden, "Users can only access their own account")
+			logs.ControllerLog.Warnf("User %v tried to access %v", email, c.Request.URL.Path)
+			return
+		}
+		c.Next()
+	}
+}
+
 func sendJsonMsg(c *gin.Context, status int, msg string) {
 	c.AbortWithStatusJSON(status, models.ServerError{
 		Message: msg,
@@ -91,13 +91,15 @@ func TestGetUsers(t *testing.T) {
 			test: func(t *testing.T) {
 				userDao.Create(&models.User{Credentials: models.Credentials{Email: testUserEmail, Password: "testpassword"}})
 				r := gofight.New()
-				r.GET("/users").
+				r.GET("/admin/users").
 					SetDebug(true).
 					Run(router, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
 						require.Equal(t, http.StatusOK, res.Code)
-						expected, err := json.Marshal([]map[string]string{{"email": testUserEmail}})
-						require.NoError(t, err)
-						require.JSONEq(t, string(expected), res.Body.String())
+						var users []models.UserDetailsDto
+						require.NoError(t, json.Unmarshal(res.Body.Bytes(), &users))
+						require.Len(t, users, 1)
+						require.Equal(t, testUserEmail, users[0].Email)
+						require.Equal(t, models.UserRoleUser, users[0].Role)
 					})
 			},
 		},
@@ -105,7 +107,7 @@ func TestGetUsers(t *testing.T) {
 			name: "When there are no users in the database, return an empty array",
 			test: func(t *testing.T) {
 				r := gofight.New()
-				r.GET("/users").
+				r.GET("/admin/users").
 					SetDebug(true).
 					Run(router, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
 						require.Equal(t, http.StatusOK, res.Code)
@@ -391,7 +393,7 @@ func TestJWTRouter(t *testing.T) {
 			test: func(t *testing.T) {
 				performActionWithToken(t, func(auth authResponse) {
 					r := gofight.New()
-					r.GET("/users").
+					r.GET("/users/"+testUserEmail).
 						SetDebug(true).
 						SetHeader(gofight.H{
 							headers.Authorization: "Bearer " + auth.Token,
@@ -405,7 +407,7 @@ func TestJWTRouter(t *testing.T) {
 			name: "When you try to access a protected route without a token, deny it",
 			test: func(t *testing.T) {
 				r := gofight.New()
-				r.GET("/users").
+				r.GET("/users/"+testUserEmail).
 					SetDebug(true).
 					Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
 						require.Equal(t, http.StatusUnauthorized, res.Code)
@@ -445,7 +447,7 @@ func TestJWTRouter(t *testing.T) {
 				performActionWithToken(t, func(auth authResponse) {
 					auth.Token += "jfklasdjflakjñs"
 					r := gofight.New()
-					r.GET("/users").
+					r.GET("/users/"+testUserEmail).
 						SetDebug(true).
 						SetHeader(gofight.H{
 							headers.Authorization: "Bearer " + auth.Token,
@@ -463,6 +465,70 @@ func TestJWTRouter(t *testing.T) {
 				})
 			},
 		},
+		{
+			name: "When you try to access another user's account, deny it",
+			test: func(t *testing.T) {
+				performActionWithToken(t, func(auth authResponse) {
+					r := gofight.New()
+					r.GET("/users/"+modifiedUserEmail).
+						SetDebug(true).
+						SetHeader(gofight.H{
+							headers.Authorization: "Bearer " + auth.Token,
+						}).Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+						require.Equal(t, http.StatusForbidden, res.Code)
+					})
+				})
+			},
+		},
+		{
+			name: "When a regular user tries to access an admin route, deny it",
+			test: func(t *testing.T) {
+				performActionWithToken(t, func(auth authResponse) {
+					r := gofight.New()
+					r.GET("/admin/users").
+						SetDebug(true).
+						SetHeader(gofight.H{
+							headers.Authorization: "Bearer " + auth.Token,
+						}).Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+						require.Equal(t, http.StatusForbidden, res.Code)
+					})
+				})
+			},
+		},
+		{
+			name: "When the user has been forced to log out, deny their previous tokens",
+			test: func(t *testing.T) {
+				performActionWithToken(t, func(auth authResponse) {
+					_, err := testUserService.ForceLogout(testUserEmail)
+					require.NoError(t, err)
+					r := gofight.New()
+					r.GET("/users/"+testUserEmail).
+						SetDebug(true).
+						SetHeader(gofight.H{
+							headers.Authorization: "Bearer " + auth.Token,
+						}).Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+						require.Equal(t, http.StatusForbidden, res.Code)
+					})
+				})
+			},
+		},
+		{
+			name: "When the user has been disabled, deny their tokens",
+			test: func(t *testing.T) {
+				performActionWithToken(t, func(auth authResponse) {
+					_, err := testUserService.SetDisabled(testUserEmail, true)
+					require.NoError(t, err)
+					r := gofight.New()
+					r.GET("/users/"+testUserEmail).
+						SetDebug(true).
+						SetHeader(gofight.H{
+							headers.Authorization: "Bearer " + auth.Token,
+						}).Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+						require.Equal(t, http.StatusForbidden, res.Code)
+					})
+				})
+			},
+		},
 		{
 			name: "When you refresh a token, its expiring date is after the original one, but both still valid",
 			test: func(t *testing.T) {
@@ -586,6 +652,34 @@ func performActionWithTokenAndCustomRouter(t *testing.T, customRouter *gin.Engin
 		})
 }
 
+// loginAs registers a user with the role and returns a token of theirs
+func loginAs(t *testing.T, email string, role string) string {
+	user, err := testUserService.RegisterUser(&models.Credentials{Email: email, Password: correctPassword})
+	require.NoError(t, err)
+	if role != models.UserRoleUser {
+		_, err = testUserService.SetRole(email, role)
+		require.NoError(t, err)
+	}
+	user, err = testUserService.Generate2FACodeAndSaveToUser(&user)
+	require.NoError(t, err)
+	var auth authResponse
+	r := gofight.New()
+	r.POST("/login").
+		SetDebug(true).
+		SetQuery(gofight.H{
+			"verification_code": user.TwoFactorAuth.ValueOrZero(),
+		}).
+		SetJSON(gofight.D{
+			"username": email,
+			"password": correctPassword,
+		}).
+		Run(secureRouter, func(res gofight.HTTPResponse, req gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, res.Code)
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &auth))
+		})
+	return auth.Token
+}
+
 func getDb(t *testing.T) *sql.DB {
 	db, err := utilities.GetPgDb()
 	require.NoError(t, err)